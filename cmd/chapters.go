@@ -0,0 +1,66 @@
+/*
+Copyright © 2024 Krzysztof Heinke <Krzysztof.Heinke@gmail.com>
+*/
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"github.com/KrzysztofHeinke/quicktime-movie-parser/internal/parser"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+// chaptersCmd represents the chapters command
+var chaptersCmd = &cobra.Command{
+	Use:   "chapters <file>",
+	Short: "Print the chapter markers of a MOV/MP4 file as JSON or FFMETADATA.",
+	Long: `Print the chapter markers of a MOV/MP4 file. Chapters are read from a QuickTime chapter
+track, i.e. a text track referenced through 'tref'/'chap', or from the Nero 'chpl' atom.
+Each chapter is printed with its start and end time and its title.`,
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		if !checkInputFile(args[0]) {
+			return
+		}
+		format, _ := cmd.Flags().GetString("format")
+
+		tree, err := parser.ReadTree(args[0])
+		if err != nil {
+			logrus.Fatal(err)
+		}
+		file, err := os.Open(args[0])
+		if err != nil {
+			logrus.Fatalf("Failed to open file: %v", err)
+		}
+		defer file.Close()
+
+		chapters, err := parser.CollectChapters(tree, file)
+		if err != nil {
+			logrus.Fatalf("Failed to read chapters: %v", err)
+		}
+
+		switch format {
+		case "json":
+			if chapters == nil {
+				chapters = []parser.Chapter{}
+			}
+			output, err := json.MarshalIndent(chapters, "", "  ")
+			if err != nil {
+				logrus.Fatalf("Failed to encode chapters: %v", err)
+			}
+			fmt.Println(string(output))
+		case "ffmetadata":
+			fmt.Print(parser.FormatFFMetadata(chapters))
+		default:
+			logrus.Fatalf("Unknown format %q, expected json or ffmetadata", format)
+		}
+	},
+}
+
+func init() {
+	chaptersCmd.Flags().StringP("format", "f", "json", "Output format (json, ffmetadata)")
+	rootCmd.AddCommand(chaptersCmd)
+}
@@ -0,0 +1,54 @@
+/*
+Copyright © 2024 Krzysztof Heinke <Krzysztof.Heinke@gmail.com>
+*/
+package cmd
+
+import (
+	"github.com/KrzysztofHeinke/quicktime-movie-parser/internal/decrypt"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+// decryptCmd represents the decrypt command
+var decryptCmd = &cobra.Command{
+	Use:   "decrypt <input> <output>",
+	Short: "Decrypt a Common Encryption protected MOV/MP4 file with known keys.",
+	Long: `Decrypt a 'cenc' (AES-CTR) or 'cbcs' (AES-CBC pattern) protected MOV/MP4 file using the
+content keys given as KID:KEY pairs of hexadecimal digits, either with --key or in a key file
+holding one pair per line. Protected sample entries get their original format back, the protection
+atoms are removed and the offsets are shifted along. The output is only written once every sample
+is decrypted.`,
+	Args: cobra.ExactArgs(2),
+	Run: func(cmd *cobra.Command, args []string) {
+		if !checkInputFile(args[0]) {
+			return
+		}
+		keySpecs, _ := cmd.Flags().GetStringArray("key")
+		keyFile, _ := cmd.Flags().GetString("key-file")
+
+		keys := decrypt.Keys{}
+		for _, spec := range keySpecs {
+			if err := keys.Add(spec); err != nil {
+				logrus.Fatal(err)
+			}
+		}
+		if keyFile != "" {
+			if err := decrypt.ReadKeyFile(keyFile, keys); err != nil {
+				logrus.Fatal(err)
+			}
+		}
+		if len(keys) == 0 {
+			logrus.Fatal("No keys given, use --key or --key-file")
+		}
+
+		if err := decrypt.DecryptFile(args[0], args[1], keys); err != nil {
+			logrus.Fatalf("Failed to decrypt file: %v", err)
+		}
+	},
+}
+
+func init() {
+	decryptCmd.Flags().StringArrayP("key", "k", nil, "Content key as KID:KEY in hexadecimal, may be repeated")
+	decryptCmd.Flags().String("key-file", "", "File with one KID:KEY pair per line")
+	rootCmd.AddCommand(decryptCmd)
+}
@@ -0,0 +1,36 @@
+/*
+Copyright © 2024 Krzysztof Heinke <Krzysztof.Heinke@gmail.com>
+*/
+package cmd
+
+import (
+	"github.com/KrzysztofHeinke/quicktime-movie-parser/internal/defragment"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+// defragmentCmd represents the defragment command
+var defragmentCmd = &cobra.Command{
+	Use:   "defragment <input> <output>",
+	Short: "Convert a fragmented MP4 file to a progressive MOV/MP4 file.",
+	Long: `Convert a file made of 'moof'/'traf'/'trun' movie fragments into a progressive MOV/MP4 file,
+e.g. for editing software which does not read fragmented recordings. The samples of all fragments are
+merged into complete 'stbl' sample tables, the 'mvex' atom is removed and the sample data is copied into
+one 'mdat' atom. Use --faststart to write the 'moov' atom in front of the media data.`,
+	Args: cobra.ExactArgs(2),
+	Run: func(cmd *cobra.Command, args []string) {
+		if !checkInputFile(args[0]) {
+			return
+		}
+		fastStart, _ := cmd.Flags().GetBool("faststart")
+		if err := defragment.Defragment(args[0], args[1], fastStart); err != nil {
+			logrus.Fatalf("Failed to defragment %s: %v", args[0], err)
+		}
+		logrus.Infof("Wrote %s", args[1])
+	},
+}
+
+func init() {
+	defragmentCmd.Flags().Bool("faststart", false, "Write the moov atom in front of the media data")
+	rootCmd.AddCommand(defragmentCmd)
+}
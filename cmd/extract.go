@@ -0,0 +1,88 @@
+/*
+Copyright © 2024 Krzysztof Heinke <Krzysztof.Heinke@gmail.com>
+*/
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/KrzysztofHeinke/quicktime-movie-parser/internal/extract"
+	"github.com/KrzysztofHeinke/quicktime-movie-parser/internal/parser"
+	"github.com/KrzysztofHeinke/quicktime-movie-parser/internal/track"
+	"github.com/KrzysztofHeinke/quicktime-movie-parser/internal/writer"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+// extractCmd represents the extract command
+var extractCmd = &cobra.Command{
+	Use:   "extract <file>",
+	Short: "Extract the elementary stream of a track from a MOV/MP4 file.",
+	Long: `Extract the samples of a track from a MOV/MP4 file into an elementary stream.
+H.264 and HEVC are written as Annex-B byte streams with the parameter sets from 'avcC'/'hvcC'
+repeated at every keyframe, AAC is written with ADTS headers built from the 'esds' AudioSpecificConfig,
+PCM audio is written as a WAV file and any other codec as the concatenated raw samples.`,
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		if !checkInputFile(args[0]) {
+			return
+		}
+		trackID, _ := cmd.Flags().GetUint32("track")
+		output, _ := cmd.Flags().GetString("output")
+
+		tree, err := parser.ReadTree(args[0])
+		if err != nil {
+			logrus.Fatal(err)
+		}
+		file, err := os.Open(args[0])
+		if err != nil {
+			logrus.Fatalf("Failed to open file: %v", err)
+		}
+		defer file.Close()
+		info, err := file.Stat()
+		if err != nil {
+			logrus.Fatalf("Failed to read file size: %v", err)
+		}
+		tracks, err := parser.ReadTracks(tree, file, info.Size())
+		if err != nil {
+			logrus.Fatalf("Failed to read tracks: %v", err)
+		}
+
+		var selected *track.Track
+		for _, t := range tracks {
+			if t.ID == trackID {
+				selected = t
+			}
+		}
+		if selected == nil {
+			logrus.Fatalf("Track %d not found", trackID)
+		}
+
+		format, err := extract.GetFormat(selected)
+		if err != nil {
+			logrus.Fatal(err)
+		}
+		if output == "" {
+			base := strings.TrimSuffix(filepath.Base(args[0]), filepath.Ext(args[0]))
+			output = fmt.Sprintf("%s.track%d.%s", base, trackID, extract.Extension(format))
+		}
+		err = writer.ReplaceFile(output, writer.OutputPerm, func(outputFile *os.File) error {
+			_, err := extract.Extract(selected, file, outputFile)
+			return err
+		})
+		if err != nil {
+			logrus.Fatalf("Failed to extract track %d: %v", trackID, err)
+		}
+		logrus.Infof("Track %d: %d samples written to %s as %s", trackID, len(selected.Samples), output, format)
+	},
+}
+
+func init() {
+	extractCmd.Flags().Uint32P("track", "t", 0, "ID of the track to extract")
+	extractCmd.Flags().StringP("output", "o", "", "Output file (default: <input>.track<ID>.<extension>)")
+	extractCmd.MarkFlagRequired("track")
+	rootCmd.AddCommand(extractCmd)
+}
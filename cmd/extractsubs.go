@@ -0,0 +1,65 @@
+/*
+Copyright © 2024 Krzysztof Heinke <Krzysztof.Heinke@gmail.com>
+*/
+package cmd
+
+import (
+	"os"
+
+	"github.com/KrzysztofHeinke/quicktime-movie-parser/internal/parser"
+	"github.com/KrzysztofHeinke/quicktime-movie-parser/internal/subtitles"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+// extractSubsCmd represents the extract-subs command
+var extractSubsCmd = &cobra.Command{
+	Use:   "extract-subs <file>",
+	Short: "Extract subtitles from the text and subtitle tracks of a MOV/MP4 file.",
+	Long: `Extract subtitles from the text and subtitle tracks of a MOV/MP4 file.
+QuickTime text and 3GPP timed text ('tx3g') tracks are converted to SRT or WebVTT,
+WebVTT ('wvtt') cues are passed through and TTML ('stpp') documents are written as they are.
+The presence of CEA-608/708 closed caption tracks is reported.`,
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		if !checkInputFile(args[0]) {
+			return
+		}
+		trackID, _ := cmd.Flags().GetUint32("track")
+		format, _ := cmd.Flags().GetString("format")
+		output, _ := cmd.Flags().GetString("output")
+
+		tree, err := parser.ReadTree(args[0])
+		if err != nil {
+			logrus.Fatal(err)
+		}
+		file, err := os.Open(args[0])
+		if err != nil {
+			logrus.Fatalf("Failed to open file: %v", err)
+		}
+		defer file.Close()
+		info, err := file.Stat()
+		if err != nil {
+			logrus.Fatalf("Failed to read file size: %v", err)
+		}
+		tracks, err := parser.ReadTracks(tree, file, info.Size())
+		if err != nil {
+			logrus.Fatalf("Failed to read tracks: %v", err)
+		}
+
+		selected := subtitles.SelectTrack(tracks, trackID)
+		if selected == nil {
+			logrus.Fatal("No subtitle track to extract")
+		}
+		if err := subtitles.Extract(selected, file, format, output, os.Stdout); err != nil {
+			logrus.Fatalf("Failed to extract subtitles: %v", err)
+		}
+	},
+}
+
+func init() {
+	extractSubsCmd.Flags().Uint32P("track", "t", 0, "ID of the track to extract (default: first subtitle track)")
+	extractSubsCmd.Flags().StringP("format", "f", "", "Output format for text cues (srt, vtt)")
+	extractSubsCmd.Flags().StringP("output", "o", "", "Output file (default: stdout)")
+	rootCmd.AddCommand(extractSubsCmd)
+}
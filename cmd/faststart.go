@@ -0,0 +1,40 @@
+/*
+Copyright © 2024 Krzysztof Heinke <Krzysztof.Heinke@gmail.com>
+*/
+package cmd
+
+import (
+	"github.com/KrzysztofHeinke/quicktime-movie-parser/internal/faststart"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+// faststartCmd represents the faststart command
+var faststartCmd = &cobra.Command{
+	Use:   "faststart <input> <output>",
+	Short: "Move the moov atom of a MOV/MP4 file in front of the media data.",
+	Long: `Rewrite a MOV/MP4 file with the 'moov' atom moved in front of the first 'mdat' atom, so that
+playback over the web can start before the whole file is downloaded. Every 'stco'/'co64' chunk offset
+is shifted by the new position of the media data, and 'stco' tables are upgraded to 'co64' when the
+offsets no longer fit 32 bits. The media data is streamed, so large files need little memory.
+A file which already is fast-start is copied unchanged.`,
+	Args: cobra.ExactArgs(2),
+	Run: func(cmd *cobra.Command, args []string) {
+		if !checkInputFile(args[0]) {
+			return
+		}
+		alreadyFastStart, err := faststart.FastStart(args[0], args[1])
+		if err != nil {
+			logrus.Fatalf("Failed to move moov atom: %v", err)
+		}
+		if alreadyFastStart {
+			logrus.Infof("%s already is fast-start, copied unchanged to %s", args[0], args[1])
+		} else {
+			logrus.Infof("Moved moov atom in front of the media data in %s", args[1])
+		}
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(faststartCmd)
+}
@@ -0,0 +1,42 @@
+/*
+Copyright © 2024 Krzysztof Heinke <Krzysztof.Heinke@gmail.com>
+*/
+package cmd
+
+import (
+	"github.com/KrzysztofHeinke/quicktime-movie-parser/internal/fragment"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+// fragmentCmd represents the fragment command
+var fragmentCmd = &cobra.Command{
+	Use:   "fragment <input> <output>",
+	Short: "Convert a progressive MOV/MP4 file to fragmented MP4 (CMAF).",
+	Long: `Convert a progressive MOV/MP4 file to fragmented MP4. The output holds an 'ftyp' and a 'moov'
+atom with 'mvex'/'trex' defaults, followed by 'moof' and 'mdat' pairs cut at the keyframes of the first
+video track once the target --duration is reached. --sidx adds a segment index. With --segments the
+output is a directory receiving an init.mp4 initialization segment and one segment-N.m4s media segment
+per fragment, ready for HLS or DASH.`,
+	Args: cobra.ExactArgs(2),
+	Run: func(cmd *cobra.Command, args []string) {
+		if !checkInputFile(args[0]) {
+			return
+		}
+		var options fragment.Options
+		options.Duration, _ = cmd.Flags().GetFloat64("duration")
+		options.SegmentIndex, _ = cmd.Flags().GetBool("sidx")
+		options.Segments, _ = cmd.Flags().GetBool("segments")
+		if err := fragment.Fragment(args[0], args[1], options); err != nil {
+			logrus.Fatalf("Failed to fragment %s: %v", args[0], err)
+		}
+		logrus.Infof("Wrote %s", args[1])
+	},
+}
+
+func init() {
+	fragmentCmd.Flags().Float64P("duration", "d", fragment.DefaultDuration, "Target duration of a fragment in seconds")
+	fragmentCmd.Flags().Bool("sidx", false, "Add a 'sidx' segment index")
+	fragmentCmd.Flags().Bool("segments", false, "Write init and media segment files to the output directory")
+	rootCmd.AddCommand(fragmentCmd)
+}
@@ -23,18 +23,31 @@ var quicktimeparserCmd = &cobra.Command{
 	   	atoms, and extracts key details such as audio sample rates, video width, and height. 
 	   It is essential for tasks such as media file analysis, editing, and metadata extraction.`,
 	Run: func(cmd *cobra.Command, args []string) {
-		info, err := os.Stat(args[0])
-		if os.IsNotExist(err) {
-			fmt.Printf("File %s do not exist!", args[0])
-			return
-		} else if info.IsDir() {
-			fmt.Printf("%s that is a directory, not a file!", args[0])
+		if !checkInputFile(args[0]) {
 			return
 		}
-		parser.Parse(args[0])
+		lenient, _ := cmd.Flags().GetBool("lenient")
+		parser.Parse(args[0], lenient)
 	},
 }
 
+// checkInputFile reports whether the path points to an existing file, printing the reason if not
+func checkInputFile(path string) bool {
+	info, err := os.Stat(path)
+	if os.IsNotExist(err) {
+		fmt.Printf("File %s do not exist!", path)
+		return false
+	} else if err != nil {
+		fmt.Printf("Cannot access %s: %v", path, err)
+		return false
+	} else if info.IsDir() {
+		fmt.Printf("%s that is a directory, not a file!", path)
+		return false
+	}
+	return true
+}
+
 func init() {
+	quicktimeparserCmd.Flags().Bool("lenient", false, "Keep parsing damaged files, reporting the track info found and a list of problems")
 	rootCmd.AddCommand(quicktimeparserCmd)
 }
@@ -0,0 +1,38 @@
+/*
+Copyright © 2024 Krzysztof Heinke <Krzysztof.Heinke@gmail.com>
+*/
+package cmd
+
+import (
+	"github.com/KrzysztofHeinke/quicktime-movie-parser/internal/recovery"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+// recoverCmd represents the recover command
+var recoverCmd = &cobra.Command{
+	Use:   "recover <broken> <reference> <output>",
+	Short: "Rebuild the moov atom of a recording which was interrupted before it was finalized.",
+	Long: `Recover a recording left without a 'moov' atom, e.g. after a camera crash or a dead battery.
+The tracks are taken from a healthy reference file recorded by the same camera with the same settings.
+The orphan 'mdat' atom is scanned for the length-prefixed H.264/HEVC NAL units of the video track and
+for constant-size audio frames such as PCM, and a playable file with new sample tables is written.
+Variable-size audio like AAC cannot be split without decoding, recovering such a recording fails
+unless --drop-audio writes the video alone.`,
+	Args: cobra.ExactArgs(3),
+	Run: func(cmd *cobra.Command, args []string) {
+		if !checkInputFile(args[0]) || !checkInputFile(args[1]) {
+			return
+		}
+		dropAudio, _ := cmd.Flags().GetBool("drop-audio")
+		if err := recovery.Recover(args[0], args[1], args[2], dropAudio); err != nil {
+			logrus.Fatalf("Failed to recover %s: %v", args[0], err)
+		}
+		logrus.Infof("Wrote %s", args[2])
+	},
+}
+
+func init() {
+	recoverCmd.Flags().Bool("drop-audio", false, "Write the recovered video alone when the audio track cannot be recovered")
+	rootCmd.AddCommand(recoverCmd)
+}
@@ -0,0 +1,43 @@
+/*
+Copyright © 2024 Krzysztof Heinke <Krzysztof.Heinke@gmail.com>
+*/
+package cmd
+
+import (
+	"github.com/KrzysztofHeinke/quicktime-movie-parser/internal/remux"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+// remuxCmd represents the remux command
+var remuxCmd = &cobra.Command{
+	Use:   "remux <input> <output>",
+	Short: "Write a MOV/MP4 file with only the selected tracks.",
+	Long: `Write a new MOV/MP4 file holding only the tracks selected with --keep-tracks and --drop-type,
+e.g. to strip commentary audio, telemetry or duplicate timecode tracks. The kept tracks are renumbered
+from 1, 'tref' references and the next track ID of 'mvhd' are updated, and the sample data is laid out
+again, interleaved in chunks of at most half a second. --drop-type takes handler types such as 'soun',
+'text' or 'meta', or one of video, audio, subtitle, timecode and metadata.`,
+	Args: cobra.ExactArgs(2),
+	Run: func(cmd *cobra.Command, args []string) {
+		if !checkInputFile(args[0]) {
+			return
+		}
+		var options remux.Options
+		keepTracks, _ := cmd.Flags().GetUintSlice("keep-tracks")
+		for _, trackID := range keepTracks {
+			options.KeepTracks = append(options.KeepTracks, uint32(trackID))
+		}
+		options.DropTypes, _ = cmd.Flags().GetStringSlice("drop-type")
+		if err := remux.Remux(args[0], args[1], options); err != nil {
+			logrus.Fatalf("Failed to remux %s: %v", args[0], err)
+		}
+		logrus.Infof("Wrote %s", args[1])
+	},
+}
+
+func init() {
+	remuxCmd.Flags().UintSlice("keep-tracks", nil, "IDs of the tracks to keep, e.g. 1,3, all tracks when not set")
+	remuxCmd.Flags().StringSlice("drop-type", nil, "Handler types or track types of the tracks to drop, e.g. text,tmcd")
+	rootCmd.AddCommand(remuxCmd)
+}
@@ -6,6 +6,7 @@ package cmd
 import (
 	"os"
 
+	"github.com/KrzysztofHeinke/quicktime-movie-parser/pkg/models/atoms"
 	"github.com/sirupsen/logrus"
 	"github.com/spf13/cobra"
 )
@@ -35,7 +36,11 @@ func init() {
 	})
 
 	rootCmd.PersistentFlags().StringP("loglevel", "l", "info", "Set the logging level (debug, info, warn, error)")
-	cobra.OnInitialize(initLogger)
+	rootCmd.PersistentFlags().Int64("max-atom-size", atoms.DefaultLimits.MaxAtomSize, "Largest atom or sample read into memory, in bytes")
+	rootCmd.PersistentFlags().Uint32("max-entry-count", atoms.DefaultLimits.MaxEntryCount, "Largest entry count of a table atom")
+	rootCmd.PersistentFlags().Int("max-depth", atoms.DefaultLimits.MaxDepth, "Deepest nesting of atoms")
+	rootCmd.PersistentFlags().Int64("max-allocation", atoms.DefaultLimits.MaxTotalAllocation, "Largest number of bytes read into memory for the atoms of one tree")
+	cobra.OnInitialize(initLogger, initLimits)
 }
 
 func initLogger() {
@@ -52,3 +57,23 @@ func initLogger() {
 
 	logrus.Infof("Log level set to %s", logLevel)
 }
+
+// initLimits applies the limits protecting the parser against crafted or corrupt files
+func initLimits() {
+	var limits atoms.Limits
+	var err error
+	flags := rootCmd.PersistentFlags()
+	if limits.MaxAtomSize, err = flags.GetInt64("max-atom-size"); err != nil {
+		logrus.Fatalf("Could not read max-atom-size flag: %v", err)
+	}
+	if limits.MaxEntryCount, err = flags.GetUint32("max-entry-count"); err != nil {
+		logrus.Fatalf("Could not read max-entry-count flag: %v", err)
+	}
+	if limits.MaxDepth, err = flags.GetInt("max-depth"); err != nil {
+		logrus.Fatalf("Could not read max-depth flag: %v", err)
+	}
+	if limits.MaxTotalAllocation, err = flags.GetInt64("max-allocation"); err != nil {
+		logrus.Fatalf("Could not read max-allocation flag: %v", err)
+	}
+	atoms.SetLimits(limits)
+}
@@ -0,0 +1,108 @@
+/*
+Copyright © 2024 Krzysztof Heinke <Krzysztof.Heinke@gmail.com>
+*/
+package cmd
+
+import (
+	"github.com/KrzysztofHeinke/quicktime-movie-parser/internal/tags"
+	"github.com/KrzysztofHeinke/quicktime-movie-parser/pkg/models/atoms"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+// tagNamesHelp describes the tag names accepted by set-tag and remove-tag
+const tagNamesHelp = `Tags are named title, comment, artist, album, genre, date, encoder, description, copyright
+or cover (whose value is the path of a JPEG, PNG or BMP image). Four character names such as '©wrt'
+address iTunes style items and names containing a dot such as 'com.example.project' are custom keys.`
+
+// setTagCmd represents the set-tag command
+var setTagCmd = &cobra.Command{
+	Use:   "set-tag <file> <name>=<value>...",
+	Short: "Set metadata tags of a MOV/MP4 file.",
+	Long: `Set metadata tags of a MOV/MP4 file in its 'udta'/'ilst' or 'mdta' metadata.
+The file is edited in place when the new 'moov' atom fits the adjacent 'free', 'skip' or 'wide'
+padding, otherwise it is rewritten with corrected chunk offsets. Use --output to write a copy.
+` + tagNamesHelp,
+	Args: cobra.MinimumNArgs(2),
+	Run: func(cmd *cobra.Command, args []string) {
+		if !checkInputFile(args[0]) {
+			return
+		}
+		moov, err := tags.ReadMovie(args[0])
+		if err != nil {
+			logrus.Fatal(err)
+		}
+		for _, spec := range args[1:] {
+			tag, err := tags.ParseTag(spec)
+			if err != nil {
+				logrus.Fatal(err)
+			}
+			if err := tags.SetTag(moov, tag); err != nil {
+				logrus.Fatalf("Failed to set tag %s: %v", tag.Name, err)
+			}
+		}
+		saveTags(cmd, args[0], moov)
+	},
+}
+
+// removeTagCmd represents the remove-tag command
+var removeTagCmd = &cobra.Command{
+	Use:   "remove-tag <file> <name>...",
+	Short: "Remove metadata tags from a MOV/MP4 file.",
+	Long: `Remove metadata tags from the 'udta'/'ilst' and 'mdta' metadata of a MOV/MP4 file.
+The file is edited in place, the freed space is kept as a 'free' atom. Use --output to write a copy.
+` + tagNamesHelp,
+	Args: cobra.MinimumNArgs(2),
+	Run: func(cmd *cobra.Command, args []string) {
+		if !checkInputFile(args[0]) {
+			return
+		}
+		moov, err := tags.ReadMovie(args[0])
+		if err != nil {
+			logrus.Fatal(err)
+		}
+		removed := false
+		for _, name := range args[1:] {
+			found, err := tags.RemoveTag(moov, name)
+			if err != nil {
+				logrus.Fatal(err)
+			}
+			if !found {
+				logrus.Warnf("Tag %s not found", name)
+			}
+			removed = removed || found
+		}
+		if !removed {
+			return
+		}
+		saveTags(cmd, args[0], moov)
+	},
+}
+
+// saveTags writes the edited 'moov' atom back to the file or to the file given with --output
+func saveTags(cmd *cobra.Command, path string, moov *atoms.CompositeAtom) {
+	output, _ := cmd.Flags().GetString("output")
+	if output != "" {
+		if err := tags.SaveAs(path, output, moov); err != nil {
+			logrus.Fatalf("Failed to write %s: %v", output, err)
+		}
+		logrus.Infof("Wrote %s", output)
+		return
+	}
+	inPlace, err := tags.Save(path, moov)
+	if err != nil {
+		logrus.Fatalf("Failed to save %s: %v", path, err)
+	}
+	if inPlace {
+		logrus.Infof("Edited %s in place", path)
+	} else {
+		logrus.Infof("Rewrote %s", path)
+	}
+}
+
+func init() {
+	setTagCmd.Flags().StringP("output", "o", "", "Write the result to this file instead of editing the input")
+	removeTagCmd.Flags().StringP("output", "o", "", "Write the result to this file instead of editing the input")
+	rootCmd.AddCommand(setTagCmd)
+	rootCmd.AddCommand(removeTagCmd)
+}
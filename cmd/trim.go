@@ -0,0 +1,39 @@
+/*
+Copyright © 2024 Krzysztof Heinke <Krzysztof.Heinke@gmail.com>
+*/
+package cmd
+
+import (
+	"github.com/KrzysztofHeinke/quicktime-movie-parser/internal/trim"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+// trimCmd represents the trim command
+var trimCmd = &cobra.Command{
+	Use:   "trim <input> <output>",
+	Short: "Cut a range out of a MOV/MP4 file without re-encoding.",
+	Long: `Write the samples of a MOV/MP4 file between --start and --end seconds to a new file without
+re-encoding. Every track starts at the last sync sample presented no later than the start, so video
+can still be decoded, and an edit list hides the samples before the start for frame accurate
+presentation. Audio, timecode and subtitle tracks are cut the same way. The 'stts', 'ctts', 'stss',
+'stsz', 'stsc' and 'stco'/'co64' tables are rebuilt and the output is fast-start.`,
+	Args: cobra.ExactArgs(2),
+	Run: func(cmd *cobra.Command, args []string) {
+		if !checkInputFile(args[0]) {
+			return
+		}
+		start, _ := cmd.Flags().GetFloat64("start")
+		end, _ := cmd.Flags().GetFloat64("end")
+		if err := trim.Trim(args[0], args[1], start, end); err != nil {
+			logrus.Fatalf("Failed to trim %s: %v", args[0], err)
+		}
+		logrus.Infof("Wrote %s", args[1])
+	},
+}
+
+func init() {
+	trimCmd.Flags().Float64("start", 0, "Start of the range in seconds")
+	trimCmd.Flags().Float64("end", 0, "End of the range in seconds (default: end of the movie)")
+	rootCmd.AddCommand(trimCmd)
+}
@@ -0,0 +1,53 @@
+/*
+Copyright © 2024 Krzysztof Heinke <Krzysztof.Heinke@gmail.com>
+*/
+package cmd
+
+import (
+	"strings"
+
+	"github.com/KrzysztofHeinke/quicktime-movie-parser/internal/validate"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+// validateCmd represents the validate command
+var validateCmd = &cobra.Command{
+	Use:   "validate <input>",
+	Short: "Check the structure of a MOV/MP4 file against ISO BMFF and QuickTime conformance rules.",
+	Long: `Check the atoms of a MOV/MP4 file and report every violation with its atom path, byte offset and
+severity. The rules are: ` + strings.Join(validate.RuleNames(), ", ") + `.
+They cover child sizes summing to their parent, the required 'mvhd', 'tkhd', 'mdhd', 'hdlr' and 'stbl'
+atoms, entry counts matching the table lengths, chunk offsets pointing inside 'mdat', samples ending
+inside the file, unique track IDs and consistent 'mvhd', 'tkhd' and 'mdhd' durations.
+The command exits with a non-zero status when an error is found, or with --strict any warning, for CI use.`,
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		if !checkInputFile(args[0]) {
+			logrus.Fatalf("Cannot validate %s", args[0])
+		}
+		strict, _ := cmd.Flags().GetBool("strict")
+		violations, err := validate.Validate(args[0])
+		if err != nil {
+			logrus.Fatalf("Failed to validate %s: %v", args[0], err)
+		}
+		errors := 0
+		for _, v := range violations {
+			if v.Severity == validate.Error {
+				errors++
+				logrus.Error(v)
+			} else {
+				logrus.Warn(v)
+			}
+		}
+		if errors > 0 || strict && len(violations) > 0 {
+			logrus.Fatalf("%s is invalid: %d errors, %d warnings", args[0], errors, len(violations)-errors)
+		}
+		logrus.Infof("%s is valid: %d warnings", args[0], len(violations))
+	},
+}
+
+func init() {
+	validateCmd.Flags().Bool("strict", false, "Exit with a non-zero status on warnings too")
+	rootCmd.AddCommand(validateCmd)
+}
@@ -0,0 +1,25 @@
+// Package atomtest builds raw atoms for the tests of the other packages.
+package atomtest
+
+import (
+	"bytes"
+	"encoding/binary"
+)
+
+// Build builds an atom of the given type around the payload
+func Build(atomType string, payload ...[]byte) []byte {
+	data := bytes.Join(payload, nil)
+	header := make([]byte, 8, 8+len(data))
+	binary.BigEndian.PutUint32(header, uint32(len(data)+8))
+	copy(header[4:], atomType)
+	return append(header, data...)
+}
+
+// Uint32s encodes the values as big-endian 32-bit integers
+func Uint32s(values ...uint32) []byte {
+	result := make([]byte, 4*len(values))
+	for i, v := range values {
+		binary.BigEndian.PutUint32(result[i*4:], v)
+	}
+	return result
+}
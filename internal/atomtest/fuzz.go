@@ -0,0 +1,39 @@
+package atomtest
+
+import (
+	"runtime"
+	"testing"
+
+	"github.com/KrzysztofHeinke/quicktime-movie-parser/pkg/models/atoms"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+)
+
+// FuzzLimits are the limits in effect while fuzzing. The sizes are lowered so that anything they do not
+// bound stands out, the entry count keeps its default so that large counts reach the allocation limits.
+var FuzzLimits = atoms.Limits{MaxAtomSize: 1 << 20, MaxDepth: 16, MaxTotalAllocation: 16 << 20}
+
+// allocationFactor is how many times MaxTotalAllocation one input may allocate. The atoms of a tree and
+// the sample index built from them have a budget each, and decoding copies what was read.
+const allocationFactor = 4
+
+// SetFuzzLimits puts FuzzLimits in effect and silences the logs until the fuzz target ends
+func SetFuzzLimits(f *testing.F) {
+	level := logrus.GetLevel()
+	logrus.SetLevel(logrus.PanicLevel)
+	atoms.SetLimits(FuzzLimits)
+	f.Cleanup(func() {
+		logrus.SetLevel(level)
+		atoms.SetLimits(atoms.DefaultLimits)
+	})
+}
+
+// CheckAllocation runs fn and fails the test if it allocated more than the limits in effect allow
+func CheckAllocation(t *testing.T, fn func()) {
+	var before, after runtime.MemStats
+	runtime.ReadMemStats(&before)
+	fn()
+	runtime.ReadMemStats(&after)
+	limit := allocationFactor * uint64(atoms.CurrentLimits().MaxTotalAllocation)
+	assert.LessOrEqual(t, after.TotalAlloc-before.TotalAlloc, limit, "Expected the allocations to be bounded by the limits")
+}
@@ -0,0 +1,86 @@
+package atomtest
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+)
+
+// Track describes a 'trak' atom built by Trak, with a movie and media timescale of 1000
+type Track struct {
+	ID          uint32
+	HandlerType string
+	Duration    uint32
+	// Entry is the only sample entry of the 'stsd' atom
+	Entry []byte
+	// Tables are the atoms of the 'stbl' atom following the 'stsd' atom
+	Tables [][]byte
+	// Extra are the atoms between the 'tkhd' and 'mdia' atoms, like 'edts' or 'tref'
+	Extra [][]byte
+}
+
+// Trak builds the 'trak' atom of the track
+func Trak(t Track) []byte {
+	matrix := Uint32s(0x10000, 0, 0, 0, 0x10000, 0, 0, 0, 0x40000000)
+	stbl := Build("stbl", append([][]byte{Build("stsd", Uint32s(0, 1), t.Entry)}, t.Tables...)...)
+	children := [][]byte{Build("tkhd", []byte{0, 0, 0, 3}, Uint32s(0, 0, t.ID, 0, t.Duration), make([]byte, 8), []byte{0, 0, 0, 0, 1, 0, 0, 0}, matrix, Uint32s(0, 0))}
+	children = append(children, t.Extra...)
+	children = append(children, Build("mdia",
+		Build("mdhd", []byte{0, 0, 0, 0}, Uint32s(0, 0, 1000, t.Duration), []byte{0x55, 0xC4, 0, 0}),
+		Build("hdlr", []byte{0, 0, 0, 0}, []byte("mhlr"+t.HandlerType), make([]byte, 12), []byte{0}),
+		Build("minf", stbl),
+	))
+	return Build("trak", children...)
+}
+
+// SampleTables builds the 'stts', 'stsc', 'stsz' and 'stco' atoms of count samples of the same duration
+// and size, stored in chunks of perChunk samples at the chunk offsets
+func SampleTables(count, duration, size, perChunk uint32, chunkOffsets ...uint32) [][]byte {
+	return [][]byte{
+		Build("stts", Uint32s(0, 1, count, duration)),
+		Build("stsc", Uint32s(0, 1, 1, perChunk, 1)),
+		Build("stsz", Uint32s(0, size, count)),
+		Build("stco", Uint32s(0, uint32(len(chunkOffsets))), Uint32s(chunkOffsets...)),
+	}
+}
+
+// SampleEntry builds a sample entry of the format with its media specific fields left zero, 20 bytes
+// of them for audio and 70 for video, followed by the extensions
+func SampleEntry(format string, fieldsSize int, extensions ...[]byte) []byte {
+	return Build(format, append([][]byte{make([]byte, 6), {0, 1}, make([]byte, fieldsSize)}, extensions...)...)
+}
+
+// FileType builds an 'ftyp' atom of the major brand, also listed first among the compatible brands
+func FileType(major string, compatible ...string) []byte {
+	return Build("ftyp", []byte(major), Uint32s(0x200), []byte(strings.Join(append([]string{major}, compatible...), "")))
+}
+
+// MovieHeader builds an 'mvhd' atom of a timescale of 1000
+func MovieHeader(duration, nextTrackID uint32) []byte {
+	return Build("mvhd", make([]byte, 12), Uint32s(1000, duration), make([]byte, 76), Uint32s(nextTrackID))
+}
+
+// Movie builds a file of the 'ftyp' atom, an 'mdat' atom holding the payload at MediaOffset and a
+// 'moov' atom of the movie header and the tracks
+func Movie(ftyp, payload, mvhd []byte, traks ...[]byte) []byte {
+	return bytes.Join([][]byte{ftyp, Build("mdat", payload), Build("moov", append([][]byte{mvhd}, traks...)...)}, nil)
+}
+
+// MediaOffset returns the offset at which Movie stores the payload after the 'ftyp' atom
+func MediaOffset(ftyp []byte) uint32 {
+	return uint32(len(ftyp) + 8)
+}
+
+// Interleave builds the payload of tracks stored in alternating chunks of perChunk samples, one track
+// after the other in each chunk. Every sample takes 4 bytes holding the letter of its track and its index.
+func Interleave(count, perChunk int, letters ...string) []byte {
+	var payload []byte
+	for chunk := 0; chunk*perChunk < count; chunk++ {
+		for _, letter := range letters {
+			for i := chunk * perChunk; i < min(count, (chunk+1)*perChunk); i++ {
+				payload = append(payload, fmt.Sprintf("%s%d..", letter, i)...)
+			}
+		}
+	}
+	return payload
+}
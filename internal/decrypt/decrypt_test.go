@@ -0,0 +1,177 @@
+package decrypt
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/KrzysztofHeinke/quicktime-movie-parser/internal/atomtest"
+	"github.com/KrzysztofHeinke/quicktime-movie-parser/pkg/models/atoms"
+	"github.com/stretchr/testify/assert"
+)
+
+var (
+	testKID = []byte{0x10, 0x11, 0x12, 0x13, 0x14, 0x15, 0x16, 0x17, 0x18, 0x19, 0x1A, 0x1B, 0x1C, 0x1D, 0x1E, 0x1F}
+	testKey = []byte{0x00, 0x01, 0x02, 0x03, 0x04, 0x05, 0x06, 0x07, 0x08, 0x09, 0x0A, 0x0B, 0x0C, 0x0D, 0x0E, 0x0F}
+)
+
+// plaintext returns deterministic sample data of the given size
+func plaintext(size int) []byte {
+	data := make([]byte, size)
+	for i := range data {
+		data[i] = byte(i * 7)
+	}
+	return data
+}
+
+// encryptCTR encrypts the protected ranges of the sample as one AES-CTR key stream
+func encryptCTR(t *testing.T, sample []byte, iv []byte, subsamples []atoms.SubsampleEntry) []byte {
+	block, err := aes.NewCipher(testKey)
+	assert.NoError(t, err)
+	counter := make([]byte, 16)
+	copy(counter, iv)
+	stream := cipher.NewCTR(block, counter)
+	ranges, err := protectedRanges(len(sample), subsamples)
+	assert.NoError(t, err)
+	encrypted := bytes.Clone(sample)
+	for _, r := range ranges {
+		stream.XORKeyStream(encrypted[r[0]:r[1]], encrypted[r[0]:r[1]])
+	}
+	return encrypted
+}
+
+// TestParseKey tests parsing KID:KEY pairs
+func TestParseKey(t *testing.T) {
+	kid, key, err := ParseKey("10111213-1415-1617-1819-1a1b1c1d1e1f:000102030405060708090a0b0c0d0e0f")
+	assert.NoError(t, err)
+	assert.Equal(t, testKID, kid[:])
+	assert.Equal(t, testKey, key)
+
+	_, _, err = ParseKey("1011:0001")
+	assert.Error(t, err)
+	_, _, err = ParseKey("000102030405060708090a0b0c0d0e0f")
+	assert.Error(t, err)
+}
+
+// TestDecryptSampleCenc tests AES-CTR decryption continuing the key stream across subsamples
+func TestDecryptSampleCenc(t *testing.T) {
+	sample := plaintext(100)
+	encryption := atoms.SampleEncryption{
+		IV:         []byte{1, 2, 3, 4, 5, 6, 7, 8},
+		Subsamples: []atoms.SubsampleEntry{{BytesOfClearData: 5, BytesOfProtectedData: 21}, {BytesOfClearData: 10, BytesOfProtectedData: 64}},
+	}
+	encrypted := encryptCTR(t, sample, encryption.IV, encryption.Subsamples)
+	assert.Equal(t, sample[:5], encrypted[:5])
+	assert.NotEqual(t, sample, encrypted)
+
+	err := DecryptSample(encrypted, &Protection{Scheme: "cenc", Key: testKey, IVSize: 8}, encryption)
+	assert.NoError(t, err)
+	assert.Equal(t, sample, encrypted)
+}
+
+// TestDecryptSampleCbcs tests AES-CBC decryption with a 1:9 pattern restarting in every subsample
+func TestDecryptSampleCbcs(t *testing.T) {
+	sample := plaintext(400)
+	iv := plaintext(16)
+	subsamples := []atoms.SubsampleEntry{{BytesOfClearData: 8, BytesOfProtectedData: 200}, {BytesOfClearData: 0, BytesOfProtectedData: 192}}
+
+	block, err := aes.NewCipher(testKey)
+	assert.NoError(t, err)
+	encrypted := bytes.Clone(sample)
+	ranges, err := protectedRanges(len(sample), subsamples)
+	assert.NoError(t, err)
+	for _, r := range ranges {
+		encrypter := cipher.NewCBCEncrypter(block, iv)
+		data := encrypted[r[0]:r[1]]
+		for start := 0; start+16 <= len(data); start += 10 * 16 {
+			encrypter.CryptBlocks(data[start:start+16], data[start:start+16])
+		}
+	}
+
+	protection := &Protection{Scheme: "cbcs", Key: testKey, ConstantIV: iv, CryptBlock: 1, SkipBlock: 9}
+	err = DecryptSample(encrypted, protection, atoms.SampleEncryption{Subsamples: subsamples})
+	assert.NoError(t, err)
+	assert.Equal(t, sample, encrypted)
+}
+
+// TestDecryptFile tests decrypting a fragmented 'cenc' file and restoring its sample entry
+func TestDecryptFile(t *testing.T) {
+	entryFields := make([]byte, 78)
+	binary.BigEndian.PutUint16(entryFields[6:], 1)
+	encv := atomtest.Build("encv", entryFields,
+		atomtest.Build("sinf",
+			atomtest.Build("frma", []byte("avc1")),
+			atomtest.Build("schm", atomtest.Uint32s(0), []byte("cenc"), atomtest.Uint32s(0x00010000)),
+			atomtest.Build("schi", atomtest.Build("tenc", []byte{0, 0, 0, 0, 0, 0, 1, 8}, testKID)),
+		),
+	)
+	pssh := atomtest.Build("pssh", atomtest.Uint32s(0), make([]byte, 16), atomtest.Uint32s(0))
+	moov := func(entry []byte, protection ...[]byte) []byte {
+		return atomtest.Build("moov", append([][]byte{
+			atomtest.Build("mvhd", make([]byte, 12), atomtest.Uint32s(1000, 0), make([]byte, 80)),
+			atomtest.Build("trak",
+				atomtest.Build("tkhd", make([]byte, 12), atomtest.Uint32s(1), make([]byte, 68)),
+				atomtest.Build("mdia",
+					atomtest.Build("mdhd", make([]byte, 12), atomtest.Uint32s(1000, 0), []byte{0x55, 0xC4, 0, 0}),
+					atomtest.Build("hdlr", make([]byte, 8), []byte("vide"), make([]byte, 13)),
+					atomtest.Build("minf", atomtest.Build("stbl", atomtest.Build("stsd", atomtest.Uint32s(0, 1), entry))),
+				),
+			),
+			atomtest.Build("mvex", atomtest.Build("trex", atomtest.Uint32s(0, 1, 1, 40, 0, 0))),
+		}, protection...)...)
+	}
+
+	samples := [][]byte{plaintext(48), plaintext(30)}
+	ivs := [][]byte{{1, 1, 1, 1, 1, 1, 1, 1}, {2, 2, 2, 2, 2, 2, 2, 2}}
+	subsamples := [][]atoms.SubsampleEntry{{{BytesOfClearData: 16, BytesOfProtectedData: 32}}, nil}
+	senc := bytes.Join([][]byte{atomtest.Uint32s(0x000002, 2),
+		ivs[0], []byte{0, 1, 0, 16, 0, 0, 0, 32},
+		ivs[1], []byte{0, 0},
+	}, nil)
+	mdat := atomtest.Build("mdat",
+		encryptCTR(t, samples[0], ivs[0], subsamples[0]),
+		encryptCTR(t, samples[1], ivs[1], subsamples[1]),
+	)
+	moofWithOffset := func(dataOffset uint32, protection ...[]byte) []byte {
+		return atomtest.Build("moof",
+			atomtest.Build("mfhd", atomtest.Uint32s(0, 1)),
+			atomtest.Build("traf", append([][]byte{
+				atomtest.Build("tfhd", atomtest.Uint32s(0x020000, 1)),
+				atomtest.Build("trun", atomtest.Uint32s(0x000201, 2, dataOffset, 48, 30)),
+			}, protection...)...),
+		)
+	}
+	moof := moofWithOffset(uint32(len(moofWithOffset(0, atomtest.Build("senc", senc)))+8), atomtest.Build("senc", senc))
+	ftyp := atomtest.Build("ftyp", []byte("iso6"), atomtest.Uint32s(0))
+	input := bytes.Join([][]byte{ftyp, moov(encv, pssh), moof, mdat}, nil)
+
+	// The clear file has neither 'sinf' nor the protection atoms, the data offset follows the smaller 'moof'
+	clearMoof := moofWithOffset(uint32(len(moofWithOffset(0)) + 8))
+	expected := bytes.Join([][]byte{ftyp, moov(atomtest.Build("avc1", entryFields)), clearMoof, atomtest.Build("mdat", samples...)}, nil)
+
+	directory := t.TempDir()
+	inputPath := filepath.Join(directory, "encrypted.mp4")
+	outputPath := filepath.Join(directory, "clear.mp4")
+	assert.NoError(t, os.WriteFile(inputPath, input, 0o644))
+
+	var kid [16]byte
+	copy(kid[:], testKID)
+	err := DecryptFile(inputPath, outputPath, Keys{kid: testKey})
+	assert.NoError(t, err)
+
+	output, err := os.ReadFile(outputPath)
+	assert.NoError(t, err)
+	assert.Equal(t, expected, output)
+
+	// A failure leaves neither a partial output nor a temporary file behind
+	assert.NoError(t, os.Remove(outputPath))
+	err = DecryptFile(inputPath, outputPath, Keys{})
+	assert.ErrorContains(t, err, "no key for KID 10111213-1415-1617-1819-1a1b1c1d1e1f")
+	entries, err := os.ReadDir(directory)
+	assert.NoError(t, err)
+	assert.Len(t, entries, 1)
+}
@@ -0,0 +1,286 @@
+package decrypt
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"unsafe"
+
+	"github.com/KrzysztofHeinke/quicktime-movie-parser/internal/parser"
+	"github.com/KrzysztofHeinke/quicktime-movie-parser/internal/track"
+	"github.com/KrzysztofHeinke/quicktime-movie-parser/internal/writer"
+	"github.com/KrzysztofHeinke/quicktime-movie-parser/pkg/models/atoms"
+	"github.com/sirupsen/logrus"
+)
+
+// DecryptFile writes a clear copy of a 'cenc' or 'cbcs' protected file. Protected sample entries get
+// their original format back from 'frma', the 'sinf' atoms and the protection atoms are removed and the
+// offsets pointing past them are shifted. The copy is written to a temporary file which only replaces the
+// output once every sample is decrypted.
+func DecryptFile(input, output string, keys Keys) error {
+	file, err := os.Open(input)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	info, err := file.Stat()
+	if err != nil {
+		return err
+	}
+
+	tree, err := parser.ReadTree(input)
+	if err != nil {
+		return err
+	}
+	moov, ok := tree.(*atoms.CompositeAtom).GetChild("moov").(*atoms.CompositeAtom)
+	if !ok {
+		return fmt.Errorf("moov atom could not be parsed")
+	}
+	tracks, err := parser.ReadTracks(tree, file, info.Size())
+	if err != nil {
+		return err
+	}
+	topLevelAtoms, err := parser.ReadTopLevelAtoms(file, info.Size())
+	if err != nil {
+		return err
+	}
+	fragments, err := parser.ReadFragments(file, topLevelAtoms)
+	if err != nil {
+		return err
+	}
+
+	// The encryption entries are read before their atoms are removed
+	budget := atoms.NewBudget(atoms.CurrentLimits().MaxTotalAllocation)
+	var protected []*protectedTrack
+	for _, t := range tracks {
+		p, err := newProtectedTrack(file, t, fragments, keys, budget)
+		if err != nil {
+			return fmt.Errorf("track %d: %w", t.ID, err)
+		}
+		if p != nil {
+			protected = append(protected, p)
+		}
+	}
+	layout, err := newClearLayout(file, topLevelAtoms, moov, fragments)
+	if err != nil {
+		return err
+	}
+
+	return writer.ReplaceFile(output, info.Mode().Perm(), func(destination *os.File) error {
+		if err := layout.write(destination, file); err != nil {
+			return err
+		}
+		for _, p := range protected {
+			if err := p.decrypt(file, destination, layout.relocate); err != nil {
+				return fmt.Errorf("track %d: %w", p.track.ID, err)
+			}
+		}
+		return nil
+	})
+}
+
+// newProtection returns the decryption parameters of a sample entry, or nil if its samples are clear
+func newProtection(entry *atoms.SampleEntry, keys Keys) (*Protection, error) {
+	if !entry.IsProtected() {
+		return nil, nil
+	}
+	schm, ok := entry.GetExtension("schm").(*atoms.SchmAtom)
+	if !ok {
+		return nil, fmt.Errorf("protected sample entry %s has no schm atom", entry.GetType())
+	}
+	tenc, ok := entry.GetExtension("tenc").(*atoms.TencAtom)
+	if !ok {
+		return nil, fmt.Errorf("protected sample entry %s has no tenc atom", entry.GetType())
+	}
+	if tenc.DefaultIsProtected == 0 {
+		return nil, nil
+	}
+	key, ok := keys[tenc.DefaultKID]
+	if !ok {
+		return nil, fmt.Errorf("no key for KID %s", atoms.FormatUUID(tenc.DefaultKID))
+	}
+	return &Protection{
+		Scheme:     schm.GetSchemeType(),
+		Key:        key,
+		IVSize:     int(tenc.DefaultPerSampleIVSize),
+		ConstantIV: tenc.DefaultConstantIV,
+		CryptBlock: int(tenc.DefaultCryptByteBlock),
+		SkipBlock:  int(tenc.DefaultSkipByteBlock),
+	}, nil
+}
+
+// protectedTrack holds what decrypting the samples of a track takes
+type protectedTrack struct {
+	track *track.Track
+	// protections holds the decryption parameters of every sample description, nil for clear ones
+	protections []*Protection
+	encryption  []atoms.SampleEncryption
+	scheme      string
+}
+
+// newProtectedTrack reads the decryption parameters and the encryption entries of a track, it returns nil
+// if the samples of the track are clear
+func newProtectedTrack(r io.ReaderAt, t *track.Track, fragments []track.Fragment, keys Keys, budget *atoms.Budget) (*protectedTrack, error) {
+	protections := make([]*Protection, len(t.SampleDescriptions))
+	var first *Protection
+	for i := range t.SampleDescriptions {
+		protection, err := newProtection(&t.SampleDescriptions[i], keys)
+		if err != nil {
+			return nil, err
+		}
+		protections[i] = protection
+		if first == nil {
+			first = protection
+		}
+	}
+	if first == nil {
+		return nil, nil
+	}
+
+	encryption, err := sampleEncryption(r, t, fragments, first.IVSize, budget)
+	if err != nil {
+		return nil, err
+	}
+	return &protectedTrack{track: t, protections: protections, encryption: encryption, scheme: first.Scheme}, nil
+}
+
+// decrypt reads the protected samples of the track from the input and writes them decrypted to the
+// output, at the offsets relocate moves them to
+func (p *protectedTrack) decrypt(input io.ReaderAt, output io.WriterAt, relocate func(uint64) uint64) error {
+	decrypted := 0
+	for i, sample := range p.track.Samples {
+		index := int(sample.DescriptionIndex) - 1
+		if index < 0 || index >= len(p.protections) || p.protections[index] == nil {
+			continue
+		}
+		data, err := p.track.ReadSample(input, i)
+		if err != nil {
+			return err
+		}
+		if err := DecryptSample(data, p.protections[index], p.encryption[i]); err != nil {
+			return fmt.Errorf("sample %d: %w", i+1, err)
+		}
+		if _, err := output.WriteAt(data, int64(relocate(sample.Offset))); err != nil {
+			return fmt.Errorf("failed to write sample %d: %w", i+1, err)
+		}
+		decrypted++
+	}
+	logrus.Infof("Track %d: decrypted %d samples (%s)", p.track.ID, decrypted, p.scheme)
+	return nil
+}
+
+// sampleEncryption returns the IV and subsample map of every sample of the track, read from the
+// 'senc' atoms or the sample auxiliary information of the sample table and of the track fragments.
+func sampleEncryption(r io.ReaderAt, t *track.Track, fragments []track.Fragment, ivSize int, budget *atoms.Budget) ([]atoms.SampleEncryption, error) {
+	var fragmented []atoms.SampleEncryption
+	for _, fragment := range fragments {
+		for _, atom := range fragment.Moof.FindAll("traf") {
+			traf, ok := atom.(*atoms.CompositeAtom)
+			if !ok {
+				continue
+			}
+			tfhd, ok := traf.LeafData("tfhd").(*atoms.TfhdAtom)
+			if !ok || tfhd.TrackID != t.ID {
+				continue
+			}
+			base := uint64(fragment.Offset)
+			if tfhd.GetFlags()&atoms.TfhdBaseDataOffsetPresent != 0 {
+				base = tfhd.BaseDataOffset
+			}
+			entries, err := readEncryption(r, traf, base, trafSampleCount(traf), ivSize, budget)
+			if err != nil {
+				return nil, fmt.Errorf("fragment at offset %d: %w", fragment.Offset, err)
+			}
+			fragmented = append(fragmented, entries...)
+		}
+	}
+
+	progressive := len(t.Samples) - len(fragmented)
+	if progressive < 0 {
+		return nil, fmt.Errorf("%d encryption entries for %d samples", len(fragmented), len(t.Samples))
+	}
+	var result []atoms.SampleEncryption
+	if progressive > 0 {
+		stbl, ok := t.Atom.Find("mdia", "minf", "stbl").(*atoms.CompositeAtom)
+		if !ok {
+			return nil, fmt.Errorf("missing stbl atom")
+		}
+		entries, err := readEncryption(r, stbl, 0, progressive, ivSize, budget)
+		if err != nil {
+			return nil, err
+		}
+		result = entries
+	}
+	return append(result, fragmented...), nil
+}
+
+// trafSampleCount returns the number of samples of the track runs of a 'traf' atom
+func trafSampleCount(traf *atoms.CompositeAtom) int {
+	count := 0
+	for _, atom := range traf.FindAll("trun") {
+		if leaf, ok := atom.(*atoms.LeafAtom); ok {
+			if trun, ok := leaf.Data.(*atoms.TrunAtom); ok {
+				count += int(trun.SampleCount)
+			}
+		}
+	}
+	return count
+}
+
+// readEncryption reads the encryption entries of the samples of an 'stbl' or 'traf' atom, either from its
+// 'senc' atom or from the auxiliary information located by 'saiz' and 'saio' relative to base. Samples
+// encrypted with a constant IV and without subsamples may have no entries at all.
+func readEncryption(r io.ReaderAt, parent *atoms.CompositeAtom, base uint64, count int, ivSize int, budget *atoms.Budget) ([]atoms.SampleEncryption, error) {
+	if senc, ok := parent.LeafData("senc").(*atoms.SencAtom); ok {
+		entries, err := senc.GetSamples(ivSize, budget)
+		if err != nil {
+			return nil, err
+		}
+		if len(entries) != count {
+			return nil, fmt.Errorf("senc atom has %d entries for %d samples", len(entries), count)
+		}
+		return entries, nil
+	}
+
+	saiz, hasSaiz := parent.LeafData("saiz").(*atoms.SaizAtom)
+	saio, hasSaio := parent.LeafData("saio").(*atoms.SaioAtom)
+	if !hasSaiz || !hasSaio {
+		if ivSize != 0 {
+			return nil, fmt.Errorf("missing sample encryption information")
+		}
+		return make([]atoms.SampleEncryption, count), nil
+	}
+	if int(saiz.SampleCount) != count {
+		return nil, fmt.Errorf("saiz atom has %d entries for %d samples", saiz.SampleCount, count)
+	}
+	if len(saio.Offsets) != 1 {
+		return nil, fmt.Errorf("saio atoms with %d offsets are not supported", len(saio.Offsets))
+	}
+
+	total := 0
+	for i := 0; i < count; i++ {
+		total += saiz.GetSampleInfoSize(i)
+	}
+	if err := atoms.CheckSize("sample auxiliary information size", uint64(total), atoms.CurrentLimits().MaxAtomSize); err != nil {
+		return nil, err
+	}
+	if err := budget.Charge("sample encryption entries", uint64(count), unsafe.Sizeof(atoms.SampleEncryption{})); err != nil {
+		return nil, err
+	}
+	data := make([]byte, total)
+	if _, err := r.ReadAt(data, int64(base+saio.Offsets[0])); err != nil {
+		return nil, fmt.Errorf("error reading sample auxiliary information: %w", err)
+	}
+
+	entries := make([]atoms.SampleEncryption, count)
+	for i := range entries {
+		size := saiz.GetSampleInfoSize(i)
+		entry, err := ParseAuxiliaryInfo(data[:size], ivSize)
+		if err != nil {
+			return nil, fmt.Errorf("sample %d: %w", i+1, err)
+		}
+		entries[i] = entry
+		data = data[size:]
+	}
+	return entries, nil
+}
@@ -0,0 +1,64 @@
+package decrypt
+
+import (
+	"bufio"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// Keys maps key IDs to their 128-bit content keys
+type Keys map[[16]byte][]byte
+
+// ParseKey parses a "KID:KEY" pair of hexadecimal strings. Dashes of UUID-formatted key IDs are ignored.
+func ParseKey(spec string) ([16]byte, []byte, error) {
+	var kid [16]byte
+	parts := strings.FieldsFunc(spec, func(r rune) bool { return r == ':' || r == '=' || r == ' ' || r == '\t' })
+	if len(parts) != 2 {
+		return kid, nil, fmt.Errorf("invalid key %q, expected KID:KEY", spec)
+	}
+
+	kidBytes, err := hex.DecodeString(strings.ReplaceAll(parts[0], "-", ""))
+	if err != nil || len(kidBytes) != 16 {
+		return kid, nil, fmt.Errorf("invalid key ID %q, expected 32 hexadecimal digits", parts[0])
+	}
+	key, err := hex.DecodeString(parts[1])
+	if err != nil || len(key) != 16 {
+		return kid, nil, fmt.Errorf("invalid key %q, expected 32 hexadecimal digits", parts[1])
+	}
+	copy(kid[:], kidBytes)
+	return kid, key, nil
+}
+
+// Add parses a "KID:KEY" pair and adds it to the keys
+func (k Keys) Add(spec string) error {
+	kid, key, err := ParseKey(spec)
+	if err != nil {
+		return err
+	}
+	k[kid] = key
+	return nil
+}
+
+// ReadKeyFile reads keys from a file holding one "KID:KEY" pair per line. Empty lines and lines starting
+// with '#' are ignored.
+func ReadKeyFile(path string, keys Keys) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("failed to open key file: %w", err)
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+		if err := keys.Add(text); err != nil {
+			return fmt.Errorf("%s:%d: %w", path, line, err)
+		}
+	}
+	return scanner.Err()
+}
@@ -0,0 +1,301 @@
+package decrypt
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/KrzysztofHeinke/quicktime-movie-parser/internal/parser"
+	"github.com/KrzysztofHeinke/quicktime-movie-parser/internal/track"
+	"github.com/KrzysztofHeinke/quicktime-movie-parser/internal/writer"
+	"github.com/KrzysztofHeinke/quicktime-movie-parser/pkg/models/atoms"
+)
+
+// Atoms which only carry protection information and are removed from the clear file
+var protectionAtoms = map[string]bool{
+	"pssh": true,
+	"senc": true,
+	"saiz": true,
+	"saio": true,
+}
+
+// clearLayout places the top level atoms of the input in the clear file. The atoms which held
+// protection atoms or offsets are written from their rewritten data, the others are copied.
+type clearLayout struct {
+	topLevelAtoms []parser.TopLevelAtom
+	// data holds the rewritten atoms by their index
+	data    map[int][]byte
+	offsets []int64
+	size    int64
+}
+
+// newClearLayout removes the protection atoms from the 'moov' atom and the movie fragments, places the
+// top level atoms one after the other and shifts the chunk offsets, the data offsets of the fragments
+// and the offsets of the 'sidx' and 'tfra' indexes along.
+func newClearLayout(r io.ReaderAt, topLevelAtoms []parser.TopLevelAtom, moov *atoms.CompositeAtom, fragments []track.Fragment) (*clearLayout, error) {
+	trees := map[int]*atoms.CompositeAtom{}
+	first, _ := parser.FindTopLevelAtom(topLevelAtoms, "moov")
+	for i, atom := range topLevelAtoms {
+		switch atom.Type {
+		case "moov":
+			if atom.Offset == first.Offset {
+				trees[i] = moov
+			}
+		case "moof":
+			for _, fragment := range fragments {
+				if fragment.Offset == atom.Offset {
+					trees[i] = fragment.Moof
+				}
+			}
+		case "sidx", "mfra":
+			tree, err := parser.ReadTopLevelAtom(r, atom)
+			if err != nil {
+				return nil, err
+			}
+			if composite, ok := tree.(*atoms.CompositeAtom); ok {
+				trees[i] = composite
+			} else {
+				trees[i] = &atoms.CompositeAtom{Childrens: []atoms.AtomIf{tree}}
+			}
+		}
+	}
+
+	layout := &clearLayout{topLevelAtoms: topLevelAtoms, data: map[int][]byte{}, offsets: make([]int64, len(topLevelAtoms))}
+	sizes := make([]int64, len(topLevelAtoms))
+	for i, atom := range topLevelAtoms {
+		sizes[i] = atom.Size
+		tree, ok := trees[i]
+		if !ok || atom.Type == "sidx" || atom.Type == "mfra" {
+			continue
+		}
+		if err := stripProtection(tree); err != nil {
+			return nil, fmt.Errorf("%s atom at offset %d: %w", atom.Type, atom.Offset, err)
+		}
+		data, err := writer.Marshal(tree)
+		if err != nil {
+			return nil, err
+		}
+		sizes[i] = int64(len(data))
+	}
+	for i := range topLevelAtoms {
+		layout.offsets[i] = layout.size
+		layout.size += sizes[i]
+	}
+
+	for i, atom := range topLevelAtoms {
+		tree, ok := trees[i]
+		if !ok {
+			continue
+		}
+		var data []byte
+		var err error
+		switch atom.Type {
+		case "moov":
+			data, err = writer.RelocateMovie(tree, topLevelAtoms, func(int64) []int64 { return layout.offsets }, sizes[i])
+		case "moof":
+			data, err = layout.relocateFragment(tree, i)
+		case "sidx":
+			data, err = layout.relocateSegmentIndex(tree, i)
+		case "mfra":
+			data, err = layout.relocateRandomAccess(tree)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%s atom at offset %d: %w", atom.Type, atom.Offset, err)
+		}
+		if int64(len(data)) != sizes[i] {
+			return nil, fmt.Errorf("%s atom at offset %d changed its size while relocating", atom.Type, atom.Offset)
+		}
+		layout.data[i] = data
+	}
+	return layout, nil
+}
+
+// relocate moves an offset of the input to the clear file along with the top level atom holding it.
+// Offsets past the last atom keep their distance to the end of the file.
+func (l *clearLayout) relocate(offset uint64) uint64 {
+	for i, atom := range l.topLevelAtoms {
+		if int64(offset) < atom.Offset+atom.Size {
+			return uint64(l.offsets[i] + int64(offset) - atom.Offset)
+		}
+	}
+	if len(l.topLevelAtoms) == 0 {
+		return offset
+	}
+	last := l.topLevelAtoms[len(l.topLevelAtoms)-1]
+	return uint64(l.size + int64(offset) - last.Offset - last.Size)
+}
+
+// relocateFragment shifts the data offsets of the track fragments of the 'moof' atom with the given
+// index. Explicit base data offsets are absolute, the data offsets of track runs are relative to the
+// 'moof' atom for the first track fragment and those marked default-base-is-moof. The other track
+// fragments follow the data of the previous one, which moves along.
+func (l *clearLayout) relocateFragment(moof *atoms.CompositeAtom, index int) ([]byte, error) {
+	start := uint64(l.topLevelAtoms[index].Offset)
+	for i, atom := range moof.FindAll("traf") {
+		traf, ok := atom.(*atoms.CompositeAtom)
+		if !ok {
+			continue
+		}
+		tfhdLeaf, ok := traf.GetChild("tfhd").(*atoms.LeafAtom)
+		if !ok {
+			return nil, fmt.Errorf("missing tfhd atom")
+		}
+		tfhd, ok := tfhdLeaf.Data.(*atoms.TfhdAtom)
+		if !ok {
+			return nil, fmt.Errorf("tfhd atom could not be parsed")
+		}
+		if tfhd.GetFlags()&atoms.TfhdBaseDataOffsetPresent != 0 {
+			tfhd.BaseDataOffset = l.relocate(tfhd.BaseDataOffset)
+			tfhdLeaf.SetData(tfhd)
+			continue
+		}
+		if i > 0 && tfhd.GetFlags()&atoms.TfhdDefaultBaseIsMoof == 0 {
+			continue
+		}
+		for _, child := range traf.FindAll("trun") {
+			leaf, ok := child.(*atoms.LeafAtom)
+			if !ok {
+				continue
+			}
+			trun, ok := leaf.Data.(*atoms.TrunAtom)
+			if !ok {
+				return nil, fmt.Errorf("trun atom could not be parsed")
+			}
+			if trun.GetFlags()&atoms.TrunDataOffsetPresent == 0 {
+				continue
+			}
+			offset := int64(l.relocate(uint64(int64(start)+int64(trun.DataOffset)))) - l.offsets[index]
+			if int64(int32(offset)) != offset {
+				return nil, fmt.Errorf("data offset %d does not fit 32 bits", offset)
+			}
+			trun.DataOffset = int32(offset)
+			leaf.SetData(trun)
+		}
+	}
+	return writer.Marshal(moof)
+}
+
+// relocateSegmentIndex resizes the references of the 'sidx' atom with the given index to the bytes
+// they cover in the clear file
+func (l *clearLayout) relocateSegmentIndex(tree *atoms.CompositeAtom, index int) ([]byte, error) {
+	leaf, ok := tree.GetChild("sidx").(*atoms.LeafAtom)
+	if !ok {
+		return nil, fmt.Errorf("sidx atom could not be parsed")
+	}
+	sidx, ok := leaf.Data.(*atoms.SidxAtom)
+	if !ok {
+		return nil, fmt.Errorf("sidx atom could not be parsed")
+	}
+	anchor := uint64(l.topLevelAtoms[index].Offset + l.topLevelAtoms[index].Size)
+	start := anchor + sidx.FirstOffset
+	sidx.FirstOffset = l.relocate(start) - l.relocate(anchor)
+	for i := range sidx.References {
+		end := start + uint64(sidx.References[i].ReferencedSize)
+		sidx.References[i].ReferencedSize = uint32(l.relocate(end) - l.relocate(start))
+		start = end
+	}
+	leaf.SetData(sidx)
+	return writer.Marshal(tree)
+}
+
+// relocateRandomAccess moves the 'moof' offsets of the 'tfra' atoms of an 'mfra' atom
+func (l *clearLayout) relocateRandomAccess(mfra *atoms.CompositeAtom) ([]byte, error) {
+	for _, atom := range mfra.FindAll("tfra") {
+		leaf, ok := atom.(*atoms.LeafAtom)
+		if !ok {
+			continue
+		}
+		tfra, ok := leaf.Data.(*atoms.TfraAtom)
+		if !ok {
+			return nil, fmt.Errorf("tfra atom could not be parsed")
+		}
+		for i := range tfra.Entries {
+			tfra.Entries[i].MoofOffset = l.relocate(tfra.Entries[i].MoofOffset)
+		}
+		leaf.SetData(tfra)
+	}
+	return writer.Marshal(mfra)
+}
+
+// write writes the top level atoms of the clear file, copying those which were not rewritten from the input
+func (l *clearLayout) write(w io.Writer, input io.ReaderAt) error {
+	for i, atom := range l.topLevelAtoms {
+		if data, ok := l.data[i]; ok {
+			if _, err := w.Write(data); err != nil {
+				return err
+			}
+			continue
+		}
+		if _, err := io.Copy(w, io.NewSectionReader(input, atom.Offset, atom.Size)); err != nil {
+			return fmt.Errorf("failed to copy %s atom at offset %d: %w", atom.Type, atom.Offset, err)
+		}
+	}
+	return nil
+}
+
+// stripProtection removes the protection atoms from below the atom and restores the original format of
+// the protected sample entries of its tracks
+func stripProtection(atom *atoms.CompositeAtom) error {
+	var children []atoms.AtomIf
+	for _, child := range atom.GetChildren() {
+		if protectionAtoms[child.GetType()] {
+			continue
+		}
+		if composite, ok := child.(*atoms.CompositeAtom); ok {
+			if err := stripProtection(composite); err != nil {
+				return fmt.Errorf("%s: %w", composite.GetType(), err)
+			}
+		}
+		children = append(children, child)
+	}
+	atom.SetChildren(children)
+	if atom.GetType() == "trak" {
+		return restoreSampleEntries(atom)
+	}
+	return nil
+}
+
+// restoreSampleEntries gives the protected sample entries of a 'trak' atom the format of their 'frma'
+// atom back and removes their 'sinf' atoms
+func restoreSampleEntries(trak *atoms.CompositeAtom) error {
+	leaf, ok := trak.Find("mdia", "minf", "stbl", "stsd").(*atoms.LeafAtom)
+	if !ok {
+		return nil
+	}
+	stsd, ok := leaf.Data.(*atoms.AtomStsd)
+	if !ok {
+		return fmt.Errorf("stsd atom could not be parsed")
+	}
+	handlerType := ""
+	if hdlr, ok := trak.LeafData("mdia", "hdlr").(*atoms.HdlrAtom); ok {
+		handlerType = hdlr.GetHandlerType()
+	}
+
+	restored := false
+	for i := range stsd.SampleEntries {
+		entry := &stsd.SampleEntries[i]
+		if !entry.IsProtected() {
+			continue
+		}
+		offset := entry.ExtensionsOffset(handlerType)
+		extensions, ok := entry.Extensions.(*atoms.CompositeAtom)
+		if offset < 0 || offset > len(entry.Data) || !ok {
+			return fmt.Errorf("unknown layout of sample entry %s", entry.GetType())
+		}
+		frma, ok := entry.GetExtension("frma").(*atoms.FrmaAtom)
+		if !ok {
+			return fmt.Errorf("%s: missing frma atom", entry.GetType())
+		}
+		extensions.RemoveChildren("sinf")
+		data, err := writer.Marshal(extensions)
+		if err != nil {
+			return fmt.Errorf("%s: %w", entry.GetType(), err)
+		}
+		entry.Data = append(entry.Data[:offset:offset], data...)
+		entry.Type = frma.DataFormat
+		restored = true
+	}
+	if restored {
+		leaf.SetData(stsd)
+	}
+	return nil
+}
@@ -0,0 +1,127 @@
+package decrypt
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"encoding/binary"
+	"fmt"
+
+	"github.com/KrzysztofHeinke/quicktime-movie-parser/pkg/models/atoms"
+)
+
+// Protection holds the decryption parameters of a protected sample entry
+type Protection struct {
+	Scheme     string
+	Key        []byte
+	IVSize     int
+	ConstantIV []byte
+	CryptBlock int
+	SkipBlock  int
+}
+
+// DecryptSample decrypts the sample in place. 'cenc' samples are decrypted with AES-CTR, the protected
+// bytes of all subsamples forming one key stream. 'cbcs' samples are decrypted with AES-CBC following the
+// crypt and skip block pattern, restarting from the IV in every subsample.
+func DecryptSample(sample []byte, protection *Protection, encryption atoms.SampleEncryption) error {
+	block, err := aes.NewCipher(protection.Key)
+	if err != nil {
+		return err
+	}
+	iv := encryption.IV
+	if len(iv) == 0 {
+		iv = protection.ConstantIV
+	}
+	if len(iv) != 8 && len(iv) != 16 {
+		return fmt.Errorf("invalid IV size %d", len(iv))
+	}
+	iv16 := make([]byte, aes.BlockSize)
+	copy(iv16, iv)
+
+	ranges, err := protectedRanges(len(sample), encryption.Subsamples)
+	if err != nil {
+		return err
+	}
+
+	switch protection.Scheme {
+	case "cenc":
+		stream := cipher.NewCTR(block, iv16)
+		for _, r := range ranges {
+			stream.XORKeyStream(sample[r[0]:r[1]], sample[r[0]:r[1]])
+		}
+	case "cbcs":
+		crypt, skip := protection.CryptBlock, protection.SkipBlock
+		if crypt == 0 && skip == 0 {
+			crypt = 1
+		}
+		for _, r := range ranges {
+			decryptPattern(cipher.NewCBCDecrypter(block, iv16), sample[r[0]:r[1]], crypt, skip)
+		}
+	default:
+		return fmt.Errorf("unsupported protection scheme %q", protection.Scheme)
+	}
+	return nil
+}
+
+// protectedRanges returns the byte ranges of the sample which are encrypted. Without subsamples
+// the whole sample is encrypted.
+func protectedRanges(size int, subsamples []atoms.SubsampleEntry) ([][2]int, error) {
+	if len(subsamples) == 0 {
+		return [][2]int{{0, size}}, nil
+	}
+	var ranges [][2]int
+	position := 0
+	for i, subsample := range subsamples {
+		start := position + int(subsample.BytesOfClearData)
+		end := start + int(subsample.BytesOfProtectedData)
+		if end > size || end < start {
+			return nil, fmt.Errorf("subsample %d exceeds the %d bytes of the sample", i+1, size)
+		}
+		if end > start {
+			ranges = append(ranges, [2]int{start, end})
+		}
+		position = end
+	}
+	return ranges, nil
+}
+
+// decryptPattern decrypts the first crypt blocks of every crypt+skip block period. The CBC chain
+// continues over the encrypted blocks only, and a trailing partial block stays in the clear.
+func decryptPattern(decrypter cipher.BlockMode, data []byte, crypt, skip int) {
+	blocks := len(data) / aes.BlockSize
+	for block := 0; block < blocks; block += crypt + skip {
+		count := min(crypt, blocks-block)
+		start := block * aes.BlockSize
+		decrypter.CryptBlocks(data[start:start+count*aes.BlockSize], data[start:start+count*aes.BlockSize])
+	}
+}
+
+// ParseAuxiliaryInfo decodes the sample auxiliary information of a 'cenc' sample, i.e. the IV
+// optionally followed by the subsample map.
+func ParseAuxiliaryInfo(data []byte, ivSize int) (atoms.SampleEncryption, error) {
+	var encryption atoms.SampleEncryption
+	if len(data) < ivSize {
+		return encryption, fmt.Errorf("auxiliary information of %d bytes is shorter than the IV", len(data))
+	}
+	encryption.IV = data[:ivSize]
+	data = data[ivSize:]
+	if len(data) == 0 {
+		return encryption, nil
+	}
+	if len(data) < 2 {
+		return encryption, fmt.Errorf("missing subsample count")
+	}
+	count := int(binary.BigEndian.Uint16(data))
+	data = data[2:]
+	if len(data) < count*6 {
+		return encryption, fmt.Errorf("subsample count %d exceeds the auxiliary information", count)
+	}
+	encryption.Subsamples = make([]atoms.SubsampleEntry, count)
+	for i := range encryption.Subsamples {
+		entry := data[i*6:]
+		encryption.Subsamples[i] = atoms.SubsampleEntry{
+			BytesOfClearData:     binary.BigEndian.Uint16(entry[0:2]),
+			BytesOfProtectedData: binary.BigEndian.Uint32(entry[2:6]),
+		}
+	}
+	return encryption, nil
+}
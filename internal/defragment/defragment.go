@@ -0,0 +1,157 @@
+package defragment
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math"
+	"os"
+	"slices"
+
+	"github.com/KrzysztofHeinke/quicktime-movie-parser/internal/parser"
+	"github.com/KrzysztofHeinke/quicktime-movie-parser/internal/track"
+	"github.com/KrzysztofHeinke/quicktime-movie-parser/internal/writer"
+	"github.com/KrzysztofHeinke/quicktime-movie-parser/pkg/models/atoms"
+)
+
+// Defragment converts a fragmented movie to a progressive one. The samples of every 'moof' atom are
+// merged into complete sample tables, the 'mvex' atom is removed and the sample data is copied into
+// one 'mdat' atom keeping the interleaving of the fragments. With fastStart the 'moov' atom is written
+// in front of the 'mdat' atom, otherwise behind it.
+func Defragment(input, output string, fastStart bool) error {
+	if err := writer.CheckDistinctFiles(input, output); err != nil {
+		return err
+	}
+	file, err := os.Open(input)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	info, err := file.Stat()
+	if err != nil {
+		return err
+	}
+
+	tree, err := parser.ReadTree(input)
+	if err != nil {
+		return err
+	}
+	moov, ok := tree.(*atoms.CompositeAtom).GetChild("moov").(*atoms.CompositeAtom)
+	if !ok {
+		return fmt.Errorf("moov atom could not be parsed")
+	}
+	mvhdLeaf, ok := moov.GetChild("mvhd").(*atoms.LeafAtom)
+	if !ok {
+		return fmt.Errorf("mvhd atom not found")
+	}
+	mvhd, ok := mvhdLeaf.Data.(*atoms.MvhdAtom)
+	if !ok || mvhd.TimeScale == 0 {
+		return fmt.Errorf("mvhd atom has no time scale")
+	}
+	tracks, err := parser.ReadTracks(tree, file, info.Size())
+	if err != nil {
+		return err
+	}
+	fragmented := false
+	for _, t := range tracks {
+		fragmented = fragmented || t.Fragments > 0
+		for _, entry := range t.SampleDescriptions {
+			if entry.IsProtected() {
+				return fmt.Errorf("track %d is encrypted, decrypt the file first", t.ID)
+			}
+		}
+	}
+	if !fragmented {
+		return fmt.Errorf("the file has no movie fragments")
+	}
+
+	moov.RemoveChildren("mvex")
+	mvhd.Duration = 0
+	for _, t := range tracks {
+		resolveEditList(t, mvhd.TimeScale)
+		mvhd.Duration = max(mvhd.Duration, t.UpdateDurations(mvhd.TimeScale))
+	}
+	if mvhd.Duration > math.MaxUint32 {
+		mvhd.Version = 1
+	}
+	mvhdLeaf.SetData(mvhd)
+
+	chunks := make([][]track.Chunk, len(tracks))
+	for i, t := range tracks {
+		chunks[i] = track.SplitChunks(t.Samples)
+	}
+	ftyp, err := parser.ReadFileType(file, info.Size())
+	if err != nil {
+		return err
+	}
+	return writer.WriteTracks(output, file, progressiveFileType(ftyp), moov, tracks, chunks, fastStart)
+}
+
+// fragmentedBrands are the brands of fragmented files and their segments, which a progressive file does
+// not claim
+var fragmentedBrands = map[string]bool{"iso6": true, "dash": true, "cmfc": true, "cmf2": true, "msdh": true, "msix": true}
+
+// progressiveFileType returns the 'ftyp' atom of the input without the brands of fragmented files, the
+// reverse of what fragment.Fragment writes. A major brand among them is replaced by 'isom' of the
+// usual minor version 512.
+func progressiveFileType(ftyp []byte) []byte {
+	start := 8
+	if len(ftyp) >= 4 && binary.BigEndian.Uint32(ftyp) == 1 {
+		start = 16
+	}
+	if len(ftyp) < start+8 {
+		return ftyp
+	}
+	major, minor := string(ftyp[start:start+4]), binary.BigEndian.Uint32(ftyp[start+4:])
+	if fragmentedBrands[major] {
+		major, minor = "isom", 0x200
+	}
+	var compatible []string
+	for i := start + 8; i+4 <= len(ftyp); i += 4 {
+		if brand := string(ftyp[i : i+4]); !fragmentedBrands[brand] {
+			compatible = append(compatible, brand)
+		}
+	}
+	if !slices.Contains(compatible, major) {
+		compatible = append([]string{major}, compatible...)
+	}
+	return writer.FileTypeAtom("ftyp", major, minor, compatible...)
+}
+
+// resolveEditList sets the edits of the track with a segment duration of 0, which fragmented files use
+// for edits lasting until the end of the media, to the media duration they cover in the movie time
+// scale. An edit list with a single such edit starting the media at its beginning is removed.
+func resolveEditList(t *track.Track, movieTimeScale uint32) {
+	edts, ok := t.Atom.GetChild("edts").(*atoms.CompositeAtom)
+	if !ok {
+		return
+	}
+	leaf, ok := edts.GetChild("elst").(*atoms.LeafAtom)
+	if !ok {
+		return
+	}
+	elst, ok := leaf.Data.(*atoms.ElstAtom)
+	if !ok {
+		return
+	}
+	if len(elst.Entries) == 1 && elst.Entries[0] == (atoms.EditListEntry{MediaRateInteger: 1}) {
+		t.Atom.RemoveChildren("edts")
+		return
+	}
+
+	var mediaDuration uint64
+	for _, sample := range t.Samples {
+		mediaDuration += uint64(sample.Duration)
+	}
+	resolved := false
+	for i, entry := range elst.Entries {
+		if entry.SegmentDuration != 0 || entry.MediaTime < 0 || t.TimeScale == 0 {
+			continue
+		}
+		remaining := mediaDuration - min(mediaDuration, uint64(entry.MediaTime))
+		elst.Entries[i].SegmentDuration = uint64(math.Round(float64(remaining) * float64(movieTimeScale) / float64(t.TimeScale)))
+		resolved = true
+	}
+	if resolved {
+		leaf.SetData(elst)
+	}
+}
@@ -0,0 +1,144 @@
+package defragment
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/KrzysztofHeinke/quicktime-movie-parser/internal/atomtest"
+	"github.com/KrzysztofHeinke/quicktime-movie-parser/internal/fragment"
+	"github.com/KrzysztofHeinke/quicktime-movie-parser/internal/parser"
+	"github.com/KrzysztofHeinke/quicktime-movie-parser/internal/track"
+	"github.com/KrzysztofHeinke/quicktime-movie-parser/pkg/models/atoms"
+	"github.com/stretchr/testify/assert"
+)
+
+// writeFragmentedMovie writes a progressive movie with a video track holding the edit list and an audio
+// track, and its fragmented copy
+func writeFragmentedMovie(t *testing.T, dir string, edts []byte) (string, string) {
+	ftyp := atomtest.FileType("isom", "mp41")
+	offset := atomtest.MediaOffset(ftyp)
+	video := atomtest.Track{
+		ID: 1, HandlerType: "vide", Duration: 600, Entry: atomtest.SampleEntry("avc1", 70),
+		Tables: append(atomtest.SampleTables(6, 100, 4, 3, offset, offset+24), atomtest.Build("stss", atomtest.Uint32s(0, 2, 1, 4))),
+	}
+	if edts != nil {
+		video.Extra = [][]byte{edts}
+	}
+	audio := atomtest.Track{
+		ID: 2, HandlerType: "soun", Duration: 600, Entry: atomtest.SampleEntry("mp4a", 20),
+		Tables: atomtest.SampleTables(6, 100, 4, 3, offset+12, offset+36),
+	}
+
+	progressive := filepath.Join(dir, "progressive.mp4")
+	fragmented := filepath.Join(dir, "fragmented.mp4")
+	data := atomtest.Movie(ftyp, atomtest.Interleave(6, 3, "V", "A"), atomtest.MovieHeader(600, 3), atomtest.Trak(video), atomtest.Trak(audio))
+	assert.NoError(t, os.WriteFile(progressive, data, 0o644))
+	assert.NoError(t, fragment.Fragment(progressive, fragmented, fragment.Options{Duration: 0.2}))
+	return progressive, fragmented
+}
+
+// readMovie reads the movie atom, the tracks and the top level atom types of the file
+func readMovie(t *testing.T, path string) (*atoms.CompositeAtom, []*track.Track, []string, *os.File) {
+	tree, err := parser.ReadTree(path)
+	assert.NoError(t, err)
+	file, err := os.Open(path)
+	assert.NoError(t, err)
+	t.Cleanup(func() { file.Close() })
+	info, err := file.Stat()
+	assert.NoError(t, err)
+	tracks, err := parser.ReadTracks(tree, file, info.Size())
+	assert.NoError(t, err)
+	topLevelAtoms, err := parser.ReadTopLevelAtoms(file, info.Size())
+	assert.NoError(t, err)
+	var types []string
+	for _, atom := range topLevelAtoms {
+		types = append(types, atom.Type)
+	}
+	return tree.(*atoms.CompositeAtom).GetChild("moov").(*atoms.CompositeAtom), tracks, types, file
+}
+
+// TestDefragment tests that the fragments are merged into complete sample tables
+func TestDefragment(t *testing.T) {
+	dir := t.TempDir()
+	progressive, fragmented := writeFragmentedMovie(t, dir, nil)
+	_, original, _, _ := readMovie(t, progressive)
+
+	for _, fastStart := range []bool{false, true} {
+		output := filepath.Join(dir, fmt.Sprintf("output-%t.mp4", fastStart))
+		assert.NoError(t, Defragment(fragmented, output, fastStart))
+
+		moov, tracks, types, file := readMovie(t, output)
+		if fastStart {
+			assert.Equal(t, []string{"ftyp", "moov", "mdat"}, types)
+		} else {
+			assert.Equal(t, []string{"ftyp", "mdat", "moov"}, types)
+		}
+		assert.Nil(t, moov.GetChild("mvex"))
+		assert.Equal(t, uint64(600), moov.LeafData("mvhd").(*atoms.MvhdAtom).Duration)
+		assert.Len(t, tracks, 2)
+		for i, letter := range []string{"V", "A"} {
+			assert.Zero(t, tracks[i].Fragments)
+			assert.Equal(t, uint64(600), tracks[i].Duration)
+			assert.Equal(t, uint64(600), tracks[i].Atom.LeafData("tkhd").(*atoms.TkhdAtom).Duration)
+			assert.Len(t, tracks[i].Samples, 6)
+			for j, sample := range tracks[i].Samples {
+				expected := original[i].Samples[j]
+				expected.Offset = sample.Offset
+				assert.Equal(t, expected, sample)
+				data, err := tracks[i].ReadSample(file, j)
+				assert.NoError(t, err)
+				assert.Equal(t, fmt.Sprintf("%s%d..", letter, j), string(data))
+			}
+		}
+	}
+}
+
+// TestDefragmentProgressive tests that a progressive file is refused
+func TestDefragmentProgressive(t *testing.T) {
+	dir := t.TempDir()
+	progressive, _ := writeFragmentedMovie(t, dir, nil)
+	assert.Error(t, Defragment(progressive, filepath.Join(dir, "output.mp4"), true))
+}
+
+// TestDefragmentEditList tests that edits lasting until the end of the media get their duration
+func TestDefragmentEditList(t *testing.T) {
+	for _, test := range []struct {
+		name      string
+		mediaTime uint32
+		duration  uint64
+	}{
+		{name: "whole media", mediaTime: 0, duration: 600},
+		{name: "media offset", mediaTime: 100, duration: 500},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			dir := t.TempDir()
+			edts := atomtest.Build("edts", atomtest.Build("elst", atomtest.Uint32s(0, 1, 0, test.mediaTime, 0x10000)))
+			_, fragmented := writeFragmentedMovie(t, dir, edts)
+			output := filepath.Join(dir, "output.mp4")
+			assert.NoError(t, Defragment(fragmented, output, true))
+
+			moov, tracks, _, _ := readMovie(t, output)
+			elst, ok := tracks[0].Atom.LeafData("edts", "elst").(*atoms.ElstAtom)
+			if test.mediaTime == 0 {
+				assert.False(t, ok, "Expected the edit list covering the whole media to be removed")
+			} else {
+				assert.True(t, ok)
+				assert.Equal(t, []atoms.EditListEntry{{SegmentDuration: test.duration, MediaTime: int64(test.mediaTime), MediaRateInteger: 1}}, elst.Entries)
+			}
+			assert.Equal(t, test.duration, tracks[0].Atom.LeafData("tkhd").(*atoms.TkhdAtom).Duration)
+			assert.Equal(t, uint64(600), moov.LeafData("mvhd").(*atoms.MvhdAtom).Duration)
+		})
+	}
+}
+
+// TestProgressiveFileType tests that the brands of fragmented files are dropped from the 'ftyp' atom
+func TestProgressiveFileType(t *testing.T) {
+	assert.Equal(t, atomtest.FileType("isom", "mp41"), progressiveFileType(atomtest.Build("ftyp", []byte("iso6"), atomtest.Uint32s(0), []byte("iso6isommp41"))))
+	assert.Equal(t, atomtest.Build("ftyp", []byte("mp42"), atomtest.Uint32s(1), []byte("isommp42")),
+		progressiveFileType(atomtest.Build("ftyp", []byte("mp42"), atomtest.Uint32s(1), []byte("isomdashmp42cmfc"))))
+	assert.Equal(t, atomtest.FileType("isom"),
+		progressiveFileType(atomtest.Build("ftyp", []byte("msdh"), atomtest.Uint32s(0), []byte("msdhmsix"))))
+	assert.Nil(t, progressiveFileType(nil))
+}
@@ -0,0 +1,57 @@
+package extract
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/KrzysztofHeinke/quicktime-movie-parser/pkg/models/atoms"
+)
+
+// adtsHeaderSize is the size of an ADTS header without CRC
+const adtsHeaderSize = 7
+
+// maxADTSFrameSize is the largest frame, header included, the 13-bit ADTS frame length can describe
+const maxADTSFrameSize = 1<<13 - 1
+
+// adtsHeader builds the ADTS header of a raw AAC frame of the given size
+func adtsHeader(config *atoms.AudioSpecificConfig, frameSize int) ([]byte, error) {
+	if config.ObjectType < 1 || config.ObjectType > 4 {
+		return nil, fmt.Errorf("audio object type %d cannot be stored in ADTS", config.ObjectType)
+	}
+	if config.SamplingFrequencyIndex > 12 {
+		return nil, fmt.Errorf("explicit sampling frequency %d cannot be stored in ADTS", config.SamplingFrequency)
+	}
+	length := frameSize + adtsHeaderSize
+	if length > maxADTSFrameSize {
+		return nil, fmt.Errorf("AAC frame of %d bytes is too large for ADTS", frameSize)
+	}
+
+	profile := config.ObjectType - 1
+	channels := config.ChannelConfiguration
+	return []byte{
+		0xFF,
+		0xF1, // MPEG-4, layer 0, no CRC
+		profile<<6 | config.SamplingFrequencyIndex<<2 | channels>>2&0x01,
+		(channels&0x03)<<6 | byte(length>>11),
+		byte(length >> 3),
+		byte(length&0x07)<<5 | 0x1F, // Buffer fullness 0x7FF means variable bit rate
+		0xFC,
+	}, nil
+}
+
+// writeADTS writes the raw AAC frame preceded by its ADTS header
+func writeADTS(w io.Writer, frame []byte, audioSpecificConfig []byte) error {
+	config, err := atoms.ParseAudioSpecificConfig(audioSpecificConfig)
+	if err != nil {
+		return err
+	}
+	header, err := adtsHeader(config, len(frame))
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write(header); err != nil {
+		return err
+	}
+	_, err = w.Write(frame)
+	return err
+}
@@ -0,0 +1,49 @@
+package extract
+
+import (
+	"fmt"
+	"io"
+)
+
+// annexBStartCode precedes every NAL unit of an Annex-B byte stream
+var annexBStartCode = []byte{0, 0, 0, 1}
+
+// writeAnnexB converts a sample of length-prefixed NAL units to an Annex-B byte stream. The parameter
+// sets are written in front of sync samples so that decoding can start at any of them.
+func writeAnnexB(w io.Writer, sample []byte, lengthSize int, sync bool, parameterSets [][]byte) error {
+	if sync {
+		for _, unit := range parameterSets {
+			if err := writeNALUnit(w, unit); err != nil {
+				return err
+			}
+		}
+	}
+
+	for len(sample) > 0 {
+		if len(sample) < lengthSize {
+			return fmt.Errorf("truncated NAL unit length")
+		}
+		length := 0
+		for _, b := range sample[:lengthSize] {
+			length = length<<8 | int(b)
+		}
+		sample = sample[lengthSize:]
+		if length > len(sample) {
+			return fmt.Errorf("NAL unit of %d bytes exceeds the %d remaining bytes of the sample", length, len(sample))
+		}
+		if err := writeNALUnit(w, sample[:length]); err != nil {
+			return err
+		}
+		sample = sample[length:]
+	}
+	return nil
+}
+
+// writeNALUnit writes the NAL unit preceded by the start code
+func writeNALUnit(w io.Writer, unit []byte) error {
+	if _, err := w.Write(annexBStartCode); err != nil {
+		return err
+	}
+	_, err := w.Write(unit)
+	return err
+}
@@ -0,0 +1,130 @@
+package extract
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+
+	"github.com/KrzysztofHeinke/quicktime-movie-parser/internal/track"
+	"github.com/KrzysztofHeinke/quicktime-movie-parser/pkg/models/atoms"
+)
+
+// Output formats of extracted tracks
+const (
+	FormatH264 = "h264"
+	FormatHEVC = "hevc"
+	FormatADTS = "aac"
+	FormatWAV  = "wav"
+	FormatRaw  = "raw"
+)
+
+// Object type indications of AAC audio in the 'esds' decoder configuration
+var aacObjectTypes = map[uint8]bool{0x40: true, 0x66: true, 0x67: true, 0x68: true}
+
+// GetFormat returns the output format of the track, decided by its first sample description
+func GetFormat(t *track.Track) (string, error) {
+	if len(t.SampleDescriptions) == 0 {
+		return "", fmt.Errorf("track %d has no sample description", t.ID)
+	}
+	entry := &t.SampleDescriptions[0]
+	if entry.IsProtected() {
+		return "", fmt.Errorf("track %d is encrypted, decrypt the file first", t.ID)
+	}
+
+	switch entry.GetType() {
+	case "avc1", "avc3":
+		if _, ok := entry.GetExtension("avcC").(*atoms.AvcCAtom); ok {
+			return FormatH264, nil
+		}
+	case "hvc1", "hev1":
+		if _, ok := entry.GetExtension("hvcC").(*atoms.HvcCAtom); ok {
+			return FormatHEVC, nil
+		}
+	case "mp4a":
+		if esds, ok := entry.GetExtension("esds").(*atoms.EsdsAtom); ok && aacObjectTypes[esds.DecoderConfig.ObjectTypeIndication] {
+			return FormatADTS, nil
+		}
+	}
+	if _, err := getPCMFormat(entry); err == nil {
+		return FormatWAV, nil
+	}
+	return FormatRaw, nil
+}
+
+// Extension returns the file extension of the output format
+func Extension(format string) string {
+	switch format {
+	case FormatH264:
+		return "h264"
+	case FormatHEVC:
+		return "h265"
+	case FormatADTS:
+		return "aac"
+	case FormatWAV:
+		return "wav"
+	}
+	return "bin"
+}
+
+// Extract writes the samples of the track to w: H.264 and HEVC as Annex-B byte streams with the parameter
+// sets repeated at every sync sample, AAC with ADTS headers, PCM as a WAV file and anything else as the
+// concatenated raw samples. It returns the format written.
+func Extract(t *track.Track, r io.ReaderAt, w io.Writer) (string, error) {
+	format, err := GetFormat(t)
+	if err != nil {
+		return "", err
+	}
+	writer := bufio.NewWriter(w)
+
+	switch format {
+	case FormatWAV:
+		err = writeWAV(writer, t, r)
+	default:
+		err = writeSamples(writer, t, r, format)
+	}
+	if err != nil {
+		return "", err
+	}
+	return format, writer.Flush()
+}
+
+// writeSamples writes the samples one by one in the output format
+func writeSamples(w io.Writer, t *track.Track, r io.ReaderAt, format string) error {
+	for i, sample := range t.Samples {
+		data, err := t.ReadSample(r, i)
+		if err != nil {
+			return err
+		}
+		entry := t.GetSampleEntry(sample)
+		if entry == nil {
+			return fmt.Errorf("sample %d has no sample description", i+1)
+		}
+
+		switch format {
+		case FormatH264:
+			avcC, ok := entry.GetExtension("avcC").(*atoms.AvcCAtom)
+			if !ok {
+				return fmt.Errorf("sample %d: missing avcC atom", i+1)
+			}
+			err = writeAnnexB(w, data, avcC.LengthSize, sample.Sync, avcC.GetParameterSets())
+		case FormatHEVC:
+			hvcC, ok := entry.GetExtension("hvcC").(*atoms.HvcCAtom)
+			if !ok {
+				return fmt.Errorf("sample %d: missing hvcC atom", i+1)
+			}
+			err = writeAnnexB(w, data, hvcC.LengthSize, sample.Sync, hvcC.GetParameterSets())
+		case FormatADTS:
+			esds, ok := entry.GetExtension("esds").(*atoms.EsdsAtom)
+			if !ok {
+				return fmt.Errorf("sample %d: missing esds atom", i+1)
+			}
+			err = writeADTS(w, data, esds.DecoderConfig.DecoderSpecificInfo)
+		default:
+			_, err = w.Write(data)
+		}
+		if err != nil {
+			return fmt.Errorf("sample %d: %w", i+1, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,108 @@
+package extract
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+
+	"github.com/KrzysztofHeinke/quicktime-movie-parser/internal/track"
+	"github.com/KrzysztofHeinke/quicktime-movie-parser/pkg/models/atoms"
+	"github.com/stretchr/testify/assert"
+)
+
+// sampleEntry builds a sample entry of the given type whose extensions hold the decoded atoms
+func sampleEntry(entryType string, data []byte, extensions map[string]any) atoms.SampleEntry {
+	entry := atoms.SampleEntry{Data: data}
+	copy(entry.Type[:], entryType)
+	root := &atoms.CompositeAtom{}
+	for atomType, value := range extensions {
+		leaf := &atoms.LeafAtom{Data: value}
+		copy(leaf.Type[:], atomType)
+		root.AddChild(leaf)
+	}
+	entry.Extensions = root
+	return entry
+}
+
+// TestExtractH264 tests converting length-prefixed NAL units to Annex-B with parameter sets at sync samples
+func TestExtractH264(t *testing.T) {
+	avcC := &atoms.AvcCAtom{LengthSize: 4, SPS: [][]byte{{0x67, 0x01}}, PPS: [][]byte{{0x68, 0x02}}}
+	file := []byte{
+		0, 0, 0, 2, 0x65, 0xAA, 0, 0, 0, 1, 0x06, // IDR slice and SEI
+		0, 0, 0, 2, 0x41, 0xBB, // Non-IDR slice
+	}
+	videoTrack := &track.Track{
+		ID:                 1,
+		SampleDescriptions: []atoms.SampleEntry{sampleEntry("avc1", nil, map[string]any{"avcC": avcC})},
+		Samples: []track.Sample{
+			{Offset: 0, Size: 11, Sync: true, DescriptionIndex: 1},
+			{Offset: 11, Size: 6, DescriptionIndex: 1},
+		},
+	}
+
+	var output bytes.Buffer
+	format, err := Extract(videoTrack, bytes.NewReader(file), &output)
+	assert.NoError(t, err)
+	assert.Equal(t, FormatH264, format)
+	assert.Equal(t, []byte{
+		0, 0, 0, 1, 0x67, 0x01, 0, 0, 0, 1, 0x68, 0x02,
+		0, 0, 0, 1, 0x65, 0xAA, 0, 0, 0, 1, 0x06,
+		0, 0, 0, 1, 0x41, 0xBB,
+	}, output.Bytes())
+}
+
+// TestExtractADTS tests writing AAC frames with ADTS headers
+func TestExtractADTS(t *testing.T) {
+	esds := &atoms.EsdsAtom{DecoderConfig: atoms.DecoderConfig{ObjectTypeIndication: 0x40, DecoderSpecificInfo: []byte{0x12, 0x10}}}
+	audioTrack := &track.Track{
+		ID:                 2,
+		SampleDescriptions: []atoms.SampleEntry{sampleEntry("mp4a", make([]byte, 20), map[string]any{"esds": esds})},
+		Samples:            []track.Sample{{Offset: 0, Size: 3, DescriptionIndex: 1}},
+	}
+
+	var output bytes.Buffer
+	format, err := Extract(audioTrack, bytes.NewReader([]byte{0x21, 0x22, 0x23}), &output)
+	assert.NoError(t, err)
+	assert.Equal(t, FormatADTS, format)
+	assert.Equal(t, []byte{0xFF, 0xF1, 0x50, 0x80, 0x01, 0x5F, 0xFC, 0x21, 0x22, 0x23}, output.Bytes())
+}
+
+// TestExtractWAV tests converting big-endian QuickTime PCM stored one frame per sample into WAV
+func TestExtractWAV(t *testing.T) {
+	fields := make([]byte, 20)
+	binary.BigEndian.PutUint16(fields[8:], 2)   // Channels
+	binary.BigEndian.PutUint16(fields[10:], 16) // Sample size
+	binary.BigEndian.PutUint32(fields[16:], 48000<<16)
+	file := make([]byte, 104)
+	copy(file, []byte{0x00, 0x01, 0x00, 0x02, 0x00, 0x03, 0x00, 0x04})
+	copy(file[100:], []byte{0x00, 0x05, 0x00, 0x06})
+
+	audioTrack := &track.Track{
+		ID:                 3,
+		SampleDescriptions: []atoms.SampleEntry{sampleEntry("twos", fields, nil)},
+		Samples: []track.Sample{
+			{Offset: 0, Size: 1, DescriptionIndex: 1},
+			{Offset: 1, Size: 1, DescriptionIndex: 1},
+			{Offset: 100, Size: 1, DescriptionIndex: 1},
+		},
+	}
+
+	var output bytes.Buffer
+	format, err := Extract(audioTrack, bytes.NewReader(file), &output)
+	assert.NoError(t, err)
+	assert.Equal(t, FormatWAV, format)
+	wav := output.Bytes()
+	assert.Equal(t, "RIFF", string(wav[0:4]))
+	assert.Equal(t, uint32(48), binary.LittleEndian.Uint32(wav[4:8]))
+	assert.Equal(t, uint16(2), binary.LittleEndian.Uint16(wav[22:24]))
+	assert.Equal(t, uint32(48000), binary.LittleEndian.Uint32(wav[24:28]))
+	assert.Equal(t, []byte{0x01, 0x00, 0x02, 0x00, 0x03, 0x00, 0x04, 0x00, 0x05, 0x00, 0x06, 0x00}, wav[44:])
+}
+
+// TestGetFormatEncrypted tests that protected tracks are refused
+func TestGetFormatEncrypted(t *testing.T) {
+	frma := &atoms.FrmaAtom{DataFormat: [4]byte{'a', 'v', 'c', '1'}}
+	protected := &track.Track{ID: 1, SampleDescriptions: []atoms.SampleEntry{sampleEntry("encv", nil, map[string]any{"frma": frma})}}
+	_, err := GetFormat(protected)
+	assert.ErrorContains(t, err, "encrypted")
+}
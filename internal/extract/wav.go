@@ -0,0 +1,213 @@
+package extract
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+
+	"github.com/KrzysztofHeinke/quicktime-movie-parser/internal/track"
+	"github.com/KrzysztofHeinke/quicktime-movie-parser/pkg/models/atoms"
+)
+
+// WAV format tags
+const (
+	wavFormatPCM   = 1
+	wavFormatFloat = 3
+)
+
+// pcmFormat describes the layout of PCM samples
+type pcmFormat struct {
+	Channels      int
+	BitsPerSample int
+	SampleRate    int
+	Float         bool
+	BigEndian     bool
+	Unsigned      bool
+}
+
+// frameSize returns the number of bytes of one frame holding a sample of every channel
+func (f pcmFormat) frameSize() int {
+	return f.Channels * f.BitsPerSample / 8
+}
+
+// getPCMFormat returns the PCM layout of a sample entry or an error if it does not hold PCM audio
+func getPCMFormat(entry *atoms.SampleEntry) (pcmFormat, error) {
+	audio, err := atoms.ParseAudioSampleEntry(entry)
+	if err != nil {
+		return pcmFormat{}, err
+	}
+	format := pcmFormat{
+		Channels:      int(audio.ChannelCount),
+		BitsPerSample: int(audio.SampleSize),
+		SampleRate:    int(math.Round(audio.SampleRate)),
+		BigEndian:     true,
+	}
+	if enda, ok := entry.GetExtension("enda").(*atoms.EndaAtom); ok && enda.LittleEndian != 0 {
+		format.BigEndian = false
+	}
+
+	switch entry.GetType() {
+	case "sowt":
+		format.BigEndian = false
+	case "twos":
+	case "raw ":
+		format.Unsigned = true
+	case "in24":
+		format.BitsPerSample = 24
+	case "in32":
+		format.BitsPerSample = 32
+	case "fl32":
+		format.BitsPerSample, format.Float = 32, true
+	case "fl64":
+		format.BitsPerSample, format.Float = 64, true
+	case "lpcm":
+		if audio.Version != 2 {
+			return pcmFormat{}, fmt.Errorf("lpcm sample entry of version %d", audio.Version)
+		}
+		format.Float = audio.FormatFlags&atoms.LPCMFlagIsFloat != 0
+		format.BigEndian = audio.FormatFlags&atoms.LPCMFlagIsBigEndian != 0
+		format.Unsigned = !format.Float && audio.FormatFlags&atoms.LPCMFlagIsSigned == 0
+	case "ipcm", "fpcm":
+		pcmC, ok := entry.GetExtension("pcmC").(*atoms.PcmCAtom)
+		if !ok {
+			return pcmFormat{}, fmt.Errorf("missing pcmC atom")
+		}
+		format.BitsPerSample = int(pcmC.SampleSize)
+		format.BigEndian = !pcmC.IsLittleEndian()
+		format.Float = entry.GetType() == "fpcm"
+	default:
+		return pcmFormat{}, fmt.Errorf("sample entry %s is not PCM", entry.GetType())
+	}
+
+	if format.Channels == 0 || format.BitsPerSample == 0 || format.BitsPerSample%8 != 0 || format.SampleRate == 0 {
+		return pcmFormat{}, fmt.Errorf("unsupported PCM layout: %d channels of %d bits at %d Hz",
+			format.Channels, format.BitsPerSample, format.SampleRate)
+	}
+	return format, nil
+}
+
+// pcmRanges returns the byte ranges of the PCM data of the track, merging adjacent samples. Classic
+// QuickTime sound tracks declare a sample size of 1 with one sample per audio frame, in which case the
+// positions are rescaled to whole frames within each chunk.
+func pcmRanges(t *track.Track, frameSize int) [][2]uint64 {
+	var ranges [][2]uint64
+	var chunkStart, frameInChunk uint64
+	for i, sample := range t.Samples {
+		offset, size := sample.Offset, uint64(sample.Size)
+		if size == 1 && frameSize > 1 {
+			if i == 0 || sample.Offset != t.Samples[i-1].Offset+1 {
+				chunkStart, frameInChunk = sample.Offset, 0
+			}
+			offset, size = chunkStart+frameInChunk*uint64(frameSize), uint64(frameSize)
+			frameInChunk++
+		}
+
+		if n := len(ranges); n > 0 && ranges[n-1][1] == offset {
+			ranges[n-1][1] += size
+		} else {
+			ranges = append(ranges, [2]uint64{offset, offset + size})
+		}
+	}
+	return ranges
+}
+
+// writeWAV writes the PCM samples of the track as a WAV file converted to little-endian byte order
+func writeWAV(w io.Writer, t *track.Track, r io.ReaderAt) error {
+	format, err := getPCMFormat(&t.SampleDescriptions[0])
+	if err != nil {
+		return err
+	}
+	ranges := pcmRanges(t, format.frameSize())
+	var dataSize uint64
+	for _, byteRange := range ranges {
+		dataSize += byteRange[1] - byteRange[0]
+	}
+	if dataSize+36 > math.MaxUint32 {
+		return fmt.Errorf("PCM data of %d bytes is too large for WAV", dataSize)
+	}
+	if err := writeWAVHeader(w, format, uint32(dataSize)); err != nil {
+		return err
+	}
+
+	bytesPerSample := format.BitsPerSample / 8
+	buffer := make([]byte, 0, 1<<20)
+	for _, byteRange := range ranges {
+		for offset := byteRange[0]; offset < byteRange[1]; {
+			size := min(uint64(cap(buffer)), byteRange[1]-offset)
+			size -= size % uint64(bytesPerSample)
+			if size == 0 {
+				size = byteRange[1] - offset
+			}
+			data := buffer[:size]
+			if _, err := r.ReadAt(data, int64(offset)); err != nil {
+				return fmt.Errorf("failed to read PCM data at offset %d: %w", offset, err)
+			}
+			convertPCM(data, format)
+			if _, err := w.Write(data); err != nil {
+				return err
+			}
+			offset += size
+		}
+	}
+	if dataSize%2 == 1 {
+		_, err = w.Write([]byte{0})
+	}
+	return err
+}
+
+// convertPCM converts samples in place to the little-endian layout of WAV, where 8-bit samples are unsigned
+func convertPCM(data []byte, format pcmFormat) {
+	bytesPerSample := format.BitsPerSample / 8
+	if format.BigEndian && bytesPerSample > 1 {
+		for i := 0; i+bytesPerSample <= len(data); i += bytesPerSample {
+			sample := data[i : i+bytesPerSample]
+			for a, b := 0, len(sample)-1; a < b; a, b = a+1, b-1 {
+				sample[a], sample[b] = sample[b], sample[a]
+			}
+		}
+	}
+	if bytesPerSample == 1 && !format.Unsigned {
+		for i := range data {
+			data[i] ^= 0x80
+		}
+	}
+}
+
+// writeWAVHeader writes the RIFF header, the format chunk and the data chunk header
+func writeWAVHeader(w io.Writer, format pcmFormat, dataSize uint32) error {
+	formatTag := uint16(wavFormatPCM)
+	if format.Float {
+		formatTag = wavFormatFloat
+	}
+	header := struct {
+		RIFF          [4]byte
+		RIFFSize      uint32
+		WAVE          [4]byte
+		Fmt           [4]byte
+		FmtSize       uint32
+		FormatTag     uint16
+		Channels      uint16
+		SampleRate    uint32
+		ByteRate      uint32
+		BlockAlign    uint16
+		BitsPerSample uint16
+		Data          [4]byte
+		DataSize      uint32
+	}{
+		RIFF:          [4]byte{'R', 'I', 'F', 'F'},
+		RIFFSize:      36 + dataSize + dataSize%2,
+		WAVE:          [4]byte{'W', 'A', 'V', 'E'},
+		Fmt:           [4]byte{'f', 'm', 't', ' '},
+		FmtSize:       16,
+		FormatTag:     formatTag,
+		Channels:      uint16(format.Channels),
+		SampleRate:    uint32(format.SampleRate),
+		ByteRate:      uint32(format.SampleRate * format.frameSize()),
+		BlockAlign:    uint16(format.frameSize()),
+		BitsPerSample: uint16(format.BitsPerSample),
+		Data:          [4]byte{'d', 'a', 't', 'a'},
+		DataSize:      dataSize,
+	}
+	return binary.Write(w, binary.LittleEndian, header)
+}
@@ -0,0 +1,86 @@
+package factory
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/KrzysztofHeinke/quicktime-movie-parser/internal/atomtest"
+	"github.com/KrzysztofHeinke/quicktime-movie-parser/pkg/models/atoms"
+	"github.com/stretchr/testify/assert"
+)
+
+// decode runs the decoder of the atom type on the payload and checks that what it decoded is encoded
+// without error and decodes to the same value again
+func decode(t *testing.T, atomType, parentType string, payload []byte) {
+	header := atoms.AtomHeader{Size: uint32(len(payload) + 8)}
+	copy(header.Type[:], atomType)
+	data, err := AtomFactory(header, parentType, bytes.NewReader(payload))
+	if err != nil || data == nil {
+		return
+	}
+
+	var encoded []byte
+	if encoder, ok := data.(atoms.Encoder); ok {
+		encoded, err = encoder.Encode()
+	} else {
+		encoded, err = atoms.EncodeFixedAtom(data)
+	}
+	if !assert.NoError(t, err, "Expected the decoded '%s' atom to be encoded", atomType) {
+		return
+	}
+	header.Size = uint32(len(encoded) + 8)
+	decoded, err := AtomFactory(header, parentType, bytes.NewReader(encoded))
+	assert.NoError(t, err, "Expected the encoded '%s' atom to be decoded", atomType)
+	assert.Equal(t, data, decoded, "Expected the '%s' atom to decode to the same value once encoded", atomType)
+}
+
+// TestAtomFactoryUserDataText tests that '©' atoms are only decoded as text inside 'udta' atoms and that
+// those which are not text are kept raw
+func TestAtomFactoryUserDataText(t *testing.T) {
+	header := atoms.AtomHeader{Type: [4]byte{0xA9, 'n', 'a', 'm'}}
+	text := []byte{0, 5, 0x55, 0xC4, 't', 'i', 't', 'l', 'e'}
+
+	data, err := AtomFactory(header, "udta", bytes.NewReader(text))
+	assert.NoError(t, err)
+	assert.Equal(t, "title", data.(*atoms.UserDataTextAtom).GetText())
+
+	data, err = AtomFactory(header, "moov", bytes.NewReader(text))
+	assert.NoError(t, err)
+	assert.Nil(t, data)
+
+	data, err = AtomFactory(header, "udta", bytes.NewReader([]byte{0, 9, 0x55, 0xC4, 't'}))
+	assert.NoError(t, err)
+	assert.Nil(t, data)
+}
+
+// FuzzAtomFactory tests that no atom decoder panics, whatever the payload, and that what they decode
+// survives encoding. Every input is decoded as each of the types, as a track reference and as QuickTime
+// user data text.
+func FuzzAtomFactory(f *testing.F) {
+	atomtest.SetFuzzLimits(f)
+
+	f.Add([]byte{})
+	f.Add(make([]byte, 100))
+	// Table of one entry
+	f.Add(atomtest.Uint32s(0, 1, 1, 4, 1))
+	// Version 1 atom, segment index of two references
+	f.Add(atomtest.Uint32s(0x01000000, 2, 1000, 0, 0, 2, 40, 1000, 0, 50, 1000, 0))
+	// Track run with every sample field
+	f.Add(atomtest.Uint32s(0x00000F01, 3, 0, 10, 0x10000, 20, 0, 0, 30, 0x10000, 0, 40, 0, 0, 50))
+	// AVC decoder configuration with one sequence and one picture parameter set
+	f.Add(append([]byte{1, 0x64, 0, 0x1F, 0xFF, 0xE1, 0, 4, 0x67, 0x64, 0, 0x1F, 1, 0, 2, 0x68, 0xEB}, 0))
+	// Metadata key table with one key
+	f.Add(append(atomtest.Uint32s(0, 1), []byte("\x00\x00\x00\x0Amdta\x00\x01")...))
+	// User data text
+	f.Add([]byte{0, 5, 0x55, 0xC4, 't', 'i', 't', 'l', 'e'})
+
+	f.Fuzz(func(t *testing.T, payload []byte) {
+		atomtest.CheckAllocation(t, func() {
+			for _, atomType := range DecodedTypes() {
+				decode(t, atomType, "", payload)
+			}
+			decode(t, "chap", "tref", payload)
+			decode(t, "\xa9nam", "udta", payload)
+		})
+	})
+}
@@ -2,53 +2,113 @@ package factory
 
 import (
 	"bytes"
-	"encoding/binary"
+	"io"
+	"slices"
 
 	"github.com/KrzysztofHeinke/quicktime-movie-parser/pkg/models/atoms"
 	"github.com/sirupsen/logrus"
 )
 
-func AtomFactory(header atoms.AtomHeader, reader *bytes.Reader) (any, error) {
-	switch header.GetType() {
-	case "moov":
-	case "mvhd":
-	case "clip":
-	case "crgn":
-	case "udta":
-	case "tkhd":
-		result := &atoms.TkhdAtom{}
-		CastToStruct(reader, result)
-		return result, nil
-	case "matt":
-	case "kmat":
-	case "edts":
-	case "trak":
-	case "mdhd":
-		result := &atoms.MdhdAtom{}
-		CastToStruct(reader, result)
-		return result, nil
-	case "hdlr":
-	case "minf":
-	case "elst":
-	case "vmhd":
-	case "dref":
-	case "stts":
-	case "stss":
-	case "stsd":
-		return atoms.ParseStsdAtom(reader)
-	case "stsz":
-	case "stsc":
-	case "stco":
-	default:
+// decoders decode the payload of the leaf atom types known to AtomFactory, the other atoms are kept raw
+var decoders = map[string]func(*bytes.Reader) (any, error){
+	"mvhd": decodeWith(atoms.ParseMvhdAtom),
+	"chpl": decodeWith(atoms.ParseChplAtom),
+	"tkhd": decodeWith(atoms.ParseTkhdAtom),
+	"mdhd": decodeWith(atoms.ParseMdhdAtom),
+	"elng": decodeWith(atoms.ParseElngAtom),
+	"hdlr": decodeWith(atoms.ParseHdlrAtom),
+	"keys": decodeWith(atoms.ParseKeysAtom),
+	"data": decodeWith(atoms.ParseDataAtom),
+	"elst": decodeWith(atoms.ParseElstAtom),
+	"stts": decodeWith(atoms.ParseSttsAtom),
+	"ctts": decodeWith(atoms.ParseCttsAtom),
+	"stss": decodeWith(atoms.ParseStssAtom),
+	"stsd": decodeWith(atoms.ParseStsdAtom),
+	"pasp": decodeWith(atoms.ParseFixedAtom[atoms.PaspAtom]),
+	"clap": decodeWith(atoms.ParseFixedAtom[atoms.ClapAtom]),
+	"fiel": decodeWith(atoms.ParseFixedAtom[atoms.FielAtom]),
+	"gama": decodeWith(atoms.ParseFixedAtom[atoms.GamaAtom]),
+	"clef": decodeWith(atoms.ParseFixedAtom[atoms.TrackApertureDimensionsAtom]),
+	"prof": decodeWith(atoms.ParseFixedAtom[atoms.TrackApertureDimensionsAtom]),
+	"enof": decodeWith(atoms.ParseFixedAtom[atoms.TrackApertureDimensionsAtom]),
+	"colr": decodeWith(atoms.ParseColrAtom),
+	"mdcv": decodeWith(atoms.ParseFixedAtom[atoms.MdcvAtom]),
+	"clli": decodeWith(atoms.ParseFixedAtom[atoms.ClliAtom]),
+	"amve": decodeWith(atoms.ParseFixedAtom[atoms.AmveAtom]),
+	"dvcC": decodeWith(atoms.ParseDoviConfigAtom),
+	"dvvC": decodeWith(atoms.ParseDoviConfigAtom),
+	"dvwC": decodeWith(atoms.ParseDoviConfigAtom),
+	"vttC": decodeWith(atoms.ParseStringAtom),
+	"vlab": decodeWith(atoms.ParseStringAtom),
+	"mehd": decodeWith(atoms.ParseMehdAtom),
+	"trex": decodeWith(atoms.ParseFixedAtom[atoms.TrexAtom]),
+	"mfhd": decodeWith(atoms.ParseFixedAtom[atoms.MfhdAtom]),
+	"tfhd": decodeWith(atoms.ParseTfhdAtom),
+	"tfdt": decodeWith(atoms.ParseTfdtAtom),
+	"trun": decodeWith(atoms.ParseTrunAtom),
+	"sidx": decodeWith(atoms.ParseSidxAtom),
+	"ssix": decodeWith(atoms.ParseSsixAtom),
+	"tfra": decodeWith(atoms.ParseTfraAtom),
+	"mfro": decodeWith(atoms.ParseFixedAtom[atoms.MfroAtom]),
+	"frma": decodeWith(atoms.ParseFixedAtom[atoms.FrmaAtom]),
+	"schm": decodeWith(atoms.ParseSchmAtom),
+	"tenc": decodeWith(atoms.ParseTencAtom),
+	"pssh": decodeWith(atoms.ParsePsshAtom),
+	"senc": decodeWith(atoms.ParseSencAtom),
+	"saiz": decodeWith(atoms.ParseSaizAtom),
+	"saio": decodeWith(atoms.ParseSaioAtom),
+	"avcC": decodeWith(atoms.ParseAvcCAtom),
+	"hvcC": decodeWith(atoms.ParseHvcCAtom),
+	"esds": decodeWith(atoms.ParseEsdsAtom),
+	"enda": decodeWith(atoms.ParseFixedAtom[atoms.EndaAtom]),
+	"pcmC": decodeWith(atoms.ParseFixedAtom[atoms.PcmCAtom]),
+	"stsz": decodeWith(atoms.ParseStszAtom),
+	"stsc": decodeWith(atoms.ParseStscAtom),
+	"stco": decodeChunkOffsets(false),
+	"co64": decodeChunkOffsets(true),
+}
 
+// AtomFactory decodes the payload of a leaf atom. The parent type is needed for atoms whose
+// meaning depends on where they are found, like the track reference types inside 'tref'.
+func AtomFactory(header atoms.AtomHeader, parentType string, reader *bytes.Reader) (any, error) {
+	if parentType == "tref" {
+		return atoms.ParseTrackReferenceAtom(reader)
+	}
+	if parentType == "udta" && atoms.IsUserDataTextType(header.Type) {
+		// Some writers store other data under '©' types, such atoms are kept raw
+		text, err := atoms.ParseUserDataTextAtom(reader)
+		if err != nil {
+			logrus.Debugf("Keeping %s atom raw: %v", header.GetType(), err)
+			return nil, nil
+		}
+		return text, nil
+	}
+	if decode, ok := decoders[header.GetType()]; ok {
+		return decode(reader)
 	}
 	return nil, nil
 }
 
-func CastToStruct(reader *bytes.Reader, structToCast any) any {
-	err := binary.Read(reader, binary.BigEndian, structToCast)
-	if err != nil {
-		logrus.Fatalf("Failed to read binary data into struct: %v", err)
+// DecodedTypes returns the leaf atom types AtomFactory decodes, sorted
+func DecodedTypes() []string {
+	types := make([]string, 0, len(decoders))
+	for atomType := range decoders {
+		types = append(types, atomType)
+	}
+	slices.Sort(types)
+	return types
+}
+
+// decodeWith adapts a parser of one atom type to the decoders table
+func decodeWith[T any](parse func(io.Reader) (*T, error)) func(*bytes.Reader) (any, error) {
+	return func(reader *bytes.Reader) (any, error) {
+		return parse(reader)
+	}
+}
+
+// decodeChunkOffsets returns the decoder of the 'stco' atom, or of the 'co64' atom when large
+func decodeChunkOffsets(large bool) func(*bytes.Reader) (any, error) {
+	return func(reader *bytes.Reader) (any, error) {
+		return atoms.ParseChunkOffsetAtom(reader, large)
 	}
-	return structToCast
 }
@@ -0,0 +1,112 @@
+package faststart
+
+import (
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/KrzysztofHeinke/quicktime-movie-parser/internal/parser"
+	"github.com/KrzysztofHeinke/quicktime-movie-parser/internal/writer"
+	"github.com/KrzysztofHeinke/quicktime-movie-parser/pkg/models/atoms"
+)
+
+// IsFastStart tells whether the 'moov' atom comes before the first 'mdat' atom
+func IsFastStart(topLevelAtoms []parser.TopLevelAtom) bool {
+	for _, atom := range topLevelAtoms {
+		switch atom.Type {
+		case "moov":
+			return true
+		case "mdat":
+			return false
+		}
+	}
+	return false
+}
+
+// FastStart writes a copy of the input with the 'moov' atom moved in front of the first 'mdat' atom
+// and every chunk offset shifted accordingly. The other atoms are streamed from the input unchanged.
+// It returns true if the input already was fast-start, in which case it is copied as it is.
+func FastStart(input, output string) (bool, error) {
+	if err := writer.CheckDistinctFiles(input, output); err != nil {
+		return false, err
+	}
+	file, err := os.Open(input)
+	if err != nil {
+		return false, err
+	}
+	defer file.Close()
+	info, err := file.Stat()
+	if err != nil {
+		return false, err
+	}
+	topLevelAtoms, err := parser.ReadTopLevelAtoms(file, info.Size())
+	if err != nil {
+		return false, err
+	}
+	moovAtom, ok := parser.FindTopLevelAtom(topLevelAtoms, "moov")
+	if !ok {
+		return false, fmt.Errorf("moov atom not found")
+	}
+
+	if IsFastStart(topLevelAtoms) {
+		return true, copyFile(output, file)
+	}
+	if _, ok := parser.FindTopLevelAtom(topLevelAtoms, "moof"); ok {
+		return false, fmt.Errorf("moving the moov atom of a fragmented file is not supported")
+	}
+
+	tree, err := parser.ReadTree(input)
+	if err != nil {
+		return false, err
+	}
+	moov, ok := tree.(*atoms.CompositeAtom).GetChild("moov").(*atoms.CompositeAtom)
+	if !ok {
+		return false, fmt.Errorf("moov atom could not be parsed")
+	}
+	order := fastStartOrder(topLevelAtoms)
+	moovData, err := writer.RelocateMovie(moov, topLevelAtoms, writer.OrderedLayout(topLevelAtoms, order), moovAtom.Size)
+	if err != nil {
+		return false, err
+	}
+	return false, writeFile(output, file, topLevelAtoms, order, moovData)
+}
+
+// fastStartOrder returns the indexes of the top level atoms with the 'moov' atom moved in front of the
+// first 'mdat' atom
+func fastStartOrder(topLevelAtoms []parser.TopLevelAtom) []int {
+	var order []int
+	moovIndex := -1
+	for i, atom := range topLevelAtoms {
+		if atom.Type == "moov" && moovIndex < 0 {
+			moovIndex = i
+		}
+	}
+	moved := false
+	for i, atom := range topLevelAtoms {
+		if atom.Type == "mdat" && !moved {
+			order = append(order, moovIndex)
+			moved = true
+		}
+		if i != moovIndex {
+			order = append(order, i)
+		}
+	}
+	return order
+}
+
+// writeFile writes the top level atoms of the input to the output in the given order
+func writeFile(output string, input io.ReaderAt, topLevelAtoms []parser.TopLevelAtom, order []int, moovData []byte) error {
+	return writer.ReplaceFile(output, writer.OutputPerm, func(destination *os.File) error {
+		return writer.WriteAtoms(destination, input, topLevelAtoms, order, moovData)
+	})
+}
+
+// copyFile writes an unchanged copy of the input to the output
+func copyFile(output string, input io.Reader) error {
+	return writer.ReplaceFile(output, writer.OutputPerm, func(destination *os.File) error {
+		if _, err := io.Copy(destination, input); err != nil {
+			return fmt.Errorf("failed to copy file: %w", err)
+		}
+		return nil
+	})
+}
@@ -0,0 +1,104 @@
+package faststart
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/KrzysztofHeinke/quicktime-movie-parser/internal/atomtest"
+	"github.com/KrzysztofHeinke/quicktime-movie-parser/internal/parser"
+	"github.com/KrzysztofHeinke/quicktime-movie-parser/internal/writer"
+	"github.com/KrzysztofHeinke/quicktime-movie-parser/pkg/models/atoms"
+	"github.com/stretchr/testify/assert"
+)
+
+// testMovie builds a 'moov' atom with one track whose chunks start at the given offsets
+func testMovie(chunkOffsets ...uint32) []byte {
+	stbl := atomtest.Build("stbl",
+		atomtest.Build("stts", atomtest.Uint32s(0, 1, uint32(len(chunkOffsets)), 1)),
+		atomtest.Build("stsc", atomtest.Uint32s(0, 1, 1, 1, 1)),
+		atomtest.Build("stsz", atomtest.Uint32s(0, 4, uint32(len(chunkOffsets)))),
+		atomtest.Build("stco", atomtest.Uint32s(0, uint32(len(chunkOffsets))), atomtest.Uint32s(chunkOffsets...)),
+	)
+	return atomtest.Build("moov", atomtest.Build("trak", atomtest.Build("mdia", atomtest.Build("minf", stbl))))
+}
+
+// chunkOffsets returns the chunk offsets of the first track of the file
+func chunkOffsets(t *testing.T, path string) []uint64 {
+	tree, err := parser.ReadTree(path)
+	assert.NoError(t, err)
+	stbl := tree.(*atoms.CompositeAtom).Find("moov", "trak", "mdia", "minf", "stbl").(*atoms.CompositeAtom)
+	for _, atomType := range []string{"stco", "co64"} {
+		if data, ok := stbl.LeafData(atomType).(*atoms.ChunkOffsetAtom); ok {
+			return data.Offsets
+		}
+	}
+	return nil
+}
+
+// TestFastStart tests that 'moov' is moved in front of 'mdat' and the chunks still point at their samples
+func TestFastStart(t *testing.T) {
+	ftyp := atomtest.FileType("isom", "mp41")
+	mdat := atomtest.Build("mdat", []byte("AAAABBBB"))
+	offset := uint32(len(ftyp) + 8)
+	data := bytes.Join([][]byte{ftyp, mdat, testMovie(offset, offset+4)}, nil)
+
+	dir := t.TempDir()
+	input := filepath.Join(dir, "input.mov")
+	output := filepath.Join(dir, "output.mov")
+	assert.NoError(t, os.WriteFile(input, data, 0o644))
+
+	alreadyFastStart, err := FastStart(input, output)
+	assert.NoError(t, err)
+	assert.False(t, alreadyFastStart)
+
+	result, err := os.ReadFile(output)
+	assert.NoError(t, err)
+	assert.Equal(t, len(data), len(result))
+	topLevelAtoms, err := parser.ReadTopLevelAtoms(bytes.NewReader(result), int64(len(result)))
+	assert.NoError(t, err)
+	assert.True(t, IsFastStart(topLevelAtoms))
+
+	offsets := chunkOffsets(t, output)
+	assert.Len(t, offsets, 2)
+	assert.Equal(t, []byte("AAAA"), result[offsets[0]:offsets[0]+4])
+	assert.Equal(t, []byte("BBBB"), result[offsets[1]:offsets[1]+4])
+
+	alreadyFastStart, err = FastStart(output, filepath.Join(dir, "again.mov"))
+	assert.NoError(t, err)
+	assert.True(t, alreadyFastStart)
+	again, err := os.ReadFile(filepath.Join(dir, "again.mov"))
+	assert.NoError(t, err)
+	assert.Equal(t, result, again)
+
+	_, err = FastStart(input, input)
+	assert.Error(t, err)
+}
+
+// TestRelocateMovieUpgradesToCo64 tests that offsets pushed past 4 GiB turn 'stco' into 'co64'
+func TestRelocateMovieUpgradesToCo64(t *testing.T) {
+	moovData := testMovie(16, 0xFFFFFFF0)
+	tree, err := parser.CreateTreeOfAtoms(bytes.NewReader(moovData))
+	assert.NoError(t, err)
+	moov := parser.CleanEmptyHeaders(tree).(*atoms.CompositeAtom).GetChild("moov").(*atoms.CompositeAtom)
+
+	topLevelAtoms := []parser.TopLevelAtom{
+		{Type: "mdat", Offset: 8, Size: 0xFFFFFFF8, HeaderSize: 8},
+		{Type: "moov", Offset: 0x100000000, Size: int64(len(moovData)), HeaderSize: 8},
+	}
+	order := fastStartOrder(topLevelAtoms)
+	assert.Equal(t, []int{1, 0}, order)
+	result, err := writer.RelocateMovie(moov, topLevelAtoms, writer.OrderedLayout(topLevelAtoms, order), int64(len(moovData)))
+	assert.NoError(t, err)
+	// Each of the two entries takes 4 more bytes once stored on 64 bits
+	assert.Equal(t, len(moovData)+8, len(result))
+
+	relocated, err := parser.CreateTreeOfAtoms(bytes.NewReader(result))
+	assert.NoError(t, err)
+	stbl := parser.CleanEmptyHeaders(relocated).(*atoms.CompositeAtom).Find("moov", "trak", "mdia", "minf", "stbl").(*atoms.CompositeAtom)
+	co64, ok := stbl.LeafData("co64").(*atoms.ChunkOffsetAtom)
+	assert.True(t, ok)
+	shift := uint64(len(result)) - 8
+	assert.Equal(t, []uint64{16 + shift, 0xFFFFFFF0 + shift}, co64.Offsets)
+}
@@ -0,0 +1,258 @@
+package fragment
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+
+	"github.com/KrzysztofHeinke/quicktime-movie-parser/internal/parser"
+	"github.com/KrzysztofHeinke/quicktime-movie-parser/internal/track"
+	"github.com/KrzysztofHeinke/quicktime-movie-parser/internal/writer"
+	"github.com/KrzysztofHeinke/quicktime-movie-parser/pkg/models/atoms"
+	"github.com/sirupsen/logrus"
+)
+
+// DefaultDuration is the default target duration of a fragment in seconds
+const DefaultDuration = 2.0
+
+// InitSegmentName is the name of the initialization segment written in segment mode
+const InitSegmentName = "init.mp4"
+
+// Options configures how a movie is fragmented
+type Options struct {
+	// Duration is the target duration of a fragment in seconds
+	Duration float64
+	// SegmentIndex adds a 'sidx' atom indexing the fragments
+	SegmentIndex bool
+	// Segments writes an initialization segment and one media segment per fragment to the output
+	// directory instead of a single file
+	Segments bool
+}
+
+// SegmentName returns the file name of the media segment with the given number, counted from 1
+func SegmentName(number int) string {
+	return fmt.Sprintf("segment-%d.m4s", number)
+}
+
+// Fragment converts a progressive movie to a fragmented one. The output starts with an 'ftyp' and a
+// 'moov' atom whose sample tables are empty and whose 'mvex' atom holds the 'trex' defaults of every
+// track, followed by 'moof' and 'mdat' pairs cut at the sync samples of the first video track.
+func Fragment(input, output string, options Options) error {
+	if options.Duration <= 0 {
+		return fmt.Errorf("invalid fragment duration %gs", options.Duration)
+	}
+	if !options.Segments {
+		if err := writer.CheckDistinctFiles(input, output); err != nil {
+			return err
+		}
+	}
+	file, err := os.Open(input)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	info, err := file.Stat()
+	if err != nil {
+		return err
+	}
+
+	tree, err := parser.ReadTree(input)
+	if err != nil {
+		return err
+	}
+	moov, ok := tree.(*atoms.CompositeAtom).GetChild("moov").(*atoms.CompositeAtom)
+	if !ok {
+		return fmt.Errorf("moov atom could not be parsed")
+	}
+	if moov.GetChild("mvex") != nil {
+		return fmt.Errorf("the file already is fragmented")
+	}
+	tracks, err := parser.ReadTracks(tree, file, info.Size())
+	if err != nil {
+		return err
+	}
+	var media []*track.Track
+	for _, t := range tracks {
+		if len(t.Samples) > 0 {
+			media = append(media, t)
+		}
+	}
+	if len(media) == 0 {
+		return fmt.Errorf("the file has no samples")
+	}
+
+	reference := referenceTrack(media)
+	fragments := splitFragments(media, reference, options.Duration)
+	for i, f := range fragments {
+		if err := f.build(uint32(i + 1)); err != nil {
+			return err
+		}
+	}
+	logrus.Debugf("Cut %d fragments at the sync samples of track %d", len(fragments), reference.ID)
+	initData, err := initSegment(moov, tracks)
+	if err != nil {
+		return err
+	}
+
+	if options.Segments {
+		return writeSegments(output, file, initData, fragments, reference, options.SegmentIndex)
+	}
+	var index []byte
+	if options.SegmentIndex {
+		if index, err = segmentIndex(fragments, reference); err != nil {
+			return err
+		}
+	}
+	return writeFile(output, file, [][]byte{initData, index}, fragments)
+}
+
+// referenceTrack returns the first video track, or the first track if there is none
+func referenceTrack(tracks []*track.Track) *track.Track {
+	for _, t := range tracks {
+		if t.HandlerType == "vide" {
+			return t
+		}
+	}
+	return tracks[0]
+}
+
+// initSegment turns the movie into the 'moov' atom of a fragmented movie and returns it behind a new
+// 'ftyp' atom. The sample tables are emptied, the durations moved to the 'mehd' atom. The fragments
+// hold every track in one 'moof' atom, so the file does not claim the CMAF 'cmfc' brand.
+func initSegment(moov *atoms.CompositeAtom, tracks []*track.Track) ([]byte, error) {
+	mvex := atoms.NewCompositeAtom("mvex")
+	if mvhdLeaf, ok := moov.GetChild("mvhd").(*atoms.LeafAtom); ok {
+		if mvhd, ok := mvhdLeaf.Data.(*atoms.MvhdAtom); ok {
+			mehd := &atoms.MehdAtom{FragmentDuration: mvhd.Duration}
+			if mehd.FragmentDuration > math.MaxUint32 {
+				mehd.Version = 1
+			}
+			mvex.AddChild(atoms.NewLeafAtom("mehd", mehd))
+			mvhd.Duration = 0
+			mvhdLeaf.SetData(mvhd)
+		}
+	}
+	for _, t := range tracks {
+		if stbl, ok := t.Atom.Find("mdia", "minf", "stbl").(*atoms.CompositeAtom); ok {
+			track.ReplaceSampleTables(stbl, track.BuildSampleTables(nil, nil))
+		}
+		if mdhd, ok := t.Atom.Find("mdia", "mdhd").(*atoms.LeafAtom); ok {
+			if data, ok := mdhd.Data.(*atoms.MdhdAtom); ok {
+				data.Duration = 0
+				mdhd.SetData(data)
+			}
+		}
+		if tkhd, ok := t.Atom.GetChild("tkhd").(*atoms.LeafAtom); ok {
+			if data, ok := tkhd.Data.(*atoms.TkhdAtom); ok {
+				data.Duration = 0
+				tkhd.SetData(data)
+			}
+		}
+		mvex.AddChild(atoms.NewLeafAtom("trex", &atoms.TrexAtom{TrackID: t.ID, DefaultSampleDescriptionIndex: 1}))
+	}
+	moov.AddChild(mvex)
+
+	moovData, err := writer.Marshal(moov)
+	if err != nil {
+		return nil, err
+	}
+	return append(writer.FileTypeAtom("ftyp", "iso6", 0, "iso6", "isom", "mp41"), moovData...), nil
+}
+
+// segmentIndex returns the 'sidx' atom indexing the fragments by the samples of the reference track.
+// The fragments are expected to follow the atom directly.
+func segmentIndex(fragments []*fragment, reference *track.Track) ([]byte, error) {
+	if len(fragments) > math.MaxUint16 {
+		return nil, fmt.Errorf("%d fragments do not fit a segment index", len(fragments))
+	}
+	sidx := &atoms.SidxAtom{ReferenceID: reference.ID, TimeScale: reference.TimeScale}
+	for i, f := range fragments {
+		samples := f.referenceSamples(reference)
+		if len(samples) == 0 {
+			return nil, fmt.Errorf("fragment %d has no samples of track %d", i+1, reference.ID)
+		}
+		if f.size > math.MaxInt32 {
+			return nil, fmt.Errorf("fragment %d is too large for a segment index", i+1)
+		}
+		var duration uint64
+		earliest := int64(math.MaxInt64)
+		for _, sample := range samples {
+			duration += uint64(sample.Duration)
+			earliest = min(earliest, int64(sample.DecodeTime)+int64(sample.CompositionOffset))
+		}
+		if i == 0 {
+			sidx.EarliestPresentationTime = uint64(max(earliest, 0))
+		}
+		if duration > math.MaxUint32 {
+			return nil, fmt.Errorf("fragment %d is too long for a segment index", i+1)
+		}
+		entry := atoms.SegmentReference{ReferencedSize: uint32(f.size), SubsegmentDuration: uint32(duration)}
+		if samples[0].Sync {
+			entry.StartsWithSAP, entry.SAPType = true, 1
+		}
+		sidx.References = append(sidx.References, entry)
+	}
+	if sidx.EarliestPresentationTime > math.MaxUint32 {
+		sidx.Version = 1
+	}
+	sidx.ReferenceCount = uint16(len(sidx.References))
+	return writer.Marshal(atoms.NewLeafAtom("sidx", sidx))
+}
+
+// writeFile writes the atoms followed by the fragments to the output
+func writeFile(output string, input io.ReaderAt, atomsData [][]byte, fragments []*fragment) error {
+	return writer.ReplaceFile(output, writer.OutputPerm, func(destination *os.File) error {
+		return writeFragments(destination, input, atomsData, fragments)
+	})
+}
+
+// writeFragments writes the atoms followed by the 'moof' and 'mdat' atoms of the fragments
+func writeFragments(destination io.Writer, input io.ReaderAt, atomsData [][]byte, fragments []*fragment) error {
+	w := bufio.NewWriter(destination)
+	for _, data := range atomsData {
+		if _, err := w.Write(data); err != nil {
+			return err
+		}
+	}
+	for _, f := range fragments {
+		if _, err := w.Write(f.header); err != nil {
+			return err
+		}
+		if err := writer.CopyChunks(w, input, f.chunks); err != nil {
+			return err
+		}
+	}
+	return w.Flush()
+}
+
+// writeSegments writes the initialization segment and one media segment per fragment to the directory.
+// Every media segment starts with a 'styp' atom and, if requested, a 'sidx' atom indexing it.
+func writeSegments(directory string, input io.ReaderAt, initData []byte, fragments []*fragment, reference *track.Track, withIndex bool) error {
+	if err := os.MkdirAll(directory, 0o755); err != nil {
+		return err
+	}
+	if err := os.WriteFile(filepath.Join(directory, InitSegmentName), initData, 0o644); err != nil {
+		return err
+	}
+	styp := writer.FileTypeAtom("styp", "msdh", 0, "msdh")
+	if withIndex {
+		styp = writer.FileTypeAtom("styp", "msdh", 0, "msdh", "msix")
+	}
+	for i, f := range fragments {
+		segmentAtoms := [][]byte{styp}
+		if withIndex {
+			index, err := segmentIndex([]*fragment{f}, reference)
+			if err != nil {
+				return err
+			}
+			segmentAtoms = append(segmentAtoms, index)
+		}
+		if err := writeFile(filepath.Join(directory, SegmentName(i+1)), input, segmentAtoms, []*fragment{f}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,118 @@
+package fragment
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/KrzysztofHeinke/quicktime-movie-parser/internal/atomtest"
+	"github.com/KrzysztofHeinke/quicktime-movie-parser/internal/parser"
+	"github.com/KrzysztofHeinke/quicktime-movie-parser/internal/track"
+	"github.com/stretchr/testify/assert"
+)
+
+// writeTestMovie writes a progressive movie with an audio and a video track of six samples each. Video
+// samples 0 and 3 are sync samples and have composition offsets.
+func writeTestMovie(t *testing.T, path string) {
+	ftyp := atomtest.FileType("isom", "mp41")
+	offset := atomtest.MediaOffset(ftyp)
+	audio := atomtest.Trak(atomtest.Track{
+		ID: 1, HandlerType: "soun", Duration: 600, Entry: atomtest.SampleEntry("mp4a", 20),
+		Tables: atomtest.SampleTables(6, 100, 4, 3, offset, offset+24),
+	})
+	video := atomtest.Trak(atomtest.Track{
+		ID: 2, HandlerType: "vide", Duration: 600, Entry: atomtest.SampleEntry("avc1", 70),
+		Tables: append(atomtest.SampleTables(6, 100, 4, 3, offset+12, offset+36),
+			atomtest.Build("ctts", atomtest.Uint32s(0, 1, 6, 100)), atomtest.Build("stss", atomtest.Uint32s(0, 2, 1, 4))),
+	})
+	data := atomtest.Movie(ftyp, atomtest.Interleave(6, 3, "A", "V"), atomtest.MovieHeader(600, 3), audio, video)
+	assert.NoError(t, os.WriteFile(path, data, 0o644))
+}
+
+// readTracks reads the tracks of the file, merging the samples of its fragments
+func readTracks(t *testing.T, path string) ([]*track.Track, *os.File) {
+	tree, err := parser.ReadTree(path)
+	assert.NoError(t, err)
+	file, err := os.Open(path)
+	assert.NoError(t, err)
+	t.Cleanup(func() { file.Close() })
+	info, err := file.Stat()
+	assert.NoError(t, err)
+	tracks, err := parser.ReadTracks(tree, file, info.Size())
+	assert.NoError(t, err)
+	return tracks, file
+}
+
+// assertSamples checks that the fragmented tracks hold the samples of the progressive ones
+func assertSamples(t *testing.T, input string, tracks []*track.Track, file *os.File) {
+	original, _ := readTracks(t, input)
+	assert.Len(t, tracks, len(original))
+	for i, letter := range []string{"A", "V"} {
+		assert.Equal(t, 2, tracks[i].Fragments)
+		assert.Len(t, tracks[i].Samples, len(original[i].Samples))
+		for j, sample := range tracks[i].Samples {
+			expected := original[i].Samples[j]
+			expected.Offset = sample.Offset
+			assert.Equal(t, expected, sample)
+			data, err := tracks[i].ReadSample(file, j)
+			assert.NoError(t, err)
+			assert.Equal(t, fmt.Sprintf("%s%d..", letter, j), string(data))
+		}
+	}
+}
+
+// TestFragment tests that the fragments are cut at the video sync samples and hold every sample
+func TestFragment(t *testing.T) {
+	dir := t.TempDir()
+	input := filepath.Join(dir, "input.mp4")
+	output := filepath.Join(dir, "output.mp4")
+	writeTestMovie(t, input)
+
+	assert.NoError(t, Fragment(input, output, Options{Duration: 0.2, SegmentIndex: true}))
+
+	tracks, file := readTracks(t, output)
+	assertSamples(t, input, tracks, file)
+
+	info, err := file.Stat()
+	assert.NoError(t, err)
+	topLevelAtoms, err := parser.ReadTopLevelAtoms(file, info.Size())
+	assert.NoError(t, err)
+	var types []string
+	for _, atom := range topLevelAtoms {
+		types = append(types, atom.Type)
+	}
+	assert.Equal(t, []string{"ftyp", "moov", "sidx", "moof", "mdat", "moof", "mdat"}, types)
+	fileType, err := parser.ReadFileType(file, info.Size())
+	assert.NoError(t, err)
+	assert.NotContains(t, string(fileType), "cmfc", "Expected no CMAF brand for fragments holding several tracks")
+	indexes, err := parser.ReadSegmentIndexes(file, topLevelAtoms)
+	assert.NoError(t, err)
+	assert.Len(t, indexes, 1)
+	assert.Equal(t, uint32(2), indexes[0].Sidx.ReferenceID)
+	assert.Equal(t, uint64(100), indexes[0].Sidx.EarliestPresentationTime)
+	assert.Empty(t, parser.VerifySegmentIndexes(topLevelAtoms, indexes, tracks))
+}
+
+// TestFragmentSegments tests that the init and media segments together form the fragmented movie
+func TestFragmentSegments(t *testing.T) {
+	dir := t.TempDir()
+	input := filepath.Join(dir, "input.mp4")
+	segments := filepath.Join(dir, "segments")
+	writeTestMovie(t, input)
+
+	assert.NoError(t, Fragment(input, segments, Options{Duration: 0.2, SegmentIndex: true, Segments: true}))
+
+	var joined []byte
+	for _, name := range []string{InitSegmentName, SegmentName(1), SegmentName(2)} {
+		data, err := os.ReadFile(filepath.Join(segments, name))
+		assert.NoError(t, err)
+		joined = append(joined, data...)
+	}
+	assert.NoFileExists(t, filepath.Join(segments, SegmentName(3)))
+	output := filepath.Join(dir, "joined.mp4")
+	assert.NoError(t, os.WriteFile(output, joined, 0o644))
+
+	tracks, file := readTracks(t, output)
+	assertSamples(t, input, tracks, file)
+}
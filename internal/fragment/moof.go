@@ -0,0 +1,168 @@
+package fragment
+
+import (
+	"fmt"
+	"math"
+
+	"github.com/KrzysztofHeinke/quicktime-movie-parser/internal/track"
+	"github.com/KrzysztofHeinke/quicktime-movie-parser/internal/writer"
+	"github.com/KrzysztofHeinke/quicktime-movie-parser/pkg/models/atoms"
+)
+
+// Sample flags of the track runs: sync samples depend on no other sample, the others do
+const (
+	syncSampleFlags    = 0x02000000
+	nonSyncSampleFlags = 0x01000000 | atoms.SampleIsNonSyncSample
+)
+
+// run is a run of samples of one track in a fragment sharing their sample description
+type run struct {
+	track   *track.Track
+	samples []track.Sample
+}
+
+// fragment is a 'moof' and 'mdat' pair of the output
+type fragment struct {
+	runs []run
+	// header holds the 'moof' atom and the header of the 'mdat' atom, chunks the 'mdat' payload
+	header []byte
+	chunks []writer.MediaChunk
+	size   uint64
+}
+
+// splitFragments cuts the samples of the tracks into fragments. A fragment starts at the first sync
+// sample of the reference track decoded at least the target duration after the start of the previous
+// fragment, the samples of the other tracks follow by their decode time.
+func splitFragments(tracks []*track.Track, reference *track.Track, duration float64) []*fragment {
+	var boundaries []float64
+	next := duration
+	for _, sample := range reference.Samples {
+		if start := seconds(sample.DecodeTime, reference.TimeScale); sample.Sync && start >= next {
+			boundaries = append(boundaries, start)
+			next = start + duration
+		}
+	}
+
+	fragments := make([]*fragment, len(boundaries)+1)
+	for i := range fragments {
+		fragments[i] = &fragment{}
+	}
+	for _, t := range tracks {
+		index := 0
+		for _, sample := range t.Samples {
+			for index < len(boundaries) && seconds(sample.DecodeTime, t.TimeScale) >= boundaries[index] {
+				index++
+			}
+			fragments[index].add(t, sample)
+		}
+	}
+	return fragments
+}
+
+// seconds converts a time of the time scale to seconds
+func seconds(value uint64, timeScale uint32) float64 {
+	if timeScale == 0 {
+		return 0
+	}
+	return float64(value) / float64(timeScale)
+}
+
+// add appends the sample to the fragment, starting a new run when the track or the sample description changes
+func (f *fragment) add(t *track.Track, sample track.Sample) {
+	if n := len(f.runs); n > 0 {
+		last := &f.runs[n-1]
+		if last.track == t && last.samples[0].DescriptionIndex == sample.DescriptionIndex {
+			last.samples = append(last.samples, sample)
+			return
+		}
+	}
+	f.runs = append(f.runs, run{track: t, samples: []track.Sample{sample}})
+}
+
+// build serializes the 'moof' atom of the fragment and the header of its 'mdat' atom. Every track run
+// points at its samples in the 'mdat' atom relative to the start of the 'moof' atom.
+func (f *fragment) build(sequenceNumber uint32) error {
+	moof := atoms.NewCompositeAtom("moof", atoms.NewLeafAtom("mfhd", &atoms.MfhdAtom{SequenceNumber: sequenceNumber}))
+	var truns []*atoms.LeafAtom
+	var payloadSize uint64
+	for _, r := range f.runs {
+		traf, trun := r.trackFragment()
+		moof.AddChild(traf)
+		truns = append(truns, trun)
+		for _, chunk := range track.SplitChunks(r.samples) {
+			f.chunks = append(f.chunks, writer.MediaChunk{Source: chunk.Offset, Size: chunk.Size})
+			payloadSize += chunk.Size
+		}
+	}
+
+	moofData, err := writer.Marshal(moof)
+	if err != nil {
+		return err
+	}
+	mdatHeader := writer.AppendHeader(nil, [4]byte{'m', 'd', 'a', 't'}, payloadSize, false)
+	dataOffset := uint64(len(moofData) + len(mdatHeader))
+	for i, r := range f.runs {
+		if dataOffset > math.MaxInt32 {
+			return fmt.Errorf("fragment %d is too large for the data offsets of its track runs", sequenceNumber)
+		}
+		data := truns[i].Data.(*atoms.TrunAtom)
+		data.DataOffset = int32(dataOffset)
+		truns[i].SetData(data)
+		for _, sample := range r.samples {
+			dataOffset += uint64(sample.Size)
+		}
+	}
+	if moofData, err = writer.Marshal(moof); err != nil {
+		return err
+	}
+	f.header = append(moofData, mdatHeader...)
+	f.size = uint64(len(f.header)) + payloadSize
+	return nil
+}
+
+// trackFragment returns the 'traf' atom describing the run and its 'trun' atom
+func (r run) trackFragment() (*atoms.CompositeAtom, *atoms.LeafAtom) {
+	tfhd := &atoms.TfhdAtom{TrackID: r.track.ID}
+	tfhdFlags := uint32(atoms.TfhdDefaultBaseIsMoof)
+	if index := r.samples[0].DescriptionIndex; index != 1 {
+		tfhd.SampleDescriptionIndex = index
+		tfhdFlags |= atoms.TfhdSampleDescriptionIndexPresent
+	}
+	tfhd.SetFlags(tfhdFlags)
+
+	trun := &atoms.TrunAtom{SampleCount: uint32(len(r.samples))}
+	trunFlags := uint32(atoms.TrunDataOffsetPresent | atoms.TrunSampleDurationPresent | atoms.TrunSampleSizePresent | atoms.TrunSampleFlagsPresent)
+	for _, sample := range r.samples {
+		entry := atoms.TrunSample{Duration: sample.Duration, Size: sample.Size, Flags: nonSyncSampleFlags, CompositionTimeOffset: sample.CompositionOffset}
+		if sample.Sync {
+			entry.Flags = syncSampleFlags
+		}
+		if sample.CompositionOffset != 0 {
+			trunFlags |= atoms.TrunSampleCompositionTimeOffsetsPresent
+		}
+		if sample.CompositionOffset < 0 {
+			trun.Version = 1
+		}
+		trun.Samples = append(trun.Samples, entry)
+	}
+	trun.SetFlags(trunFlags)
+
+	trunLeaf := atoms.NewLeafAtom("trun", trun)
+	traf := atoms.NewCompositeAtom("traf",
+		atoms.NewLeafAtom("tfhd", tfhd),
+		atoms.NewLeafAtom("tfdt", &atoms.TfdtAtom{Version: 1, BaseMediaDecodeTime: r.samples[0].DecodeTime}),
+		trunLeaf,
+	)
+	return traf, trunLeaf
+}
+
+// referenceSamples returns the samples of the reference track in the fragment
+func (f *fragment) referenceSamples(reference *track.Track) []track.Sample {
+	var samples []track.Sample
+	for _, r := range f.runs {
+		if r.track == reference {
+			samples = append(samples, r.samples...)
+		}
+	}
+	return samples
+}
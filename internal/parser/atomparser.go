@@ -3,16 +3,95 @@ package parser
 import (
 	"bytes"
 	"encoding/binary"
+	"errors"
 	"fmt"
 	"io"
+	"math"
+	"path"
 
 	"github.com/KrzysztofHeinke/quicktime-movie-parser/internal/factory"
 	"github.com/KrzysztofHeinke/quicktime-movie-parser/pkg/models/atoms"
 	"github.com/sirupsen/logrus"
 )
 
-// CreateTreeOfAtoms parses atoms from the reader and constructs a tree of atoms.
+// Problem is a defect of the data found by the lenient parser
+type Problem struct {
+	// Path is the path of the atom, e.g. 'moov/trak/mdia/minf/stbl/stsz'
+	Path string
+	// Offset is the offset of the atom in the file, or in the parsed data if it is not known
+	Offset  int64
+	Message string
+}
+
+// String formats the problem for a report
+func (p Problem) String() string {
+	atomPath := p.Path
+	if atomPath == "" {
+		atomPath = "file"
+	}
+	return fmt.Sprintf("%s at offset %d: %s", atomPath, p.Offset, p.Message)
+}
+
+// treeBuilder builds trees of atoms. In lenient mode malformed atoms do not stop the parsing: they are
+// kept as InvalidAtom nodes and recorded as problems. Exceeding the limits in effect when the builder
+// was created stops the parsing in both modes, except for atoms nested too deep in lenient mode.
+type treeBuilder struct {
+	lenient  bool
+	problems []Problem
+	limits   atoms.Limits
+	// budget accounts for the bytes read into memory for the tree
+	budget *atoms.Budget
+}
+
+// newTreeBuilder returns a builder using the limits in effect
+func newTreeBuilder(lenient bool) *treeBuilder {
+	limits := atoms.CurrentLimits()
+	return &treeBuilder{lenient: lenient, limits: limits, budget: atoms.NewBudget(limits.MaxTotalAllocation)}
+}
+
+// CreateTreeOfAtoms parses atoms from the reader and constructs a tree of atoms. Exceeding the
+// configured limits fails with an *atoms.LimitError.
 func CreateTreeOfAtoms(reader *bytes.Reader) (atoms.AtomIf, error) {
+	builder := newTreeBuilder(false)
+	if err := builder.allocate(int64(reader.Len())); err != nil {
+		return nil, err
+	}
+	return builder.createTreeOfAtoms(reader, "", "", 0, 1)
+}
+
+// CreateTreeOfAtomsLenient parses atoms from the reader like CreateTreeOfAtoms, but turns atoms which
+// cannot be decoded into InvalidAtom nodes, clips truncated atoms and resumes after an atom of invalid
+// size at the next plausible atom header. The problems found are returned with offsets counted from base.
+func CreateTreeOfAtomsLenient(reader *bytes.Reader, base int64) (atoms.AtomIf, []Problem) {
+	builder := newTreeBuilder(true)
+	err := builder.allocate(int64(reader.Len()))
+	var root atoms.AtomIf
+	if err == nil {
+		root, err = builder.createTreeOfAtoms(reader, "", "", base, 1)
+	}
+	if err != nil {
+		// Only reading the in-memory data and exceeding the allocation limit can fail in lenient mode
+		builder.report("", base, "%v", err)
+		root = &atoms.CompositeAtom{}
+	}
+	return root, builder.problems
+}
+
+// report records a problem found in lenient mode
+func (b *treeBuilder) report(path string, offset int64, format string, args ...any) {
+	problem := Problem{Path: path, Offset: offset, Message: fmt.Sprintf(format, args...)}
+	logrus.Debugf("Lenient parsing: %s", problem)
+	b.problems = append(b.problems, problem)
+}
+
+// allocate accounts for bytes read into memory for the tree and fails once they exceed the allocation limit
+func (b *treeBuilder) allocate(size int64) error {
+	return b.budget.Charge("atom data", uint64(max(size, 0)), 1)
+}
+
+// createTreeOfAtoms builds the tree for the children of an atom of the given parent type and path
+// whose payload starts at base. The atoms read are at the given nesting depth, 1 for the top level.
+func (b *treeBuilder) createTreeOfAtoms(reader *bytes.Reader, parentType, parentPath string, base int64, depth int) (atoms.AtomIf, error) {
 	root := &atoms.CompositeAtom{}
 	dataSize := int64(reader.Len())
 	dataRead := int64(0)
@@ -25,21 +104,84 @@ func CreateTreeOfAtoms(reader *bytes.Reader) (atoms.AtomIf, error) {
 
 		header, err := ReadAtomHeader(reader)
 		if err != nil {
-			return nil, err
+			if !b.lenient {
+				return nil, err
+			}
+			b.report(parentPath, base+startPos, "%d bytes at the end are too few for an atom header", dataSize-startPos)
+			break
 		}
 		if header == nil {
 			break
 		}
 
 		atomType := header.GetType()
-		atomSize := int64(header.GetSize())
-		headerSize := int64(binary.Size(*header))
+		atomPath := path.Join(parentPath, atomType)
+		atomSize := int64(header.GetFullSize())
+		headerSize := int64(header.HeaderSize())
+		if header.Size == 0 {
+			// The atom extends to the end of its parent
+			atomSize = dataSize - startPos
+			if atomSize > math.MaxUint32 {
+				// Keep the 64-bit size, as for extended headers
+				header.Size, header.LargeSize = 1, uint64(atomSize)
+			} else {
+				header.Size = uint32(atomSize)
+			}
+		}
 
-		if atomSize <= headerSize {
-			return nil, fmt.Errorf("invalid atom size: %d (header size: %d)", atomSize, headerSize)
+		if atomSize < headerSize || atomSize > dataSize-startPos {
+			if !b.lenient {
+				return nil, fmt.Errorf("invalid atom size: %d (header size: %d)", atomSize, headerSize)
+			}
+			if atomSize < headerSize {
+				next := nextPlausibleHeader(reader, startPos+1, dataSize)
+				if err := b.allocate(next - startPos); err != nil {
+					return nil, err
+				}
+				raw := make([]byte, next-startPos)
+				if _, err := reader.ReadAt(raw, startPos); err != nil {
+					return nil, fmt.Errorf("error reading invalid atom: %w", err)
+				}
+				root.AddChild(&atoms.InvalidAtom{
+					AtomHeader: *header,
+					Raw:        raw,
+					Err:        fmt.Errorf("invalid atom size: %d (header size: %d)", atomSize, headerSize),
+				})
+				b.report(atomPath, base+startPos, "invalid size %d, skipped %d bytes to the next plausible atom header", atomSize, len(raw))
+				dataRead = next
+				if _, err := reader.Seek(dataRead, io.SeekStart); err != nil {
+					return nil, fmt.Errorf("error seeking after invalid atom: %w", err)
+				}
+				continue
+			}
+			b.report(atomPath, base+startPos, "truncated: size %d reaches %d bytes past the end of its parent", atomSize, atomSize-(dataSize-startPos))
+			atomSize = dataSize - startPos
+			if header.Size == 1 {
+				header.LargeSize = uint64(atomSize)
+			} else {
+				header.Size = uint32(atomSize)
+			}
 		}
 
-		if isCompositeAtom(atomType) {
+		if (IsCompositeAtom(atomType) || parentType == "ilst") && depth >= b.limits.MaxDepth && atomSize > headerSize {
+			limitErr := &atoms.LimitError{What: "atom nesting depth", Value: uint64(depth + 1), Limit: uint64(b.limits.MaxDepth)}
+			if !b.lenient {
+				return nil, limitErr
+			}
+			if err := b.allocate(atomSize); err != nil {
+				return nil, err
+			}
+			raw := make([]byte, atomSize)
+			if _, err := reader.ReadAt(raw, startPos); err != nil {
+				return nil, fmt.Errorf("error reading atom nested too deep: %w", err)
+			}
+			root.AddChild(&atoms.InvalidAtom{AtomHeader: *header, Raw: raw, Err: limitErr})
+			b.report(atomPath, base+startPos, "%v", limitErr)
+			dataRead = startPos + atomSize
+			if _, err := reader.Seek(dataRead, io.SeekStart); err != nil {
+				return nil, fmt.Errorf("error seeking after atom nested too deep: %w", err)
+			}
+		} else if IsCompositeAtom(atomType) || parentType == "ilst" {
 			logrus.Debugf("Found composite atom: %s", atomType)
 
 			compositeAtom := &atoms.CompositeAtom{
@@ -47,21 +189,35 @@ func CreateTreeOfAtoms(reader *bytes.Reader) (atoms.AtomIf, error) {
 			}
 
 			remainingSize := atomSize - headerSize
-			if remainingSize <= 0 {
-				return nil, fmt.Errorf("invalid remaining size: %d", remainingSize)
-			}
+			if remainingSize > 0 {
+				if err := b.allocate(remainingSize); err != nil {
+					return nil, err
+				}
+				sectionReader := io.NewSectionReader(reader, startPos+headerSize, remainingSize)
+				sectionData, err := ReadBytes(sectionReader, int(remainingSize))
+				if err != nil {
+					return nil, err
+				}
+				offset := ChildrenOffset(atomType, sectionData)
+				if offset > 0 {
+					compositeAtom.Prefix = sectionData[:offset]
+					sectionData = sectionData[offset:]
+				}
 
-			sectionReader := io.NewSectionReader(reader, startPos+headerSize, remainingSize)
-			sectionData, err := ReadBytes(sectionReader, int(remainingSize))
-			if err != nil {
-				return nil, err
+				childRoot, err := b.createTreeOfAtoms(bytes.NewReader(sectionData), atomType, atomPath, base+startPos+headerSize+int64(offset), depth+1)
+				if err != nil {
+					return nil, err
+				}
+				if childRoot, ok := childRoot.(*atoms.CompositeAtom); ok {
+					compositeAtom.Trailer, childRoot.Trailer = childRoot.Trailer, nil
+				}
+				compositeAtom.AddChild(childRoot)
 			}
-
-			childRoot, err := CreateTreeOfAtoms(bytes.NewReader(sectionData))
-			if err != nil {
-				return nil, err
+			if atomType == "trak" {
+				if err := b.decodeSampleEntryExtensions(compositeAtom, depth); err != nil {
+					return nil, err
+				}
 			}
-			compositeAtom.AddChild(childRoot)
 
 			root.AddChild(compositeAtom)
 
@@ -71,21 +227,29 @@ func CreateTreeOfAtoms(reader *bytes.Reader) (atoms.AtomIf, error) {
 			}
 		} else {
 			logrus.Debugf("Found leaf atom: %s", atomType)
-			atomData, err := ReadBytes(reader, int(atomSize))
-			if err != nil {
+			if err := b.allocate(atomSize); err != nil {
 				return nil, err
 			}
-
-			atomAdditionalData, err := factory.AtomFactory(*header, bytes.NewReader(atomData[8:]))
+			atomData, err := ReadBytes(reader, int(atomSize))
 			if err != nil {
 				return nil, err
 			}
 
-			leafAtom := &atoms.LeafAtom{
-				AtomHeader: *header,
-				Data:       atomAdditionalData,
+			atomAdditionalData, err := factory.AtomFactory(*header, parentType, bytes.NewReader(atomData[headerSize:]))
+			if err != nil {
+				if !b.lenient {
+					return nil, err
+				}
+				root.AddChild(&atoms.InvalidAtom{AtomHeader: *header, Raw: atomData, Err: err})
+				b.report(atomPath, base+startPos, "%v", err)
+			} else {
+				leafAtom := &atoms.LeafAtom{
+					AtomHeader: *header,
+					Data:       atomAdditionalData,
+					Raw:        atomData[headerSize:],
+				}
+				root.AddChild(leafAtom)
 			}
-			root.AddChild(leafAtom)
 			dataRead = startPos + atomSize
 			if _, err := reader.Seek(dataRead, io.SeekStart); err != nil {
 				return nil, fmt.Errorf("error seeking after leaf atom: %w", err)
@@ -93,35 +257,137 @@ func CreateTreeOfAtoms(reader *bytes.Reader) (atoms.AtomIf, error) {
 		}
 	}
 
+	if dataRead < dataSize {
+		// Bytes too few to form an atom, like the 32-bit terminator of QuickTime 'udta' atoms
+		root.Trailer = make([]byte, dataSize-dataRead)
+		if _, err := reader.ReadAt(root.Trailer, dataRead); err != nil {
+			return nil, fmt.Errorf("error reading trailing bytes: %w", err)
+		}
+	}
+
 	return root, nil
 }
 
-// ReadAtomHeader reads the atom header from the reader.
+// nextPlausibleHeader returns the offset of the first position from start on holding an atom header of
+// a size which fits the data and a type made of printable characters, or end if there is none
+func nextPlausibleHeader(reader *bytes.Reader, start, end int64) int64 {
+	header := make([]byte, 8)
+	for offset := start; offset+8 <= end; offset++ {
+		if _, err := reader.ReadAt(header, offset); err != nil {
+			break
+		}
+		size := int64(binary.BigEndian.Uint32(header[0:4]))
+		if size >= 8 && size <= end-offset && isPlausibleType(header[4:8]) {
+			return offset
+		}
+	}
+	return end
+}
+
+// isPlausibleType tells whether the atom type is made of letters, digits, spaces and the copyright sign
+// of QuickTime user data types
+func isPlausibleType(atomType []byte) bool {
+	for _, c := range atomType {
+		if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == ' ' || c == 0xA9) {
+			return false
+		}
+	}
+	return true
+}
+
+// ReadAtomHeader reads the atom header from the reader, including the 64-bit size of atoms whose size is 1.
+// The reader is left at the start of the atom.
 func ReadAtomHeader(reader *bytes.Reader) (*atoms.AtomHeader, error) {
 	header := atoms.AtomHeader{}
-	err := binary.Read(reader, binary.BigEndian, &header)
-	if err != nil {
+	if err := binary.Read(reader, binary.BigEndian, &header.Size); err != nil {
+		return nil, fmt.Errorf("error during header reading: %w", err)
+	}
+	if err := binary.Read(reader, binary.BigEndian, &header.Type); err != nil {
 		return nil, fmt.Errorf("error during header reading: %w", err)
 	}
-	if _, err := reader.Seek(-int64(binary.Size(header)), io.SeekCurrent); err != nil {
+	if header.Size == 1 {
+		if err := binary.Read(reader, binary.BigEndian, &header.LargeSize); err != nil {
+			return nil, fmt.Errorf("error during extended size reading: %w", err)
+		}
+	}
+	if _, err := reader.Seek(-int64(header.HeaderSize()), io.SeekCurrent); err != nil {
 		return nil, fmt.Errorf("error seeking after reading header: %w", err)
 	}
 
 	return &header, nil
 }
 
-// isCompositeAtom returns true if the atom is a composite atom.
-func isCompositeAtom(atomType string) bool {
+// IsCompositeAtom returns true if the atom is a composite atom.
+func IsCompositeAtom(atomType string) bool {
 	compositeAtoms := map[string]bool{
 		"moov": true,
 		"trak": true,
 		"mdia": true,
 		"minf": true,
 		"stbl": true,
+		"udta": true,
+		"meta": true,
+		"ilst": true,
+		"tapt": true,
+		"tref": true,
+		"edts": true,
+		"mvex": true,
+		"moof": true,
+		"traf": true,
+		"mfra": true,
+		"sinf": true,
+		"schi": true,
+		"wave": true,
 	}
 	return compositeAtoms[atomType]
 }
 
+// ChildrenOffset returns how many bytes of the composite atom payload precede its children.
+// The ISO 'meta' atom is a full atom with version and flags, the QuickTime 'meta' atom is not.
+func ChildrenOffset(atomType string, payload []byte) int {
+	if atomType == "meta" && len(payload) >= 8 && string(payload[4:8]) != "hdlr" &&
+		bytes.Equal(payload[:4], []byte{0, 0, 0, 0}) {
+		return 4
+	}
+	return 0
+}
+
+// decodeSampleEntryExtensions builds the trees of the child atoms of the sample entries of a 'trak' atom
+// at the given depth. Where these atoms start depends on the media handler type, so it can only be done
+// once the track is known. Entries whose atoms cannot be parsed keep no extensions, only exceeding the
+// limits is an error.
+func (b *treeBuilder) decodeSampleEntryExtensions(trakAtom *atoms.CompositeAtom, depth int) error {
+	stsd, ok := trakAtom.LeafData("mdia", "minf", "stbl", "stsd").(*atoms.AtomStsd)
+	if !ok {
+		return nil
+	}
+	handlerType := ""
+	if hdlr, ok := trakAtom.LeafData("mdia", "hdlr").(*atoms.HdlrAtom); ok {
+		handlerType = hdlr.GetHandlerType()
+	}
+
+	for i := range stsd.SampleEntries {
+		entry := &stsd.SampleEntries[i]
+		offset := entry.ExtensionsOffset(handlerType)
+		if offset < 0 || len(entry.Data)-offset < 8 {
+			continue
+		}
+		// The entries are parsed strictly, sharing the allocation budget of the tree. Their atoms are
+		// nested below trak/mdia/minf/stbl/stsd and the entry.
+		entryBuilder := &treeBuilder{limits: b.limits, budget: b.budget}
+		extensions, err := entryBuilder.createTreeOfAtoms(bytes.NewReader(entry.Data[offset:]), "", "", 0, depth+6)
+		if errors.Is(err, atoms.ErrLimitExceeded) {
+			return err
+		}
+		if err != nil {
+			logrus.Debugf("Failed to decode extensions of sample entry %s: %v", entry.GetType(), err)
+			continue
+		}
+		entry.Extensions = CleanEmptyHeaders(extensions)
+	}
+	return nil
+}
+
 // ReadBytes reads the specified number of bytes from the reader.
 func ReadBytes(reader io.Reader, size int) ([]byte, error) {
 	if size <= 0 {
@@ -164,6 +430,8 @@ func CleanEmptyHeaders(root atoms.AtomIf) atoms.AtomIf {
 			return &atoms.CompositeAtom{
 				AtomHeader: compositeAtom.AtomHeader,
 				Childrens:  compositeAtom.GetChildren(),
+				Prefix:     compositeAtom.Prefix,
+				Trailer:    compositeAtom.Trailer,
 			}
 		}
 	}
@@ -178,39 +446,13 @@ func isHeaderEmpty(header atoms.AtomHeader) bool {
 
 // CollectTrackInfo collects and prints track information from the atom tree.
 func CollectTrackInfo(root atoms.AtomIf) {
-	if compositeAtom, ok := root.(*atoms.CompositeAtom); ok {
-		for _, child := range compositeAtom.GetChildren() {
-			if trakAtom, ok := child.(*atoms.CompositeAtom); ok {
-				var isVideoTrack bool
-				var width, height float64
-
-				for _, trakChild := range trakAtom.GetChildren() {
-					switch atom := trakChild.(type) {
-					case *atoms.CompositeAtom:
-						CollectTrackInfo(atom)
-					case *atoms.LeafAtom:
-						if atom.AtomHeader.GetType() == "tkhd" {
-							a := atom.Data.(*atoms.TkhdAtom)
-							width = fixedPointToFloat32(a.Width)
-							height = fixedPointToFloat32(a.Height)
-							isVideoTrack = true
-						}
-						if atom.AtomHeader.GetType() == "stsd" {
-							a := atom.Data.(*atoms.AtomStsd)
-							sampleRates, _ := atoms.GetSampleRates(a)
-							for codec, rates := range sampleRates {
-								for _, rate := range rates {
-									logrus.Infof("Codec: %s, Sample Rate: %.2f Hz\n", codec, fixedPointToFloat32(uint32(rate)))
-								}
-							}
-						}
-					}
-				}
-				if isVideoTrack {
-					logrus.Infof("Video Track: Width = %.2f, Height = %.2f\n", width, height)
-				}
-			}
-			CollectTrackInfo(child)
+	compositeAtom, ok := root.(*atoms.CompositeAtom)
+	if !ok {
+		return
+	}
+	for i, child := range compositeAtom.FindAll("trak") {
+		if trakAtom, ok := child.(*atoms.CompositeAtom); ok {
+			logTrackInfo(i+1, trakAtom)
 		}
 	}
 }
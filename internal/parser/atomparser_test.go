@@ -2,8 +2,13 @@ package parser
 
 import (
 	"bytes"
+	"encoding/binary"
+	"errors"
+	"os"
+	"path/filepath"
 	"testing"
 
+	"github.com/KrzysztofHeinke/quicktime-movie-parser/internal/atomtest"
 	"github.com/KrzysztofHeinke/quicktime-movie-parser/pkg/models/atoms"
 	"github.com/stretchr/testify/assert"
 )
@@ -42,6 +47,23 @@ func TestReadAtomHeader(t *testing.T) {
 	assert.Equal(t, uint32(92), header.GetSize(), "Expected atom size to be 92")
 }
 
+// TestReadAtomHeaderLargeSize tests reading the header of an atom with a 64-bit size
+func TestReadAtomHeaderLargeSize(t *testing.T) {
+	data := []byte{0, 0, 0, 1, 'f', 'r', 'e', 'e', 0, 0, 0, 0, 0, 0, 0, 16}
+	reader := bytes.NewReader(data)
+	header, err := ReadAtomHeader(reader)
+	assert.NoError(t, err, "Expected no error reading atom header")
+	assert.Equal(t, uint64(16), header.GetFullSize())
+	assert.Equal(t, 16, header.HeaderSize())
+	assert.Equal(t, len(data), reader.Len(), "Expected the reader to stay at the start of the atom")
+
+	root, err := CreateTreeOfAtoms(reader)
+	assert.NoError(t, err, "Expected no error creating tree of atoms")
+	free, ok := CleanEmptyHeaders(root).(*atoms.CompositeAtom).GetChild("free").(*atoms.LeafAtom)
+	assert.True(t, ok)
+	assert.Empty(t, free.Raw)
+}
+
 // TestFixedPointToFloat32 tests the FixedPointToFloat32 function.
 func TestFixedPointToFloat32(t *testing.T) {
 	width := uint32(0x00020000)  // 2.0 in Q16.16
@@ -92,3 +114,101 @@ func TestCleanEmptyHeaders(t *testing.T) {
 	assert.Equal(t, 1, len(cleanedRoot.(*atoms.CompositeAtom).GetChildren()), "Expected 1 child after cleaning")
 	assert.Equal(t, childAtom, cleanedRoot.(*atoms.CompositeAtom).GetChildren()[0], "Expected the child to be preserved")
 }
+
+// damagedMovie builds a 'moov' atom with a sample size table whose entry count exceeds its data, an atom
+// of invalid size followed by a valid one and a 'udta' atom cut short by the end of the data
+func damagedMovie() []byte {
+	stbl := atomtest.Build("stbl", atomtest.Build("stsz", atomtest.Uint32s(0, 0, 10, 4)))
+	trak := atomtest.Build("trak", tkhdData, atomtest.Build("mdia", handlerAtom("vide"), atomtest.Build("minf", stbl)))
+	invalid := append(atomtest.Uint32s(3), []byte("junk")...)
+	udta := atomtest.Build("udta", atomtest.Build("\xa9nam", userDataText(0, "title")))
+	binary.BigEndian.PutUint32(udta, 100)
+	return atomtest.Build("moov", atomtest.Build("mvhd", make([]byte, 100)), trak, invalid, atomtest.Build("free"), udta)
+}
+
+// TestCreateTreeOfAtomsLenient tests that damaged atoms become invalid atoms and problems in lenient mode
+// while the rest of the tree is read
+func TestCreateTreeOfAtomsLenient(t *testing.T) {
+	data := damagedMovie()
+	_, err := CreateTreeOfAtoms(bytes.NewReader(data))
+	assert.Error(t, err, "Expected the strict mode to fail")
+
+	tree, problems := CreateTreeOfAtomsLenient(bytes.NewReader(data), 100)
+	moov := CleanEmptyHeaders(tree).(*atoms.CompositeAtom).GetChild("moov").(*atoms.CompositeAtom)
+	var types []string
+	for _, child := range moov.GetChildren() {
+		types = append(types, child.GetType())
+	}
+	assert.Equal(t, []string{"mvhd", "trak", "junk", "free", "udta"}, types)
+	assert.IsType(t, &atoms.InvalidAtom{}, moov.GetChildren()[2])
+	assert.Len(t, moov.GetChildren()[2].(*atoms.InvalidAtom).Raw, 8)
+	assert.IsType(t, &atoms.UserDataTextAtom{}, moov.LeafData("udta", "\xa9nam"))
+
+	trak := moov.GetChild("trak").(*atoms.CompositeAtom)
+	assert.IsType(t, &atoms.HdlrAtom{}, trak.LeafData("mdia", "hdlr"))
+	stsz, ok := trak.Find("mdia", "minf", "stbl", "stsz").(*atoms.InvalidAtom)
+	assert.True(t, ok, "Expected the broken sample size table to be an invalid atom")
+	assert.Error(t, stsz.Err)
+	assert.Len(t, stsz.Raw, 24)
+
+	var paths []string
+	for _, problem := range problems {
+		paths = append(paths, problem.Path)
+	}
+	assert.Equal(t, []string{"moov/trak/mdia/minf/stbl/stsz", "moov/junk", "moov/udta"}, paths)
+	junkOffset := int64(bytes.Index(data, []byte("junk")) - 4)
+	assert.Equal(t, 100+junkOffset, problems[1].Offset)
+	assert.Contains(t, problems[2].Message, "truncated")
+}
+
+// TestReadTreeLenient tests that the moov atom is found by its type when the top level atoms cannot be walked
+func TestReadTreeLenient(t *testing.T) {
+	data := bytes.Join([][]byte{atomtest.Build("ftyp", []byte("qt  ")), atomtest.Uint32s(2), []byte("bad!"), damagedMovie()}, nil)
+	path := filepath.Join(t.TempDir(), "damaged.mov")
+	assert.NoError(t, os.WriteFile(path, data, 0o644))
+
+	_, err := ReadTree(path)
+	assert.Error(t, err)
+	tree, problems, err := ReadTreeLenient(path)
+	assert.NoError(t, err)
+	assert.NotNil(t, tree.(*atoms.CompositeAtom).Find("moov", "mvhd"))
+	assert.Len(t, problems, 5)
+	assert.Equal(t, Problem{Path: "moov", Offset: 20, Message: "found by searching for its type"}, problems[1])
+	assert.Equal(t, "moov/junk", problems[3].Path)
+}
+
+// nestedAtoms builds 'udta' atoms nested to the given depth around a 'free' atom
+func nestedAtoms(depth int) []byte {
+	data := atomtest.Build("free")
+	for i := 0; i < depth; i++ {
+		data = atomtest.Build("udta", data)
+	}
+	return data
+}
+
+// TestCreateTreeOfAtomsLimits tests that atoms nested too deep and trees exceeding the allocation limit
+// fail with limit errors, and that lenient mode keeps the atoms nested too deep as invalid atoms
+func TestCreateTreeOfAtomsLimits(t *testing.T) {
+	t.Cleanup(func() { atoms.SetLimits(atoms.DefaultLimits) })
+	atoms.SetLimits(atoms.Limits{MaxDepth: 4})
+
+	_, err := CreateTreeOfAtoms(bytes.NewReader(nestedAtoms(3)))
+	assert.NoError(t, err)
+	_, err = CreateTreeOfAtoms(bytes.NewReader(nestedAtoms(4)))
+	var limitErr *atoms.LimitError
+	assert.True(t, errors.As(err, &limitErr), "Expected a limit error, got %v", err)
+	assert.Equal(t, &atoms.LimitError{What: "atom nesting depth", Value: 5, Limit: 4}, limitErr)
+
+	tree, problems := CreateTreeOfAtomsLenient(bytes.NewReader(nestedAtoms(4)), 0)
+	invalid, ok := tree.(*atoms.CompositeAtom).Find("udta", "udta", "udta", "udta").(*atoms.InvalidAtom)
+	assert.True(t, ok, "Expected the atoms nested too deep to be an invalid atom")
+	assert.Len(t, invalid.Raw, 16)
+	assert.Equal(t, []Problem{{Path: "udta/udta/udta/udta", Offset: 24, Message: limitErr.Error()}}, problems)
+
+	// Every level of nesting copies the payload of its atom
+	atoms.SetLimits(atoms.Limits{MaxTotalAllocation: 100})
+	_, err = CreateTreeOfAtoms(bytes.NewReader(nestedAtoms(3)))
+	assert.NoError(t, err)
+	_, err = CreateTreeOfAtoms(bytes.NewReader(nestedAtoms(4)))
+	assert.True(t, errors.Is(err, atoms.ErrLimitExceeded), "Expected a limit error, got %v", err)
+}
@@ -0,0 +1,124 @@
+package parser
+
+import (
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/KrzysztofHeinke/quicktime-movie-parser/internal/track"
+	"github.com/KrzysztofHeinke/quicktime-movie-parser/pkg/models/atoms"
+)
+
+// neroTimeScale is the number of Nero chapter time units per second
+const neroTimeScale = 10000000
+
+// Chapter is a chapter marker with its start and end time in seconds
+type Chapter struct {
+	Start float64 `json:"start"`
+	End   float64 `json:"end"`
+	Title string  `json:"title"`
+}
+
+// CollectChapters returns the chapters of the movie. QuickTime chapter tracks, i.e. text tracks referenced
+// through 'tref'/'chap', are preferred over the Nero 'chpl' atom of the movie user data.
+func CollectChapters(root atoms.AtomIf, r io.ReaderAt) ([]Chapter, error) {
+	moov := findMovieAtom(root)
+	if moov == nil {
+		return nil, fmt.Errorf("moov atom not found")
+	}
+
+	for _, atom := range moov.FindAll("trak") {
+		trakAtom, ok := atom.(*atoms.CompositeAtom)
+		if !ok {
+			continue
+		}
+		chap, ok := trakAtom.LeafData("tref", "chap").(*atoms.TrackReferenceAtom)
+		if !ok || len(chap.TrackIDs) == 0 {
+			continue
+		}
+		chapterTrak := track.FindTrak(moov, chap.TrackIDs[0])
+		if chapterTrak == nil {
+			return nil, fmt.Errorf("chapter track %d not found", chap.TrackIDs[0])
+		}
+		return readChapterTrack(chapterTrak, r)
+	}
+
+	if chpl, ok := moov.LeafData("udta", "chpl").(*atoms.ChplAtom); ok {
+		return neroChapters(chpl, movieDuration(moov)), nil
+	}
+	return nil, nil
+}
+
+// readChapterTrack reads the text samples of a chapter track, each sample being one chapter.
+func readChapterTrack(trakAtom *atoms.CompositeAtom, r io.ReaderAt) ([]Chapter, error) {
+	chapterTrack, err := track.NewTrack(trakAtom, atoms.NewBudget(atoms.CurrentLimits().MaxTotalAllocation))
+	if err != nil {
+		return nil, err
+	}
+	if chapterTrack.TimeScale == 0 {
+		return nil, fmt.Errorf("chapter track %d has no time scale", chapterTrack.ID)
+	}
+
+	timeScale := float64(chapterTrack.TimeScale)
+	chapters := make([]Chapter, 0, len(chapterTrack.Samples))
+	for i, sample := range chapterTrack.Samples {
+		data, err := chapterTrack.ReadSample(r, i)
+		if err != nil {
+			return nil, err
+		}
+		title, err := atoms.DecodeTextSample(data)
+		if err != nil {
+			return nil, fmt.Errorf("chapter %d: %w", i+1, err)
+		}
+		chapters = append(chapters, Chapter{
+			Start: float64(sample.DecodeTime) / timeScale,
+			End:   float64(sample.DecodeTime+uint64(sample.Duration)) / timeScale,
+			Title: title,
+		})
+	}
+	return chapters, nil
+}
+
+// neroChapters converts the Nero chapter list, each chapter ending where the next one starts
+// and the last one at the end of the movie.
+func neroChapters(chpl *atoms.ChplAtom, duration float64) []Chapter {
+	chapters := make([]Chapter, len(chpl.Chapters))
+	for i, entry := range chpl.Chapters {
+		chapters[i] = Chapter{Start: float64(entry.StartTime) / neroTimeScale, Title: entry.Title}
+		if i > 0 {
+			chapters[i-1].End = chapters[i].Start
+		}
+	}
+	if len(chapters) > 0 {
+		chapters[len(chapters)-1].End = max(duration, chapters[len(chapters)-1].Start)
+	}
+	return chapters
+}
+
+// movieDuration returns the duration of the movie in seconds according to the 'mvhd' atom.
+func movieDuration(moov *atoms.CompositeAtom) float64 {
+	mvhd, ok := moov.LeafData("mvhd").(*atoms.MvhdAtom)
+	if !ok || mvhd.TimeScale == 0 {
+		return 0
+	}
+	return float64(mvhd.Duration) / float64(mvhd.TimeScale)
+}
+
+// FormatFFMetadata formats the chapters as an FFMETADATA1 file with millisecond time base.
+func FormatFFMetadata(chapters []Chapter) string {
+	var builder strings.Builder
+	builder.WriteString(";FFMETADATA1\n")
+	for _, chapter := range chapters {
+		builder.WriteString("\n[CHAPTER]\nTIMEBASE=1/1000\n")
+		fmt.Fprintf(&builder, "START=%d\n", int64(chapter.Start*1000+0.5))
+		fmt.Fprintf(&builder, "END=%d\n", int64(chapter.End*1000+0.5))
+		fmt.Fprintf(&builder, "title=%s\n", escapeFFMetadata(chapter.Title))
+	}
+	return builder.String()
+}
+
+// escapeFFMetadata escapes the characters with a special meaning in FFMETADATA files.
+func escapeFFMetadata(value string) string {
+	replacer := strings.NewReplacer("\\", "\\\\", "=", "\\=", ";", "\\;", "#", "\\#", "\n", "\\\n")
+	return replacer.Replace(value)
+}
@@ -0,0 +1,85 @@
+package parser
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+
+	"github.com/KrzysztofHeinke/quicktime-movie-parser/internal/atomtest"
+	"github.com/stretchr/testify/assert"
+)
+
+// textSample builds a QuickTime text sample
+func textSample(text string) []byte {
+	result := make([]byte, 2, 2+len(text))
+	binary.BigEndian.PutUint16(result, uint16(len(text)))
+	return append(result, text...)
+}
+
+// trackHeader builds a 'tkhd' atom for the track ID
+func trackHeader(trackID uint32) []byte {
+	return atomtest.Build("tkhd", make([]byte, 12), atomtest.Uint32s(trackID), make([]byte, 68))
+}
+
+// mediaHeader builds a 'mdhd' atom with the time scale and duration
+func mediaHeader(timeScale, duration uint32) []byte {
+	return atomtest.Build("mdhd", make([]byte, 12), atomtest.Uint32s(timeScale, duration), []byte{0x55, 0xC4, 0, 0})
+}
+
+// TestCollectChaptersFromTrack tests reading chapters from a text track referenced through 'tref'/'chap'
+func TestCollectChaptersFromTrack(t *testing.T) {
+	ftyp := atomtest.Build("ftyp", []byte("qt  "), atomtest.Uint32s(0), []byte("qt  "))
+	first, second := textSample("Intro"), textSample("Main = Part; #1")
+	mdat := atomtest.Build("mdat", first, second)
+
+	video := atomtest.Build("trak",
+		trackHeader(1),
+		atomtest.Build("tref", atomtest.Build("chap", atomtest.Uint32s(2))),
+	)
+	entry := atomtest.Build("text", make([]byte, 6), []byte{0, 1})
+	text := atomtest.Build("trak",
+		trackHeader(2),
+		atomtest.Build("mdia",
+			mediaHeader(1000, 90000),
+			handlerAtom("text"),
+			atomtest.Build("minf", atomtest.Build("stbl",
+				atomtest.Build("stsd", atomtest.Uint32s(0, 1), entry),
+				atomtest.Build("stts", atomtest.Uint32s(0, 2, 1, 30000, 1, 60000)),
+				atomtest.Build("stsc", atomtest.Uint32s(0, 1, 1, 2, 1)),
+				atomtest.Build("stsz", atomtest.Uint32s(0, 0, 2, uint32(len(first)), uint32(len(second)))),
+				atomtest.Build("stco", atomtest.Uint32s(0, 1, uint32(len(ftyp)+8))),
+			)),
+		),
+	)
+	file := bytes.Join([][]byte{ftyp, mdat, atomtest.Build("moov", video, text)}, nil)
+	tree := parseTree(t, file[len(ftyp)+len(mdat):])
+
+	chapters, err := CollectChapters(tree, bytes.NewReader(file))
+	assert.NoError(t, err)
+	assert.Equal(t, []Chapter{
+		{Start: 0, End: 30, Title: "Intro"},
+		{Start: 30, End: 90, Title: "Main = Part; #1"},
+	}, chapters)
+
+	assert.Equal(t, ";FFMETADATA1\n"+
+		"\n[CHAPTER]\nTIMEBASE=1/1000\nSTART=0\nEND=30000\ntitle=Intro\n"+
+		"\n[CHAPTER]\nTIMEBASE=1/1000\nSTART=30000\nEND=90000\ntitle=Main \\= Part\\; \\#1\n",
+		FormatFFMetadata(chapters))
+}
+
+// TestCollectChaptersFromChpl tests reading chapters from the Nero 'chpl' atom
+func TestCollectChaptersFromChpl(t *testing.T) {
+	chpl := atomtest.Build("chpl", []byte{1, 0, 0, 0}, atomtest.Uint32s(0), []byte{2},
+		[]byte{0, 0, 0, 0, 0, 0, 0, 0}, []byte{5}, []byte("Start"),
+		[]byte{0, 0, 0, 0, 0x0B, 0xEB, 0xC2, 0x00}, []byte{3}, []byte("End"),
+	)
+	mvhd := atomtest.Build("mvhd", make([]byte, 12), atomtest.Uint32s(600, 36000), make([]byte, 80))
+	tree := parseTree(t, atomtest.Build("moov", mvhd, atomtest.Build("udta", chpl)))
+
+	chapters, err := CollectChapters(tree, bytes.NewReader(nil))
+	assert.NoError(t, err)
+	assert.Equal(t, []Chapter{
+		{Start: 0, End: 20, Title: "Start"},
+		{Start: 20, End: 60, Title: "End"},
+	}, chapters)
+}
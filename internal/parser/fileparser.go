@@ -5,25 +5,148 @@ import (
 	"encoding/binary"
 	"fmt"
 	"io"
+	"math"
 	"os"
 
+	"github.com/KrzysztofHeinke/quicktime-movie-parser/pkg/models/atoms"
 	"github.com/sirupsen/logrus"
 )
 
 const chunkSize = 4096
 
-// Parse is starting point to start parsing file.
-func Parse(p string) {
+// Parse is starting point to start parsing file. In lenient mode damaged atoms do not stop the parsing,
+// whatever can be read is reported followed by the problems found.
+func Parse(p string, lenient bool) {
+	var tree atoms.AtomIf
+	var problems []Problem
+	var err error
+	if lenient {
+		tree, problems, err = ReadTreeLenient(p)
+	} else {
+		tree, err = ReadTree(p)
+	}
+	if err != nil {
+		logrus.Fatal(err)
+	}
+	CollectTrackInfo(tree)
+	LogMetadata(CollectMetadata(tree))
+	LogProtectionSystems(CollectProtectionSystems(tree))
+
+	file, err := os.Open(p)
+	if err != nil {
+		logrus.Fatal("Failed to open file")
+	}
+	defer file.Close()
+	info, err := file.Stat()
+	if err != nil {
+		logrus.Fatal("Failed to read file size")
+	}
+	tracks, err := ReadTracks(tree, file, info.Size())
+	if err != nil {
+		logrus.Errorf("Failed to read tracks: %v", err)
+	} else {
+		LogTracks(tree, tracks)
+		mismatches, err := CheckSegmentIndexes(file, info.Size(), tracks)
+		if err != nil {
+			logrus.Errorf("Failed to check segment indexes: %v", err)
+		}
+		for _, mismatch := range mismatches {
+			logrus.Warnf("Segment index mismatch: %s", mismatch)
+		}
+	}
+	LogTimecodes(CollectTimecodes(tree, file))
+	if lenient {
+		for _, problem := range problems {
+			logrus.Warnf("Problem: %s", problem)
+		}
+		logrus.Infof("Parsed with %d problems", len(problems))
+	}
+}
+
+// ReadTree reads the moov atom of the file and builds the cleaned tree of its atoms.
+func ReadTree(p string) (atoms.AtomIf, error) {
 	metadata, err := ReadFileMetadata(p)
 	if err != nil {
-		logrus.Fatal("Failed to read metadata of file")
+		return nil, fmt.Errorf("failed to read metadata of file: %w", err)
 	}
 	tree, err := CreateTreeOfAtoms(bytes.NewReader(metadata))
 	if err != nil {
-		logrus.Fatal("Failed to create tree of atoms")
+		return nil, fmt.Errorf("failed to create tree of atoms: %w", err)
 	}
-	tree = CleanEmptyHeaders(tree)
-	CollectTrackInfo(tree)
+	return CleanEmptyHeaders(tree), nil
+}
+
+// ReadTreeLenient reads the moov atom of the file like ReadTree, but keeps going on damaged data: atoms
+// which cannot be decoded become InvalidAtom nodes and truncated atoms are clipped, see
+// CreateTreeOfAtomsLenient. If the top level atoms cannot be walked the moov atom is searched by its type.
+// An error is only returned if no moov atom is found.
+func ReadTreeLenient(p string) (atoms.AtomIf, []Problem, error) {
+	file, err := os.Open(p)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer file.Close()
+	info, err := file.Stat()
+	if err != nil {
+		return nil, nil, err
+	}
+	return readTreeLenient(file, info.Size())
+}
+
+// readTreeLenient reads the moov atom of the data like ReadTreeLenient
+func readTreeLenient(r io.ReaderAt, fileSize int64) (atoms.AtomIf, []Problem, error) {
+	var problems []Problem
+	moov, ok := TopLevelAtom{}, false
+	topLevelAtoms, err := ReadTopLevelAtoms(r, fileSize)
+	if err == nil {
+		moov, ok = FindTopLevelAtom(topLevelAtoms, "moov")
+	} else {
+		problems = append(problems, Problem{Message: fmt.Sprintf("top level atoms cannot be walked: %v", err)})
+	}
+	if !ok {
+		if moov, ok = searchMovieAtom(r, fileSize); !ok {
+			return nil, problems, fmt.Errorf("moov atom not found")
+		}
+		problems = append(problems, Problem{Path: "moov", Offset: moov.Offset, Message: "found by searching for its type"})
+	}
+	if moov.Size > math.MaxUint32 {
+		return nil, problems, fmt.Errorf("moov atom of %d bytes is too large", moov.Size)
+	}
+	if err := checkAtomSize(moov); err != nil {
+		return nil, problems, err
+	}
+
+	data := make([]byte, moov.Size)
+	if _, err := r.ReadAt(data, moov.Offset); err != nil {
+		return nil, problems, fmt.Errorf("error reading moov atom: %w", err)
+	}
+	tree, treeProblems := CreateTreeOfAtomsLenient(bytes.NewReader(data), moov.Offset)
+	return CleanEmptyHeaders(tree), append(problems, treeProblems...), nil
+}
+
+// searchMovieAtom looks for the first 'moov' type in the file and returns the atom it belongs to,
+// clipped to the end of the file
+func searchMovieAtom(r io.ReaderAt, fileSize int64) (TopLevelAtom, bool) {
+	index, err := FindAtomInFile(io.NewSectionReader(r, 0, fileSize), []byte("moov"))
+	if err != nil || index < 4 {
+		return TopLevelAtom{}, false
+	}
+	atom := TopLevelAtom{Type: "moov", Offset: index - 4, HeaderSize: 8}
+	header := make([]byte, 16)
+	if _, err := r.ReadAt(header[:8], atom.Offset); err != nil {
+		return TopLevelAtom{}, false
+	}
+	atom.Size = int64(binary.BigEndian.Uint32(header))
+	if atom.Size == 1 && atom.Offset+16 <= fileSize {
+		if _, err := r.ReadAt(header[8:], atom.Offset+8); err != nil {
+			return TopLevelAtom{}, false
+		}
+		atom.Size, atom.HeaderSize = int64(binary.BigEndian.Uint64(header[8:])), 16
+	}
+	if atom.Size < atom.HeaderSize || atom.Size > fileSize-atom.Offset {
+		atom.Size, atom.Truncated = fileSize-atom.Offset, true
+	}
+	return atom, true
 }
 
 // FindAtomInFile is seeking for the specified atom in file
@@ -52,18 +175,145 @@ func FindAtomInFile(r io.Reader, search []byte) (int64, error) {
 	}
 }
 
-// ReadData taking a file, cursor posistion and reads data
+// ReadData taking a file, cursor posistion and reads data. A size reaching past the end of the file or
+// above the atom size limit fails with an *atoms.LimitError before anything is allocated.
 func ReadData(f *os.File, cursorPosition int64, sizeToRead uint32) ([]byte, error) {
-	var size []byte = make([]byte, sizeToRead)
-	_, err := f.Seek(cursorPosition, io.SeekStart)
+	info, err := f.Stat()
 	if err != nil {
 		return nil, err
 	}
-	_, err = f.Read(size[:sizeToRead])
+	if remaining := max(info.Size()-cursorPosition, 0); int64(sizeToRead) > remaining {
+		return nil, &atoms.LimitError{What: "read size", Value: uint64(sizeToRead), Limit: uint64(remaining), Remaining: true}
+	}
+	if err := atoms.CheckSize("read size", uint64(sizeToRead), atoms.CurrentLimits().MaxAtomSize); err != nil {
+		return nil, err
+	}
+	data := make([]byte, sizeToRead)
+	if _, err := f.ReadAt(data, cursorPosition); err != nil {
+		return nil, err
+	}
+	return data, nil
+}
+
+// checkAtomSize checks that the top level atom is small enough to be read into memory
+func checkAtomSize(atom TopLevelAtom) error {
+	return atoms.CheckSize(atom.Type+" atom size", uint64(atom.Size), atoms.CurrentLimits().MaxAtomSize)
+}
+
+// TopLevelAtom describes an atom found at the top level of a file
+type TopLevelAtom struct {
+	Type       string
+	Offset     int64
+	Size       int64
+	HeaderSize int64
+	Truncated  bool
+}
+
+// ReadTopLevelAtoms walks the atoms at the top level of the file. It follows 64-bit sizes and a zero
+// size meaning the atom extends to the end of the file. An atom reaching past the end of the file
+// is clipped and marked as truncated.
+func ReadTopLevelAtoms(r io.ReaderAt, fileSize int64) ([]TopLevelAtom, error) {
+	var result []TopLevelAtom
+	header := make([]byte, 16)
+
+	for offset := int64(0); offset+8 <= fileSize; {
+		if _, err := r.ReadAt(header[:8], offset); err != nil {
+			return nil, fmt.Errorf("error reading atom header at offset %d: %w", offset, err)
+		}
+		atom := TopLevelAtom{
+			Type:       string(header[4:8]),
+			Offset:     offset,
+			Size:       int64(binary.BigEndian.Uint32(header[0:4])),
+			HeaderSize: 8,
+		}
+		switch atom.Size {
+		case 0:
+			atom.Size = fileSize - offset
+		case 1:
+			if _, err := r.ReadAt(header[8:16], offset+8); err != nil {
+				return nil, fmt.Errorf("error reading extended size at offset %d: %w", offset, err)
+			}
+			atom.Size = int64(binary.BigEndian.Uint64(header[8:16]))
+			atom.HeaderSize = 16
+		}
+		if atom.Size < atom.HeaderSize {
+			return nil, fmt.Errorf("invalid size %d of atom '%s' at offset %d", atom.Size, atom.Type, offset)
+		}
+		if atom.Size > fileSize-offset {
+			logrus.Debugf("Atom '%s' at offset %d is truncated: %d of %d bytes", atom.Type, offset, fileSize-offset, atom.Size)
+			atom.Size = fileSize - offset
+			atom.Truncated = true
+		}
+
+		result = append(result, atom)
+		offset += atom.Size
+	}
+
+	return result, nil
+}
+
+// FindTopLevelAtom returns the first top level atom of the given type
+func FindTopLevelAtom(topLevelAtoms []TopLevelAtom, atomType string) (TopLevelAtom, bool) {
+	for _, atom := range topLevelAtoms {
+		if atom.Type == atomType {
+			return atom, true
+		}
+	}
+	return TopLevelAtom{}, false
+}
+
+// ReadFileType returns the raw 'ftyp' atom of the file, or nothing if it has none
+func ReadFileType(r io.ReaderAt, fileSize int64) ([]byte, error) {
+	topLevelAtoms, err := ReadTopLevelAtoms(r, fileSize)
 	if err != nil {
 		return nil, err
 	}
-	return size, nil
+	atom, ok := FindTopLevelAtom(topLevelAtoms, "ftyp")
+	if !ok {
+		return nil, nil
+	}
+	if atom.Truncated || atom.Size > math.MaxUint32 {
+		return nil, fmt.Errorf("ftyp atom at offset %d is invalid", atom.Offset)
+	}
+	if err := checkAtomSize(atom); err != nil {
+		return nil, err
+	}
+	data := make([]byte, atom.Size)
+	if _, err := r.ReadAt(data, atom.Offset); err != nil {
+		return nil, fmt.Errorf("error reading ftyp atom: %w", err)
+	}
+	return data, nil
+}
+
+// ReadTopLevelAtom reads a top level atom of the file and parses it into a tree
+func ReadTopLevelAtom(r io.ReaderAt, atom TopLevelAtom) (atoms.AtomIf, error) {
+	if atom.Truncated {
+		return nil, fmt.Errorf("%s atom at offset %d is truncated", atom.Type, atom.Offset)
+	}
+	if atom.Size > math.MaxUint32 {
+		return nil, fmt.Errorf("%s atom of %d bytes at offset %d is too large", atom.Type, atom.Size, atom.Offset)
+	}
+	if err := checkAtomSize(atom); err != nil {
+		return nil, fmt.Errorf("%s atom at offset %d: %w", atom.Type, atom.Offset, err)
+	}
+
+	data := make([]byte, atom.Size)
+	if _, err := r.ReadAt(data, atom.Offset); err != nil {
+		return nil, fmt.Errorf("error reading %s atom at offset %d: %w", atom.Type, atom.Offset, err)
+	}
+	tree, err := CreateTreeOfAtoms(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("error parsing %s atom at offset %d: %w", atom.Type, atom.Offset, err)
+	}
+	root, ok := CleanEmptyHeaders(tree).(*atoms.CompositeAtom)
+	if !ok {
+		return nil, fmt.Errorf("%s atom at offset %d could not be parsed", atom.Type, atom.Offset)
+	}
+	child := root.GetChild(atom.Type)
+	if child == nil {
+		return nil, fmt.Errorf("%s atom at offset %d could not be parsed", atom.Type, atom.Offset)
+	}
+	return child, nil
 }
 
 // ReadFileMetadata looks for the moov atom as the starting point and reads its contents.
@@ -75,29 +325,29 @@ func ReadFileMetadata(filename string) ([]byte, error) {
 	}
 	defer file.Close()
 
-	position, err := FindAtomInFile(file, []byte("moov"))
+	info, err := file.Stat()
 	if err != nil {
-		logrus.Errorf("Error finding moov atom: %v", err)
+		logrus.Errorf("Error reading file size: %v", err)
 		return nil, err
 	}
 
-	// Go to the start of the "moov" atom minus header and moov size
-	_, err = file.Seek(position-7, io.SeekStart)
+	topLevelAtoms, err := ReadTopLevelAtoms(file, info.Size())
 	if err != nil {
-		logrus.Errorf("Error seeking to moov atom: %v", err)
+		logrus.Errorf("Error walking top level atoms: %v", err)
 		return nil, err
 	}
 
-	moovSizeData := make([]byte, 4)
-	_, err = file.Read(moovSizeData)
-	if err != nil {
-		logrus.Errorf("Error reading moov size: %v", err)
-		return nil, err
+	moov, ok := FindTopLevelAtom(topLevelAtoms, "moov")
+	if !ok {
+		logrus.Errorf("Error finding moov atom")
+		return nil, fmt.Errorf("moov atom not found")
+	}
+	if moov.Size > math.MaxUint32 {
+		return nil, fmt.Errorf("moov atom of %d bytes is too large", moov.Size)
 	}
-	size := binary.BigEndian.Uint32(moovSizeData)
 
 	// Read the entire "moov" atom (including its header)
-	atomData, err := ReadData(file, position-7, size)
+	atomData, err := ReadData(file, moov.Offset, uint32(moov.Size))
 	if err != nil {
 		logrus.Errorf("Error reading moov atom data: %v", err)
 		return nil, err
@@ -5,6 +5,7 @@ import (
 	"os"
 	"testing"
 
+	"github.com/KrzysztofHeinke/quicktime-movie-parser/pkg/models/atoms"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -37,6 +38,9 @@ func TestReadData(t *testing.T) {
 	data, err := ReadData(tmpFile, 5, 9)
 	assert.NoError(t, err, "Expected no error reading data from file")
 	assert.Equal(t, []byte("is some t"), data, "Expected to read 'is some t' from file")
+
+	_, err = ReadData(tmpFile, 5, 0xFFFFFFFF)
+	assert.Equal(t, &atoms.LimitError{What: "read size", Value: 0xFFFFFFFF, Limit: 30, Remaining: true}, err)
 }
 
 // TestSearchAtoms tests the SearchAtoms function
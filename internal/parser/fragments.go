@@ -0,0 +1,81 @@
+package parser
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/KrzysztofHeinke/quicktime-movie-parser/internal/track"
+	"github.com/KrzysztofHeinke/quicktime-movie-parser/pkg/models/atoms"
+	"github.com/sirupsen/logrus"
+)
+
+// ReadFragments reads and parses every 'moof' atom found at the top level of the file.
+func ReadFragments(r io.ReaderAt, topLevelAtoms []TopLevelAtom) ([]track.Fragment, error) {
+	var fragments []track.Fragment
+	for _, atom := range topLevelAtoms {
+		if atom.Type != "moof" {
+			continue
+		}
+		if atom.Truncated {
+			logrus.Warnf("Skipping truncated moof atom at offset %d", atom.Offset)
+			continue
+		}
+		parsed, err := ReadTopLevelAtom(r, atom)
+		if err != nil {
+			return nil, err
+		}
+		moof, ok := parsed.(*atoms.CompositeAtom)
+		if !ok {
+			return nil, fmt.Errorf("moof atom at offset %d is not a composite atom", atom.Offset)
+		}
+		fragments = append(fragments, track.Fragment{Offset: atom.Offset, Moof: moof})
+	}
+	return fragments, nil
+}
+
+// ReadTracks builds the tracks of the movie and merges the samples of all movie fragments into them,
+// so that fragmented and progressive files are presented the same way. The samples of all tracks share
+// one budget of the total allocation limit.
+func ReadTracks(root atoms.AtomIf, r io.ReaderAt, fileSize int64) ([]*track.Track, error) {
+	budget := atoms.NewBudget(atoms.CurrentLimits().MaxTotalAllocation)
+	tracks, err := track.ReadTracks(root, budget)
+	if err != nil {
+		return nil, err
+	}
+
+	topLevelAtoms, err := ReadTopLevelAtoms(r, fileSize)
+	if err != nil {
+		return nil, err
+	}
+	fragments, err := ReadFragments(r, topLevelAtoms)
+	if err != nil {
+		return nil, err
+	}
+	if err := track.ApplyFragments(root, tracks, fragments, budget); err != nil {
+		return nil, err
+	}
+	return tracks, nil
+}
+
+// LogTracks logs the number of samples and the duration of every track
+func LogTracks(root atoms.AtomIf, tracks []*track.Track) {
+	if moov := findMovieAtom(root); moov != nil {
+		if mehd, ok := moov.LeafData("mvex", "mehd").(*atoms.MehdAtom); ok {
+			if mvhd, ok := moov.LeafData("mvhd").(*atoms.MvhdAtom); ok && mvhd.TimeScale != 0 {
+				logrus.Infof("Fragmented movie duration: %.3f s", float64(mehd.FragmentDuration)/float64(mvhd.TimeScale))
+			}
+		}
+	}
+
+	for _, t := range tracks {
+		duration := 0.0
+		if t.TimeScale != 0 {
+			duration = float64(t.Duration) / float64(t.TimeScale)
+		}
+		if t.Fragments > 0 {
+			logrus.Infof("Track %d: Samples = %d, Duration = %.3f s, Fragments = %d", t.ID, len(t.Samples), duration, t.Fragments)
+		} else {
+			logrus.Infof("Track %d: Samples = %d, Duration = %.3f s", t.ID, len(t.Samples), duration)
+		}
+	}
+}
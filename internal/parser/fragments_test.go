@@ -0,0 +1,95 @@
+package parser
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/KrzysztofHeinke/quicktime-movie-parser/internal/atomtest"
+	"github.com/KrzysztofHeinke/quicktime-movie-parser/internal/track"
+	"github.com/stretchr/testify/assert"
+)
+
+// movieFragment builds a 'moof' atom for track 1 whose track run data follows in the next 'mdat' atom
+func movieFragment(sequence uint32, tfhdFlags uint32, defaults []byte, tfdt []byte, trunFlags uint32, sampleCount uint32, fields ...uint32) []byte {
+	build := func(dataOffset uint32) []byte {
+		traf := [][]byte{atomtest.Build("tfhd", atomtest.Uint32s(tfhdFlags, 1), defaults)}
+		if tfdt != nil {
+			traf = append(traf, tfdt)
+		}
+		traf = append(traf, atomtest.Build("trun", atomtest.Uint32s(trunFlags, sampleCount, dataOffset), atomtest.Uint32s(fields...)))
+		return atomtest.Build("moof", atomtest.Build("mfhd", atomtest.Uint32s(0, sequence)), atomtest.Build("traf", traf...))
+	}
+	return build(uint32(len(build(0)) + 8))
+}
+
+// fragmentedMovieHeader builds a 'moov' atom for a fragmented movie with one video track in time scale 1000
+// whose fragment samples last 40 units by default and are not sync samples
+func fragmentedMovieHeader() []byte {
+	return atomtest.Build("moov",
+		atomtest.Build("mvhd", make([]byte, 12), atomtest.Uint32s(1000, 0), make([]byte, 80)),
+		atomtest.Build("trak",
+			atomtest.Build("tkhd", make([]byte, 12), atomtest.Uint32s(1), make([]byte, 68)),
+			atomtest.Build("mdia",
+				atomtest.Build("mdhd", make([]byte, 12), atomtest.Uint32s(1000, 0), []byte{0x55, 0xC4, 0, 0}),
+				handlerAtom("vide"),
+				atomtest.Build("minf", atomtest.Build("stbl")),
+			),
+		),
+		atomtest.Build("mvex",
+			atomtest.Build("mehd", atomtest.Uint32s(0, 220)),
+			atomtest.Build("trex", atomtest.Uint32s(0, 1, 1, 40, 0, 0x10000)),
+		),
+	)
+}
+
+// TestReadTracksFragmented tests merging the track runs of movie fragments with the 'trex' defaults
+func TestReadTracksFragmented(t *testing.T) {
+	ftyp := atomtest.Build("ftyp", []byte("iso6"), atomtest.Uint32s(0))
+	moov := fragmentedMovieHeader()
+	// First fragment: base is the moof, first sample flags mark a sync sample, sizes per sample
+	moof1 := movieFragment(1, 0x020000, nil, atomtest.Build("tfdt", atomtest.Uint32s(0, 0)), 0x000205, 3,
+		0, 10, 20, 30)
+	// Second fragment: default duration from tfhd, decode time continues, signed composition offsets
+	moof2 := movieFragment(2, 0x020008, atomtest.Uint32s(50), nil, 0x01000A01, 2,
+		5, 0xFFFFFFF6, 5, 20)
+	file := bytes.Join([][]byte{
+		ftyp, moov,
+		moof1, atomtest.Build("mdat", make([]byte, 60)),
+		moof2, atomtest.Build("mdat", make([]byte, 10)),
+	}, nil)
+
+	tree := parseTree(t, moov)
+	tracks, err := ReadTracks(tree, bytes.NewReader(file), int64(len(file)))
+	assert.NoError(t, err)
+	assert.Len(t, tracks, 1)
+
+	data1 := uint64(len(ftyp) + len(moov) + len(moof1) + 8)
+	data2 := data1 + 60 + uint64(len(moof2)) + 8
+	assert.Equal(t, []track.Sample{
+		{Offset: data1, Size: 10, DecodeTime: 0, Duration: 40, Sync: true, DescriptionIndex: 1},
+		{Offset: data1 + 10, Size: 20, DecodeTime: 40, Duration: 40, DescriptionIndex: 1},
+		{Offset: data1 + 30, Size: 30, DecodeTime: 80, Duration: 40, DescriptionIndex: 1},
+		{Offset: data2, Size: 5, DecodeTime: 120, Duration: 50, CompositionOffset: -10, DescriptionIndex: 1},
+		{Offset: data2 + 5, Size: 5, DecodeTime: 170, Duration: 50, CompositionOffset: 20, DescriptionIndex: 1},
+	}, tracks[0].Samples)
+	assert.Equal(t, uint64(220), tracks[0].Duration)
+	assert.Equal(t, 2, tracks[0].Fragments)
+}
+
+// TestReadTracksRunWithoutSampleFields tests that the samples of a track run without sample fields take
+// the defaults of the track fragment
+func TestReadTracksRunWithoutSampleFields(t *testing.T) {
+	ftyp := atomtest.Build("ftyp", []byte("iso6"), atomtest.Uint32s(0))
+	moov := fragmentedMovieHeader()
+	moof := movieFragment(1, 0x020010, atomtest.Uint32s(8), nil, 0x000001, 3)
+	file := bytes.Join([][]byte{ftyp, moov, moof, atomtest.Build("mdat", make([]byte, 24))}, nil)
+
+	tracks, err := ReadTracks(parseTree(t, moov), bytes.NewReader(file), int64(len(file)))
+	assert.NoError(t, err)
+	data := uint64(len(ftyp) + len(moov) + len(moof) + 8)
+	assert.Equal(t, []track.Sample{
+		{Offset: data, Size: 8, DecodeTime: 0, Duration: 40, DescriptionIndex: 1},
+		{Offset: data + 8, Size: 8, DecodeTime: 40, Duration: 40, DescriptionIndex: 1},
+		{Offset: data + 16, Size: 8, DecodeTime: 80, Duration: 40, DescriptionIndex: 1},
+	}, tracks[0].Samples)
+}
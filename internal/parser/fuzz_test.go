@@ -0,0 +1,105 @@
+package parser
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/KrzysztofHeinke/quicktime-movie-parser/internal/atomtest"
+	"github.com/KrzysztofHeinke/quicktime-movie-parser/pkg/models/atoms"
+	"github.com/stretchr/testify/assert"
+)
+
+// seedFiles returns the files built by the tests of the package together with synthetic variants
+func seedFiles() [][]byte {
+	ftyp := atomtest.FileType("isom", "mp41")
+	fragmented := bytes.Join([][]byte{
+		ftyp,
+		fragmentedMovieHeader(),
+		movieFragment(1, 0x020000, nil, atomtest.Build("tfdt", atomtest.Uint32s(0, 0)), 0x000301, 2, 40, 10, 40, 10),
+		atomtest.Build("mdat", make([]byte, 20)),
+	}, nil)
+	entry := visualSampleEntry("encv", 1280, 720,
+		atomtest.Build("pasp", atomtest.Uint32s(1, 1)),
+		atomtest.Build("sinf", atomtest.Build("frma", []byte("avc1")), atomtest.Build("schm", atomtest.Uint32s(0), []byte("cenc"), atomtest.Uint32s(0x00010000))),
+	)
+	metadata := atomtest.Build("udta",
+		atomtest.Build("\xa9nam", userDataText(0x55C4, "title")),
+		atomtest.Build("meta", atomtest.Uint32s(0), handlerAtom("mdir"), atomtest.Build("ilst", atomtest.Build("\xa9ART", dataAtom("artist")))),
+	)
+	largeSize := append(atomtest.Uint32s(1), []byte("free")...)
+	largeSize = append(append(largeSize, atomtest.Uint32s(0, 24)...), make([]byte, 8)...)
+	return [][]byte{
+		timecodeMovie(3600),
+		indexedFile([2]uint32{40, 40}, 0),
+		fragmented,
+		bytes.Join([][]byte{ftyp, damagedMovie()}, nil),
+		bytes.Join([][]byte{ftyp, largeSize, atomtest.Build("moov", videoTrak(entry), metadata)}, nil),
+		atomtest.Build("moov", nestedAtoms(20)),
+	}
+}
+
+// inspect runs what the parse command does with a tree on it, with data as the file
+func inspect(root atoms.AtomIf, data []byte) {
+	r := bytes.NewReader(data)
+	CollectTrackInfo(root)
+	CollectMetadata(root)
+	CollectProtectionSystems(root)
+	if tracks, err := ReadTracks(root, r, int64(len(data))); err == nil {
+		LogTracks(root, tracks)
+		_, _ = CheckSegmentIndexes(r, int64(len(data)), tracks)
+	}
+	CollectTimecodes(root, r)
+	_, _ = CollectChapters(root, r)
+}
+
+// FuzzCreateTreeOfAtoms tests that building trees in strict and lenient mode never panics, that lenient
+// mode accepts whatever strict mode does, and that the trees can be inspected
+func FuzzCreateTreeOfAtoms(f *testing.F) {
+	atomtest.SetFuzzLimits(f)
+	f.Add(tkhdData)
+	for _, file := range seedFiles() {
+		f.Add(file)
+	}
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		atomtest.CheckAllocation(t, func() {
+			tree, err := CreateTreeOfAtoms(bytes.NewReader(data))
+			if err == nil {
+				inspect(CleanEmptyHeaders(tree), data)
+			}
+			lenientTree, problems := CreateTreeOfAtomsLenient(bytes.NewReader(data), 0)
+			if err == nil {
+				assert.Empty(t, problems, "Expected no problems with data the strict mode accepts")
+			}
+			inspect(CleanEmptyHeaders(lenientTree), data)
+		})
+	})
+}
+
+// FuzzReadFile tests that walking the top level atoms of a file and reading its movie atom, in strict and
+// lenient mode, never panics
+func FuzzReadFile(f *testing.F) {
+	atomtest.SetFuzzLimits(f)
+	for _, file := range seedFiles() {
+		f.Add(file)
+	}
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		atomtest.CheckAllocation(t, func() {
+			r := bytes.NewReader(data)
+			_, _ = ReadFileType(r, int64(len(data)))
+			if topLevelAtoms, err := ReadTopLevelAtoms(r, int64(len(data))); err == nil {
+				if moov, ok := FindTopLevelAtom(topLevelAtoms, "moov"); ok {
+					if tree, err := ReadTopLevelAtom(r, moov); err == nil {
+						root := &atoms.CompositeAtom{}
+						root.AddChild(tree)
+						inspect(root, data)
+					}
+				}
+			}
+			if tree, _, err := readTreeLenient(r, int64(len(data))); err == nil {
+				inspect(tree, data)
+			}
+		})
+	})
+}
@@ -0,0 +1,128 @@
+package parser
+
+import (
+	"encoding/binary"
+
+	"github.com/KrzysztofHeinke/quicktime-movie-parser/pkg/models/atoms"
+	"github.com/KrzysztofHeinke/quicktime-movie-parser/pkg/models/metadata"
+	"github.com/sirupsen/logrus"
+)
+
+// CollectMetadata gathers the movie metadata from the classic QuickTime user data atoms
+// and from the 'meta' atoms ('mdta' keys or iTunes style items).
+func CollectMetadata(root atoms.AtomIf) *metadata.Metadata {
+	result := &metadata.Metadata{}
+
+	moov := findMovieAtom(root)
+	if moov == nil {
+		return result
+	}
+
+	if meta, ok := moov.GetChild("meta").(*atoms.CompositeAtom); ok {
+		collectMetaItems(meta, result)
+	}
+	if udta, ok := moov.GetChild("udta").(*atoms.CompositeAtom); ok {
+		for _, child := range udta.GetChildren() {
+			switch atom := child.(type) {
+			case *atoms.LeafAtom:
+				if text, ok := atom.Data.(*atoms.UserDataTextAtom); ok {
+					for _, entry := range text.Entries {
+						result.Add(metadata.Item{
+							Key:      displayType(atom.GetType()),
+							Value:    entry.Text,
+							Language: atoms.DecodeLanguage(entry.Language),
+						})
+					}
+				}
+			case *atoms.CompositeAtom:
+				if atom.GetType() == "meta" {
+					collectMetaItems(atom, result)
+				}
+			}
+		}
+	}
+
+	return result
+}
+
+// collectMetaItems adds the items of the 'ilst' atom, resolving 'mdta' key indexes through the 'keys' atom.
+func collectMetaItems(meta *atoms.CompositeAtom, result *metadata.Metadata) {
+	keys, _ := meta.LeafData("keys").(*atoms.KeysAtom)
+	ilst, ok := meta.GetChild("ilst").(*atoms.CompositeAtom)
+	if !ok {
+		return
+	}
+
+	for _, child := range ilst.GetChildren() {
+		item, ok := child.(*atoms.CompositeAtom)
+		if !ok {
+			continue
+		}
+		key := displayType(item.GetType())
+		if keys != nil {
+			index := binary.BigEndian.Uint32(item.Type[:])
+			if name, ok := keys.GetKey(index); ok {
+				key = name
+			}
+		}
+		for _, itemChild := range item.GetChildren() {
+			if leaf, ok := itemChild.(*atoms.LeafAtom); ok {
+				if data, ok := leaf.Data.(*atoms.DataAtom); ok {
+					result.Add(metadata.Item{Key: key, Value: data.String()})
+				}
+			}
+		}
+	}
+}
+
+// findMovieAtom returns the 'moov' atom, accepting either the root of the tree or the atom itself.
+func findMovieAtom(root atoms.AtomIf) *atoms.CompositeAtom {
+	composite, ok := root.(*atoms.CompositeAtom)
+	if !ok {
+		return nil
+	}
+	if composite.GetType() == "moov" {
+		return composite
+	}
+	moov, _ := composite.GetChild("moov").(*atoms.CompositeAtom)
+	return moov
+}
+
+// displayType returns the atom type with the leading 0xA9 byte of user data atoms shown as '©'.
+func displayType(atomType string) string {
+	if len(atomType) > 0 && atomType[0] == 0xA9 {
+		return "©" + atomType[1:]
+	}
+	return atomType
+}
+
+// LogMetadata prints the collected movie metadata.
+func LogMetadata(md *metadata.Metadata) {
+	if md.Title != "" {
+		logrus.Infof("Title: %s", md.Title)
+	}
+	if md.Make != "" || md.Model != "" {
+		logrus.Infof("Device: Make = %s, Model = %s", md.Make, md.Model)
+	}
+	if md.Software != "" {
+		logrus.Infof("Software: %s", md.Software)
+	}
+	if md.CreationDate != "" {
+		logrus.Infof("Creation Date: %s", md.CreationDate)
+	}
+	if md.Location != nil {
+		if md.Location.HasAltitude {
+			logrus.Infof("Location: Latitude = %.4f, Longitude = %.4f, Altitude = %.2f m",
+				md.Location.Latitude, md.Location.Longitude, md.Location.Altitude)
+		} else {
+			logrus.Infof("Location: Latitude = %.4f, Longitude = %.4f", md.Location.Latitude, md.Location.Longitude)
+		}
+	}
+	for _, item := range md.Items {
+		if item.Language != "" {
+			logrus.Debugf("Metadata: %s [%s] = %s", item.Key, item.Language, item.Value)
+		} else {
+			logrus.Debugf("Metadata: %s = %s", item.Key, item.Value)
+		}
+	}
+}
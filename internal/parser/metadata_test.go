@@ -0,0 +1,94 @@
+package parser
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+
+	"github.com/KrzysztofHeinke/quicktime-movie-parser/internal/atomtest"
+	"github.com/stretchr/testify/assert"
+)
+
+// userDataText builds the payload of a classic '©xxx' user data atom
+func userDataText(language uint16, text string) []byte {
+	result := make([]byte, 4, 4+len(text))
+	binary.BigEndian.PutUint16(result, uint16(len(text)))
+	binary.BigEndian.PutUint16(result[2:], language)
+	return append(result, text...)
+}
+
+// dataAtom builds a UTF-8 'data' atom
+func dataAtom(value string) []byte {
+	return atomtest.Build("data", []byte{0, 0, 0, 1, 0, 0, 0, 0}, []byte(value))
+}
+
+// TestCollectMetadataUserData tests decoding of classic QuickTime '©xxx' user data atoms
+func TestCollectMetadataUserData(t *testing.T) {
+	moov := atomtest.Build("moov",
+		atomtest.Build("udta",
+			atomtest.Build("\xa9mak", userDataText(0x55c4, "Apple")),
+			atomtest.Build("\xa9mod", userDataText(0x55c4, "iPhone 12")),
+			atomtest.Build("\xa9day", userDataText(0x55c4, "2024-05-01T10:00:00+0200")),
+			atomtest.Build("\xa9xyz", userDataText(0x15c7, "+52.2297+021.0122/")),
+		),
+	)
+
+	tree, err := CreateTreeOfAtoms(bytes.NewReader(moov))
+	assert.NoError(t, err, "Expected no error creating tree of atoms")
+
+	md := CollectMetadata(CleanEmptyHeaders(tree))
+	assert.Equal(t, "Apple", md.Make)
+	assert.Equal(t, "iPhone 12", md.Model)
+	assert.Equal(t, "2024-05-01T10:00:00+0200", md.CreationDate)
+	assert.NotNil(t, md.Location, "Expected location to be decoded")
+	assert.InDelta(t, 52.2297, md.Location.Latitude, 1e-9)
+	assert.InDelta(t, 21.0122, md.Location.Longitude, 1e-9)
+}
+
+// TestCollectMetadataKeys tests decoding of 'mdta' keyed metadata
+func TestCollectMetadataKeys(t *testing.T) {
+	key := func(name string) []byte {
+		result := make([]byte, 4)
+		binary.BigEndian.PutUint32(result, uint32(8+len(name)))
+		return append(append(result, "mdta"...), name...)
+	}
+	hdlr := atomtest.Build("hdlr", make([]byte, 8), []byte("mdta"), make([]byte, 12), []byte{0})
+	keys := atomtest.Build("keys", []byte{0, 0, 0, 0, 0, 0, 0, 3},
+		key("com.apple.quicktime.make"),
+		key("com.apple.quicktime.creationdate"),
+		key("com.apple.quicktime.location.ISO6709"))
+	ilst := atomtest.Build("ilst",
+		atomtest.Build("\x00\x00\x00\x01", dataAtom("Apple")),
+		atomtest.Build("\x00\x00\x00\x02", dataAtom("2024-05-01T10:00:00+0200")),
+		atomtest.Build("\x00\x00\x00\x03", dataAtom("+37.3318-122.0312+045.000/")),
+	)
+	moov := atomtest.Build("moov", atomtest.Build("meta", hdlr, keys, ilst))
+
+	tree, err := CreateTreeOfAtoms(bytes.NewReader(moov))
+	assert.NoError(t, err, "Expected no error creating tree of atoms")
+
+	md := CollectMetadata(CleanEmptyHeaders(tree))
+	assert.Equal(t, "Apple", md.Make)
+	assert.Equal(t, "2024-05-01T10:00:00+0200", md.CreationDate)
+	assert.NotNil(t, md.Location, "Expected location to be decoded")
+	assert.InDelta(t, 37.3318, md.Location.Latitude, 1e-9)
+	assert.InDelta(t, -122.0312, md.Location.Longitude, 1e-9)
+	assert.True(t, md.Location.HasAltitude)
+	assert.InDelta(t, 45.0, md.Location.Altitude, 1e-9)
+}
+
+// TestCollectMetadataItunesStyle tests the ISO 'meta' full atom with iTunes style items
+func TestCollectMetadataItunesStyle(t *testing.T) {
+	hdlr := atomtest.Build("hdlr", make([]byte, 8), []byte("mdir"), make([]byte, 12), []byte{0})
+	ilst := atomtest.Build("ilst", atomtest.Build("\xa9nam", dataAtom("Surfing")))
+	moov := atomtest.Build("moov", atomtest.Build("udta", atomtest.Build("meta", make([]byte, 4), hdlr, ilst)))
+
+	tree, err := CreateTreeOfAtoms(bytes.NewReader(moov))
+	assert.NoError(t, err, "Expected no error creating tree of atoms")
+
+	md := CollectMetadata(CleanEmptyHeaders(tree))
+	assert.Equal(t, "Surfing", md.Title)
+	value, ok := md.Get("©nam")
+	assert.True(t, ok)
+	assert.Equal(t, "Surfing", value)
+}
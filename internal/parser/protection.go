@@ -0,0 +1,63 @@
+package parser
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/KrzysztofHeinke/quicktime-movie-parser/pkg/models/atoms"
+	"github.com/sirupsen/logrus"
+)
+
+// logProtectionInfo prints the protection scheme and the default encryption parameters of a protected sample entry.
+func logProtectionInfo(entry *atoms.SampleEntry) {
+	if !entry.IsProtected() {
+		return
+	}
+	scheme := "unknown"
+	if schm, ok := entry.GetExtension("schm").(*atoms.SchmAtom); ok {
+		scheme = schm.GetSchemeType()
+	}
+	logrus.Infof("Encryption: Scheme = %s, Original Format = %s, Sample Entry = %s\n", scheme, entry.GetOriginalFormat(), entry.GetType())
+
+	tenc, ok := entry.GetExtension("tenc").(*atoms.TencAtom)
+	if !ok {
+		return
+	}
+	pattern := "none"
+	if tenc.HasPattern() {
+		pattern = fmt.Sprintf("%d:%d", tenc.DefaultCryptByteBlock, tenc.DefaultSkipByteBlock)
+	}
+	ivSize := fmt.Sprintf("%d", tenc.GetIVSize())
+	if tenc.DefaultPerSampleIVSize == 0 && len(tenc.DefaultConstantIV) > 0 {
+		ivSize += " (constant)"
+	}
+	logrus.Infof("Encryption: Default KID = %s, Protected = %t, IV Size = %s, Pattern = %s\n",
+		atoms.FormatUUID(tenc.DefaultKID), tenc.DefaultIsProtected == 1, ivSize, pattern)
+}
+
+// CollectProtectionSystems returns the 'pssh' atoms found in the tree
+func CollectProtectionSystems(root atoms.AtomIf) []*atoms.PsshAtom {
+	composite, ok := root.(*atoms.CompositeAtom)
+	if !ok {
+		return nil
+	}
+	var systems []*atoms.PsshAtom
+	for _, atom := range composite.FindAll("pssh") {
+		if pssh, ok := leafData(atom).(*atoms.PsshAtom); ok {
+			systems = append(systems, pssh)
+		}
+	}
+	return systems
+}
+
+// LogProtectionSystems prints the DRM systems and key IDs of the 'pssh' atoms
+func LogProtectionSystems(systems []*atoms.PsshAtom) {
+	for _, pssh := range systems {
+		kids := make([]string, len(pssh.KIDs))
+		for i, kid := range pssh.KIDs {
+			kids[i] = atoms.FormatUUID(kid)
+		}
+		logrus.Infof("Protection System: %s (%s), KIDs = [%s], Data Size = %d\n",
+			pssh.GetSystemName(), atoms.FormatUUID(pssh.SystemID), strings.Join(kids, ", "), len(pssh.Data))
+	}
+}
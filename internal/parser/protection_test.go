@@ -0,0 +1,50 @@
+package parser
+
+import (
+	"testing"
+
+	"github.com/KrzysztofHeinke/quicktime-movie-parser/internal/atomtest"
+	"github.com/KrzysztofHeinke/quicktime-movie-parser/pkg/models/atoms"
+	"github.com/stretchr/testify/assert"
+)
+
+// TestProtectedSampleEntry tests resolving the scheme and original format of an 'encv' sample entry
+func TestProtectedSampleEntry(t *testing.T) {
+	kid := []byte{0x10, 0x11, 0x12, 0x13, 0x14, 0x15, 0x16, 0x17, 0x18, 0x19, 0x1A, 0x1B, 0x1C, 0x1D, 0x1E, 0x1F}
+	entry := visualSampleEntry("encv", 1280, 720,
+		atomtest.Build("sinf",
+			atomtest.Build("frma", []byte("avc1")),
+			atomtest.Build("schm", atomtest.Uint32s(0), []byte("cbcs"), atomtest.Uint32s(0x00010000)),
+			atomtest.Build("schi",
+				atomtest.Build("tenc", []byte{1, 0, 0, 0, 0, 0x19, 1, 0}, kid, []byte{16}, make([]byte, 16)),
+			),
+		),
+	)
+	widevine := []byte{0xED, 0xEF, 0x8B, 0xA9, 0x79, 0xD6, 0x4A, 0xCE, 0xA3, 0xC8, 0x27, 0xDC, 0xD5, 0x1D, 0x21, 0xED}
+	pssh := atomtest.Build("pssh", atomtest.Uint32s(0x01000000), widevine, atomtest.Uint32s(1), kid, atomtest.Uint32s(3), []byte{1, 2, 3})
+	tree := parseTree(t, atomtest.Build("moov", pssh, videoTrak(entry)))
+
+	stsd, ok := tree.LeafData("moov", "trak", "mdia", "minf", "stbl", "stsd").(*atoms.AtomStsd)
+	assert.True(t, ok, "Expected stsd atom")
+	sampleEntry := &stsd.SampleEntries[0]
+	assert.True(t, sampleEntry.IsProtected())
+	assert.Equal(t, "avc1", sampleEntry.GetOriginalFormat())
+
+	schm, ok := sampleEntry.GetExtension("schm").(*atoms.SchmAtom)
+	assert.True(t, ok, "Expected schm atom")
+	assert.Equal(t, "cbcs", schm.GetSchemeType())
+
+	tenc, ok := sampleEntry.GetExtension("tenc").(*atoms.TencAtom)
+	assert.True(t, ok, "Expected tenc atom")
+	assert.Equal(t, "10111213-1415-1617-1819-1a1b1c1d1e1f", atoms.FormatUUID(tenc.DefaultKID))
+	assert.True(t, tenc.HasPattern())
+	assert.Equal(t, uint8(1), tenc.DefaultCryptByteBlock)
+	assert.Equal(t, uint8(9), tenc.DefaultSkipByteBlock)
+	assert.Equal(t, 16, tenc.GetIVSize())
+
+	systems := CollectProtectionSystems(tree)
+	assert.Len(t, systems, 1)
+	assert.Equal(t, "Widevine", systems[0].GetSystemName())
+	assert.Len(t, systems[0].KIDs, 1)
+	assert.Equal(t, []byte{1, 2, 3}, systems[0].Data)
+}
@@ -0,0 +1,272 @@
+package parser
+
+import (
+	"fmt"
+	"io"
+	"math"
+
+	"github.com/KrzysztofHeinke/quicktime-movie-parser/internal/track"
+	"github.com/KrzysztofHeinke/quicktime-movie-parser/pkg/models/atoms"
+	"github.com/sirupsen/logrus"
+)
+
+// SegmentIndex is a 'sidx' atom found at the top level of the file together with the 'ssix' atom following it
+type SegmentIndex struct {
+	Offset int64
+	Size   int64
+	Sidx   *atoms.SidxAtom
+	Ssix   *atoms.SsixAtom
+}
+
+// leafData returns the decoded data of a leaf atom or nil
+func leafData(atom atoms.AtomIf) any {
+	if leaf, ok := atom.(*atoms.LeafAtom); ok {
+		return leaf.Data
+	}
+	return nil
+}
+
+// ReadSegmentIndexes reads every 'sidx' atom found at the top level of the file
+func ReadSegmentIndexes(r io.ReaderAt, topLevelAtoms []TopLevelAtom) ([]SegmentIndex, error) {
+	var indexes []SegmentIndex
+	for i, atom := range topLevelAtoms {
+		if atom.Type != "sidx" {
+			continue
+		}
+		parsed, err := ReadTopLevelAtom(r, atom)
+		if err != nil {
+			return nil, err
+		}
+		sidx, ok := leafData(parsed).(*atoms.SidxAtom)
+		if !ok {
+			return nil, fmt.Errorf("sidx atom at offset %d could not be decoded", atom.Offset)
+		}
+		index := SegmentIndex{Offset: atom.Offset, Size: atom.Size, Sidx: sidx}
+
+		if i+1 < len(topLevelAtoms) && topLevelAtoms[i+1].Type == "ssix" {
+			parsed, err := ReadTopLevelAtom(r, topLevelAtoms[i+1])
+			if err != nil {
+				return nil, err
+			}
+			if ssix, ok := leafData(parsed).(*atoms.SsixAtom); ok {
+				index.Ssix = ssix
+			}
+		}
+		indexes = append(indexes, index)
+	}
+	return indexes, nil
+}
+
+// ReadRandomAccess reads the 'mfra' atom of the file, returning nil when the file has none
+func ReadRandomAccess(r io.ReaderAt, topLevelAtoms []TopLevelAtom) (*atoms.CompositeAtom, error) {
+	atom, ok := FindTopLevelAtom(topLevelAtoms, "mfra")
+	if !ok {
+		return nil, nil
+	}
+	parsed, err := ReadTopLevelAtom(r, atom)
+	if err != nil {
+		return nil, err
+	}
+	mfra, ok := parsed.(*atoms.CompositeAtom)
+	if !ok {
+		return nil, fmt.Errorf("mfra atom at offset %d is not a composite atom", atom.Offset)
+	}
+	return mfra, nil
+}
+
+// VerifySegmentIndexes checks that the references of the segment indexes match the byte ranges of the
+// top level atoms and the durations of the samples they cover. It returns the list of mismatches found.
+func VerifySegmentIndexes(topLevelAtoms []TopLevelAtom, indexes []SegmentIndex, tracks []*track.Track) []string {
+	var problems []string
+	starts := map[int64]TopLevelAtom{}
+	ends := map[int64]bool{}
+	for _, atom := range topLevelAtoms {
+		starts[atom.Offset] = atom
+		ends[atom.Offset+atom.Size] = true
+	}
+	sidxByOffset := map[int64]*atoms.SidxAtom{}
+	for _, index := range indexes {
+		sidxByOffset[index.Offset] = index.Sidx
+	}
+	tracksByID := map[uint32]*track.Track{}
+	for _, t := range tracks {
+		tracksByID[t.ID] = t
+	}
+
+	for _, index := range indexes {
+		sidx := index.Sidx
+		t := tracksByID[sidx.ReferenceID]
+		if t == nil {
+			problems = append(problems, fmt.Sprintf("sidx at offset %d references unknown track %d", index.Offset, sidx.ReferenceID))
+		}
+
+		start := index.Offset + index.Size + int64(sidx.FirstOffset)
+		for i, reference := range sidx.References {
+			end := start + int64(reference.ReferencedSize)
+			prefix := fmt.Sprintf("sidx at offset %d, reference %d (bytes %d-%d)", index.Offset, i+1, start, end)
+
+			first, ok := starts[start]
+			if !ok {
+				problems = append(problems, prefix+": does not start at an atom boundary")
+			}
+			if !ends[end] {
+				problems = append(problems, prefix+": does not end at an atom boundary")
+			}
+
+			if reference.IsIndexReference() {
+				if referenced := sidxByOffset[start]; referenced == nil {
+					problems = append(problems, prefix+": does not point to a sidx atom")
+				} else if referenced.GetDuration() != uint64(reference.SubsegmentDuration) {
+					problems = append(problems, fmt.Sprintf("%s: duration %d differs from the %d of the referenced sidx",
+						prefix, reference.SubsegmentDuration, referenced.GetDuration()))
+				}
+			} else {
+				if ok && !rangeContainsAtom(topLevelAtoms, start, end, "moof") {
+					problems = append(problems, fmt.Sprintf("%s: no moof atom in the referenced range starting with %s", prefix, first.Type))
+				}
+				if t != nil {
+					if problem := verifySubsegmentDuration(t, sidx, reference, start, end); problem != "" {
+						problems = append(problems, prefix+": "+problem)
+					}
+				}
+			}
+			start = end
+		}
+
+		if index.Ssix != nil {
+			problems = append(problems, verifySubsegmentIndex(index)...)
+		}
+	}
+	return problems
+}
+
+// rangeContainsAtom tells whether a top level atom of the type lies within the byte range
+func rangeContainsAtom(topLevelAtoms []TopLevelAtom, start, end int64, atomType string) bool {
+	for _, atom := range topLevelAtoms {
+		if atom.Type == atomType && atom.Offset >= start && atom.Offset+atom.Size <= end {
+			return true
+		}
+	}
+	return false
+}
+
+// verifySubsegmentDuration compares the duration of a media reference with the duration of the track's
+// samples whose data lies within the referenced byte range.
+func verifySubsegmentDuration(t *track.Track, sidx *atoms.SidxAtom, reference atoms.SegmentReference, start, end int64) string {
+	var duration uint64
+	for _, sample := range t.Samples {
+		if int64(sample.Offset) >= start && int64(sample.Offset) < end {
+			duration += uint64(sample.Duration)
+		}
+	}
+
+	expected := duration
+	tolerance := uint64(0)
+	if t.TimeScale != sidx.TimeScale {
+		if t.TimeScale == 0 {
+			return fmt.Sprintf("track %d has no time scale", t.ID)
+		}
+		expected = uint64(math.Round(float64(duration) * float64(sidx.TimeScale) / float64(t.TimeScale)))
+		tolerance = 1
+	}
+	actual := uint64(reference.SubsegmentDuration)
+	if max(actual, expected)-min(actual, expected) > tolerance {
+		return fmt.Sprintf("duration %d differs from the %d of the samples in the range", actual, expected)
+	}
+	return ""
+}
+
+// verifySubsegmentIndex checks that the 'ssix' atom describes every subsegment of its 'sidx' atom
+// and that the ranges of each subsegment add up to its size.
+func verifySubsegmentIndex(index SegmentIndex) []string {
+	var problems []string
+	if int(index.Ssix.SubsegmentCount) != len(index.Sidx.References) {
+		return append(problems, fmt.Sprintf("ssix after sidx at offset %d has %d subsegments, sidx has %d references",
+			index.Offset, index.Ssix.SubsegmentCount, len(index.Sidx.References)))
+	}
+	for i, ranges := range index.Ssix.Subsegments {
+		var size uint64
+		for _, subsegmentRange := range ranges {
+			size += uint64(subsegmentRange.RangeSize)
+		}
+		if referenced := uint64(index.Sidx.References[i].ReferencedSize); size != referenced {
+			problems = append(problems, fmt.Sprintf("ssix after sidx at offset %d: ranges of subsegment %d cover %d of %d bytes",
+				index.Offset, i+1, size, referenced))
+		}
+	}
+	return problems
+}
+
+// VerifyRandomAccess checks that the 'mfro' atom holds the size of the 'mfra' atom and that every
+// 'tfra' entry points to a 'moof' atom.
+func VerifyRandomAccess(topLevelAtoms []TopLevelAtom, mfra *atoms.CompositeAtom) []string {
+	var problems []string
+	if mfra == nil {
+		return nil
+	}
+	if atom, ok := FindTopLevelAtom(topLevelAtoms, "mfra"); ok {
+		if mfro, ok := mfra.LeafData("mfro").(*atoms.MfroAtom); !ok {
+			problems = append(problems, "mfra atom has no mfro atom")
+		} else if int64(mfro.Size) != atom.Size {
+			problems = append(problems, fmt.Sprintf("mfro size %d differs from the mfra size %d", mfro.Size, atom.Size))
+		}
+	}
+
+	moofs := map[uint64]bool{}
+	for _, atom := range topLevelAtoms {
+		if atom.Type == "moof" {
+			moofs[uint64(atom.Offset)] = true
+		}
+	}
+	for _, atom := range mfra.FindAll("tfra") {
+		tfra, ok := leafData(atom).(*atoms.TfraAtom)
+		if !ok {
+			continue
+		}
+		for i, entry := range tfra.Entries {
+			if !moofs[entry.MoofOffset] {
+				problems = append(problems, fmt.Sprintf("tfra of track %d, entry %d: offset %d does not point to a moof atom",
+					tfra.TrackID, i+1, entry.MoofOffset))
+			}
+		}
+	}
+	return problems
+}
+
+// CheckSegmentIndexes reads, logs and verifies the segment indexes and random access tables of the file.
+// It returns the mismatches found between the tables and the fragments.
+func CheckSegmentIndexes(r io.ReaderAt, fileSize int64, tracks []*track.Track) ([]string, error) {
+	topLevelAtoms, err := ReadTopLevelAtoms(r, fileSize)
+	if err != nil {
+		return nil, err
+	}
+	indexes, err := ReadSegmentIndexes(r, topLevelAtoms)
+	if err != nil {
+		return nil, err
+	}
+	mfra, err := ReadRandomAccess(r, topLevelAtoms)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, index := range indexes {
+		duration := 0.0
+		if index.Sidx.TimeScale != 0 {
+			duration = float64(index.Sidx.GetDuration()) / float64(index.Sidx.TimeScale)
+		}
+		logrus.Infof("Segment index at offset %d: Track = %d, References = %d, Duration = %.3f s",
+			index.Offset, index.Sidx.ReferenceID, len(index.Sidx.References), duration)
+		if index.Ssix != nil {
+			logrus.Infof("Subsegment index at offset %d: Subsegments = %d", index.Offset+index.Size, index.Ssix.SubsegmentCount)
+		}
+	}
+	if mfra != nil {
+		for _, atom := range mfra.FindAll("tfra") {
+			if tfra, ok := leafData(atom).(*atoms.TfraAtom); ok {
+				logrus.Infof("Random access table: Track = %d, Entries = %d", tfra.TrackID, len(tfra.Entries))
+			}
+		}
+	}
+
+	return append(VerifySegmentIndexes(topLevelAtoms, indexes, tracks), VerifyRandomAccess(topLevelAtoms, mfra)...), nil
+}
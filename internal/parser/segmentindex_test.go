@@ -0,0 +1,61 @@
+package parser
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/KrzysztofHeinke/quicktime-movie-parser/internal/atomtest"
+	"github.com/stretchr/testify/assert"
+)
+
+// indexedFile builds a fragmented file with a 'sidx' atom describing two single-sample fragments
+// and an 'mfra' atom pointing to both 'moof' atoms
+func indexedFile(durations [2]uint32, mfroSize int) []byte {
+	ftyp := atomtest.Build("ftyp", []byte("iso6"), atomtest.Uint32s(0))
+	moov := fragmentedMovieHeader()
+	moof1 := movieFragment(1, 0x020000, nil, atomtest.Build("tfdt", atomtest.Uint32s(0, 0)), 0x000201, 1, 10)
+	mdat1 := atomtest.Build("mdat", make([]byte, 10))
+	moof2 := movieFragment(2, 0x020000, nil, atomtest.Build("tfdt", atomtest.Uint32s(0, 40)), 0x000201, 1, 10)
+	mdat2 := atomtest.Build("mdat", make([]byte, 10))
+
+	sidx := atomtest.Build("sidx", atomtest.Uint32s(0, 1, 1000, 0, 0, 2),
+		atomtest.Uint32s(uint32(len(moof1)+len(mdat1)), durations[0], 0x90000000),
+		atomtest.Uint32s(uint32(len(moof2)+len(mdat2)), durations[1], 0x90000000),
+	)
+	moof1Offset := len(ftyp) + len(moov) + len(sidx)
+	moof2Offset := moof1Offset + len(moof1) + len(mdat1)
+	tfra := atomtest.Build("tfra", atomtest.Uint32s(0, 1, 0, 2),
+		atomtest.Uint32s(0, uint32(moof1Offset)), []byte{1, 1, 1},
+		atomtest.Uint32s(40, uint32(moof2Offset)), []byte{1, 1, 1},
+	)
+	mfra := atomtest.Build("mfra", tfra, atomtest.Build("mfro", atomtest.Uint32s(0, uint32(len(tfra)+24+mfroSize))))
+	return bytes.Join([][]byte{ftyp, moov, sidx, moof1, mdat1, moof2, mdat2, mfra}, nil)
+}
+
+// TestVerifySegmentIndexes tests checking the segment index and random access tables against the fragments
+func TestVerifySegmentIndexes(t *testing.T) {
+	check := func(file []byte) []string {
+		reader := bytes.NewReader(file)
+		tracks, err := ReadTracks(parseTree(t, fragmentedMovieHeader()), reader, int64(len(file)))
+		assert.NoError(t, err)
+		topLevelAtoms, err := ReadTopLevelAtoms(reader, int64(len(file)))
+		assert.NoError(t, err)
+		indexes, err := ReadSegmentIndexes(reader, topLevelAtoms)
+		assert.NoError(t, err)
+		assert.Len(t, indexes, 1)
+		mfra, err := ReadRandomAccess(reader, topLevelAtoms)
+		assert.NoError(t, err)
+		assert.NotNil(t, mfra)
+		problems, err := CheckSegmentIndexes(reader, int64(len(file)), tracks)
+		assert.NoError(t, err)
+		return problems
+	}
+
+	assert.Empty(t, check(indexedFile([2]uint32{40, 40}, 0)))
+
+	problems := check(indexedFile([2]uint32{40, 50}, 4))
+	assert.Len(t, problems, 2)
+	assert.Contains(t, problems[0], "reference 2")
+	assert.Contains(t, problems[0], "duration 50 differs from the 40")
+	assert.Contains(t, problems[1], "mfro size")
+}
@@ -0,0 +1,95 @@
+package parser
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+
+	"github.com/KrzysztofHeinke/quicktime-movie-parser/internal/track"
+	"github.com/KrzysztofHeinke/quicktime-movie-parser/pkg/models/atoms"
+	"github.com/sirupsen/logrus"
+)
+
+// Timecode is the start timecode of a 'tmcd' track
+type Timecode struct {
+	TrackID    uint32
+	StartFrame int64
+	Timecode   string
+	FrameRate  float64
+	DropFrame  bool
+	ReelName   string
+}
+
+// CollectTimecodes reads the start timecode of every 'tmcd' track. The timecode track holds a single
+// sample with the frame number of the first frame, which is read from the file through the sample tables.
+func CollectTimecodes(root atoms.AtomIf, r io.ReaderAt) []Timecode {
+	var timecodes []Timecode
+
+	composite, ok := root.(*atoms.CompositeAtom)
+	if !ok {
+		return nil
+	}
+	for _, atom := range composite.FindAll("trak") {
+		trakAtom, ok := atom.(*atoms.CompositeAtom)
+		if !ok {
+			continue
+		}
+		if hdlr, ok := trakAtom.LeafData("mdia", "hdlr").(*atoms.HdlrAtom); !ok || hdlr.GetHandlerType() != "tmcd" {
+			continue
+		}
+
+		timecode, err := readTimecode(trakAtom, r)
+		if err != nil {
+			logrus.Warnf("Failed to read timecode track: %v", err)
+			continue
+		}
+		timecodes = append(timecodes, *timecode)
+	}
+
+	return timecodes
+}
+
+// readTimecode decodes the sample description and the first sample of a timecode track.
+func readTimecode(trakAtom *atoms.CompositeAtom, r io.ReaderAt) (*Timecode, error) {
+	tmcdTrack, err := track.NewTrack(trakAtom, atoms.NewBudget(atoms.CurrentLimits().MaxTotalAllocation))
+	if err != nil {
+		return nil, err
+	}
+	if len(tmcdTrack.Samples) == 0 {
+		return nil, fmt.Errorf("timecode track %d has no samples", tmcdTrack.ID)
+	}
+	entry := tmcdTrack.GetSampleEntry(tmcdTrack.Samples[0])
+	if entry == nil || entry.GetType() != "tmcd" {
+		return nil, fmt.Errorf("timecode track %d has no tmcd sample description", tmcdTrack.ID)
+	}
+	description, err := atoms.ParseTimecodeSampleEntry(entry)
+	if err != nil {
+		return nil, err
+	}
+
+	sample, err := tmcdTrack.ReadSample(r, 0)
+	if err != nil {
+		return nil, err
+	}
+	if len(sample) < 4 {
+		return nil, fmt.Errorf("timecode sample too short: %d bytes", len(sample))
+	}
+	startFrame := int64(int32(binary.BigEndian.Uint32(sample)))
+
+	return &Timecode{
+		TrackID:    tmcdTrack.ID,
+		StartFrame: startFrame,
+		Timecode:   description.FormatTimecode(startFrame),
+		FrameRate:  description.GetFrameRate(),
+		DropFrame:  description.IsDropFrame(),
+		ReelName:   description.ReelName,
+	}, nil
+}
+
+// LogTimecodes prints the start timecodes.
+func LogTimecodes(timecodes []Timecode) {
+	for _, timecode := range timecodes {
+		logrus.Infof("Timecode Track %d: Start = %s, Frame Rate = %.3f, Drop Frame = %t, Reel = %s\n",
+			timecode.TrackID, timecode.Timecode, timecode.FrameRate, timecode.DropFrame, timecode.ReelName)
+	}
+}
@@ -0,0 +1,83 @@
+package parser
+
+import (
+	"bytes"
+	"os"
+	"testing"
+
+	"github.com/KrzysztofHeinke/quicktime-movie-parser/internal/atomtest"
+	"github.com/stretchr/testify/assert"
+)
+
+// sampleTableAtom builds an 'stbl' atom with a single sample entry and one chunk holding all samples
+func sampleTableAtom(entry []byte, chunkOffset uint32, sampleDuration uint32, sampleSizes ...uint32) []byte {
+	return atomtest.Build("stbl",
+		atomtest.Build("stsd", atomtest.Uint32s(0, 1), entry),
+		atomtest.Build("stts", atomtest.Uint32s(0, 1, uint32(len(sampleSizes)), sampleDuration)),
+		atomtest.Build("stsc", atomtest.Uint32s(0, 1, 1, uint32(len(sampleSizes)), 1)),
+		atomtest.Build("stsz", atomtest.Uint32s(0, 0, uint32(len(sampleSizes))), atomtest.Uint32s(sampleSizes...)),
+		atomtest.Build("stco", atomtest.Uint32s(0, 1, chunkOffset)),
+	)
+}
+
+// timecodeMovie builds a file with a 'tmcd' track whose single sample holds the start frame
+func timecodeMovie(startFrame uint32) []byte {
+	ftyp := atomtest.Build("ftyp", []byte("qt  "), atomtest.Uint32s(0), []byte("qt  "))
+	mdat := atomtest.Build("mdat", atomtest.Uint32s(startFrame))
+
+	entry := atomtest.Build("tmcd",
+		make([]byte, 6), []byte{0, 1}, // Reserved, data reference index
+		atomtest.Uint32s(0, 1, 30000, 1001), []byte{30, 0},
+		atomtest.Build("name", []byte{0x00, 0x04, 0x15, 0xC7}, []byte("A001")),
+	)
+	trak := atomtest.Build("trak",
+		atomtest.Build("tkhd", make([]byte, 12), atomtest.Uint32s(3), make([]byte, 68)),
+		atomtest.Build("mdia",
+			atomtest.Build("mdhd", make([]byte, 12), atomtest.Uint32s(30000, 1001), []byte{0x55, 0xC4, 0, 0}),
+			handlerAtom("tmcd"),
+			atomtest.Build("minf", sampleTableAtom(entry, uint32(len(ftyp)+8), 1001, 4)),
+		),
+	)
+	return bytes.Join([][]byte{ftyp, mdat, atomtest.Build("moov", trak)}, nil)
+}
+
+// TestCollectTimecodes tests reading the start timecode of a 'tmcd' track through the sample tables
+func TestCollectTimecodes(t *testing.T) {
+	// 01:00:00;00 in 29.97 drop-frame
+	file := timecodeMovie(107892)
+
+	tmpFile, err := os.CreateTemp("", "timecode*.mov")
+	assert.NoError(t, err, "Expected no error creating temp file")
+	defer os.Remove(tmpFile.Name())
+	_, err = tmpFile.Write(file)
+	assert.NoError(t, err, "Expected no error writing temp file")
+	tmpFile.Close()
+
+	moov, err := ReadFileMetadata(tmpFile.Name())
+	assert.NoError(t, err, "Expected no error reading moov atom")
+	tree := parseTree(t, moov)
+
+	timecodes := CollectTimecodes(tree, bytes.NewReader(file))
+	assert.Len(t, timecodes, 1)
+	assert.Equal(t, uint32(3), timecodes[0].TrackID)
+	assert.Equal(t, int64(107892), timecodes[0].StartFrame)
+	assert.Equal(t, "01:00:00;00", timecodes[0].Timecode)
+	assert.True(t, timecodes[0].DropFrame)
+	assert.Equal(t, "A001", timecodes[0].ReelName)
+}
+
+// TestReadTopLevelAtoms tests walking the top level atoms including 64-bit and truncated sizes
+func TestReadTopLevelAtoms(t *testing.T) {
+	large := append(atomtest.Uint32s(1), []byte("mdat")...)
+	large = append(large, 0, 0, 0, 0, 0, 0, 0, 20)
+	large = append(large, 1, 2, 3, 4)
+	file := bytes.Join([][]byte{atomtest.Build("ftyp", []byte("isom")), large, atomtest.Uint32s(100), []byte("free")}, nil)
+
+	topLevelAtoms, err := ReadTopLevelAtoms(bytes.NewReader(file), int64(len(file)))
+	assert.NoError(t, err)
+	assert.Len(t, topLevelAtoms, 3)
+	assert.Equal(t, TopLevelAtom{Type: "mdat", Offset: 12, Size: 20, HeaderSize: 16}, topLevelAtoms[1])
+	assert.Equal(t, "free", topLevelAtoms[2].Type)
+	assert.True(t, topLevelAtoms[2].Truncated)
+	assert.Equal(t, int64(8), topLevelAtoms[2].Size)
+}
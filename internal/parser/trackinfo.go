@@ -0,0 +1,199 @@
+package parser
+
+import (
+	"fmt"
+
+	"github.com/KrzysztofHeinke/quicktime-movie-parser/pkg/models/atoms"
+	"github.com/sirupsen/logrus"
+)
+
+// logTrackInfo prints the information of a single 'trak' atom.
+func logTrackInfo(index int, trakAtom *atoms.CompositeAtom) {
+	handlerType := ""
+	if hdlr, ok := trakAtom.LeafData("mdia", "hdlr").(*atoms.HdlrAtom); ok {
+		handlerType = hdlr.GetHandlerType()
+	}
+	logrus.Infof("Track %d: Handler = %s, Language = %s\n", index, handlerType, trackLanguage(trakAtom))
+
+	if tkhd, ok := trakAtom.LeafData("tkhd").(*atoms.TkhdAtom); ok {
+		if handlerType == "vide" || (handlerType == "" && tkhd.Width != 0) {
+			width := fixedPointToFloat32(tkhd.Width)
+			height := fixedPointToFloat32(tkhd.Height)
+			logrus.Infof("Video Track: Width = %.2f, Height = %.2f\n", width, height)
+
+			matrix := tkhd.GetMatrix()
+			transform := matrix.GetTransform()
+			displayWidth, displayHeight := matrix.DisplaySize(width, height)
+			logrus.Infof("Display: Rotation = %d, Horizontal Flip = %t, Vertical Flip = %t, Width = %.2f, Height = %.2f\n",
+				transform.Rotation, transform.HorizontalFlip, transform.VerticalFlip, displayWidth, displayHeight)
+		}
+	}
+
+	if stsd, ok := trakAtom.LeafData("mdia", "minf", "stbl", "stsd").(*atoms.AtomStsd); ok {
+		sampleRates, _ := atoms.GetSampleRates(stsd)
+		for codec, rates := range sampleRates {
+			for _, rate := range rates {
+				logrus.Infof("Codec: %s, Sample Rate: %.2f Hz\n", codec, fixedPointToFloat32(uint32(rate)))
+			}
+		}
+		if handlerType == "vide" {
+			for i := range stsd.SampleEntries {
+				logVisualSampleEntry(&stsd.SampleEntries[i])
+			}
+		}
+		for i := range stsd.SampleEntries {
+			logSubtitleSampleEntry(&stsd.SampleEntries[i])
+			logProtectionInfo(&stsd.SampleEntries[i])
+		}
+	}
+	logTrackAperture(trakAtom)
+}
+
+// trackLanguage returns the language of the track, preferring the BCP-47 tag of the 'elng' atom
+// over the ISO-639-2/T code of the 'mdhd' atom.
+func trackLanguage(trakAtom *atoms.CompositeAtom) string {
+	if elng, ok := trakAtom.LeafData("mdia", "elng").(*atoms.ElngAtom); ok && elng.Language != "" {
+		return elng.Language
+	}
+	if mdhd, ok := trakAtom.LeafData("mdia", "mdhd").(*atoms.MdhdAtom); ok {
+		return mdhd.GetLanguage()
+	}
+	return atoms.UndeterminedLanguage
+}
+
+// logVisualSampleEntry prints the codec, pixel aspect ratio, clean aperture and field information of a video sample entry.
+func logVisualSampleEntry(entry *atoms.SampleEntry) {
+	visual, err := atoms.ParseVisualSampleEntry(entry)
+	if err != nil {
+		logrus.Debugf("Failed to decode visual sample entry %s: %v", entry.GetType(), err)
+		return
+	}
+	width, height := float64(visual.Width), float64(visual.Height)
+	logrus.Infof("Codec: %s, Coded Width = %d, Coded Height = %d\n", entry.GetOriginalFormat(), visual.Width, visual.Height)
+
+	sar := 1.0
+	sarText := "1:1"
+	if pasp, ok := entry.GetExtension("pasp").(*atoms.PaspAtom); ok && pasp.VerticalSpacing != 0 {
+		sar = pasp.GetRatio()
+		sarText = fmt.Sprintf("%d:%d", pasp.HorizontalSpacing, pasp.VerticalSpacing)
+	}
+	logrus.Infof("Pixel Aspect Ratio: %s\n", sarText)
+
+	cleanWidth, cleanHeight := width, height
+	if clap, ok := entry.GetExtension("clap").(*atoms.ClapAtom); ok {
+		x, y, w, h := clap.GetRectangle(width, height)
+		if w > 0 && h > 0 {
+			cleanWidth, cleanHeight = w, h
+		}
+		logrus.Infof("Clean Aperture: X = %.2f, Y = %.2f, Width = %.2f, Height = %.2f\n", x, y, w, h)
+	}
+
+	if fiel, ok := entry.GetExtension("fiel").(*atoms.FielAtom); ok {
+		logrus.Infof("Field Order: %s\n", fiel.GetFieldOrder())
+	}
+	if gama, ok := entry.GetExtension("gama").(*atoms.GamaAtom); ok {
+		logrus.Infof("Gamma: %.2f\n", gama.GetGamma())
+	}
+
+	if cleanHeight > 0 {
+		logrus.Infof("Display Aspect Ratio: %.4f\n", cleanWidth*sar/cleanHeight)
+	}
+
+	logColourInfo(entry)
+}
+
+// logColourInfo prints the colour description and HDR metadata of a video sample entry.
+func logColourInfo(entry *atoms.SampleEntry) {
+	colr, hasColr := entry.GetExtension("colr").(*atoms.ColrAtom)
+	if hasColr {
+		switch colr.GetColourType() {
+		case "nclx", "nclc":
+			colourRange := "limited"
+			if colr.FullRange {
+				colourRange = "full"
+			}
+			if colr.GetColourType() == "nclc" {
+				colourRange = "unspecified"
+			}
+			logrus.Infof("Colour: Primaries = %s, Transfer = %s, Matrix = %s, Range = %s\n",
+				colr.GetPrimariesName(), colr.GetTransferName(), colr.GetMatrixName(), colourRange)
+		case "prof", "rICC":
+			logrus.Infof("Colour: ICC Profile (%s), Colour Space = %s, Size = %d bytes\n",
+				colr.GetColourType(), colr.GetICCColourSpace(), len(colr.ICCProfile))
+		}
+	}
+
+	mdcv, hasMdcv := entry.GetExtension("mdcv").(*atoms.MdcvAtom)
+	if hasMdcv {
+		red, green, blue := mdcv.GetPrimaries()
+		white := mdcv.GetWhitePoint()
+		logrus.Infof("Mastering Display: R = (%.4f, %.4f), G = (%.4f, %.4f), B = (%.4f, %.4f), WP = (%.4f, %.4f), Luminance = %.4f-%.0f cd/m2\n",
+			red.X, red.Y, green.X, green.Y, blue.X, blue.Y, white.X, white.Y, mdcv.GetMinLuminance(), mdcv.GetMaxLuminance())
+	}
+	clli, hasClli := entry.GetExtension("clli").(*atoms.ClliAtom)
+	if hasClli {
+		logrus.Infof("Content Light Level: MaxCLL = %d cd/m2, MaxFALL = %d cd/m2\n", clli.MaxContentLightLevel, clli.MaxPicAverageLightLevel)
+	}
+	if amve, ok := entry.GetExtension("amve").(*atoms.AmveAtom); ok {
+		light := amve.GetLight()
+		logrus.Infof("Ambient Viewing Environment: Illuminance = %.4f lux, Light = (%.4f, %.4f)\n", amve.GetIlluminance(), light.X, light.Y)
+	}
+
+	for _, atomType := range []string{"dvcC", "dvvC", "dvwC"} {
+		if dovi, ok := entry.GetExtension(atomType).(*atoms.DoviConfigAtom); ok {
+			logrus.Infof("Dolby Vision: Profile = %s, Level = %d, RPU = %t, EL = %t, BL = %t\n",
+				dovi.GetProfileName(), dovi.Level, dovi.RPUPresent, dovi.ELPresent, dovi.BLPresent)
+		}
+	}
+
+	if hasColr && colr.IsPQ() {
+		if hasMdcv || hasClli {
+			logrus.Infof("HDR: HDR10\n")
+		} else {
+			logrus.Infof("HDR: PQ\n")
+		}
+	} else if hasColr && colr.IsHLG() {
+		logrus.Infof("HDR: HLG\n")
+	}
+}
+
+// logSubtitleSampleEntry prints the format of a text, subtitle or closed caption sample entry.
+func logSubtitleSampleEntry(entry *atoms.SampleEntry) {
+	name, ok := atoms.GetSubtitleFormat(entry.GetType())
+	if !ok {
+		return
+	}
+	if atoms.IsClosedCaptionFormat(entry.GetType()) {
+		logrus.Infof("Closed Captions: %s present\n", name)
+		return
+	}
+	logrus.Infof("Subtitles: Format = %s (%s)\n", name, entry.GetType())
+
+	switch entry.GetType() {
+	case "stpp":
+		if stpp, err := atoms.ParseXMLSubtitleSampleEntry(entry); err == nil {
+			logrus.Infof("Subtitles: Namespace = %s\n", stpp.Namespace)
+		}
+	case "tx3g":
+		if tx3g, err := atoms.ParseTx3gSampleEntry(entry); err == nil {
+			logrus.Debugf("Subtitles: Font Size = %d, Display Flags = 0x%08x\n", tx3g.DefaultStyle.FontSize, tx3g.DisplayFlags)
+		}
+	}
+}
+
+// logTrackAperture prints the dimensions of the track aperture modes of the 'tapt' atom.
+func logTrackAperture(trakAtom *atoms.CompositeAtom) {
+	modes := []struct {
+		atomType string
+		name     string
+	}{
+		{"clef", "Clean Aperture"},
+		{"prof", "Production Aperture"},
+		{"enof", "Encoded Pixels"},
+	}
+	for _, mode := range modes {
+		if dimensions, ok := trakAtom.LeafData("tapt", mode.atomType).(*atoms.TrackApertureDimensionsAtom); ok {
+			logrus.Infof("Track Aperture %s: Width = %.2f, Height = %.2f\n", mode.name, dimensions.GetWidth(), dimensions.GetHeight())
+		}
+	}
+}
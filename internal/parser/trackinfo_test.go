@@ -0,0 +1,97 @@
+package parser
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+
+	"github.com/KrzysztofHeinke/quicktime-movie-parser/internal/atomtest"
+	"github.com/KrzysztofHeinke/quicktime-movie-parser/pkg/models/atoms"
+	"github.com/stretchr/testify/assert"
+)
+
+// handlerAtom builds an 'hdlr' atom of the given handler type
+func handlerAtom(handlerType string) []byte {
+	return atomtest.Build("hdlr", make([]byte, 8), []byte(handlerType), make([]byte, 12), []byte{0})
+}
+
+// visualSampleEntry builds a video sample entry of the given codec and size followed by its extension atoms
+func visualSampleEntry(codec string, width, height uint16, extensions ...[]byte) []byte {
+	fields := make([]byte, 78)
+	binary.BigEndian.PutUint16(fields[6:], 1) // Data reference index
+	binary.BigEndian.PutUint16(fields[24:], width)
+	binary.BigEndian.PutUint16(fields[26:], height)
+	binary.BigEndian.PutUint16(fields[74:], 24) // Depth
+	return atomtest.Build(codec, fields, bytes.Join(extensions, nil))
+}
+
+// videoTrak builds a video 'trak' atom holding a single sample entry
+func videoTrak(entry []byte) []byte {
+	stsd := atomtest.Build("stsd", atomtest.Uint32s(0, 1), entry)
+	return atomtest.Build("trak",
+		atomtest.Build("mdia",
+			handlerAtom("vide"),
+			atomtest.Build("minf", atomtest.Build("stbl", stsd)),
+		),
+	)
+}
+
+// parseTree builds the cleaned tree of atoms from raw data
+func parseTree(t *testing.T, data []byte) *atoms.CompositeAtom {
+	tree, err := CreateTreeOfAtoms(bytes.NewReader(data))
+	assert.NoError(t, err, "Expected no error creating tree of atoms")
+	return CleanEmptyHeaders(tree).(*atoms.CompositeAtom)
+}
+
+// TestVisualSampleEntryExtensions tests decoding of the geometry atoms of a video sample entry
+func TestVisualSampleEntryExtensions(t *testing.T) {
+	entry := visualSampleEntry("apcn", 1920, 1080,
+		atomtest.Build("pasp", atomtest.Uint32s(4, 3)),
+		atomtest.Build("clap", atomtest.Uint32s(1888, 1, 1062, 1, 0, 1, 0, 1)),
+		atomtest.Build("fiel", []byte{2, 9}),
+		atomtest.Build("gama", atomtest.Uint32s(0x00023333)),
+	)
+	tree := parseTree(t, atomtest.Build("moov", videoTrak(entry)))
+
+	stsd, ok := tree.Find("moov", "trak", "mdia", "minf", "stbl", "stsd").(*atoms.LeafAtom)
+	assert.True(t, ok, "Expected stsd atom")
+	sampleEntry := &stsd.Data.(*atoms.AtomStsd).SampleEntries[0]
+
+	visual, err := atoms.ParseVisualSampleEntry(sampleEntry)
+	assert.NoError(t, err)
+	assert.Equal(t, uint16(1920), visual.Width)
+	assert.Equal(t, uint16(1080), visual.Height)
+
+	pasp, ok := sampleEntry.GetExtension("pasp").(*atoms.PaspAtom)
+	assert.True(t, ok, "Expected pasp atom")
+	assert.InDelta(t, 4.0/3.0, pasp.GetRatio(), 1e-9)
+
+	clap, ok := sampleEntry.GetExtension("clap").(*atoms.ClapAtom)
+	assert.True(t, ok, "Expected clap atom")
+	x, y, w, h := clap.GetRectangle(1920, 1080)
+	assert.Equal(t, []float64{16, 9, 1888, 1062}, []float64{x, y, w, h})
+
+	fiel, ok := sampleEntry.GetExtension("fiel").(*atoms.FielAtom)
+	assert.True(t, ok, "Expected fiel atom")
+	assert.True(t, fiel.IsInterlaced())
+	assert.Equal(t, "interleaved, top field first", fiel.GetFieldOrder())
+
+	gama, ok := sampleEntry.GetExtension("gama").(*atoms.GamaAtom)
+	assert.True(t, ok, "Expected gama atom")
+	assert.InDelta(t, 2.2, gama.GetGamma(), 1e-4)
+}
+
+// TestTrackApertureDimensions tests decoding of the 'tapt' atom
+func TestTrackApertureDimensions(t *testing.T) {
+	tapt := atomtest.Build("tapt",
+		atomtest.Build("clef", atomtest.Uint32s(0, 1888<<16, 1062<<16)),
+		atomtest.Build("prof", atomtest.Uint32s(0, 1920<<16, 1080<<16)),
+		atomtest.Build("enof", atomtest.Uint32s(0, 1920<<16, 1080<<16)),
+	)
+	tree := parseTree(t, atomtest.Build("moov", atomtest.Build("trak", tapt)))
+
+	clef, ok := tree.LeafData("moov", "trak", "tapt", "clef").(*atoms.TrackApertureDimensionsAtom)
+	assert.True(t, ok, "Expected clef atom")
+	assert.Equal(t, 1888.0, clef.GetWidth())
+	assert.Equal(t, 1062.0, clef.GetHeight())
+}
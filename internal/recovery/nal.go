@@ -0,0 +1,200 @@
+package recovery
+
+import (
+	"io"
+)
+
+// maxNALUnitSize bounds the size of a NAL unit accepted while scanning, larger lengths are taken as noise
+const maxNALUnitSize = 64 << 20
+
+// windowSize is the number of bytes the scanner keeps in memory
+const windowSize = 1 << 20
+
+// nalUnit is the header of a length-prefixed NAL unit found in the media data
+type nalUnit struct {
+	// size is the size of the NAL unit including its length prefix
+	size uint64
+	// header holds the first bytes of the NAL unit, enough for its type and the start of a slice header
+	header []byte
+}
+
+// codec tells how the NAL units of a video stream are classified
+type codec interface {
+	// plausible tells whether the header can start a NAL unit of the stream
+	plausible(header []byte) bool
+	// isVCL tells whether the NAL unit holds coded picture data
+	isVCL(header []byte) bool
+	// startsAccessUnit tells whether the NAL unit starts a new access unit once a picture was seen
+	startsAccessUnit(header []byte) bool
+	// isSync tells whether the NAL unit makes its access unit a sync sample
+	isSync(header []byte) bool
+}
+
+// avc classifies H.264 NAL units
+type avc struct{}
+
+// plausible tells whether the header is a valid H.264 NAL unit header of a type found in MP4 samples
+func (avc) plausible(header []byte) bool {
+	nalType := header[0] & 0x1F
+	return header[0]&0x80 == 0 && nalType >= 1 && nalType <= 23
+}
+
+// isVCL tells whether the NAL unit is a slice
+func (avc) isVCL(header []byte) bool {
+	nalType := header[0] & 0x1F
+	return nalType >= 1 && nalType <= 5
+}
+
+// startsAccessUnit tells whether the NAL unit is an access unit delimiter, a parameter set, an SEI or the
+// first slice of a picture, i.e. a slice with first_mb_in_slice 0
+func (avc) startsAccessUnit(header []byte) bool {
+	switch nalType := header[0] & 0x1F; {
+	case nalType >= 6 && nalType <= 9, nalType >= 14 && nalType <= 18:
+		return true
+	case nalType == 1 || nalType == 5:
+		return len(header) > 1 && header[1]&0x80 != 0
+	}
+	return false
+}
+
+// isSync tells whether the NAL unit is an IDR slice
+func (avc) isSync(header []byte) bool {
+	return header[0]&0x1F == 5
+}
+
+// hevc classifies H.265 NAL units
+type hevc struct{}
+
+// plausible tells whether the header is a valid H.265 NAL unit header of the base layer
+func (hevc) plausible(header []byte) bool {
+	if len(header) < 2 {
+		return false
+	}
+	nalType := header[0] >> 1 & 0x3F
+	layerID := (header[0]&0x01)<<5 | header[1]>>3
+	return header[0]&0x80 == 0 && nalType <= 40 && layerID == 0 && header[1]&0x07 != 0
+}
+
+// isVCL tells whether the NAL unit is a slice segment
+func (hevc) isVCL(header []byte) bool {
+	return header[0]>>1&0x3F < 32
+}
+
+// startsAccessUnit tells whether the NAL unit is an access unit delimiter, a parameter set, a prefix SEI
+// or the first slice segment of a picture
+func (hevc) startsAccessUnit(header []byte) bool {
+	switch nalType := header[0] >> 1 & 0x3F; {
+	case nalType >= 32 && nalType <= 35, nalType == 39, nalType >= 41 && nalType <= 44, nalType >= 48 && nalType <= 55:
+		return true
+	case nalType < 32:
+		return len(header) > 2 && header[2]&0x80 != 0
+	}
+	return false
+}
+
+// isSync tells whether the NAL unit is a slice of an IRAP picture
+func (hevc) isSync(header []byte) bool {
+	nalType := header[0] >> 1 & 0x3F
+	return nalType >= 16 && nalType <= 21
+}
+
+// scanner reads the media data through a window kept in memory
+type scanner struct {
+	r          io.ReaderAt
+	end        uint64
+	lengthSize int
+	codec      codec
+	window     []byte
+	start      uint64
+}
+
+// newScanner returns a scanner of the media data of the reader up to end
+func newScanner(r io.ReaderAt, end uint64, lengthSize int, c codec) *scanner {
+	return &scanner{r: r, end: end, lengthSize: lengthSize, codec: c}
+}
+
+// peek returns up to n bytes at the position, fewer at the end of the media data
+func (s *scanner) peek(position uint64, n int) []byte {
+	if position >= s.end {
+		return nil
+	}
+	n = int(min(uint64(n), s.end-position))
+	if position < s.start || position+uint64(n) > s.start+uint64(len(s.window)) {
+		size := int(min(uint64(max(n, windowSize)), s.end-position))
+		window := make([]byte, size)
+		read, err := s.r.ReadAt(window, int64(position))
+		if err != nil && err != io.EOF {
+			read = 0
+		}
+		s.window, s.start = window[:read], position
+		n = min(n, read)
+	}
+	return s.window[position-s.start : position-s.start+uint64(n)]
+}
+
+// nalUnitAt returns the NAL unit at the position if its length prefix and header are plausible and it
+// ends within the media data
+func (s *scanner) nalUnitAt(position uint64) (nalUnit, bool) {
+	data := s.peek(position, s.lengthSize+3)
+	if len(data) < s.lengthSize+1 {
+		return nalUnit{}, false
+	}
+	length := uint64(0)
+	for _, b := range data[:s.lengthSize] {
+		length = length<<8 | uint64(b)
+	}
+	header := data[s.lengthSize:]
+	if length == 0 || length > maxNALUnitSize || position+uint64(s.lengthSize)+length > s.end {
+		return nalUnit{}, false
+	}
+	header = header[:min(uint64(len(header)), length)]
+	if !s.codec.plausible(header) {
+		return nalUnit{}, false
+	}
+	return nalUnit{size: uint64(s.lengthSize) + length, header: append([]byte(nil), header...)}, true
+}
+
+// isAccessUnitStart tells whether a video sample starts at the position, i.e. its first NAL unit starts
+// an access unit. When strict, the NAL unit must also be followed by another plausible NAL unit or by
+// the end of the media data, which rules out most matches in other data.
+func (s *scanner) isAccessUnitStart(position uint64, strict bool) bool {
+	unit, ok := s.nalUnitAt(position)
+	if !ok || !s.codec.startsAccessUnit(unit.header) {
+		return false
+	}
+	next := position + unit.size
+	if !strict || next == s.end {
+		return true
+	}
+	_, ok = s.nalUnitAt(next)
+	return ok
+}
+
+// readAccessUnit returns the end of the video sample starting at the position and whether it is a sync
+// sample. It fails if the NAL units up to the next access unit hold no picture.
+func (s *scanner) readAccessUnit(position uint64) (uint64, bool, bool) {
+	seenPicture, sync := false, false
+	for position < s.end {
+		unit, ok := s.nalUnitAt(position)
+		if !ok || seenPicture && s.codec.startsAccessUnit(unit.header) {
+			break
+		}
+		if s.codec.isVCL(unit.header) {
+			seenPicture = true
+			sync = sync || s.codec.isSync(unit.header)
+		}
+		position += unit.size
+	}
+	return position, sync, seenPicture
+}
+
+// nextAccessUnit returns the position of the next video sample strictly found at or after the position,
+// or the end of the media data
+func (s *scanner) nextAccessUnit(position uint64) uint64 {
+	for ; position < s.end; position++ {
+		if s.isAccessUnitStart(position, true) {
+			return position
+		}
+	}
+	return s.end
+}
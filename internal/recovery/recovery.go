@@ -0,0 +1,333 @@
+package recovery
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"sort"
+
+	"github.com/KrzysztofHeinke/quicktime-movie-parser/internal/parser"
+	"github.com/KrzysztofHeinke/quicktime-movie-parser/internal/remux"
+	"github.com/KrzysztofHeinke/quicktime-movie-parser/internal/track"
+	"github.com/KrzysztofHeinke/quicktime-movie-parser/internal/writer"
+	"github.com/KrzysztofHeinke/quicktime-movie-parser/pkg/models/atoms"
+	"github.com/sirupsen/logrus"
+)
+
+// maxChunkSizes bounds the number of audio chunk sizes of the reference tried at every position
+const maxChunkSizes = 8
+
+// videoProfile describes the video track of the reference file
+type videoProfile struct {
+	track      *track.Track
+	codec      codec
+	lengthSize int
+	duration   uint32
+}
+
+// audioProfile describes an audio track of the reference file whose samples all have the same size
+type audioProfile struct {
+	track      *track.Track
+	sampleSize uint32
+	duration   uint32
+	chunkSizes []uint64
+}
+
+// Recover rebuilds the movie of a recording which was interrupted before its 'moov' atom was written.
+// The tracks are taken from a healthy reference file recorded with the same settings. The orphan
+// 'mdat' atom is scanned for the length-prefixed NAL units of the H.264 or H.265 video track, every
+// access unit becoming a video sample. The data between video samples is taken as audio when the audio
+// track of the reference has samples of a constant size, e.g. PCM. Frames of variable size like AAC
+// cannot be told apart without decoding them, so an audio track which cannot be recovered is an error
+// unless dropAudio allows writing the movie without it. Composition offsets of B-frames cannot be
+// recovered either. The output is written fast-start.
+func Recover(input, reference, output string, dropAudio bool) error {
+	if err := writer.CheckDistinctFiles(input, output); err != nil {
+		return err
+	}
+	tree, err := parser.ReadTree(reference)
+	if err != nil {
+		return fmt.Errorf("failed to read reference file: %w", err)
+	}
+	moov, ok := tree.(*atoms.CompositeAtom).GetChild("moov").(*atoms.CompositeAtom)
+	if !ok {
+		return fmt.Errorf("moov atom of the reference file could not be parsed")
+	}
+	mvhdLeaf, ok := moov.GetChild("mvhd").(*atoms.LeafAtom)
+	if !ok {
+		return fmt.Errorf("mvhd atom of the reference file not found")
+	}
+	mvhd, ok := mvhdLeaf.Data.(*atoms.MvhdAtom)
+	if !ok || mvhd.TimeScale == 0 {
+		return fmt.Errorf("mvhd atom of the reference file has no time scale")
+	}
+	tracks, err := readReferenceTracks(reference, tree)
+	if err != nil {
+		return err
+	}
+	video, err := newVideoProfile(tracks)
+	if err != nil {
+		return err
+	}
+	audio := newAudioProfile(tracks)
+
+	file, err := os.Open(input)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	info, err := file.Stat()
+	if err != nil {
+		return err
+	}
+	start, end, err := findMediaData(file, info.Size())
+	if err != nil {
+		return err
+	}
+
+	s := newScanner(file, end, video.lengthSize, video.codec)
+	videoSamples, audioSamples, skipped := scan(s, start, video, audio)
+	if len(videoSamples) == 0 {
+		return fmt.Errorf("no video samples found in the media data")
+	}
+	logrus.Infof("Recovered %d video and %d audio samples", len(videoSamples), len(audioSamples))
+	if skipped > 0 {
+		logrus.Warnf("%d bytes of the media data could not be assigned to a track and were dropped", skipped)
+	}
+
+	video.track.Samples = videoSamples
+	kept := []*track.Track{video.track}
+	if audio != nil && len(audioSamples) > 0 {
+		audio.track.Samples = audioSamples
+		kept = append(kept, audio.track)
+	}
+	for _, t := range tracks {
+		if t == video.track || audio != nil && t == audio.track && len(audioSamples) > 0 {
+			continue
+		}
+		if t.HandlerType == "soun" && !dropAudio {
+			return fmt.Errorf("audio track %d cannot be recovered, only audio frames of a constant size like PCM can be found without decoding them", t.ID)
+		}
+		logrus.Warnf("Track %d (%s) cannot be recovered and is dropped", t.ID, t.HandlerType)
+	}
+	remux.KeepTracks(moov, kept)
+	moov.RemoveChildren("mvex")
+	mvhd.Duration = 0
+	chunks := make([][]track.Chunk, len(kept))
+	for i, t := range kept {
+		t.Atom.RemoveChildren("edts")
+		mvhd.Duration = max(mvhd.Duration, t.UpdateDurations(mvhd.TimeScale))
+		chunks[i] = track.SplitChunks(t.Samples)
+	}
+	if mvhd.Duration > math.MaxUint32 {
+		mvhd.Version = 1
+	}
+	mvhdLeaf.SetData(mvhd)
+
+	ftyp, err := parser.ReadFileType(file, info.Size())
+	if err != nil || ftyp == nil {
+		if ftyp, err = readReferenceFileType(reference); err != nil {
+			return err
+		}
+	}
+	return writer.WriteTracks(output, file, ftyp, moov, kept, chunks, true)
+}
+
+// readReferenceTracks reads the tracks of the reference file
+func readReferenceTracks(reference string, tree atoms.AtomIf) ([]*track.Track, error) {
+	file, err := os.Open(reference)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	info, err := file.Stat()
+	if err != nil {
+		return nil, err
+	}
+	return parser.ReadTracks(tree, file, info.Size())
+}
+
+// readReferenceFileType returns the 'ftyp' atom of the reference file
+func readReferenceFileType(reference string) ([]byte, error) {
+	file, err := os.Open(reference)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	info, err := file.Stat()
+	if err != nil {
+		return nil, err
+	}
+	return parser.ReadFileType(file, info.Size())
+}
+
+// newVideoProfile returns the profile of the first H.264 or H.265 track of the reference
+func newVideoProfile(tracks []*track.Track) (*videoProfile, error) {
+	for _, t := range tracks {
+		if len(t.SampleDescriptions) == 0 {
+			continue
+		}
+		entry := &t.SampleDescriptions[0]
+		profile := &videoProfile{track: t, duration: commonDuration(t.Samples)}
+		if avcC, ok := entry.GetExtension("avcC").(*atoms.AvcCAtom); ok {
+			profile.codec, profile.lengthSize = avc{}, avcC.LengthSize
+		} else if hvcC, ok := entry.GetExtension("hvcC").(*atoms.HvcCAtom); ok {
+			profile.codec, profile.lengthSize = hevc{}, hvcC.LengthSize
+		} else {
+			continue
+		}
+		if profile.duration == 0 {
+			return nil, fmt.Errorf("video track %d of the reference file has no samples", t.ID)
+		}
+		return profile, nil
+	}
+	return nil, fmt.Errorf("the reference file has no H.264 or H.265 video track")
+}
+
+// newAudioProfile returns the profile of the first audio track of the reference whose samples have a
+// constant size, or nil if there is none
+func newAudioProfile(tracks []*track.Track) *audioProfile {
+	for _, t := range tracks {
+		if t.HandlerType != "soun" || len(t.Samples) == 0 {
+			continue
+		}
+		sampleSize := t.Samples[0].Size
+		constant := sampleSize > 0
+		for _, sample := range t.Samples {
+			constant = constant && sample.Size == sampleSize
+		}
+		if !constant {
+			logrus.Warnf("Audio track %d has samples of varying size, which cannot be recovered", t.ID)
+			continue
+		}
+		return &audioProfile{track: t, sampleSize: sampleSize, duration: commonDuration(t.Samples), chunkSizes: commonChunkSizes(t.Samples)}
+	}
+	return nil
+}
+
+// commonDuration returns the most common sample duration
+func commonDuration(samples []track.Sample) uint32 {
+	counts := make(map[uint32]int)
+	var duration uint32
+	for _, sample := range samples {
+		counts[sample.Duration]++
+		if counts[sample.Duration] > counts[duration] || counts[sample.Duration] == counts[duration] && sample.Duration < duration {
+			duration = sample.Duration
+		}
+	}
+	return duration
+}
+
+// commonChunkSizes returns the most common sizes of the chunks of the samples, most common first
+func commonChunkSizes(samples []track.Sample) []uint64 {
+	counts := make(map[uint64]int)
+	var sizes []uint64
+	for _, chunk := range track.SplitChunks(samples) {
+		if counts[chunk.Size] == 0 {
+			sizes = append(sizes, chunk.Size)
+		}
+		counts[chunk.Size]++
+	}
+	sort.SliceStable(sizes, func(i, j int) bool { return counts[sizes[i]] > counts[sizes[j]] })
+	return sizes[:min(len(sizes), maxChunkSizes)]
+}
+
+// scan walks the media data from start and returns the video and audio samples found in it, together
+// with the number of bytes which could not be assigned to a track
+func scan(s *scanner, start uint64, video *videoProfile, audio *audioProfile) ([]track.Sample, []track.Sample, uint64) {
+	var videoSamples, audioSamples []track.Sample
+	var skipped uint64
+	appendAudio := func(position, size uint64) {
+		for ; size >= uint64(audio.sampleSize); size -= uint64(audio.sampleSize) {
+			audioSamples = append(audioSamples, newSample(position, audio.sampleSize, audioSamples, audio.duration, true))
+			position += uint64(audio.sampleSize)
+		}
+		skipped += size
+	}
+
+	for position := start; position < s.end; {
+		if size, ok := audioChunkAt(s, position, audio); ok {
+			appendAudio(position, size)
+			position += size
+			continue
+		}
+		if s.isAccessUnitStart(position, false) {
+			if next, sync, ok := s.readAccessUnit(position); ok {
+				videoSamples = append(videoSamples, newSample(position, uint32(next-position), videoSamples, video.duration, sync))
+				position = next
+				continue
+			}
+		}
+		next := s.nextAccessUnit(position + 1)
+		if audio != nil {
+			appendAudio(position, next-position)
+		} else {
+			skipped += next - position
+		}
+		position = next
+	}
+	return videoSamples, audioSamples, skipped
+}
+
+// audioChunkAt returns the size of the audio chunk at the position: one of the chunk sizes of the
+// reference which is followed by a video sample or by the end of the media data
+func audioChunkAt(s *scanner, position uint64, audio *audioProfile) (uint64, bool) {
+	if audio == nil {
+		return 0, false
+	}
+	for _, size := range audio.chunkSizes {
+		if next := position + size; next == s.end || next < s.end && s.isAccessUnitStart(next, true) {
+			return size, true
+		}
+	}
+	return 0, false
+}
+
+// newSample returns the next sample of a track following the samples found so far
+func newSample(offset uint64, size uint32, previous []track.Sample, duration uint32, sync bool) track.Sample {
+	sample := track.Sample{Offset: offset, Size: size, Duration: duration, Sync: sync, DescriptionIndex: 1}
+	if n := len(previous); n > 0 {
+		sample.DecodeTime = previous[n-1].DecodeTime + uint64(previous[n-1].Duration)
+	}
+	return sample
+}
+
+// findMediaData returns the range of the payload of the 'mdat' atom of the file. A size left at 0 or
+// reaching past the end of the file, as written by interrupted recordings, extends to the end of the file.
+func findMediaData(r io.ReaderAt, fileSize int64) (uint64, uint64, error) {
+	header := make([]byte, 16)
+	var start, end int64
+	for offset := int64(0); offset+8 <= fileSize; {
+		if _, err := r.ReadAt(header[:8], offset); err != nil {
+			return 0, 0, fmt.Errorf("error reading atom header at offset %d: %w", offset, err)
+		}
+		size, headerSize := int64(binary.BigEndian.Uint32(header[0:4])), int64(8)
+		if size == 1 && offset+16 <= fileSize {
+			if _, err := r.ReadAt(header[8:16], offset+8); err != nil {
+				return 0, 0, fmt.Errorf("error reading extended size at offset %d: %w", offset, err)
+			}
+			size, headerSize = int64(binary.BigEndian.Uint64(header[8:16])), 16
+		}
+		atomType := string(header[4:8])
+		if atomType == "moov" {
+			return 0, 0, fmt.Errorf("the file has a moov atom at offset %d, there is nothing to recover", offset)
+		}
+		complete := size >= headerSize && size <= fileSize-offset
+		if atomType == "mdat" && end == 0 {
+			start, end = offset+headerSize, fileSize
+			if complete && size > headerSize {
+				end = offset + size
+			}
+		}
+		if !complete || size == headerSize && atomType == "mdat" {
+			break
+		}
+		offset += size
+	}
+	if end == 0 {
+		return 0, 0, fmt.Errorf("mdat atom not found")
+	}
+	return uint64(start), uint64(end), nil
+}
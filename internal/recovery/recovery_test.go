@@ -0,0 +1,160 @@
+package recovery
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/KrzysztofHeinke/quicktime-movie-parser/internal/atomtest"
+	"github.com/KrzysztofHeinke/quicktime-movie-parser/internal/parser"
+	"github.com/KrzysztofHeinke/quicktime-movie-parser/internal/track"
+	"github.com/KrzysztofHeinke/quicktime-movie-parser/pkg/models/atoms"
+	"github.com/stretchr/testify/assert"
+)
+
+// nalUnits prefixes every NAL unit with its 4 byte length
+func nalUnits(units ...[]byte) []byte {
+	var data []byte
+	for _, unit := range units {
+		data = append(data, atomtest.Uint32s(uint32(len(unit)))...)
+		data = append(data, unit...)
+	}
+	return data
+}
+
+// writeReference writes a healthy movie with an H.264 track of three 40ms samples and an audio track of
+// eight samples with the sizes of the 'stsz' atom stored in chunks of four
+func writeReference(t *testing.T, path string, stsz []byte) {
+	ftyp := atomtest.FileType("isom", "mp41")
+	offset := atomtest.MediaOffset(ftyp)
+	avcC := atomtest.Build("avcC", []byte{1, 0x42, 0, 0x1E, 0xFF, 0xE1, 0, 4, 0x67, 0x42, 0, 0x1E, 1, 0, 2, 0x68, 0xCE})
+	video := atomtest.Trak(atomtest.Track{
+		ID: 1, HandlerType: "vide", Duration: 120, Entry: atomtest.SampleEntry("avc1", 70, avcC),
+		Tables: [][]byte{
+			atomtest.Build("stts", atomtest.Uint32s(0, 1, 3, 40)),
+			atomtest.Build("stss", atomtest.Uint32s(0, 1, 1)),
+			atomtest.Build("stsc", atomtest.Uint32s(0, 1, 1, 3, 1)),
+			atomtest.Build("stsz", atomtest.Uint32s(0, 0, 3, 16, 16, 32)),
+			atomtest.Build("stco", atomtest.Uint32s(0, 1, offset)),
+		},
+	})
+	audio := atomtest.Trak(atomtest.Track{
+		ID: 2, HandlerType: "soun", Duration: 120, Entry: atomtest.SampleEntry("sowt", 20),
+		Tables: [][]byte{
+			atomtest.Build("stts", atomtest.Uint32s(0, 1, 8, 15)),
+			atomtest.Build("stsc", atomtest.Uint32s(0, 1, 1, 4, 1)),
+			stsz,
+			atomtest.Build("stco", atomtest.Uint32s(0, 2, offset+64, offset+80)),
+		},
+	})
+	data := atomtest.Movie(ftyp, make([]byte, 96), atomtest.MovieHeader(120, 3), video, audio)
+	assert.NoError(t, os.WriteFile(path, data, 0o644))
+}
+
+// writeBroken writes a recording left with an 'mdat' atom of size 0 holding the returned video samples
+// matching the reference and two chunks of four audio samples
+func writeBroken(t *testing.T, path string) ([][]byte, [][]byte) {
+	videoSamples := [][]byte{
+		nalUnits([]byte{0x67, 0x42, 0, 0x1E}, []byte{0x68, 0xCE}, []byte{0x65, 0x88, 0x84, 0x21, 0xA0}),
+		nalUnits([]byte{0x41, 0x9A, 0x02, 0x0C}),
+		nalUnits([]byte{0x41, 0x9A, 0x04, 0x18}, []byte{0x41, 0x22, 0x33}),
+	}
+	audioSamples := [][]byte{[]byte("a0a0"), []byte("a1a1"), []byte("a2a2"), []byte("a3a3"), []byte("b0b0"), []byte("b1b1"), []byte("b2b2"), []byte("b3b3")}
+	mdat := bytes.Join([][]byte{
+		videoSamples[0], bytes.Join(audioSamples[:4], nil), videoSamples[1], videoSamples[2], bytes.Join(audioSamples[4:], nil),
+	}, nil)
+	assert.NoError(t, os.WriteFile(path, bytes.Join([][]byte{atomtest.FileType("isom", "mp41"), atomtest.Uint32s(0), []byte("mdat"), mdat}, nil), 0o644))
+	return videoSamples, audioSamples
+}
+
+// TestRecover tests that the video and audio samples of an 'mdat' atom left without a 'moov' atom are
+// found and written with new sample tables
+func TestRecover(t *testing.T) {
+	dir := t.TempDir()
+	reference := filepath.Join(dir, "reference.mp4")
+	input := filepath.Join(dir, "broken.mp4")
+	output := filepath.Join(dir, "recovered.mp4")
+	writeReference(t, reference, atomtest.Build("stsz", atomtest.Uint32s(0, 4, 8)))
+	videoSamples, audioSamples := writeBroken(t, input)
+
+	assert.NoError(t, Recover(input, reference, output, false))
+
+	tree, err := parser.ReadTree(output)
+	assert.NoError(t, err)
+	file, err := os.Open(output)
+	assert.NoError(t, err)
+	defer file.Close()
+	info, err := file.Stat()
+	assert.NoError(t, err)
+	tracks, err := parser.ReadTracks(tree, file, info.Size())
+	assert.NoError(t, err)
+	assert.Len(t, tracks, 2)
+	for i, expected := range [][][]byte{videoSamples, audioSamples} {
+		assert.Len(t, tracks[i].Samples, len(expected))
+		for j := range tracks[i].Samples {
+			data, err := tracks[i].ReadSample(file, j)
+			assert.NoError(t, err)
+			assert.Equal(t, expected[j], data, fmt.Sprintf("track %d sample %d", i+1, j))
+		}
+	}
+	assert.Equal(t, []bool{true, false, false}, []bool{tracks[0].Samples[0].Sync, tracks[0].Samples[1].Sync, tracks[0].Samples[2].Sync})
+	assert.Equal(t, uint64(80), tracks[0].Samples[2].DecodeTime)
+	assert.Equal(t, uint64(120), tracks[1].Atom.LeafData("mdia", "mdhd").(*atoms.MdhdAtom).Duration)
+	assert.Equal(t, uint64(120), tree.(*atoms.CompositeAtom).Find("moov", "mvhd").(*atoms.LeafAtom).Data.(*atoms.MvhdAtom).Duration)
+}
+
+// TestRecoverVariableSizeAudio tests that audio of variable frame size fails the recovery unless it may
+// be dropped
+func TestRecoverVariableSizeAudio(t *testing.T) {
+	dir := t.TempDir()
+	reference := filepath.Join(dir, "reference.mp4")
+	input := filepath.Join(dir, "broken.mp4")
+	output := filepath.Join(dir, "recovered.mp4")
+	writeReference(t, reference, atomtest.Build("stsz", atomtest.Uint32s(0, 0, 8, 4, 4, 4, 4, 2, 6, 4, 4)))
+	writeBroken(t, input)
+
+	assert.ErrorContains(t, Recover(input, reference, output, false), "audio track 2 cannot be recovered")
+	assert.NoFileExists(t, output)
+
+	assert.NoError(t, Recover(input, reference, output, true))
+	tree, err := parser.ReadTree(output)
+	assert.NoError(t, err)
+	file, err := os.Open(output)
+	assert.NoError(t, err)
+	defer file.Close()
+	info, err := file.Stat()
+	assert.NoError(t, err)
+	tracks, err := parser.ReadTracks(tree, file, info.Size())
+	assert.NoError(t, err)
+	assert.Len(t, tracks, 1)
+	assert.Equal(t, "vide", tracks[0].HandlerType)
+	assert.Len(t, tracks[0].Samples, 3)
+}
+
+// TestRecoverRejectsCompleteFile tests that a file which still has its 'moov' atom is left alone
+func TestRecoverRejectsCompleteFile(t *testing.T) {
+	dir := t.TempDir()
+	reference := filepath.Join(dir, "reference.mp4")
+	writeReference(t, reference, atomtest.Build("stsz", atomtest.Uint32s(0, 4, 8)))
+
+	assert.ErrorContains(t, Recover(reference, reference, filepath.Join(dir, "output.mp4"), false), "nothing to recover")
+}
+
+// TestScanWithoutAudio tests that data between video samples is skipped when no audio can be recovered
+func TestScanWithoutAudio(t *testing.T) {
+	data := bytes.Join([][]byte{
+		nalUnits([]byte{0x65, 0x88, 0x80}), []byte("noise"), nalUnits([]byte{0x41, 0x9A, 0x01}),
+	}, nil)
+	s := newScanner(bytes.NewReader(data), uint64(len(data)), 4, avc{})
+	video := &videoProfile{duration: 40}
+
+	samples, audio, skipped := scan(s, 0, video, nil)
+	assert.Empty(t, audio)
+	assert.Equal(t, uint64(5), skipped)
+	assert.Equal(t, []track.Sample{
+		{Offset: 0, Size: 7, Duration: 40, Sync: true, DescriptionIndex: 1},
+		{Offset: 12, Size: 7, DecodeTime: 40, Duration: 40, DescriptionIndex: 1},
+	}, samples)
+}
@@ -0,0 +1,284 @@
+package remux
+
+import (
+	"fmt"
+	"math"
+	"os"
+	"slices"
+	"sort"
+
+	"github.com/KrzysztofHeinke/quicktime-movie-parser/internal/parser"
+	"github.com/KrzysztofHeinke/quicktime-movie-parser/internal/track"
+	"github.com/KrzysztofHeinke/quicktime-movie-parser/internal/writer"
+	"github.com/KrzysztofHeinke/quicktime-movie-parser/pkg/models/atoms"
+	"github.com/sirupsen/logrus"
+)
+
+// interleaveDuration is the longest stretch of a track in seconds stored in one chunk of the output
+const interleaveDuration = 0.5
+
+// handlerAliases maps the track type names accepted besides handler types to the handler types they cover
+var handlerAliases = map[string][]string{
+	"video":    {"vide"},
+	"audio":    {"soun"},
+	"subtitle": {"sbtl", "subt", "text", "clcp"},
+	"timecode": {"tmcd"},
+	"metadata": {"meta"},
+}
+
+// Options selects the tracks written by Remux
+type Options struct {
+	// KeepTracks lists the IDs of the tracks to keep, every track is kept when it is empty
+	KeepTracks []uint32
+	// DropTypes lists the handler types, e.g. 'soun' or 'text', or aliases like 'audio' of the tracks to drop
+	DropTypes []string
+}
+
+// keeps tells whether the track is selected by the options
+func (o Options) keeps(t *track.Track) bool {
+	if len(o.KeepTracks) > 0 && !slices.Contains(o.KeepTracks, t.ID) {
+		return false
+	}
+	for _, dropType := range o.DropTypes {
+		if dropType == t.HandlerType || slices.Contains(handlerAliases[dropType], t.HandlerType) {
+			return false
+		}
+	}
+	return true
+}
+
+// layout is a kept track together with the chunks its samples are written in
+type layout struct {
+	track   *track.Track
+	chunks  []track.Chunk
+	sources []uint64
+}
+
+// placedChunk is a chunk of a kept track together with its position in the output 'mdat' atom
+type placedChunk struct {
+	layout *layout
+	index  int
+	offset uint64
+}
+
+// Remux writes the tracks of the input selected by the options to the output. The kept tracks are
+// renumbered from 1 in their original order, track references and the next track ID of 'mvhd' follow
+// the new IDs, and the samples are copied interleaved by time into one 'mdat' atom.
+func Remux(input, output string, options Options) error {
+	if err := writer.CheckDistinctFiles(input, output); err != nil {
+		return err
+	}
+	file, err := os.Open(input)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	info, err := file.Stat()
+	if err != nil {
+		return err
+	}
+
+	tree, err := parser.ReadTree(input)
+	if err != nil {
+		return err
+	}
+	moov, ok := tree.(*atoms.CompositeAtom).GetChild("moov").(*atoms.CompositeAtom)
+	if !ok {
+		return fmt.Errorf("moov atom could not be parsed")
+	}
+	mvhdLeaf, ok := moov.GetChild("mvhd").(*atoms.LeafAtom)
+	if !ok {
+		return fmt.Errorf("mvhd atom not found")
+	}
+	mvhd, ok := mvhdLeaf.Data.(*atoms.MvhdAtom)
+	if !ok {
+		return fmt.Errorf("mvhd atom could not be parsed")
+	}
+	tracks, err := parser.ReadTracks(tree, file, info.Size())
+	if err != nil {
+		return err
+	}
+
+	kept, err := selectTracks(tracks, options)
+	if err != nil {
+		return err
+	}
+	KeepTracks(moov, kept)
+	mvhd.Duration = 0
+	for _, t := range kept {
+		if tkhd, ok := t.Atom.LeafData("tkhd").(*atoms.TkhdAtom); ok {
+			mvhd.Duration = max(mvhd.Duration, tkhd.Duration)
+		}
+	}
+	mvhdLeaf.SetData(mvhd)
+
+	layouts := make([]*layout, len(kept))
+	for i, t := range kept {
+		layouts[i] = newLayout(t)
+	}
+	chunks := interleave(layouts)
+	ftyp, err := parser.ReadFileType(file, info.Size())
+	if err != nil {
+		return err
+	}
+	mediaChunks := make([]writer.MediaChunk, len(chunks))
+	for i, chunk := range chunks {
+		mediaChunks[i] = writer.MediaChunk{Source: chunk.layout.sources[chunk.index], Size: chunk.layout.chunks[chunk.index].Size}
+	}
+	return writer.WriteMovieFile(output, file, ftyp, moov, mediaChunks, true, func(dataOffset uint64) {
+		for _, chunk := range chunks {
+			chunk.layout.chunks[chunk.index].Offset = dataOffset + chunk.offset
+		}
+		for _, l := range layouts {
+			if stbl, ok := l.track.Atom.Find("mdia", "minf", "stbl").(*atoms.CompositeAtom); ok {
+				track.ReplaceSampleTables(stbl, track.BuildSampleTables(l.track.Samples, l.chunks))
+			}
+		}
+	})
+}
+
+// selectTracks returns the tracks selected by the options
+func selectTracks(tracks []*track.Track, options Options) ([]*track.Track, error) {
+	for _, trackID := range options.KeepTracks {
+		if !slices.ContainsFunc(tracks, func(t *track.Track) bool { return t.ID == trackID }) {
+			return nil, fmt.Errorf("track %d not found", trackID)
+		}
+	}
+	var kept []*track.Track
+	for _, t := range tracks {
+		if t.Fragments > 0 {
+			return nil, fmt.Errorf("remuxing fragmented files is not supported")
+		}
+		if options.keeps(t) {
+			kept = append(kept, t)
+		} else {
+			logrus.Infof("Dropping track %d (%s)", t.ID, t.HandlerType)
+		}
+	}
+	if len(kept) == 0 {
+		return nil, fmt.Errorf("no track left to write")
+	}
+	return kept, nil
+}
+
+// KeepTracks removes the 'trak' atoms of the tracks which are not kept from the movie and renumbers the
+// kept tracks from 1 in their order. Track references and the next track ID of 'mvhd' follow the new IDs.
+func KeepTracks(moov *atoms.CompositeAtom, kept []*track.Track) {
+	removeTracks(moov, kept)
+	renumberTracks(kept)
+	if mvhdLeaf, ok := moov.GetChild("mvhd").(*atoms.LeafAtom); ok {
+		if mvhd, ok := mvhdLeaf.Data.(*atoms.MvhdAtom); ok {
+			mvhd.NextTrackID = uint32(len(kept) + 1)
+			mvhdLeaf.SetData(mvhd)
+		}
+	}
+}
+
+// removeTracks removes the 'trak' atoms of the movie which do not belong to the kept tracks
+func removeTracks(moov *atoms.CompositeAtom, kept []*track.Track) {
+	var children []atoms.AtomIf
+	for _, child := range moov.GetChildren() {
+		trak, ok := child.(*atoms.CompositeAtom)
+		if ok && trak.GetType() == "trak" && !slices.ContainsFunc(kept, func(t *track.Track) bool { return t.Atom == trak }) {
+			continue
+		}
+		children = append(children, child)
+	}
+	moov.SetChildren(children)
+}
+
+// renumberTracks gives the tracks the IDs 1 to n in their order and updates their track references.
+// References to tracks which are not kept are removed.
+func renumberTracks(tracks []*track.Track) {
+	ids := make(map[uint32]uint32)
+	for i, t := range tracks {
+		ids[t.ID] = uint32(i + 1)
+	}
+	for _, t := range tracks {
+		if tkhd, ok := t.Atom.GetChild("tkhd").(*atoms.LeafAtom); ok {
+			if data, ok := tkhd.Data.(*atoms.TkhdAtom); ok {
+				data.TrackID = ids[t.ID]
+				tkhd.SetData(data)
+			}
+		}
+		t.ID = ids[t.ID]
+		updateReferences(t.Atom, ids)
+	}
+}
+
+// updateReferences maps the track IDs of the 'tref' atom of the track to the new IDs, dropping reference
+// types left without a track and the 'tref' atom itself when it ends up empty
+func updateReferences(trak *atoms.CompositeAtom, ids map[uint32]uint32) {
+	tref, ok := trak.GetChild("tref").(*atoms.CompositeAtom)
+	if !ok {
+		return
+	}
+	var references []atoms.AtomIf
+	for _, child := range tref.GetChildren() {
+		leaf, ok := child.(*atoms.LeafAtom)
+		if !ok {
+			references = append(references, child)
+			continue
+		}
+		reference, ok := leaf.Data.(*atoms.TrackReferenceAtom)
+		if !ok {
+			references = append(references, child)
+			continue
+		}
+		var trackIDs []uint32
+		for _, trackID := range reference.TrackIDs {
+			if id, ok := ids[trackID]; ok {
+				trackIDs = append(trackIDs, id)
+			}
+		}
+		if len(trackIDs) == 0 {
+			continue
+		}
+		reference.TrackIDs = trackIDs
+		leaf.SetData(reference)
+		references = append(references, leaf)
+	}
+	tref.SetChildren(references)
+	if len(references) == 0 {
+		trak.RemoveChildren("tref")
+	}
+}
+
+// newLayout splits the samples of the track into chunks of at most interleaveDuration
+func newLayout(t *track.Track) *layout {
+	maxDuration := uint64(math.Round(interleaveDuration * float64(t.TimeScale)))
+	l := &layout{track: t, chunks: track.SplitChunksByDuration(t.Samples, maxDuration)}
+	for _, chunk := range l.chunks {
+		l.sources = append(l.sources, chunk.Offset)
+	}
+	return l
+}
+
+// interleave returns the chunks of all tracks ordered by the time their first sample is decoded at,
+// placed one after the other
+func interleave(layouts []*layout) []placedChunk {
+	var chunks []placedChunk
+	for _, l := range layouts {
+		for i := range l.chunks {
+			chunks = append(chunks, placedChunk{layout: l, index: i})
+		}
+	}
+	sort.SliceStable(chunks, func(i, j int) bool {
+		return chunks[i].startTime() < chunks[j].startTime()
+	})
+	var size uint64
+	for i := range chunks {
+		chunks[i].offset = size
+		size += chunks[i].layout.chunks[chunks[i].index].Size
+	}
+	return chunks
+}
+
+// startTime returns the decode time of the first sample of the chunk in seconds
+func (c placedChunk) startTime() float64 {
+	t := c.layout.track
+	if t.TimeScale == 0 {
+		return 0
+	}
+	return float64(t.Samples[c.layout.chunks[c.index].FirstSample].DecodeTime) / float64(t.TimeScale)
+}
@@ -0,0 +1,91 @@
+package remux
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/KrzysztofHeinke/quicktime-movie-parser/internal/atomtest"
+	"github.com/KrzysztofHeinke/quicktime-movie-parser/internal/parser"
+	"github.com/KrzysztofHeinke/quicktime-movie-parser/internal/track"
+	"github.com/KrzysztofHeinke/quicktime-movie-parser/pkg/models/atoms"
+	"github.com/stretchr/testify/assert"
+)
+
+// testTrack builds a 'trak' atom with four samples of one second stored in a single chunk
+func testTrack(id uint32, handlerType string, chunkOffset uint32, extra ...[]byte) []byte {
+	return atomtest.Trak(atomtest.Track{
+		ID: id, HandlerType: handlerType, Duration: 4000, Entry: atomtest.SampleEntry("mp4a", 20),
+		Tables: atomtest.SampleTables(4, 1000, 4, 4, chunkOffset), Extra: extra,
+	})
+}
+
+// writeTestMovie writes a movie with a video, an audio and a text track whose samples are stored one
+// track after the other. The video track references the text track as its chapters.
+func writeTestMovie(t *testing.T, path string) {
+	ftyp := atomtest.FileType("qt  ")
+	offset := atomtest.MediaOffset(ftyp)
+	data := atomtest.Movie(ftyp, atomtest.Interleave(4, 4, "V", "A", "T"), atomtest.MovieHeader(4000, 4),
+		testTrack(1, "vide", offset, atomtest.Build("tref", atomtest.Build("chap", atomtest.Uint32s(3)))),
+		testTrack(2, "soun", offset+16),
+		testTrack(3, "text", offset+32),
+	)
+	assert.NoError(t, os.WriteFile(path, data, 0o644))
+}
+
+// readOutput reads the movie atom and the tracks of the output
+func readOutput(t *testing.T, path string) (*atoms.CompositeAtom, []*track.Track, *os.File) {
+	tree, err := parser.ReadTree(path)
+	assert.NoError(t, err)
+	file, err := os.Open(path)
+	assert.NoError(t, err)
+	t.Cleanup(func() { file.Close() })
+	info, err := file.Stat()
+	assert.NoError(t, err)
+	tracks, err := parser.ReadTracks(tree, file, info.Size())
+	assert.NoError(t, err)
+	return tree.(*atoms.CompositeAtom).GetChild("moov").(*atoms.CompositeAtom), tracks, file
+}
+
+// TestRemuxDropType tests that dropped tracks are removed and the others renumbered and interleaved
+func TestRemuxDropType(t *testing.T) {
+	dir := t.TempDir()
+	input := filepath.Join(dir, "input.mov")
+	output := filepath.Join(dir, "output.mov")
+	writeTestMovie(t, input)
+
+	assert.NoError(t, Remux(input, output, Options{DropTypes: []string{"audio"}}))
+
+	moov, tracks, file := readOutput(t, output)
+	assert.Equal(t, uint32(3), moov.LeafData("mvhd").(*atoms.MvhdAtom).NextTrackID)
+	assert.Len(t, tracks, 2)
+	for i, letter := range []string{"V", "T"} {
+		assert.Equal(t, uint32(i+1), tracks[i].ID)
+		assert.Len(t, tracks[i].Samples, 4)
+		for j := range tracks[i].Samples {
+			data, err := tracks[i].ReadSample(file, j)
+			assert.NoError(t, err)
+			assert.Equal(t, fmt.Sprintf("%s%d..", letter, j), string(data))
+		}
+	}
+	assert.Equal(t, []uint32{2}, tracks[0].Atom.LeafData("tref", "chap").(*atoms.TrackReferenceAtom).TrackIDs)
+	assert.Less(t, tracks[1].Samples[0].Offset, tracks[0].Samples[3].Offset)
+}
+
+// TestRemuxKeepTracks tests that references to dropped tracks are removed
+func TestRemuxKeepTracks(t *testing.T) {
+	dir := t.TempDir()
+	input := filepath.Join(dir, "input.mov")
+	output := filepath.Join(dir, "output.mov")
+	writeTestMovie(t, input)
+
+	assert.Error(t, Remux(input, output, Options{KeepTracks: []uint32{7}}))
+	assert.Error(t, Remux(input, output, Options{KeepTracks: []uint32{2}, DropTypes: []string{"soun"}}))
+	assert.NoError(t, Remux(input, output, Options{KeepTracks: []uint32{1, 2}}))
+
+	moov, tracks, _ := readOutput(t, output)
+	assert.Equal(t, uint32(3), moov.LeafData("mvhd").(*atoms.MvhdAtom).NextTrackID)
+	assert.Equal(t, []string{"vide", "soun"}, []string{tracks[0].HandlerType, tracks[1].HandlerType})
+	assert.Nil(t, tracks[0].Atom.GetChild("tref"))
+}
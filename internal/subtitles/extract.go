@@ -0,0 +1,116 @@
+package subtitles
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/KrzysztofHeinke/quicktime-movie-parser/internal/track"
+	"github.com/KrzysztofHeinke/quicktime-movie-parser/internal/writer"
+	"github.com/KrzysztofHeinke/quicktime-movie-parser/pkg/models/atoms"
+	"github.com/sirupsen/logrus"
+)
+
+// SelectTrack reports the subtitle and caption tracks and returns the track to extract, either the one
+// with the given ID or, for an ID of 0, the first one holding extractable subtitles. It returns nil if
+// there is no such track.
+func SelectTrack(tracks []*track.Track, trackID uint32) *track.Track {
+	var selected *track.Track
+	for _, t := range tracks {
+		format := GetFormat(t)
+		if format == "" {
+			continue
+		}
+		name, _ := atoms.GetSubtitleFormat(format)
+		if atoms.IsClosedCaptionFormat(format) {
+			logrus.Infof("Track %d: %s closed captions present", t.ID, name)
+		} else {
+			logrus.Infof("Track %d: %s subtitles, %d samples", t.ID, name, len(t.Samples))
+		}
+
+		if trackID != 0 {
+			if t.ID == trackID {
+				selected = t
+			}
+		} else if selected == nil && !atoms.IsClosedCaptionFormat(format) {
+			selected = t
+		}
+	}
+	return selected
+}
+
+// Extract writes the subtitles of the track to the output file, or to stdout if output is empty. Text
+// cues are written as SRT or WebVTT, by default WebVTT for 'wvtt' tracks and SRT for the others. TTML
+// documents are written as they are.
+func Extract(t *track.Track, r io.ReaderAt, format, output string, stdout io.Writer) error {
+	trackFormat := GetFormat(t)
+	if atoms.IsClosedCaptionFormat(trackFormat) {
+		return fmt.Errorf("track %d holds %s closed captions which cannot be extracted", t.ID, trackFormat)
+	}
+
+	if trackFormat == "stpp" {
+		documents, err := ReadDocuments(t, r)
+		if err != nil {
+			return err
+		}
+		return writeDocuments(documents, output, stdout)
+	}
+
+	cues, err := ReadCues(t, r)
+	if err != nil {
+		return err
+	}
+	if format == "" {
+		format = "srt"
+		if trackFormat == "wvtt" {
+			format = "vtt"
+		}
+	}
+
+	header := "WEBVTT"
+	if trackFormat == "wvtt" {
+		header = GetWebVTTHeader(t)
+	}
+	write := func(w io.Writer) error {
+		switch format {
+		case "srt":
+			return WriteSRT(w, cues)
+		case "vtt":
+			return WriteWebVTT(w, header, cues)
+		}
+		return fmt.Errorf("unknown format %q, expected srt or vtt", format)
+	}
+	if output == "" {
+		return write(stdout)
+	}
+	return writer.ReplaceFile(output, writer.OutputPerm, func(file *os.File) error {
+		return write(file)
+	})
+}
+
+// writeDocuments writes TTML documents. Several documents written to a file are numbered.
+func writeDocuments(documents [][]byte, output string, stdout io.Writer) error {
+	for i, document := range documents {
+		if output == "" {
+			if _, err := stdout.Write(document); err != nil {
+				return err
+			}
+			continue
+		}
+		path := output
+		if len(documents) > 1 {
+			extension := filepath.Ext(output)
+			path = fmt.Sprintf("%s-%03d%s", strings.TrimSuffix(output, extension), i+1, extension)
+		}
+		err := writer.ReplaceFile(path, writer.OutputPerm, func(file *os.File) error {
+			_, err := file.Write(document)
+			return err
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,142 @@
+package subtitles
+
+import (
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/KrzysztofHeinke/quicktime-movie-parser/internal/track"
+	"github.com/KrzysztofHeinke/quicktime-movie-parser/pkg/models/atoms"
+)
+
+// Cue is a single subtitle with its presentation interval in seconds
+type Cue struct {
+	Start    float64
+	End      float64
+	ID       string
+	Settings string
+	Text     string
+}
+
+// IsSubtitleTrack reports whether the track holds text, subtitles or closed captions
+func IsSubtitleTrack(t *track.Track) bool {
+	return GetFormat(t) != ""
+}
+
+// GetFormat returns the sample entry type of a text, subtitle or caption track or an empty string
+func GetFormat(t *track.Track) string {
+	if len(t.SampleDescriptions) == 0 {
+		return ""
+	}
+	format := t.SampleDescriptions[0].GetType()
+	if _, ok := atoms.GetSubtitleFormat(format); !ok {
+		return ""
+	}
+	return format
+}
+
+// ReadCues reads the cues of a QuickTime text, tx3g or WebVTT track. Empty samples, which only
+// mark gaps between subtitles, are skipped.
+func ReadCues(t *track.Track, r io.ReaderAt) ([]Cue, error) {
+	if t.TimeScale == 0 {
+		return nil, fmt.Errorf("track %d has no time scale", t.ID)
+	}
+	format := GetFormat(t)
+	timeScale := float64(t.TimeScale)
+
+	var cues []Cue
+	for i, sample := range t.Samples {
+		data, err := t.ReadSample(r, i)
+		if err != nil {
+			return nil, err
+		}
+		start := float64(sample.DecodeTime) / timeScale
+		end := float64(sample.DecodeTime+uint64(sample.Duration)) / timeScale
+
+		switch format {
+		case "text", "tx3g":
+			text, err := atoms.DecodeTextSample(data)
+			if err != nil {
+				return nil, fmt.Errorf("sample %d: %w", i+1, err)
+			}
+			text = strings.ReplaceAll(strings.ReplaceAll(text, "\r\n", "\n"), "\r", "\n")
+			if strings.TrimSpace(text) != "" {
+				cues = append(cues, Cue{Start: start, End: end, Text: text})
+			}
+		case "wvtt":
+			vttCues, err := atoms.DecodeWebVTTSample(data)
+			if err != nil {
+				return nil, fmt.Errorf("sample %d: %w", i+1, err)
+			}
+			for _, vttCue := range vttCues {
+				cues = append(cues, Cue{Start: start, End: end, ID: vttCue.ID, Settings: vttCue.Settings, Text: vttCue.Payload})
+			}
+		default:
+			return nil, fmt.Errorf("track %d: cannot read cues of %s samples", t.ID, format)
+		}
+	}
+	return cues, nil
+}
+
+// ReadDocuments reads the TTML documents of an 'stpp' track, one per sample.
+func ReadDocuments(t *track.Track, r io.ReaderAt) ([][]byte, error) {
+	documents := make([][]byte, 0, len(t.Samples))
+	for i := range t.Samples {
+		data, err := t.ReadSample(r, i)
+		if err != nil {
+			return nil, err
+		}
+		documents = append(documents, data)
+	}
+	return documents, nil
+}
+
+// GetWebVTTHeader returns the WebVTT file header stored in the 'vttC' atom of a WebVTT track
+func GetWebVTTHeader(t *track.Track) string {
+	if len(t.SampleDescriptions) > 0 {
+		if config, ok := t.SampleDescriptions[0].GetExtension("vttC").(*atoms.StringAtom); ok && config.Value != "" {
+			return config.Value
+		}
+	}
+	return "WEBVTT"
+}
+
+// WriteSRT writes the cues as a SubRip file
+func WriteSRT(w io.Writer, cues []Cue) error {
+	for i, cue := range cues {
+		_, err := fmt.Fprintf(w, "%d\n%s --> %s\n%s\n\n", i+1, formatTimestamp(cue.Start, ","), formatTimestamp(cue.End, ","), cue.Text)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// WriteWebVTT writes the cues as a WebVTT file with the given header
+func WriteWebVTT(w io.Writer, header string, cues []Cue) error {
+	if _, err := fmt.Fprintf(w, "%s\n\n", strings.TrimRight(header, "\n")); err != nil {
+		return err
+	}
+	for _, cue := range cues {
+		if cue.ID != "" {
+			if _, err := fmt.Fprintf(w, "%s\n", cue.ID); err != nil {
+				return err
+			}
+		}
+		timing := formatTimestamp(cue.Start, ".") + " --> " + formatTimestamp(cue.End, ".")
+		if cue.Settings != "" {
+			timing += " " + cue.Settings
+		}
+		if _, err := fmt.Fprintf(w, "%s\n%s\n\n", timing, cue.Text); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// formatTimestamp formats seconds as HH:MM:SS followed by the separator and milliseconds
+func formatTimestamp(seconds float64, separator string) string {
+	milliseconds := int64(seconds*1000 + 0.5)
+	return fmt.Sprintf("%02d:%02d:%02d%s%03d",
+		milliseconds/3600000, milliseconds/60000%60, milliseconds/1000%60, separator, milliseconds%1000)
+}
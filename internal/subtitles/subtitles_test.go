@@ -0,0 +1,123 @@
+package subtitles
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/KrzysztofHeinke/quicktime-movie-parser/internal/track"
+	"github.com/KrzysztofHeinke/quicktime-movie-parser/pkg/models/atoms"
+	"github.com/stretchr/testify/assert"
+)
+
+// box builds a raw atom of the given type
+func box(atomType string, payload ...[]byte) []byte {
+	body := bytes.Join(payload, nil)
+	result := make([]byte, 8, 8+len(body))
+	binary.BigEndian.PutUint32(result, uint32(8+len(body)))
+	copy(result[4:], atomType)
+	return append(result, body...)
+}
+
+// newTrack builds a track whose samples are stored back to back in the returned data
+func newTrack(format string, timeScale uint32, durations []uint32, samples ...[]byte) (*track.Track, []byte) {
+	t := &track.Track{ID: 3, TimeScale: timeScale}
+	entry := atoms.SampleEntry{RefIndex: 1}
+	copy(entry.Type[:], format)
+	t.SampleDescriptions = []atoms.SampleEntry{entry}
+
+	var data []byte
+	decodeTime := uint64(0)
+	for i, sample := range samples {
+		t.Samples = append(t.Samples, track.Sample{
+			Offset:           uint64(len(data)),
+			Size:             uint32(len(sample)),
+			DecodeTime:       decodeTime,
+			Duration:         durations[i],
+			Sync:             true,
+			DescriptionIndex: 1,
+		})
+		decodeTime += uint64(durations[i])
+		data = append(data, sample...)
+	}
+	return t, data
+}
+
+// textSample builds a 3GPP timed text sample
+func textSample(text string) []byte {
+	result := make([]byte, 2, 2+len(text))
+	binary.BigEndian.PutUint16(result, uint16(len(text)))
+	return append(result, text...)
+}
+
+// TestTx3gToSRT tests converting timed text samples to SubRip
+func TestTx3gToSRT(t *testing.T) {
+	subtitleTrack, data := newTrack("tx3g", 1000, []uint32{1500, 500, 2000},
+		textSample("Hello\rworld"), textSample(""), textSample("Second line"))
+
+	cues, err := ReadCues(subtitleTrack, bytes.NewReader(data))
+	assert.NoError(t, err)
+	assert.Len(t, cues, 2, "Expected the empty sample to be skipped")
+
+	var output strings.Builder
+	assert.NoError(t, WriteSRT(&output, cues))
+	assert.Equal(t, "1\n00:00:00,000 --> 00:00:01,500\nHello\nworld\n\n"+
+		"2\n00:00:02,000 --> 00:00:04,000\nSecond line\n\n", output.String())
+}
+
+// TestWebVTTPassThrough tests that WebVTT cues keep their identifiers and settings
+func TestWebVTTPassThrough(t *testing.T) {
+	cue := box("vttc", box("iden", []byte("intro")), box("sttg", []byte("line:0")), box("payl", []byte("Hi!")))
+	subtitleTrack, data := newTrack("wvtt", 90000, []uint32{90000, 45000}, cue, box("vtte"))
+
+	cues, err := ReadCues(subtitleTrack, bytes.NewReader(data))
+	assert.NoError(t, err)
+
+	var output strings.Builder
+	assert.NoError(t, WriteWebVTT(&output, GetWebVTTHeader(subtitleTrack), cues))
+	assert.Equal(t, "WEBVTT\n\nintro\n00:00:00.000 --> 00:00:01.000 line:0\nHi!\n\n", output.String())
+}
+
+// TestClosedCaptionFormat tests recognition of caption tracks
+func TestClosedCaptionFormat(t *testing.T) {
+	captionTrack, _ := newTrack("c608", 30000, nil)
+	assert.True(t, IsSubtitleTrack(captionTrack))
+	assert.True(t, atoms.IsClosedCaptionFormat(GetFormat(captionTrack)))
+}
+
+// TestSelectTrack tests that closed captions are only selected by their ID
+func TestSelectTrack(t *testing.T) {
+	captionTrack, _ := newTrack("c608", 30000, nil)
+	captionTrack.ID = 2
+	subtitleTrack, _ := newTrack("tx3g", 1000, nil)
+	tracks := []*track.Track{{ID: 1}, captionTrack, subtitleTrack}
+
+	assert.Same(t, subtitleTrack, SelectTrack(tracks, 0))
+	assert.Same(t, captionTrack, SelectTrack(tracks, 2))
+	assert.Nil(t, SelectTrack(tracks, 1))
+}
+
+// TestExtract tests the default formats of the cues, the refused closed captions and the numbering of
+// TTML documents written to a file
+func TestExtract(t *testing.T) {
+	subtitleTrack, data := newTrack("tx3g", 1000, []uint32{1500}, textSample("Hello"))
+	var output bytes.Buffer
+	assert.NoError(t, Extract(subtitleTrack, bytes.NewReader(data), "", "", &output))
+	assert.Equal(t, "1\n00:00:00,000 --> 00:00:01,500\nHello\n\n", output.String())
+
+	captionTrack, _ := newTrack("c608", 30000, nil)
+	assert.Error(t, Extract(captionTrack, bytes.NewReader(nil), "", "", &output))
+
+	ttmlTrack, data := newTrack("stpp", 1000, []uint32{1000, 1000}, []byte("<tt>1</tt>"), []byte("<tt>2</tt>"))
+	dir := t.TempDir()
+	assert.NoError(t, Extract(ttmlTrack, bytes.NewReader(data), "", filepath.Join(dir, "subs.ttml"), &output))
+	for i, name := range []string{"subs-001.ttml", "subs-002.ttml"} {
+		document, err := os.ReadFile(filepath.Join(dir, name))
+		assert.NoError(t, err)
+		assert.Equal(t, fmt.Sprintf("<tt>%d</tt>", i+1), string(document))
+	}
+}
@@ -0,0 +1,163 @@
+package tags
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"os"
+
+	"github.com/KrzysztofHeinke/quicktime-movie-parser/internal/parser"
+	"github.com/KrzysztofHeinke/quicktime-movie-parser/internal/writer"
+	"github.com/KrzysztofHeinke/quicktime-movie-parser/pkg/models/atoms"
+	"github.com/sirupsen/logrus"
+)
+
+// paddingAtoms are the top level atoms whose space may be taken by a grown 'moov' atom
+var paddingAtoms = map[string]bool{
+	"free": true,
+	"skip": true,
+	"wide": true,
+}
+
+// ReadMovie reads the 'moov' atom of the file for editing
+func ReadMovie(path string) (*atoms.CompositeAtom, error) {
+	tree, err := parser.ReadTree(path)
+	if err != nil {
+		return nil, err
+	}
+	moov, ok := tree.(*atoms.CompositeAtom).GetChild("moov").(*atoms.CompositeAtom)
+	if !ok {
+		return nil, fmt.Errorf("moov atom could not be parsed")
+	}
+	return moov, nil
+}
+
+// Save writes the edited 'moov' atom to the file. When it fits the space of the old atom together
+// with the adjacent 'free', 'skip' and 'wide' padding, only that space is rewritten and the remainder
+// is turned into a 'free' atom. A 'moov' atom at the end of the file is rewritten in place whatever its
+// size. Otherwise the file is rewritten with the chunk offsets shifted. It returns true if the file
+// was edited in place.
+func Save(path string, moov *atoms.CompositeAtom) (bool, error) {
+	file, err := os.OpenFile(path, os.O_RDWR, 0)
+	if err != nil {
+		return false, err
+	}
+	defer file.Close()
+	info, err := file.Stat()
+	if err != nil {
+		return false, err
+	}
+	topLevelAtoms, err := parser.ReadTopLevelAtoms(file, info.Size())
+	if err != nil {
+		return false, err
+	}
+	moovIndex := findMovieIndex(topLevelAtoms)
+	if moovIndex < 0 {
+		return false, fmt.Errorf("moov atom not found")
+	}
+
+	moovData, err := writer.Marshal(moov)
+	if err != nil {
+		return false, err
+	}
+	start, end := paddingWindow(topLevelAtoms, moovIndex)
+	atEnd := end == topLevelAtoms[len(topLevelAtoms)-1].Offset+topLevelAtoms[len(topLevelAtoms)-1].Size
+	if data, ok := fillWindow(moovData, end-start, atEnd); ok {
+		if _, err := file.WriteAt(data, start); err != nil {
+			return false, fmt.Errorf("failed to write moov atom: %w", err)
+		}
+		if atEnd {
+			if err := file.Truncate(start + int64(len(data))); err != nil {
+				return false, err
+			}
+		}
+		return true, nil
+	}
+
+	logrus.Infof("The moov atom does not fit its padding, rewriting the file")
+	return false, writer.ReplaceFile(path, info.Mode().Perm(), func(temporary *os.File) error {
+		err := rewrite(temporary, file, topLevelAtoms, moov, int64(len(moovData)))
+		file.Close()
+		return err
+	})
+}
+
+// SaveAs writes a copy of the file with the edited 'moov' atom to the output, shifting the chunk offsets
+func SaveAs(input, output string, moov *atoms.CompositeAtom) error {
+	file, err := os.Open(input)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	info, err := file.Stat()
+	if err != nil {
+		return err
+	}
+	topLevelAtoms, err := parser.ReadTopLevelAtoms(file, info.Size())
+	if err != nil {
+		return err
+	}
+	moovData, err := writer.Marshal(moov)
+	if err != nil {
+		return err
+	}
+
+	return writer.ReplaceFile(output, writer.OutputPerm, func(destination *os.File) error {
+		return rewrite(destination, file, topLevelAtoms, moov, int64(len(moovData)))
+	})
+}
+
+// rewrite writes the top level atoms of the input with the new 'moov' atom in place of the old one
+func rewrite(w io.Writer, input io.ReaderAt, topLevelAtoms []parser.TopLevelAtom, moov *atoms.CompositeAtom, moovSize int64) error {
+	moovIndex := findMovieIndex(topLevelAtoms)
+	if moovIndex < 0 {
+		return fmt.Errorf("moov atom not found")
+	}
+	if _, ok := parser.FindTopLevelAtom(topLevelAtoms[moovIndex:], "moof"); ok && moovSize != topLevelAtoms[moovIndex].Size {
+		return fmt.Errorf("the moov atom of a fragmented file can only be edited within its padding")
+	}
+	order := writer.SequentialOrder(topLevelAtoms)
+	moovData, err := writer.RelocateMovie(moov, topLevelAtoms, writer.OrderedLayout(topLevelAtoms, order), moovSize)
+	if err != nil {
+		return err
+	}
+	return writer.WriteAtoms(w, input, topLevelAtoms, order, moovData)
+}
+
+// findMovieIndex returns the index of the first 'moov' atom or -1
+func findMovieIndex(topLevelAtoms []parser.TopLevelAtom) int {
+	for i, atom := range topLevelAtoms {
+		if atom.Type == "moov" {
+			return i
+		}
+	}
+	return -1
+}
+
+// paddingWindow returns the byte range of the 'moov' atom extended over the padding atoms around it
+func paddingWindow(topLevelAtoms []parser.TopLevelAtom, moovIndex int) (int64, int64) {
+	first, last := moovIndex, moovIndex
+	for first > 0 && paddingAtoms[topLevelAtoms[first-1].Type] {
+		first--
+	}
+	for last < len(topLevelAtoms)-1 && paddingAtoms[topLevelAtoms[last+1].Type] {
+		last++
+	}
+	return topLevelAtoms[first].Offset, topLevelAtoms[last].Offset + topLevelAtoms[last].Size
+}
+
+// fillWindow returns the bytes to write over a window of the given size: the 'moov' atom followed by a
+// 'free' atom taking the rest. At the end of the file the window simply grows or shrinks.
+func fillWindow(moovData []byte, windowSize int64, atEnd bool) ([]byte, bool) {
+	remaining := windowSize - int64(len(moovData))
+	switch {
+	case atEnd || remaining == 0:
+		return moovData, true
+	case remaining < 8 || remaining > math.MaxUint32:
+		return nil, false
+	}
+	data := make([]byte, 0, windowSize)
+	data = append(data, moovData...)
+	data = writer.AppendHeader(data, [4]byte{'f', 'r', 'e', 'e'}, uint64(remaining-8), false)
+	return append(data, make([]byte, remaining-8)...), true
+}
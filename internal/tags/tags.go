@@ -0,0 +1,299 @@
+package tags
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/KrzysztofHeinke/quicktime-movie-parser/pkg/models/atoms"
+)
+
+// itemTypes maps the tag names to the item types of iTunes style 'ilst' atoms
+var itemTypes = map[string]string{
+	"title":       "\xa9nam",
+	"comment":     "\xa9cmt",
+	"artist":      "\xa9ART",
+	"album":       "\xa9alb",
+	"genre":       "\xa9gen",
+	"date":        "\xa9day",
+	"encoder":     "\xa9too",
+	"description": "desc",
+	"copyright":   "cprt",
+	"cover":       "covr",
+}
+
+// mdtaKeys maps the tag names to the keys of QuickTime 'mdta' metadata
+var mdtaKeys = map[string]string{
+	"title":       "com.apple.quicktime.title",
+	"comment":     "com.apple.quicktime.comment",
+	"artist":      "com.apple.quicktime.artist",
+	"album":       "com.apple.quicktime.album",
+	"genre":       "com.apple.quicktime.genre",
+	"date":        "com.apple.quicktime.creationdate",
+	"encoder":     "com.apple.quicktime.software",
+	"description": "com.apple.quicktime.description",
+	"copyright":   "com.apple.quicktime.copyright",
+	"cover":       "com.apple.quicktime.artwork",
+}
+
+// Tag is a metadata value to write to a file
+type Tag struct {
+	Name     string
+	Value    []byte
+	DataType uint32
+}
+
+// ParseTag parses a name=value argument. The value of the 'cover' tag is the path of a JPEG, PNG or BMP
+// image, every other value is stored as UTF-8 text.
+func ParseTag(spec string) (Tag, error) {
+	name, value, ok := strings.Cut(spec, "=")
+	if !ok || name == "" {
+		return Tag{}, fmt.Errorf("invalid tag %q, expected name=value", spec)
+	}
+	if name != "cover" {
+		return Tag{Name: name, Value: []byte(value), DataType: atoms.DataTypeUTF8}, nil
+	}
+
+	image, err := os.ReadFile(value)
+	if err != nil {
+		return Tag{}, fmt.Errorf("failed to read cover art: %w", err)
+	}
+	dataType, err := imageDataType(image)
+	if err != nil {
+		return Tag{}, fmt.Errorf("cover art %s: %w", value, err)
+	}
+	return Tag{Name: name, Value: image, DataType: dataType}, nil
+}
+
+// imageDataType returns the well-known data type of the image from its signature
+func imageDataType(image []byte) (uint32, error) {
+	switch {
+	case bytes.HasPrefix(image, []byte{0xFF, 0xD8, 0xFF}):
+		return atoms.DataTypeJPEG, nil
+	case bytes.HasPrefix(image, []byte("\x89PNG\r\n\x1a\n")):
+		return atoms.DataTypePNG, nil
+	case bytes.HasPrefix(image, []byte("BM")):
+		return atoms.DataTypeBMP, nil
+	}
+	return 0, fmt.Errorf("unsupported image format, expected JPEG, PNG or BMP")
+}
+
+// resolveName returns the 'ilst' item type and the 'mdta' key of a tag name. Names containing a dot are
+// custom 'mdta' keys and four character names, with '©' for the 0xA9 byte, are item types.
+func resolveName(name string) (string, string, error) {
+	if itemType, ok := itemTypes[name]; ok {
+		return itemType, mdtaKeys[name], nil
+	}
+	if strings.Contains(name, ".") {
+		return "", name, nil
+	}
+	itemType := strings.ReplaceAll(name, "©", "\xa9")
+	if len(itemType) == 4 {
+		return itemType, "", nil
+	}
+	return "", "", fmt.Errorf("unknown tag %q, use a known name, a four character item type or a reverse-DNS key", name)
+}
+
+// SetTag writes the tag to the 'moov' atom. Classic '©xxx' user data atoms of the same type are
+// updated as well. The value goes to the 'mdta' metadata when the name is a custom key, or when the file
+// only has 'mdta' metadata, and to the iTunes style 'ilst' otherwise, which is created if needed.
+func SetTag(moov *atoms.CompositeAtom, tag Tag) error {
+	itemType, key, err := resolveName(tag.Name)
+	if err != nil {
+		return err
+	}
+	if strings.HasPrefix(itemType, "\xa9") && tag.DataType == atoms.DataTypeUTF8 {
+		setUserDataText(moov, itemType, string(tag.Value))
+	}
+
+	value := &atoms.DataAtom{TypeIndicator: tag.DataType, Value: tag.Value}
+	if _, err := value.Encode(); err != nil {
+		return err
+	}
+	data := atoms.NewLeafAtom("data", value)
+	keyedMeta := findMeta(moov, "mdta")
+	itemList := findMeta(moov, "mdir")
+	if key != "" && (itemType == "" || (keyedMeta != nil && itemList == nil)) {
+		return setKeyedItem(moov, keyedMeta, key, data)
+	}
+
+	if itemList == nil {
+		itemList = newItemListMeta(moov)
+	}
+	ilst := itemList.GetChild("ilst").(*atoms.CompositeAtom)
+	setItem(ilst, atomType(itemType), data)
+	return nil
+}
+
+// RemoveTag removes the tag from the classic user data, the iTunes style 'ilst' and the 'mdta' metadata
+// of the 'moov' atom. It returns false if the tag was not found.
+func RemoveTag(moov *atoms.CompositeAtom, name string) (bool, error) {
+	itemType, key, err := resolveName(name)
+	if err != nil {
+		return false, err
+	}
+
+	removed := false
+	itemAtomType := atomType(itemType)
+	if udta, ok := moov.GetChild("udta").(*atoms.CompositeAtom); ok && itemType != "" {
+		removed = udta.RemoveChildren(string(itemAtomType[:])) || removed
+	}
+	if itemList := findMeta(moov, "mdir"); itemList != nil && itemType != "" {
+		if ilst, ok := itemList.GetChild("ilst").(*atoms.CompositeAtom); ok {
+			removed = ilst.RemoveChildren(string(itemAtomType[:])) || removed
+		}
+	}
+	if keyedMeta := findMeta(moov, "mdta"); keyedMeta != nil && key != "" {
+		keys, _ := keyedMeta.LeafData("keys").(*atoms.KeysAtom)
+		ilst, ok := keyedMeta.GetChild("ilst").(*atoms.CompositeAtom)
+		if index := keyIndex(keys, key); ok && index > 0 {
+			// The key itself is kept, so that the indexes of the other items stay valid
+			keyAtomType := keyItemType(index)
+			removed = ilst.RemoveChildren(string(keyAtomType[:])) || removed
+		}
+	}
+	return removed, nil
+}
+
+// setUserDataText replaces the text of the classic user data atoms of the given type
+func setUserDataText(moov *atoms.CompositeAtom, itemType string, value string) {
+	udta, ok := moov.GetChild("udta").(*atoms.CompositeAtom)
+	if !ok {
+		return
+	}
+	for _, child := range udta.GetChildren() {
+		leaf, ok := child.(*atoms.LeafAtom)
+		if !ok || leaf.GetType() != itemType {
+			continue
+		}
+		text, ok := leaf.Data.(*atoms.UserDataTextAtom)
+		if !ok {
+			continue
+		}
+		entry := atoms.UserDataText{Text: value}
+		if len(text.Entries) > 0 {
+			entry.Language = text.Entries[0].Language
+		}
+		text.Entries = []atoms.UserDataText{entry}
+		leaf.SetData(text)
+	}
+}
+
+// setKeyedItem stores the data atom as the item of the key in the 'mdta' metadata, creating the
+// metadata atom and the key if needed
+func setKeyedItem(moov, meta *atoms.CompositeAtom, key string, data *atoms.LeafAtom) error {
+	if meta == nil {
+		meta = atoms.NewCompositeAtom("meta")
+		meta.AddChild(newHandler("mdta", [4]byte{}))
+		meta.AddChild(atoms.NewLeafAtom("keys", &atoms.KeysAtom{}))
+		meta.AddChild(atoms.NewCompositeAtom("ilst"))
+		moov.AddChild(meta)
+	}
+
+	keysLeaf, ok := meta.GetChild("keys").(*atoms.LeafAtom)
+	if !ok {
+		return fmt.Errorf("mdta metadata without keys atom")
+	}
+	keys, ok := keysLeaf.Data.(*atoms.KeysAtom)
+	if !ok {
+		return fmt.Errorf("keys atom could not be parsed")
+	}
+	index := keyIndex(keys, key)
+	if index == 0 {
+		keys.Entries = append(keys.Entries, atoms.KeyEntry{Namespace: [4]byte{'m', 'd', 't', 'a'}, Value: key})
+		keys.EntryCount = uint32(len(keys.Entries))
+		keysLeaf.SetData(keys)
+		index = keys.EntryCount
+	}
+
+	ilst, ok := meta.GetChild("ilst").(*atoms.CompositeAtom)
+	if !ok {
+		ilst = atoms.NewCompositeAtom("ilst")
+		meta.AddChild(ilst)
+	}
+	setItem(ilst, keyItemType(index), data)
+	return nil
+}
+
+// keyIndex returns the 1-based index of the key or 0 if it is missing
+func keyIndex(keys *atoms.KeysAtom, key string) uint32 {
+	if keys == nil {
+		return 0
+	}
+	for i, entry := range keys.Entries {
+		if entry.Value == key {
+			return uint32(i + 1)
+		}
+	}
+	return 0
+}
+
+// keyItemType returns the type of the 'ilst' item of the key with the 1-based index
+func keyItemType(index uint32) [4]byte {
+	var itemType [4]byte
+	binary.BigEndian.PutUint32(itemType[:], index)
+	return itemType
+}
+
+// setItem replaces the values of the item of the given type, adding the item if it is missing
+func setItem(ilst *atoms.CompositeAtom, itemType [4]byte, data *atoms.LeafAtom) {
+	for _, child := range ilst.GetChildren() {
+		if item, ok := child.(*atoms.CompositeAtom); ok && item.Type == itemType {
+			item.SetChildren([]atoms.AtomIf{data})
+			item.Trailer = nil
+			return
+		}
+	}
+	ilst.AddChild(atoms.NewCompositeAtom(string(itemType[:]), data))
+}
+
+// findMeta returns the 'meta' atom of the movie or of its user data whose handler has the given type
+func findMeta(moov *atoms.CompositeAtom, handlerType string) *atoms.CompositeAtom {
+	candidates := []atoms.AtomIf{moov.GetChild("meta")}
+	if udta, ok := moov.GetChild("udta").(*atoms.CompositeAtom); ok {
+		candidates = append(candidates, udta.GetChild("meta"))
+	}
+	for _, candidate := range candidates {
+		meta, ok := candidate.(*atoms.CompositeAtom)
+		if !ok {
+			continue
+		}
+		if hdlr, ok := meta.LeafData("hdlr").(*atoms.HdlrAtom); ok && hdlr.GetHandlerType() == handlerType {
+			return meta
+		}
+	}
+	return nil
+}
+
+// newItemListMeta adds an ISO 'meta' atom with an empty iTunes style 'ilst' to the user data of the movie
+func newItemListMeta(moov *atoms.CompositeAtom) *atoms.CompositeAtom {
+	udta, ok := moov.GetChild("udta").(*atoms.CompositeAtom)
+	if !ok {
+		udta = atoms.NewCompositeAtom("udta")
+		moov.AddChild(udta)
+	}
+	meta := atoms.NewCompositeAtom("meta")
+	meta.Prefix = []byte{0, 0, 0, 0}
+	meta.AddChild(newHandler("mdir", [4]byte{'a', 'p', 'p', 'l'}))
+	meta.AddChild(atoms.NewCompositeAtom("ilst"))
+	// The terminator of QuickTime user data stays in the trailer behind the new atom
+	udta.AddChild(meta)
+	return meta
+}
+
+// newHandler returns a 'hdlr' atom for metadata of the given handler type
+func newHandler(handlerType string, manufacturer [4]byte) *atoms.LeafAtom {
+	hdlr := &atoms.HdlrAtom{}
+	copy(hdlr.HandlerType[:], handlerType)
+	copy(hdlr.Reserved[:], manufacturer[:])
+	return atoms.NewLeafAtom("hdlr", hdlr)
+}
+
+// atomType returns the four character code of the type
+func atomType(value string) [4]byte {
+	var result [4]byte
+	copy(result[:], value)
+	return result
+}
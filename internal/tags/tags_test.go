@@ -0,0 +1,158 @@
+package tags
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/KrzysztofHeinke/quicktime-movie-parser/internal/atomtest"
+	"github.com/KrzysztofHeinke/quicktime-movie-parser/internal/parser"
+	"github.com/KrzysztofHeinke/quicktime-movie-parser/pkg/models/atoms"
+	"github.com/stretchr/testify/assert"
+)
+
+// testMovie builds a 'moov' atom with a classic title and one chunk at the given offset
+func testMovie(chunkOffset uint32) []byte {
+	stbl := atomtest.Build("stbl", atomtest.Build("stco", atomtest.Uint32s(0, 1, chunkOffset)))
+	return atomtest.Build("moov",
+		atomtest.Build("trak", atomtest.Build("mdia", atomtest.Build("minf", stbl))),
+		atomtest.Build("udta", atomtest.Build("\xa9nam", []byte{0, 3, 0x55, 0xC4}, []byte("Old")), make([]byte, 4)),
+	)
+}
+
+// writeFile writes the atoms to a file in a temporary directory
+func writeFile(t *testing.T, parts ...[]byte) string {
+	path := filepath.Join(t.TempDir(), "movie.mov")
+	assert.NoError(t, os.WriteFile(path, bytes.Join(parts, nil), 0o644))
+	return path
+}
+
+// editTags sets and removes tags of the file and saves it in place
+func editTags(t *testing.T, path string, set []Tag, remove []string) bool {
+	moov, err := ReadMovie(path)
+	assert.NoError(t, err)
+	for _, tag := range set {
+		assert.NoError(t, SetTag(moov, tag))
+	}
+	for _, name := range remove {
+		removed, err := RemoveTag(moov, name)
+		assert.NoError(t, err)
+		assert.True(t, removed)
+	}
+	inPlace, err := Save(path, moov)
+	assert.NoError(t, err)
+	return inPlace
+}
+
+// checkChunk tests that the chunk offset of the file still points at the sample
+func checkChunk(t *testing.T, path string, sample []byte) {
+	data, err := os.ReadFile(path)
+	assert.NoError(t, err)
+	tree, err := parser.ReadTree(path)
+	assert.NoError(t, err)
+	stco, ok := tree.(*atoms.CompositeAtom).LeafData("moov", "trak", "mdia", "minf", "stbl", "stco").(*atoms.ChunkOffsetAtom)
+	assert.True(t, ok)
+	offset := stco.Offsets[0]
+	assert.Equal(t, sample, data[offset:offset+uint64(len(sample))])
+}
+
+// TestSetTagInPlace tests that a grown 'moov' atom takes the space of the padding behind it
+func TestSetTagInPlace(t *testing.T) {
+	moov := testMovie(0)
+	free := atomtest.Build("free", make([]byte, 400))
+	mdat := atomtest.Build("mdat", []byte("SAMPLE"))
+	path := writeFile(t, testMovie(uint32(len(moov)+len(free)+8)), free, mdat)
+	info, err := os.Stat(path)
+	assert.NoError(t, err)
+
+	inPlace := editTags(t, path, []Tag{
+		{Name: "title", Value: []byte("New title"), DataType: atoms.DataTypeUTF8},
+		{Name: "com.example.project", Value: []byte("Archive"), DataType: atoms.DataTypeUTF8},
+	}, nil)
+	assert.True(t, inPlace)
+
+	after, err := os.Stat(path)
+	assert.NoError(t, err)
+	assert.Equal(t, info.Size(), after.Size())
+	checkChunk(t, path, []byte("SAMPLE"))
+
+	tree, err := parser.ReadTree(path)
+	assert.NoError(t, err)
+	md := parser.CollectMetadata(tree)
+	assert.Equal(t, "New title", md.Title)
+	value, ok := md.Get("com.example.project")
+	assert.True(t, ok)
+	assert.Equal(t, "Archive", value)
+	titles := 0
+	for _, item := range md.Items {
+		if item.Key == "©nam" {
+			assert.Equal(t, "New title", item.Value)
+			titles++
+		}
+	}
+	assert.Equal(t, 2, titles, "Expected the classic and the iTunes style title")
+}
+
+// TestSetTagRewrite tests that the file is rewritten with shifted chunk offsets when there is no padding
+func TestSetTagRewrite(t *testing.T) {
+	ftyp := atomtest.Build("ftyp", []byte("qt  "), atomtest.Uint32s(0))
+	moov := testMovie(0)
+	offset := uint32(len(ftyp) + len(moov) + 8)
+	mdat := atomtest.Build("mdat", []byte("SAMPLE"))
+	path := writeFile(t, ftyp, testMovie(offset), mdat)
+
+	image := append([]byte{0xFF, 0xD8, 0xFF, 0xE0}, make([]byte, 100)...)
+	inPlace := editTags(t, path, []Tag{{Name: "cover", Value: image, DataType: atoms.DataTypeJPEG}}, nil)
+	assert.False(t, inPlace)
+	checkChunk(t, path, []byte("SAMPLE"))
+
+	info, err := os.Stat(path)
+	assert.NoError(t, err)
+	assert.Equal(t, os.FileMode(0o644), info.Mode().Perm(), "Expected the rewritten file to keep its permissions")
+
+	matches, err := filepath.Glob(filepath.Join(filepath.Dir(path), "*.tmp"))
+	assert.NoError(t, err)
+	assert.Empty(t, matches)
+}
+
+// TestRemoveTagAtEnd tests that a 'moov' atom at the end of the file shrinks the file
+func TestRemoveTagAtEnd(t *testing.T) {
+	mdat := atomtest.Build("mdat", []byte("SAMPLE"))
+	moov := testMovie(8)
+	path := writeFile(t, mdat, moov)
+
+	inPlace := editTags(t, path, nil, []string{"title"})
+	assert.True(t, inPlace)
+	info, err := os.Stat(path)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(len(mdat)+len(moov)-15), info.Size())
+	checkChunk(t, path, []byte("SAMPLE"))
+
+	tree, err := parser.ReadTree(path)
+	assert.NoError(t, err)
+	assert.Empty(t, parser.CollectMetadata(tree).Title)
+}
+
+// TestParseTag tests parsing of name=value arguments
+func TestParseTag(t *testing.T) {
+	tag, err := ParseTag("title=A=B")
+	assert.NoError(t, err)
+	assert.Equal(t, Tag{Name: "title", Value: []byte("A=B"), DataType: atoms.DataTypeUTF8}, tag)
+
+	_, err = ParseTag("title")
+	assert.Error(t, err)
+
+	cover := filepath.Join(t.TempDir(), "cover.png")
+	assert.NoError(t, os.WriteFile(cover, []byte("\x89PNG\r\n\x1a\n...."), 0o644))
+	tag, err = ParseTag("cover=" + cover)
+	assert.NoError(t, err)
+	assert.Equal(t, uint32(atoms.DataTypePNG), tag.DataType)
+
+	_, _, err = resolveName("unknown")
+	assert.Error(t, err)
+	itemType, key, err := resolveName("©wrt")
+	assert.NoError(t, err)
+	assert.Equal(t, "\xa9wrt", itemType)
+	assert.Empty(t, key)
+}
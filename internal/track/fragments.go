@@ -0,0 +1,178 @@
+package track
+
+import (
+	"fmt"
+	"slices"
+	"unsafe"
+
+	"github.com/KrzysztofHeinke/quicktime-movie-parser/pkg/models/atoms"
+)
+
+// Fragment is a parsed 'moof' atom together with its offset in the file
+type Fragment struct {
+	Offset int64
+	Moof   *atoms.CompositeAtom
+}
+
+// ApplyFragments appends the samples of the movie fragments to the tracks. Missing sample fields fall
+// back to the 'tfhd' defaults and then to the 'trex' defaults of the movie's 'mvex' atom. The samples
+// are charged to the budget.
+func ApplyFragments(root atoms.AtomIf, tracks []*Track, fragments []Fragment, budget *atoms.Budget) error {
+	defaults := map[uint32]*atoms.TrexAtom{}
+	if composite, ok := root.(*atoms.CompositeAtom); ok {
+		for _, atom := range composite.FindAll("trex") {
+			if leaf, ok := atom.(*atoms.LeafAtom); ok {
+				if trex, ok := leaf.Data.(*atoms.TrexAtom); ok {
+					defaults[trex.TrackID] = trex
+				}
+			}
+		}
+	}
+	byID := map[uint32]*Track{}
+	for _, t := range tracks {
+		byID[t.ID] = t
+	}
+
+	for i, fragment := range fragments {
+		// Without an explicit base, the first track fragment starts at the 'moof' atom
+		// and each following one where the data of the previous one ends.
+		dataEnd := uint64(fragment.Offset)
+		for _, atom := range fragment.Moof.FindAll("traf") {
+			traf, ok := atom.(*atoms.CompositeAtom)
+			if !ok {
+				continue
+			}
+			tfhd, ok := traf.LeafData("tfhd").(*atoms.TfhdAtom)
+			if !ok {
+				return fmt.Errorf("fragment %d: missing tfhd atom", i+1)
+			}
+			t, ok := byID[tfhd.TrackID]
+			if !ok {
+				return fmt.Errorf("fragment %d: track %d not found", i+1, tfhd.TrackID)
+			}
+			trex := defaults[tfhd.TrackID]
+			if trex == nil {
+				trex = &atoms.TrexAtom{TrackID: tfhd.TrackID, DefaultSampleDescriptionIndex: 1}
+			}
+
+			base := dataEnd
+			flags := tfhd.GetFlags()
+			if flags&atoms.TfhdBaseDataOffsetPresent != 0 {
+				base = tfhd.BaseDataOffset
+			} else if flags&atoms.TfhdDefaultBaseIsMoof != 0 {
+				base = uint64(fragment.Offset)
+			}
+			end, err := t.appendTrackFragment(traf, tfhd, trex, base, budget)
+			if err != nil {
+				return fmt.Errorf("fragment %d: track %d: %w", i+1, t.ID, err)
+			}
+			dataEnd = end
+			t.Fragments++
+		}
+	}
+
+	for _, t := range tracks {
+		if len(t.Samples) == 0 {
+			continue
+		}
+		last := t.Samples[len(t.Samples)-1]
+		t.Duration = max(t.Duration, last.DecodeTime+uint64(last.Duration))
+	}
+	return nil
+}
+
+// appendTrackFragment appends the samples of the track runs of a 'traf' atom and returns the
+// offset where their data ends.
+func (t *Track) appendTrackFragment(traf *atoms.CompositeAtom, tfhd *atoms.TfhdAtom, trex *atoms.TrexAtom, base uint64, budget *atoms.Budget) (uint64, error) {
+	flags := tfhd.GetFlags()
+	descriptionIndex := trex.DefaultSampleDescriptionIndex
+	if flags&atoms.TfhdSampleDescriptionIndexPresent != 0 {
+		descriptionIndex = tfhd.SampleDescriptionIndex
+	}
+	defaultDuration := trex.DefaultSampleDuration
+	if flags&atoms.TfhdDefaultSampleDurationPresent != 0 {
+		defaultDuration = tfhd.DefaultSampleDuration
+	}
+	defaultSize := trex.DefaultSampleSize
+	if flags&atoms.TfhdDefaultSampleSizePresent != 0 {
+		defaultSize = tfhd.DefaultSampleSize
+	}
+	defaultFlags := trex.DefaultSampleFlags
+	if flags&atoms.TfhdDefaultSampleFlagsPresent != 0 {
+		defaultFlags = tfhd.DefaultSampleFlags
+	}
+
+	var decodeTime uint64
+	if len(t.Samples) > 0 {
+		last := t.Samples[len(t.Samples)-1]
+		decodeTime = last.DecodeTime + uint64(last.Duration)
+	}
+	if tfdt, ok := traf.LeafData("tfdt").(*atoms.TfdtAtom); ok {
+		decodeTime = tfdt.BaseMediaDecodeTime
+	}
+
+	offset := base
+	for _, atom := range traf.FindAll("trun") {
+		leaf, ok := atom.(*atoms.LeafAtom)
+		if !ok {
+			continue
+		}
+		trun, ok := leaf.Data.(*atoms.TrunAtom)
+		if !ok {
+			continue
+		}
+		// Track runs without sample fields hold no entries and take no bytes per sample, so the samples of
+		// all runs are bounded
+		sampleCount := uint64(len(t.Samples)) + uint64(trun.SampleCount)
+		if err := atoms.CheckSize("track sample count", sampleCount, int64(atoms.CurrentLimits().MaxEntryCount)); err != nil {
+			return 0, err
+		}
+		if err := budget.Charge("sample index", uint64(trun.SampleCount), unsafe.Sizeof(Sample{})); err != nil {
+			return 0, err
+		}
+		t.Samples = slices.Grow(t.Samples, int(trun.SampleCount))
+		runFlags := trun.GetFlags()
+		if runFlags&atoms.TrunDataOffsetPresent != 0 {
+			position := int64(base) + int64(trun.DataOffset)
+			if position < 0 {
+				return 0, fmt.Errorf("track run data offset %d points before the start of the file", trun.DataOffset)
+			}
+			offset = uint64(position)
+		}
+
+		for i := 0; i < int(trun.SampleCount); i++ {
+			var entry atoms.TrunSample
+			if i < len(trun.Samples) {
+				entry = trun.Samples[i]
+			}
+			sample := Sample{
+				Offset:           offset,
+				Size:             defaultSize,
+				DecodeTime:       decodeTime,
+				Duration:         defaultDuration,
+				DescriptionIndex: descriptionIndex,
+			}
+			if runFlags&atoms.TrunSampleDurationPresent != 0 {
+				sample.Duration = entry.Duration
+			}
+			if runFlags&atoms.TrunSampleSizePresent != 0 {
+				sample.Size = entry.Size
+			}
+			sampleFlags := defaultFlags
+			if i == 0 && runFlags&atoms.TrunFirstSampleFlagsPresent != 0 {
+				sampleFlags = trun.FirstSampleFlags
+			} else if runFlags&atoms.TrunSampleFlagsPresent != 0 {
+				sampleFlags = entry.Flags
+			}
+			sample.Sync = sampleFlags&atoms.SampleIsNonSyncSample == 0
+			if runFlags&atoms.TrunSampleCompositionTimeOffsetsPresent != 0 {
+				sample.CompositionOffset = entry.CompositionTimeOffset
+			}
+
+			t.Samples = append(t.Samples, sample)
+			offset += uint64(sample.Size)
+			decodeTime += uint64(sample.Duration)
+		}
+	}
+	return offset, nil
+}
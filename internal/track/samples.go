@@ -0,0 +1,147 @@
+package track
+
+import (
+	"fmt"
+	"math"
+	"unsafe"
+
+	"github.com/KrzysztofHeinke/quicktime-movie-parser/pkg/models/atoms"
+)
+
+// BuildSamples combines the sample tables of an 'stbl' atom into the list of samples.
+// 'stsz' gives the sample sizes, 'stsc' together with 'stco' or 'co64' their positions,
+// 'stts' and 'ctts' their timing and 'stss' the sync samples. The samples are charged to the budget.
+func BuildSamples(stbl *atoms.CompositeAtom, budget *atoms.Budget) ([]Sample, error) {
+	stsz, ok := stbl.LeafData("stsz").(*atoms.StszAtom)
+	if !ok {
+		return nil, nil
+	}
+	stsc, ok := stbl.LeafData("stsc").(*atoms.StscAtom)
+	if !ok {
+		return nil, fmt.Errorf("missing stsc atom")
+	}
+	chunkOffsets, ok := stbl.LeafData("stco").(*atoms.ChunkOffsetAtom)
+	if !ok {
+		if chunkOffsets, ok = stbl.LeafData("co64").(*atoms.ChunkOffsetAtom); !ok {
+			return nil, fmt.Errorf("missing stco or co64 atom")
+		}
+	}
+
+	samples, err := locateSamples(stsz, stsc, chunkOffsets, budget)
+	if err != nil {
+		return nil, err
+	}
+	if stts, ok := stbl.LeafData("stts").(*atoms.SttsAtom); ok {
+		applyTimeToSample(samples, stts)
+	}
+	if ctts, ok := stbl.LeafData("ctts").(*atoms.CttsAtom); ok {
+		applyCompositionOffsets(samples, ctts)
+	}
+	if stss, ok := stbl.LeafData("stss").(*atoms.StssAtom); ok {
+		for i := range samples {
+			samples[i].Sync = false
+		}
+		for _, number := range stss.SampleNumbers {
+			if number >= 1 && int(number) <= len(samples) {
+				samples[number-1].Sync = true
+			}
+		}
+	}
+
+	return samples, nil
+}
+
+// locateSamples assigns every sample to its chunk and computes its offset in the file. The sample count
+// is checked against the samples the chunk tables describe before the index is allocated.
+func locateSamples(stsz *atoms.StszAtom, stsc *atoms.StscAtom, chunkOffsets *atoms.ChunkOffsetAtom, budget *atoms.Budget) ([]Sample, error) {
+	// Samples of a constant size have no entries in 'stsz', so their count is only bounded by the limit
+	if err := atoms.CheckSize("sample count", uint64(stsz.SampleCount), int64(atoms.CurrentLimits().MaxEntryCount)); err != nil {
+		return nil, err
+	}
+	if described := describedSamples(stsc, uint64(len(chunkOffsets.Offsets))); uint64(stsz.SampleCount) > described {
+		return nil, fmt.Errorf("chunk tables describe %d samples, stsz holds %d", described, stsz.SampleCount)
+	}
+	if err := budget.Charge("sample index", uint64(stsz.SampleCount), unsafe.Sizeof(Sample{})); err != nil {
+		return nil, err
+	}
+	sampleCount := int(stsz.SampleCount)
+	samples := make([]Sample, 0, sampleCount)
+
+	for i, entry := range stsc.Entries {
+		if entry.FirstChunk == 0 || (i > 0 && entry.FirstChunk <= stsc.Entries[i-1].FirstChunk) {
+			return nil, fmt.Errorf("invalid first chunk %d in stsc entry %d", entry.FirstChunk, i)
+		}
+		lastChunk := uint32(len(chunkOffsets.Offsets))
+		if i+1 < len(stsc.Entries) {
+			lastChunk = min(lastChunk, stsc.Entries[i+1].FirstChunk-1)
+		}
+
+		for chunk := entry.FirstChunk; chunk <= lastChunk && len(samples) < sampleCount; chunk++ {
+			offset := chunkOffsets.Offsets[chunk-1]
+			for j := uint32(0); j < entry.SamplesPerChunk && len(samples) < sampleCount; j++ {
+				size := stsz.GetSampleSize(len(samples))
+				samples = append(samples, Sample{
+					Offset:           offset,
+					Size:             size,
+					Sync:             true,
+					DescriptionIndex: entry.SampleDescriptionIndex,
+				})
+				offset += uint64(size)
+			}
+		}
+	}
+
+	if len(samples) != sampleCount {
+		return nil, fmt.Errorf("chunk tables describe %d samples, stsz holds %d", len(samples), sampleCount)
+	}
+	return samples, nil
+}
+
+// describedSamples returns the number of samples the 'stsc' entries give the chunks, up to the first
+// invalid entry. Counts beyond 32 bits are not summed up exactly.
+func describedSamples(stsc *atoms.StscAtom, chunkCount uint64) uint64 {
+	var total uint64
+	for i, entry := range stsc.Entries {
+		if entry.FirstChunk == 0 || uint64(entry.FirstChunk) > chunkCount || (i > 0 && entry.FirstChunk <= stsc.Entries[i-1].FirstChunk) {
+			break
+		}
+		lastChunk := chunkCount
+		if i+1 < len(stsc.Entries) && stsc.Entries[i+1].FirstChunk > entry.FirstChunk {
+			lastChunk = min(lastChunk, uint64(stsc.Entries[i+1].FirstChunk-1))
+		}
+		total += (lastChunk - uint64(entry.FirstChunk) + 1) * uint64(entry.SamplesPerChunk)
+		if total > math.MaxUint32 {
+			// More than any sample count, the sum cannot overflow
+			return total
+		}
+	}
+	return total
+}
+
+// applyTimeToSample sets the decode time and duration of the samples.
+func applyTimeToSample(samples []Sample, stts *atoms.SttsAtom) {
+	index := 0
+	decodeTime := uint64(0)
+	for _, entry := range stts.Entries {
+		for j := uint32(0); j < entry.SampleCount && index < len(samples); j++ {
+			samples[index].DecodeTime = decodeTime
+			samples[index].Duration = entry.SampleDuration
+			decodeTime += uint64(entry.SampleDuration)
+			index++
+		}
+	}
+	for ; index < len(samples); index++ {
+		samples[index].DecodeTime = decodeTime
+	}
+}
+
+// applyCompositionOffsets sets the composition offset of the samples.
+func applyCompositionOffsets(samples []Sample, ctts *atoms.CttsAtom) {
+	index := 0
+	for _, entry := range ctts.Entries {
+		for j := uint32(0); j < entry.SampleCount && index < len(samples); j++ {
+			samples[index].CompositionOffset = entry.SampleOffset
+			index++
+		}
+	}
+}
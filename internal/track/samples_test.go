@@ -0,0 +1,77 @@
+package track
+
+import (
+	"testing"
+
+	"github.com/KrzysztofHeinke/quicktime-movie-parser/pkg/models/atoms"
+	"github.com/stretchr/testify/assert"
+)
+
+// leaf wraps decoded atom data into a leaf atom of the given type
+func leaf(atomType string, data any) *atoms.LeafAtom {
+	atom := &atoms.LeafAtom{Data: data}
+	copy(atom.Type[:], atomType)
+	return atom
+}
+
+// TestBuildSamples tests combining the sample tables into the sample index
+func TestBuildSamples(t *testing.T) {
+	stbl := &atoms.CompositeAtom{}
+	stbl.AddChild(leaf("stsz", &atoms.StszAtom{SampleCount: 5, EntrySizes: []uint32{10, 20, 30, 40, 50}}))
+	stbl.AddChild(leaf("stsc", &atoms.StscAtom{Entries: []atoms.SampleToChunkEntry{
+		{FirstChunk: 1, SamplesPerChunk: 2, SampleDescriptionIndex: 1},
+		{FirstChunk: 3, SamplesPerChunk: 1, SampleDescriptionIndex: 1},
+	}}))
+	stbl.AddChild(leaf("stco", &atoms.ChunkOffsetAtom{Offsets: []uint64{1000, 2000, 3000}}))
+	stbl.AddChild(leaf("stts", &atoms.SttsAtom{Entries: []atoms.TimeToSampleEntry{{SampleCount: 5, SampleDuration: 100}}}))
+	stbl.AddChild(leaf("ctts", &atoms.CttsAtom{Entries: []atoms.CompositionOffsetEntry{
+		{SampleCount: 1, SampleOffset: 200}, {SampleCount: 4, SampleOffset: 0},
+	}}))
+	stbl.AddChild(leaf("stss", &atoms.StssAtom{SampleNumbers: []uint32{1, 4}}))
+
+	samples, err := BuildSamples(stbl, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, []Sample{
+		{Offset: 1000, Size: 10, DecodeTime: 0, Duration: 100, CompositionOffset: 200, Sync: true, DescriptionIndex: 1},
+		{Offset: 1010, Size: 20, DecodeTime: 100, Duration: 100, DescriptionIndex: 1},
+		{Offset: 2000, Size: 30, DecodeTime: 200, Duration: 100, DescriptionIndex: 1},
+		{Offset: 2030, Size: 40, DecodeTime: 300, Duration: 100, Sync: true, DescriptionIndex: 1},
+		{Offset: 3000, Size: 50, DecodeTime: 400, Duration: 100, DescriptionIndex: 1},
+	}, samples)
+}
+
+// TestBuildSamplesMismatch tests that chunk tables describing too few samples are reported
+func TestBuildSamplesMismatch(t *testing.T) {
+	stbl := &atoms.CompositeAtom{}
+	stbl.AddChild(leaf("stsz", &atoms.StszAtom{SampleSize: 4, SampleCount: 10}))
+	stbl.AddChild(leaf("stsc", &atoms.StscAtom{Entries: []atoms.SampleToChunkEntry{{FirstChunk: 1, SamplesPerChunk: 2, SampleDescriptionIndex: 1}}}))
+	stbl.AddChild(leaf("stco", &atoms.ChunkOffsetAtom{Offsets: []uint64{0}}))
+
+	_, err := BuildSamples(stbl, nil)
+	assert.Error(t, err)
+}
+
+// TestBuildSamplesLimit tests that samples of a constant size are not expanded past the entry count limit
+func TestBuildSamplesLimit(t *testing.T) {
+	stbl := &atoms.CompositeAtom{}
+	stbl.AddChild(leaf("stsz", &atoms.StszAtom{SampleSize: 4, SampleCount: 0xFFFFFFFF}))
+	stbl.AddChild(leaf("stsc", &atoms.StscAtom{Entries: []atoms.SampleToChunkEntry{{FirstChunk: 1, SamplesPerChunk: 0xFFFFFFFF, SampleDescriptionIndex: 1}}}))
+	stbl.AddChild(leaf("stco", &atoms.ChunkOffsetAtom{Offsets: []uint64{0}}))
+
+	_, err := BuildSamples(stbl, nil)
+	assert.ErrorIs(t, err, atoms.ErrLimitExceeded)
+}
+
+// TestBuildSamplesBudget tests that the sample index is charged to the allocation budget before it is built
+func TestBuildSamplesBudget(t *testing.T) {
+	stbl := &atoms.CompositeAtom{}
+	stbl.AddChild(leaf("stsz", &atoms.StszAtom{SampleSize: 1, SampleCount: 1 << 16}))
+	stbl.AddChild(leaf("stsc", &atoms.StscAtom{Entries: []atoms.SampleToChunkEntry{{FirstChunk: 1, SamplesPerChunk: 0xFFFFFFFF, SampleDescriptionIndex: 1}}}))
+	stbl.AddChild(leaf("stco", &atoms.ChunkOffsetAtom{Offsets: []uint64{0}}))
+
+	_, err := BuildSamples(stbl, atoms.NewBudget(1<<20))
+	assert.ErrorIs(t, err, atoms.ErrLimitExceeded)
+	samples, err := BuildSamples(stbl, atoms.NewBudget(1<<22))
+	assert.NoError(t, err)
+	assert.Len(t, samples, 1<<16)
+}
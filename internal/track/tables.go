@@ -0,0 +1,221 @@
+package track
+
+import (
+	"math"
+
+	"github.com/KrzysztofHeinke/quicktime-movie-parser/pkg/models/atoms"
+)
+
+// sampleTableAtoms are the atoms of an 'stbl' atom which describe its samples and are replaced when
+// the tables are rebuilt. Per-sample tables which are not rebuilt would be stale and are dropped too.
+var sampleTableAtoms = map[string]bool{
+	"stts": true,
+	"ctts": true,
+	"cslg": true,
+	"stss": true,
+	"stps": true,
+	"sdtp": true,
+	"stsz": true,
+	"stz2": true,
+	"stsc": true,
+	"stco": true,
+	"co64": true,
+	"padb": true,
+	"stdp": true,
+	"sbgp": true,
+	"subs": true,
+	"saiz": true,
+	"saio": true,
+}
+
+// Chunk is a run of samples of a track stored back to back in the file
+type Chunk struct {
+	Offset           uint64
+	Size             uint64
+	FirstSample      int
+	SampleCount      int
+	DescriptionIndex uint32
+}
+
+// SplitChunks groups the samples into chunks of samples which follow each other in the file and share
+// their sample description. The chunks keep the offsets the samples have in the file.
+func SplitChunks(samples []Sample) []Chunk {
+	return SplitChunksByDuration(samples, 0)
+}
+
+// SplitChunksByDuration groups the samples like SplitChunks, additionally starting a new chunk when a
+// chunk would last longer than the given duration in the media time scale. A duration of 0 sets no limit.
+func SplitChunksByDuration(samples []Sample, maxDuration uint64) []Chunk {
+	var chunks []Chunk
+	var duration uint64
+	for i, sample := range samples {
+		if len(chunks) > 0 {
+			last := &chunks[len(chunks)-1]
+			contiguous := last.Offset+last.Size == sample.Offset && last.DescriptionIndex == sample.DescriptionIndex
+			if contiguous && (maxDuration == 0 || duration+uint64(sample.Duration) <= maxDuration) {
+				last.Size += uint64(sample.Size)
+				last.SampleCount++
+				duration += uint64(sample.Duration)
+				continue
+			}
+		}
+		chunks = append(chunks, Chunk{
+			Offset:           sample.Offset,
+			Size:             uint64(sample.Size),
+			FirstSample:      i,
+			SampleCount:      1,
+			DescriptionIndex: sample.DescriptionIndex,
+		})
+		duration = uint64(sample.Duration)
+	}
+	return chunks
+}
+
+// BuildSampleTables returns the 'stts', 'ctts', 'stss', 'stsz', 'stsc' and 'stco' or 'co64' leaf atoms
+// describing the samples stored in the chunks, the inverse of BuildSamples. 'ctts' is only built when
+// a sample has a composition offset and 'stss' only when a sample is not a sync sample.
+func BuildSampleTables(samples []Sample, chunks []Chunk) []*atoms.LeafAtom {
+	stts := &atoms.SttsAtom{}
+	ctts := &atoms.CttsAtom{}
+	stss := &atoms.StssAtom{}
+	stsz := &atoms.StszAtom{SampleCount: uint32(len(samples))}
+	hasCompositionOffsets, allSync := false, true
+	for i, sample := range samples {
+		if n := len(stts.Entries); n > 0 && stts.Entries[n-1].SampleDuration == sample.Duration {
+			stts.Entries[n-1].SampleCount++
+		} else {
+			stts.Entries = append(stts.Entries, atoms.TimeToSampleEntry{SampleCount: 1, SampleDuration: sample.Duration})
+		}
+		if n := len(ctts.Entries); n > 0 && ctts.Entries[n-1].SampleOffset == sample.CompositionOffset {
+			ctts.Entries[n-1].SampleCount++
+		} else {
+			ctts.Entries = append(ctts.Entries, atoms.CompositionOffsetEntry{SampleCount: 1, SampleOffset: sample.CompositionOffset})
+		}
+		if sample.CompositionOffset < 0 {
+			ctts.Version = 1
+		}
+		hasCompositionOffsets = hasCompositionOffsets || sample.CompositionOffset != 0
+		if sample.Sync {
+			stss.SampleNumbers = append(stss.SampleNumbers, uint32(i+1))
+		}
+		allSync = allSync && sample.Sync
+		stsz.EntrySizes = append(stsz.EntrySizes, sample.Size)
+	}
+	if len(samples) > 0 && allEqual(stsz.EntrySizes) {
+		stsz.SampleSize, stsz.EntrySizes = samples[0].Size, nil
+	}
+
+	stsc := &atoms.StscAtom{}
+	chunkOffsets := &atoms.ChunkOffsetAtom{}
+	for i, chunk := range chunks {
+		n := len(stsc.Entries)
+		if n == 0 || stsc.Entries[n-1].SamplesPerChunk != uint32(chunk.SampleCount) || stsc.Entries[n-1].SampleDescriptionIndex != chunk.DescriptionIndex {
+			stsc.Entries = append(stsc.Entries, atoms.SampleToChunkEntry{
+				FirstChunk:             uint32(i + 1),
+				SamplesPerChunk:        uint32(chunk.SampleCount),
+				SampleDescriptionIndex: chunk.DescriptionIndex,
+			})
+		}
+		chunkOffsets.Offsets = append(chunkOffsets.Offsets, chunk.Offset)
+		chunkOffsets.Is64Bit = chunkOffsets.Is64Bit || chunk.Offset > math.MaxUint32
+	}
+
+	stts.EntryCount, ctts.EntryCount = uint32(len(stts.Entries)), uint32(len(ctts.Entries))
+	stss.EntryCount, stsc.EntryCount = uint32(len(stss.SampleNumbers)), uint32(len(stsc.Entries))
+	chunkOffsets.EntryCount = uint32(len(chunkOffsets.Offsets))
+
+	tables := []*atoms.LeafAtom{atoms.NewLeafAtom("stts", stts)}
+	if hasCompositionOffsets {
+		tables = append(tables, atoms.NewLeafAtom("ctts", ctts))
+	}
+	if !allSync {
+		tables = append(tables, atoms.NewLeafAtom("stss", stss))
+	}
+	return append(tables,
+		atoms.NewLeafAtom("stsz", stsz),
+		atoms.NewLeafAtom("stsc", stsc),
+		atoms.NewLeafAtom(chunkOffsets.GetType(), chunkOffsets),
+	)
+}
+
+// ReplaceSampleTables replaces the sample tables of the 'stbl' atom with the given leaf atoms, which
+// are placed after the 'stsd' atom
+func ReplaceSampleTables(stbl *atoms.CompositeAtom, tables []*atoms.LeafAtom) {
+	var children []atoms.AtomIf
+	inserted := false
+	for _, child := range stbl.GetChildren() {
+		if sampleTableAtoms[child.GetType()] {
+			continue
+		}
+		children = append(children, child)
+		if child.GetType() == "stsd" && !inserted {
+			children = appendTables(children, tables)
+			inserted = true
+		}
+	}
+	if !inserted {
+		children = appendTables(children, tables)
+	}
+	stbl.SetChildren(children)
+}
+
+// appendTables appends the leaf atoms to the children
+func appendTables(children []atoms.AtomIf, tables []*atoms.LeafAtom) []atoms.AtomIf {
+	for _, table := range tables {
+		children = append(children, table)
+	}
+	return children
+}
+
+// allEqual tells whether all values are the same
+func allEqual(values []uint32) bool {
+	for _, value := range values {
+		if value != values[0] {
+			return false
+		}
+	}
+	return true
+}
+
+// UpdateDurations sets the media duration of the track to the duration of its samples and the track
+// duration to the length of its edit list, or of its media without one. It returns the track duration
+// in the movie time scale.
+func (t *Track) UpdateDurations(movieTimeScale uint32) uint64 {
+	var mediaDuration uint64
+	for _, sample := range t.Samples {
+		mediaDuration += uint64(sample.Duration)
+	}
+	if mdhd, ok := t.Atom.Find("mdia", "mdhd").(*atoms.LeafAtom); ok {
+		if data, ok := mdhd.Data.(*atoms.MdhdAtom); ok {
+			data.Duration = mediaDuration
+			if mediaDuration > math.MaxUint32 {
+				data.Version = 1
+			}
+			mdhd.SetData(data)
+		}
+	}
+
+	var duration uint64
+	if t.TimeScale != 0 {
+		duration = uint64(math.Round(float64(mediaDuration) * float64(movieTimeScale) / float64(t.TimeScale)))
+	}
+	if elst, ok := t.Atom.LeafData("edts", "elst").(*atoms.ElstAtom); ok {
+		var editDuration uint64
+		for _, entry := range elst.Entries {
+			editDuration += entry.SegmentDuration
+		}
+		if editDuration > 0 {
+			duration = editDuration
+		}
+	}
+	if tkhd, ok := t.Atom.GetChild("tkhd").(*atoms.LeafAtom); ok {
+		if data, ok := tkhd.Data.(*atoms.TkhdAtom); ok {
+			data.Duration = duration
+			if duration > math.MaxUint32 {
+				data.Version = 1
+			}
+			tkhd.SetData(data)
+		}
+	}
+	return duration
+}
@@ -0,0 +1,74 @@
+package track
+
+import (
+	"testing"
+
+	"github.com/KrzysztofHeinke/quicktime-movie-parser/pkg/models/atoms"
+	"github.com/stretchr/testify/assert"
+)
+
+// TestBuildSampleTables tests that the rebuilt tables describe the samples they were built from
+func TestBuildSampleTables(t *testing.T) {
+	samples := []Sample{
+		{Offset: 1000, Size: 10, DecodeTime: 0, Duration: 100, CompositionOffset: 200, Sync: true, DescriptionIndex: 1},
+		{Offset: 1010, Size: 20, DecodeTime: 100, Duration: 100, DescriptionIndex: 1},
+		{Offset: 5000, Size: 30, DecodeTime: 200, Duration: 100, DescriptionIndex: 1},
+		{Offset: 5030, Size: 40, DecodeTime: 300, Duration: 50, CompositionOffset: -50, Sync: true, DescriptionIndex: 1},
+		{Offset: 5070, Size: 50, DecodeTime: 350, Duration: 50, DescriptionIndex: 2},
+	}
+	chunks := SplitChunks(samples)
+	assert.Equal(t, []Chunk{
+		{Offset: 1000, Size: 30, FirstSample: 0, SampleCount: 2, DescriptionIndex: 1},
+		{Offset: 5000, Size: 70, FirstSample: 2, SampleCount: 2, DescriptionIndex: 1},
+		{Offset: 5070, Size: 50, FirstSample: 4, SampleCount: 1, DescriptionIndex: 2},
+	}, chunks)
+
+	stbl := &atoms.CompositeAtom{}
+	stbl.AddChild(leaf("stsd", &atoms.AtomStsd{}))
+	stbl.AddChild(leaf("stco", &atoms.ChunkOffsetAtom{}))
+	stbl.AddChild(leaf("sdtp", nil))
+	ReplaceSampleTables(stbl, BuildSampleTables(samples, chunks))
+
+	var types []string
+	for _, child := range stbl.GetChildren() {
+		types = append(types, child.GetType())
+	}
+	assert.Equal(t, []string{"stsd", "stts", "ctts", "stss", "stsz", "stsc", "stco"}, types)
+	assert.Equal(t, uint8(1), stbl.LeafData("ctts").(*atoms.CttsAtom).Version)
+
+	rebuilt, err := BuildSamples(stbl, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, samples, rebuilt)
+}
+
+// TestBuildSampleTablesConstantSize tests that samples of one size share the size of 'stsz' and need no 'stss'
+func TestBuildSampleTablesConstantSize(t *testing.T) {
+	samples := []Sample{
+		{Offset: 0x100000000, Size: 4, Duration: 1024, Sync: true, DescriptionIndex: 1},
+		{Offset: 0x100000004, Size: 4, DecodeTime: 1024, Duration: 1024, Sync: true, DescriptionIndex: 1},
+	}
+	tables := BuildSampleTables(samples, SplitChunks(samples))
+
+	var types []string
+	for _, table := range tables {
+		types = append(types, table.GetType())
+	}
+	assert.Equal(t, []string{"stts", "stsz", "stsc", "co64"}, types)
+	stsz := tables[1].Data.(*atoms.StszAtom)
+	assert.Equal(t, uint32(4), stsz.SampleSize)
+	assert.Equal(t, uint32(2), stsz.SampleCount)
+	assert.Empty(t, stsz.EntrySizes)
+}
+
+// TestSplitChunksByDuration tests that chunks are split when they would last too long
+func TestSplitChunksByDuration(t *testing.T) {
+	var samples []Sample
+	for i := 0; i < 5; i++ {
+		samples = append(samples, Sample{Offset: uint64(i * 10), Size: 10, DecodeTime: uint64(i * 100), Duration: 100, DescriptionIndex: 1})
+	}
+	chunks := SplitChunksByDuration(samples, 200)
+	assert.Len(t, chunks, 3)
+	assert.Equal(t, []int{0, 2, 4}, []int{chunks[0].FirstSample, chunks[1].FirstSample, chunks[2].FirstSample})
+	assert.Equal(t, uint64(20), chunks[1].Offset)
+	assert.Len(t, SplitChunksByDuration(samples, 0), 1)
+}
@@ -0,0 +1,129 @@
+package track
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/KrzysztofHeinke/quicktime-movie-parser/pkg/models/atoms"
+)
+
+// Sample describes a single media sample located through the sample tables
+type Sample struct {
+	Offset            uint64
+	Size              uint32
+	DecodeTime        uint64
+	Duration          uint32
+	CompositionOffset int32
+	Sync              bool
+	DescriptionIndex  uint32
+}
+
+// Track is a track of the movie together with the index of its samples
+type Track struct {
+	ID                 uint32
+	HandlerType        string
+	TimeScale          uint32
+	Duration           uint64
+	SampleDescriptions []atoms.SampleEntry
+	Samples            []Sample
+	Fragments          int
+	Atom               *atoms.CompositeAtom
+}
+
+// ReadTracks builds the tracks of every 'trak' atom of the movie, charging their samples to the budget
+func ReadTracks(root atoms.AtomIf, budget *atoms.Budget) ([]*Track, error) {
+	composite, ok := root.(*atoms.CompositeAtom)
+	if !ok {
+		return nil, fmt.Errorf("root atom is not a composite atom")
+	}
+
+	var tracks []*Track
+	for _, atom := range composite.FindAll("trak") {
+		trakAtom, ok := atom.(*atoms.CompositeAtom)
+		if !ok {
+			continue
+		}
+		track, err := NewTrack(trakAtom, budget)
+		if err != nil {
+			return nil, err
+		}
+		tracks = append(tracks, track)
+	}
+	return tracks, nil
+}
+
+// NewTrack builds the track and its sample index from a 'trak' atom, charging the samples to the budget
+func NewTrack(trakAtom *atoms.CompositeAtom, budget *atoms.Budget) (*Track, error) {
+	track := &Track{Atom: trakAtom}
+
+	if tkhd, ok := trakAtom.LeafData("tkhd").(*atoms.TkhdAtom); ok {
+		track.ID = tkhd.TrackID
+	}
+	if hdlr, ok := trakAtom.LeafData("mdia", "hdlr").(*atoms.HdlrAtom); ok {
+		track.HandlerType = hdlr.GetHandlerType()
+	}
+	if mdhd, ok := trakAtom.LeafData("mdia", "mdhd").(*atoms.MdhdAtom); ok {
+		track.TimeScale = mdhd.TimeScale
+		track.Duration = mdhd.Duration
+	}
+
+	stbl, ok := trakAtom.Find("mdia", "minf", "stbl").(*atoms.CompositeAtom)
+	if !ok {
+		return track, nil
+	}
+	if stsd, ok := stbl.LeafData("stsd").(*atoms.AtomStsd); ok {
+		track.SampleDescriptions = stsd.SampleEntries
+	}
+
+	samples, err := BuildSamples(stbl, budget)
+	if err != nil {
+		return nil, fmt.Errorf("track %d: %w", track.ID, err)
+	}
+	track.Samples = samples
+
+	return track, nil
+}
+
+// GetSampleEntry returns the sample description used by the sample or nil
+func (t *Track) GetSampleEntry(sample Sample) *atoms.SampleEntry {
+	index := int(sample.DescriptionIndex) - 1
+	if index < 0 || index >= len(t.SampleDescriptions) {
+		return nil
+	}
+	return &t.SampleDescriptions[index]
+}
+
+// ReadSample reads the data of the sample with the 0-based index from the movie file. Samples above
+// the atom size limit are not read.
+func (t *Track) ReadSample(r io.ReaderAt, index int) ([]byte, error) {
+	if index < 0 || index >= len(t.Samples) {
+		return nil, fmt.Errorf("sample %d out of range, track has %d samples", index, len(t.Samples))
+	}
+	sample := t.Samples[index]
+	if err := atoms.CheckSize("sample size", uint64(sample.Size), atoms.CurrentLimits().MaxAtomSize); err != nil {
+		return nil, fmt.Errorf("sample %d: %w", index, err)
+	}
+	data := make([]byte, sample.Size)
+	if _, err := r.ReadAt(data, int64(sample.Offset)); err != nil {
+		return nil, fmt.Errorf("failed to read sample %d at offset %d: %w", index, sample.Offset, err)
+	}
+	return data, nil
+}
+
+// FindTrak returns the 'trak' atom of the track with the given ID or nil
+func FindTrak(root atoms.AtomIf, trackID uint32) *atoms.CompositeAtom {
+	composite, ok := root.(*atoms.CompositeAtom)
+	if !ok {
+		return nil
+	}
+	for _, atom := range composite.FindAll("trak") {
+		trakAtom, ok := atom.(*atoms.CompositeAtom)
+		if !ok {
+			continue
+		}
+		if tkhd, ok := trakAtom.LeafData("tkhd").(*atoms.TkhdAtom); ok && tkhd.TrackID == trackID {
+			return trakAtom
+		}
+	}
+	return nil
+}
@@ -0,0 +1,169 @@
+package trim
+
+import (
+	"math"
+
+	"github.com/KrzysztofHeinke/quicktime-movie-parser/internal/track"
+	"github.com/KrzysztofHeinke/quicktime-movie-parser/pkg/models/atoms"
+)
+
+// cut is the part of a track kept by the trim
+type cut struct {
+	track   *track.Track
+	samples []track.Sample
+	chunks  []track.Chunk
+	// sources holds the offsets of the chunks in the input, the chunks themselves get their offsets in the output
+	sources []uint64
+	// emptyDuration and mediaTime describe the edit list, segmentDuration is in the movie time scale
+	emptyDuration   uint64
+	mediaTime       int64
+	segmentDuration uint64
+}
+
+// cutTrack selects the samples of the track needed to present the range from start to end seconds of
+// the movie. The range starts at the last sync sample presented no later than the start, so the kept
+// samples can be decoded, and the edit list skips the samples presented before the start.
+func cutTrack(t *track.Track, movieTimeScale uint32, start, end float64) *cut {
+	result := &cut{track: t}
+	if t.TimeScale == 0 || len(t.Samples) == 0 {
+		return result
+	}
+	delay, shift := editOffsets(t.Atom, movieTimeScale)
+	startMedia := int64(math.Round((start-delay)*float64(t.TimeScale))) + shift
+	endMedia := int64(math.Round((end-delay)*float64(t.TimeScale))) + shift
+
+	first, last := 0, -1
+	for i, sample := range t.Samples {
+		presentationTime := presentationTime(sample)
+		if sample.Sync && presentationTime <= startMedia {
+			first = i
+		}
+		if presentationTime < endMedia {
+			last = i
+		}
+	}
+	if last < first {
+		return result
+	}
+
+	base := t.Samples[first].DecodeTime
+	mediaStart, mediaEnd := int64(math.MaxInt64), int64(math.MinInt64)
+	for _, sample := range t.Samples[first : last+1] {
+		mediaStart = min(mediaStart, presentationTime(sample))
+		mediaEnd = max(mediaEnd, presentationTime(sample)+int64(sample.Duration))
+		sample.DecodeTime -= base
+		result.samples = append(result.samples, sample)
+	}
+	mediaStart, mediaEnd = max(mediaStart, startMedia), min(mediaEnd, endMedia)
+	if mediaEnd <= mediaStart {
+		result.samples = nil
+		return result
+	}
+
+	result.emptyDuration = rescale(uint64(mediaStart-startMedia), t.TimeScale, movieTimeScale)
+	result.mediaTime = mediaStart - int64(base)
+	result.segmentDuration = rescale(uint64(mediaEnd-mediaStart), t.TimeScale, movieTimeScale)
+	result.chunks = track.SplitChunks(result.samples)
+	for _, chunk := range result.chunks {
+		result.sources = append(result.sources, chunk.Offset)
+	}
+	return result
+}
+
+// presentationTime returns the time the sample is presented at in the media time scale
+func presentationTime(sample track.Sample) int64 {
+	return int64(sample.DecodeTime) + int64(sample.CompositionOffset)
+}
+
+// editOffsets returns the time in seconds the edit list of the track delays its media with leading empty
+// edits and the media time its first edit starts at. Later edits are not taken into account.
+func editOffsets(trak *atoms.CompositeAtom, movieTimeScale uint32) (float64, int64) {
+	elst, ok := trak.LeafData("edts", "elst").(*atoms.ElstAtom)
+	if !ok || movieTimeScale == 0 {
+		return 0, 0
+	}
+	var delay uint64
+	for _, entry := range elst.Entries {
+		if entry.MediaTime >= 0 {
+			break
+		}
+		delay += entry.SegmentDuration
+	}
+	return float64(delay) / float64(movieTimeScale), elst.GetMediaStart()
+}
+
+// rescale converts a duration from one time scale to another
+func rescale(duration uint64, from, to uint32) uint64 {
+	return uint64(math.Round(float64(duration) * float64(to) / float64(from)))
+}
+
+// duration returns the duration of the kept samples in the media time scale
+func (c *cut) duration() uint64 {
+	var duration uint64
+	for _, sample := range c.samples {
+		duration += uint64(sample.Duration)
+	}
+	return duration
+}
+
+// apply rewrites the atoms of the track to describe the kept samples, whose chunks are placed at the
+// given offsets of the output
+func (c *cut) apply(offsets []uint64) {
+	for i := range c.chunks {
+		c.chunks[i].Offset = offsets[i]
+	}
+	trak := c.track.Atom
+	if stbl, ok := trak.Find("mdia", "minf", "stbl").(*atoms.CompositeAtom); ok {
+		track.ReplaceSampleTables(stbl, track.BuildSampleTables(c.samples, c.chunks))
+	}
+	if mdhd, ok := trak.Find("mdia", "mdhd").(*atoms.LeafAtom); ok {
+		if data, ok := mdhd.Data.(*atoms.MdhdAtom); ok {
+			data.Duration = c.duration()
+			mdhd.SetData(data)
+		}
+	}
+	if tkhd, ok := trak.GetChild("tkhd").(*atoms.LeafAtom); ok {
+		if data, ok := tkhd.Data.(*atoms.TkhdAtom); ok {
+			data.Duration = c.trackDuration()
+			tkhd.SetData(data)
+		}
+	}
+	c.replaceEditList()
+}
+
+// trackDuration returns the duration of the track in the movie time scale
+func (c *cut) trackDuration() uint64 {
+	if len(c.samples) == 0 {
+		return 0
+	}
+	return c.emptyDuration + c.segmentDuration
+}
+
+// replaceEditList replaces the edit list of the track with one presenting the kept range
+func (c *cut) replaceEditList() {
+	trak := c.track.Atom
+	trak.RemoveChildren("edts")
+	if len(c.samples) == 0 {
+		return
+	}
+	var children []atoms.AtomIf
+	for _, child := range trak.GetChildren() {
+		children = append(children, child)
+		if child.GetType() == "tkhd" {
+			children = append(children, c.editListAtom())
+		}
+	}
+	trak.SetChildren(children)
+}
+
+// editListAtom returns the 'edts' atom holding the edit list of the kept range
+func (c *cut) editListAtom() *atoms.CompositeAtom {
+	elst := &atoms.ElstAtom{}
+	if c.emptyDuration > 0 {
+		elst.Entries = append(elst.Entries, atoms.EditListEntry{SegmentDuration: c.emptyDuration, MediaTime: -1, MediaRateInteger: 1})
+	}
+	elst.Entries = append(elst.Entries, atoms.EditListEntry{SegmentDuration: c.segmentDuration, MediaTime: c.mediaTime, MediaRateInteger: 1})
+	elst.EntryCount = uint32(len(elst.Entries))
+
+	return atoms.NewCompositeAtom("edts", atoms.NewLeafAtom("elst", elst))
+}
@@ -0,0 +1,133 @@
+package trim
+
+import (
+	"fmt"
+	"os"
+	"sort"
+
+	"github.com/KrzysztofHeinke/quicktime-movie-parser/internal/parser"
+	"github.com/KrzysztofHeinke/quicktime-movie-parser/internal/writer"
+	"github.com/KrzysztofHeinke/quicktime-movie-parser/pkg/models/atoms"
+	"github.com/sirupsen/logrus"
+)
+
+// placedChunk is a chunk of a cut track together with its position in the output 'mdat' atom
+type placedChunk struct {
+	cut    *cut
+	index  int
+	offset uint64
+}
+
+// Trim writes the part of the input from start to end seconds to the output without re-encoding. Every
+// track starts at the last sync sample presented no later than the start, and an edit list hides the
+// samples before the start, so presentation is frame accurate. An end of 0 or past the movie keeps the
+// rest of the movie. The output holds the 'ftyp' atom of the input, the 'moov' atom and one 'mdat' atom.
+func Trim(input, output string, start, end float64) error {
+	if start < 0 || end < 0 || (end > 0 && end <= start) {
+		return fmt.Errorf("invalid range from %gs to %gs", start, end)
+	}
+	if err := writer.CheckDistinctFiles(input, output); err != nil {
+		return err
+	}
+	file, err := os.Open(input)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	info, err := file.Stat()
+	if err != nil {
+		return err
+	}
+
+	tree, err := parser.ReadTree(input)
+	if err != nil {
+		return err
+	}
+	moov, ok := tree.(*atoms.CompositeAtom).GetChild("moov").(*atoms.CompositeAtom)
+	if !ok {
+		return fmt.Errorf("moov atom could not be parsed")
+	}
+	mvhdLeaf, ok := moov.GetChild("mvhd").(*atoms.LeafAtom)
+	if !ok {
+		return fmt.Errorf("mvhd atom not found")
+	}
+	mvhd, ok := mvhdLeaf.Data.(*atoms.MvhdAtom)
+	if !ok || mvhd.TimeScale == 0 {
+		return fmt.Errorf("mvhd atom has no time scale")
+	}
+	tracks, err := parser.ReadTracks(tree, file, info.Size())
+	if err != nil {
+		return err
+	}
+	for _, t := range tracks {
+		if t.Fragments > 0 {
+			return fmt.Errorf("trimming fragmented files is not supported")
+		}
+	}
+
+	movieDuration := float64(mvhd.Duration) / float64(mvhd.TimeScale)
+	if end == 0 || end > movieDuration {
+		end = movieDuration
+	}
+	if start >= end {
+		return fmt.Errorf("start %gs is past the end of the %gs movie", start, movieDuration)
+	}
+
+	var cuts []*cut
+	for _, t := range tracks {
+		c := cutTrack(t, mvhd.TimeScale, start, end)
+		logrus.Debugf("Track %d: keeping %d of %d samples", t.ID, len(c.samples), len(t.Samples))
+		cuts = append(cuts, c)
+	}
+	chunks := placeChunks(cuts)
+	ftyp, err := parser.ReadFileType(file, info.Size())
+	if err != nil {
+		return err
+	}
+	mediaChunks := make([]writer.MediaChunk, len(chunks))
+	for i, chunk := range chunks {
+		mediaChunks[i] = writer.MediaChunk{Source: chunk.cut.sources[chunk.index], Size: chunk.cut.chunks[chunk.index].Size}
+	}
+	return writer.WriteMovieFile(output, file, ftyp, moov, mediaChunks, true, func(dataOffset uint64) {
+		applyCuts(cuts, chunks, dataOffset)
+		mvhd.Duration = 0
+		for _, c := range cuts {
+			mvhd.Duration = max(mvhd.Duration, c.trackDuration())
+		}
+		mvhdLeaf.SetData(mvhd)
+	})
+}
+
+// placeChunks returns the chunks of all cut tracks in the order of the input, which keeps the
+// interleaving of the tracks, placed one after the other
+func placeChunks(cuts []*cut) []placedChunk {
+	var chunks []placedChunk
+	for _, c := range cuts {
+		for i := range c.chunks {
+			chunks = append(chunks, placedChunk{cut: c, index: i})
+		}
+	}
+	sort.SliceStable(chunks, func(i, j int) bool {
+		return chunks[i].cut.sources[chunks[i].index] < chunks[j].cut.sources[chunks[j].index]
+	})
+	var size uint64
+	for i := range chunks {
+		chunks[i].offset = size
+		size += chunks[i].cut.chunks[chunks[i].index].Size
+	}
+	return chunks
+}
+
+// applyCuts rewrites the atoms of every cut track with the chunks placed after the given offset
+func applyCuts(cuts []*cut, chunks []placedChunk, dataOffset uint64) {
+	offsets := make(map[*cut][]uint64)
+	for _, c := range cuts {
+		offsets[c] = make([]uint64, len(c.chunks))
+	}
+	for _, chunk := range chunks {
+		offsets[chunk.cut][chunk.index] = dataOffset + chunk.offset
+	}
+	for _, c := range cuts {
+		c.apply(offsets[c])
+	}
+}
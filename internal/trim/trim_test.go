@@ -0,0 +1,89 @@
+package trim
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/KrzysztofHeinke/quicktime-movie-parser/internal/atomtest"
+	"github.com/KrzysztofHeinke/quicktime-movie-parser/internal/parser"
+	"github.com/KrzysztofHeinke/quicktime-movie-parser/pkg/models/atoms"
+	"github.com/stretchr/testify/assert"
+)
+
+// writeTestMovie writes a movie with an interleaved video and audio track of six samples each. Video
+// samples 0 and 3 are sync samples, every sample holds its track letter and index.
+func writeTestMovie(t *testing.T, path string) {
+	ftyp := atomtest.FileType("isom", "mp41")
+	offset := atomtest.MediaOffset(ftyp)
+	video := atomtest.Trak(atomtest.Track{
+		ID: 1, HandlerType: "vide", Duration: 600, Entry: atomtest.SampleEntry("avc1", 70),
+		Tables: append(atomtest.SampleTables(6, 100, 4, 3, offset, offset+24), atomtest.Build("stss", atomtest.Uint32s(0, 2, 1, 4))),
+	})
+	audio := atomtest.Trak(atomtest.Track{
+		ID: 2, HandlerType: "soun", Duration: 600, Entry: atomtest.SampleEntry("mp4a", 20),
+		Tables: atomtest.SampleTables(6, 100, 4, 3, offset+12, offset+36),
+	})
+	data := atomtest.Movie(ftyp, atomtest.Interleave(6, 3, "V", "A"), atomtest.MovieHeader(600, 0), video, audio)
+	assert.NoError(t, os.WriteFile(path, data, 0o644))
+}
+
+// TestTrim tests that the tracks start at the previous sync sample and the edit list skips to the start
+func TestTrim(t *testing.T) {
+	dir := t.TempDir()
+	input := filepath.Join(dir, "input.mov")
+	output := filepath.Join(dir, "output.mov")
+	writeTestMovie(t, input)
+
+	assert.NoError(t, Trim(input, output, 0.35, 0.5))
+
+	tree, err := parser.ReadTree(output)
+	assert.NoError(t, err)
+	file, err := os.Open(output)
+	assert.NoError(t, err)
+	defer file.Close()
+	info, err := file.Stat()
+	assert.NoError(t, err)
+	tracks, err := parser.ReadTracks(tree, file, info.Size())
+	assert.NoError(t, err)
+	assert.Len(t, tracks, 2)
+
+	for i, letter := range []string{"V", "A"} {
+		track := tracks[i]
+		assert.Len(t, track.Samples, 2)
+		assert.Equal(t, uint64(200), track.Duration)
+		for j := range track.Samples {
+			data, err := track.ReadSample(file, j)
+			assert.NoError(t, err)
+			assert.Equal(t, fmt.Sprintf("%s%d..", letter, j+3), string(data))
+		}
+		elst, ok := track.Atom.LeafData("edts", "elst").(*atoms.ElstAtom)
+		assert.True(t, ok)
+		assert.Equal(t, []atoms.EditListEntry{{SegmentDuration: 150, MediaTime: 50, MediaRateInteger: 1}}, elst.Entries)
+		assert.Equal(t, uint64(150), track.Atom.LeafData("tkhd").(*atoms.TkhdAtom).Duration)
+	}
+	assert.True(t, tracks[0].Samples[0].Sync)
+	assert.False(t, tracks[0].Samples[1].Sync)
+
+	moov := tree.(*atoms.CompositeAtom).GetChild("moov").(*atoms.CompositeAtom)
+	assert.Equal(t, uint64(150), moov.LeafData("mvhd").(*atoms.MvhdAtom).Duration)
+	topLevelAtoms, err := parser.ReadTopLevelAtoms(file, info.Size())
+	assert.NoError(t, err)
+	var types []string
+	for _, atom := range topLevelAtoms {
+		types = append(types, atom.Type)
+	}
+	assert.Equal(t, []string{"ftyp", "moov", "mdat"}, types)
+}
+
+// TestTrimInvalidRange tests that ranges outside the movie are refused
+func TestTrimInvalidRange(t *testing.T) {
+	dir := t.TempDir()
+	input := filepath.Join(dir, "input.mov")
+	writeTestMovie(t, input)
+
+	assert.Error(t, Trim(input, filepath.Join(dir, "output.mov"), 0.5, 0.2))
+	assert.Error(t, Trim(input, filepath.Join(dir, "output.mov"), 1, 0))
+	assert.Error(t, Trim(input, input, 0, 0))
+}
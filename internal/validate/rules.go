@@ -0,0 +1,449 @@
+package validate
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"math"
+	"strings"
+
+	"github.com/KrzysztofHeinke/quicktime-movie-parser/pkg/models/atoms"
+)
+
+// requiredChildren lists the children a composite atom must have, alternatives of one child grouped together
+var requiredChildren = map[string][][]string{
+	"moov": {{"mvhd"}},
+	"trak": {{"tkhd"}, {"mdia"}},
+	"mdia": {{"mdhd"}, {"hdlr"}, {"minf"}},
+	"minf": {{"stbl"}},
+	"stbl": {{"stsd"}, {"stts"}, {"stsc"}, {"stsz", "stz2"}, {"stco", "co64"}},
+}
+
+// tableLayout is the size of the fields in front of the entries of a sample table atom and of an entry
+type tableLayout struct {
+	header int64
+	entry  int64
+}
+
+// tableLayouts maps the sample table atoms checked for their entry count to their layout
+var tableLayouts = map[string]tableLayout{
+	"stts": {8, 8},
+	"ctts": {8, 8},
+	"stsc": {8, 12},
+	"stss": {8, 4},
+	"stsz": {12, 4},
+	"stco": {8, 4},
+	"co64": {8, 8},
+}
+
+// checkChildSizes checks that every atom fits its parent and that the children fill their parent
+func checkChildSizes(f *file) []Violation {
+	var violations []Violation
+	f.root.walk(func(n *node) {
+		if !n.composite {
+			return
+		}
+		for _, child := range n.children {
+			switch {
+			case child.declared < child.headerSize:
+				violations = append(violations, violation("child-sizes", child, Error,
+					"invalid size %d, smaller than the %d byte header, the rest of the parent cannot be read", child.declared, child.headerSize))
+			case child.declared > child.size:
+				violations = append(violations, violation("child-sizes", child, Error,
+					"size %d reaches %d bytes past the end of its parent", child.declared, child.declared-child.size))
+			}
+		}
+		if len(n.trailing) == 0 || n.atomType == "udta" && bytes.Equal(n.trailing, []byte{0, 0, 0, 0}) {
+			// QuickTime 'udta' atoms may end with a 32-bit zero terminator
+			return
+		}
+		v := violation("child-sizes", n, Warning, "%d bytes after the last child do not form an atom", len(n.trailing))
+		v.Offset = n.offset + n.size - int64(len(n.trailing))
+		violations = append(violations, v)
+	})
+	return violations
+}
+
+// checkRequiredAtoms checks that the file has a movie and that its atoms have their mandatory children.
+// Composite atoms whose children were not read for exceeding a limit are left to checkPayloads.
+func checkRequiredAtoms(f *file) []Violation {
+	if f.root.child("moov") == nil {
+		return []Violation{violation("required-atoms", f.root, Error, "the file has no moov atom")}
+	}
+	var violations []Violation
+	f.root.walk(func(n *node) {
+		if !n.composite || n.decodeErr != nil {
+			return
+		}
+		for _, alternatives := range requiredChildren[n.atomType] {
+			found := false
+			for _, atomType := range alternatives {
+				found = found || n.child(atomType) != nil
+			}
+			if !found {
+				violations = append(violations, violation("required-atoms", n, Error,
+					"required %s atom is missing", strings.Join(alternatives, " or ")))
+			}
+		}
+	})
+	return violations
+}
+
+// checkPayloads checks that the payloads of the known leaf atoms can be decoded and that the atoms are
+// within the limits. The sample tables which were read are left to checkEntryCounts.
+func checkPayloads(f *file) []Violation {
+	var violations []Violation
+	f.root.walk(func(n *node) {
+		if _, ok := tableLayouts[n.atomType]; n.decodeErr != nil && (!ok || n.payload == nil) {
+			violations = append(violations, violation("payloads", n, Error, "payload cannot be decoded: %v", n.decodeErr))
+		}
+	})
+	return violations
+}
+
+// checkEntryCounts checks that the entry counts of the sample tables match their lengths and that the
+// tables of a track describe the same number of samples
+func checkEntryCounts(f *file) []Violation {
+	var violations []Violation
+	f.root.walk(func(n *node) {
+		layout, ok := tableLayouts[n.atomType]
+		if ok && !n.composite && n.payload != nil {
+			violations = append(violations, checkTableLength(n, layout)...)
+		}
+		if n.atomType == "stbl" && n.composite {
+			violations = append(violations, checkSampleCounts(n)...)
+		}
+	})
+	return violations
+}
+
+// checkTableLength checks that the payload of the sample table holds exactly its entries
+func checkTableLength(n *node, layout tableLayout) []Violation {
+	length := int64(len(n.payload))
+	if length < layout.header {
+		return []Violation{violation("entry-counts", n, Error, "payload of %d bytes is too short for the table header", length)}
+	}
+	count := int64(binary.BigEndian.Uint32(n.payload[layout.header-4 : layout.header]))
+	if n.atomType == "stsz" && binary.BigEndian.Uint32(n.payload[4:8]) != 0 {
+		// All samples have the size given in the header, there are no entries
+		count = 0
+	}
+	expected := layout.header + count*layout.entry
+	switch {
+	case length < expected:
+		return []Violation{violation("entry-counts", n, Error,
+			"entry count %d needs %d bytes, but the table holds %d", count, expected-layout.header, length-layout.header)}
+	case length > expected:
+		return []Violation{violation("entry-counts", n, Warning, "%d bytes follow the %d entries", length-expected, count)}
+	}
+	return nil
+}
+
+// checkSampleCounts checks that the tables of the sample table atom agree on the number of samples
+func checkSampleCounts(stbl *node) []Violation {
+	stszNode := stbl.child("stsz")
+	if stszNode == nil {
+		return nil
+	}
+	stsz, ok := stszNode.data.(*atoms.StszAtom)
+	if !ok {
+		return nil
+	}
+	var violations []Violation
+	if n := stbl.child("stts"); n != nil {
+		if stts, ok := n.data.(*atoms.SttsAtom); ok {
+			var count uint64
+			for _, entry := range stts.Entries {
+				count += uint64(entry.SampleCount)
+			}
+			if count != uint64(stsz.SampleCount) {
+				violations = append(violations, violation("entry-counts", n, Error, "describes %d samples, stsz %d", count, stsz.SampleCount))
+			}
+		}
+	}
+	if n := stbl.child("ctts"); n != nil {
+		if ctts, ok := n.data.(*atoms.CttsAtom); ok {
+			var count uint64
+			for _, entry := range ctts.Entries {
+				count += uint64(entry.SampleCount)
+			}
+			if count != uint64(stsz.SampleCount) {
+				violations = append(violations, violation("entry-counts", n, Error, "describes %d samples, stsz %d", count, stsz.SampleCount))
+			}
+		}
+	}
+	if n := stbl.child("stss"); n != nil {
+		if stss, ok := n.data.(*atoms.StssAtom); ok {
+			for _, number := range stss.SampleNumbers {
+				if number == 0 || number > stsz.SampleCount {
+					violations = append(violations, violation("entry-counts", n, Error, "sync sample %d is outside the %d samples", number, stsz.SampleCount))
+					break
+				}
+			}
+		}
+	}
+	stscNode, chunkOffsets := stbl.child("stsc"), chunkOffsetTable(stbl)
+	if stscNode == nil || chunkOffsets == nil {
+		return violations
+	}
+	stsc, ok := stscNode.data.(*atoms.StscAtom)
+	if !ok {
+		return violations
+	}
+	counts, problem := chunkSampleCounts(stsc, len(chunkOffsets.Offsets))
+	if problem != "" {
+		return append(violations, violation("entry-counts", stscNode, Error, "%s", problem))
+	}
+	var count uint64
+	for _, c := range counts {
+		count += uint64(c)
+	}
+	if count != uint64(stsz.SampleCount) {
+		violations = append(violations, violation("entry-counts", stscNode, Error,
+			"maps %d samples to the %d chunks, stsz describes %d", count, len(counts), stsz.SampleCount))
+	}
+	return violations
+}
+
+// chunkOffsetTable returns the decoded 'stco' or 'co64' atom of the sample table atom or nil
+func chunkOffsetTable(stbl *node) *atoms.ChunkOffsetAtom {
+	for _, atomType := range []string{"stco", "co64"} {
+		if n := stbl.child(atomType); n != nil {
+			if table, ok := n.data.(*atoms.ChunkOffsetAtom); ok {
+				return table
+			}
+		}
+	}
+	return nil
+}
+
+// chunkSampleCounts returns the number of samples of every chunk, or a description of why the
+// sample-to-chunk table cannot be applied
+func chunkSampleCounts(stsc *atoms.StscAtom, chunkCount int) ([]uint32, string) {
+	counts := make([]uint32, chunkCount)
+	for i, entry := range stsc.Entries {
+		switch {
+		case i == 0 && entry.FirstChunk != 1:
+			return nil, "the first entry does not start at chunk 1"
+		case i > 0 && entry.FirstChunk <= stsc.Entries[i-1].FirstChunk:
+			return nil, "the first chunks of the entries do not increase"
+		case int64(entry.FirstChunk) > int64(chunkCount):
+			return nil, "an entry starts after the last chunk"
+		}
+		last := uint32(chunkCount)
+		if i+1 < len(stsc.Entries) {
+			last = min(last, stsc.Entries[i+1].FirstChunk-1)
+		}
+		for chunk := entry.FirstChunk; chunk <= last; chunk++ {
+			counts[chunk-1] = entry.SamplesPerChunk
+		}
+	}
+	if len(stsc.Entries) == 0 && chunkCount > 0 {
+		return nil, "no entry maps samples to the chunks"
+	}
+	return counts, ""
+}
+
+// checkChunkOffsets checks that every chunk starts inside the payload of an 'mdat' atom
+func checkChunkOffsets(f *file) []Violation {
+	var violations []Violation
+	f.root.walk(func(n *node) {
+		table, ok := n.data.(*atoms.ChunkOffsetAtom)
+		if !ok {
+			return
+		}
+		first, outside := -1, 0
+		for i, offset := range table.Offsets {
+			if !f.inMediaData(offset) {
+				if first < 0 {
+					first = i
+				}
+				outside++
+			}
+		}
+		if outside > 0 {
+			violations = append(violations, violation("chunk-offsets", n, Error,
+				"%d of %d chunks lie outside the media data, the first is chunk %d at offset %d",
+				outside, len(table.Offsets), first+1, table.Offsets[first]))
+		}
+	})
+	return violations
+}
+
+// inMediaData tells whether the offset lies inside the payload of an 'mdat' atom
+func (f *file) inMediaData(offset uint64) bool {
+	return f.mediaDataEnd(offset) >= 0
+}
+
+// mediaDataEnd returns the end of the payload of the 'mdat' atom the offset lies in, or -1
+func (f *file) mediaDataEnd(offset uint64) int64 {
+	for _, r := range f.mediaData {
+		if offset >= uint64(r[0]) && offset < uint64(r[1]) {
+			return r[1]
+		}
+	}
+	return -1
+}
+
+// checkSampleBounds checks that the samples of every chunk end inside the file and inside the 'mdat'
+// atom the chunk starts in
+func checkSampleBounds(f *file) []Violation {
+	var violations []Violation
+	f.root.walk(func(stbl *node) {
+		if stbl.atomType != "stbl" || !stbl.composite {
+			return
+		}
+		stszNode, stscNode, table := stbl.child("stsz"), stbl.child("stsc"), chunkOffsetTable(stbl)
+		if stszNode == nil || stscNode == nil || table == nil {
+			return
+		}
+		stsz, ok := stszNode.data.(*atoms.StszAtom)
+		stsc, ok2 := stscNode.data.(*atoms.StscAtom)
+		if !ok || !ok2 {
+			return
+		}
+		counts, problem := chunkSampleCounts(stsc, len(table.Offsets))
+		if problem != "" {
+			return
+		}
+		sample, first, outside := 0, "", 0
+		for i, offset := range table.Offsets {
+			end := offset
+			for j := uint32(0); j < counts[i] && sample < int(stsz.SampleCount); j++ {
+				end += uint64(stsz.GetSampleSize(sample))
+				sample++
+			}
+			mediaDataEnd := f.mediaDataEnd(offset)
+			var reason string
+			switch {
+			case end > uint64(f.size):
+				reason = "past the end of the file"
+			case mediaDataEnd >= 0 && end > uint64(mediaDataEnd):
+				reason = "past the end of its mdat atom"
+			default:
+				continue
+			}
+			if outside == 0 {
+				first = fmt.Sprintf("the first is chunk %d ending at offset %d, %s", i+1, end, reason)
+			}
+			outside++
+		}
+		if outside > 0 {
+			violations = append(violations, violation("sample-bounds", stszNode, Error,
+				"the samples of %d of %d chunks end outside their media data, %s", outside, len(table.Offsets), first))
+		}
+	})
+	return violations
+}
+
+// checkTrackIDs checks that the track IDs of every movie are unique and below its next track ID
+func checkTrackIDs(f *file) []Violation {
+	var violations []Violation
+	for _, moov := range f.root.all("moov") {
+		used := make(map[uint32]*node)
+		var largest uint32
+		for _, trak := range moov.all("trak") {
+			n := trak.child("tkhd")
+			if n == nil {
+				continue
+			}
+			tkhd, ok := n.data.(*atoms.TkhdAtom)
+			if !ok {
+				continue
+			}
+			switch other := used[tkhd.TrackID]; {
+			case tkhd.TrackID == 0:
+				violations = append(violations, violation("track-ids", n, Error, "track ID 0 is invalid"))
+			case other != nil:
+				violations = append(violations, violation("track-ids", n, Error, "track ID %d is already used by %s", tkhd.TrackID, other.path))
+			default:
+				used[tkhd.TrackID] = n
+			}
+			largest = max(largest, tkhd.TrackID)
+		}
+		if n := moov.child("mvhd"); n != nil {
+			if mvhd, ok := n.data.(*atoms.MvhdAtom); ok && mvhd.NextTrackID <= largest {
+				violations = append(violations, violation("track-ids", n, Warning,
+					"next track ID %d is not above the largest track ID %d", mvhd.NextTrackID, largest))
+			}
+		}
+	}
+	return violations
+}
+
+// checkDurations checks that the durations of 'mvhd', 'tkhd' and 'mdhd' agree with each other, with
+// the edit lists and with the sample tables. Fragmented movies, whose durations grow with every
+// fragment, are skipped.
+func checkDurations(f *file) []Violation {
+	var violations []Violation
+	for _, moov := range f.root.all("moov") {
+		mvhdNode := moov.child("mvhd")
+		if mvhdNode == nil || moov.child("mvex") != nil {
+			continue
+		}
+		mvhd, ok := mvhdNode.data.(*atoms.MvhdAtom)
+		if !ok {
+			continue
+		}
+		if mvhd.TimeScale == 0 {
+			violations = append(violations, violation("durations", mvhdNode, Error, "time scale is 0"))
+			continue
+		}
+		var longest uint64
+		for _, trak := range moov.all("trak") {
+			tkhdNode, mdhdNode := trak.child("tkhd"), trak.find("mdia", "mdhd")
+			if tkhdNode == nil || mdhdNode == nil {
+				continue
+			}
+			tkhd, ok := tkhdNode.data.(*atoms.TkhdAtom)
+			mdhd, ok2 := mdhdNode.data.(*atoms.MdhdAtom)
+			if !ok || !ok2 {
+				continue
+			}
+			longest = max(longest, tkhd.Duration)
+			if mdhd.TimeScale == 0 {
+				violations = append(violations, violation("durations", mdhdNode, Error, "time scale is 0"))
+				continue
+			}
+			if n := trak.find("mdia", "minf", "stbl", "stts"); n != nil {
+				if stts, ok := n.data.(*atoms.SttsAtom); ok {
+					var total uint64
+					for _, entry := range stts.Entries {
+						total += uint64(entry.SampleCount) * uint64(entry.SampleDuration)
+					}
+					if total != mdhd.Duration {
+						violations = append(violations, violation("durations", mdhdNode, Warning,
+							"duration %d differs from the %d of the samples in stts", mdhd.Duration, total))
+					}
+				}
+			}
+			if n := trak.find("edts", "elst"); n != nil {
+				if elst, ok := n.data.(*atoms.ElstAtom); ok {
+					var total uint64
+					for _, entry := range elst.Entries {
+						total += entry.SegmentDuration
+					}
+					if total != tkhd.Duration {
+						violations = append(violations, violation("durations", tkhdNode, Warning,
+							"duration %d differs from the %d of the edit list", tkhd.Duration, total))
+					}
+				}
+				continue
+			}
+			expected := uint64(math.Round(float64(mdhd.Duration) * float64(mvhd.TimeScale) / float64(mdhd.TimeScale)))
+			if max(expected, tkhd.Duration)-min(expected, tkhd.Duration) > 1 {
+				violations = append(violations, violation("durations", tkhdNode, Warning,
+					"duration %d differs from the media duration of %d in the movie time scale", tkhd.Duration, expected))
+			}
+		}
+		switch {
+		case mvhd.Duration < longest:
+			violations = append(violations, violation("durations", mvhdNode, Error,
+				"duration %d is shorter than the longest track of %d", mvhd.Duration, longest))
+		case mvhd.Duration > longest:
+			violations = append(violations, violation("durations", mvhdNode, Warning,
+				"duration %d is longer than the longest track of %d", mvhd.Duration, longest))
+		}
+	}
+	return violations
+}
@@ -0,0 +1,196 @@
+package validate
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+
+	"github.com/KrzysztofHeinke/quicktime-movie-parser/internal/factory"
+	"github.com/KrzysztofHeinke/quicktime-movie-parser/internal/parser"
+	"github.com/KrzysztofHeinke/quicktime-movie-parser/pkg/models/atoms"
+)
+
+// node is an atom of the file together with where it was found. Unlike the trees of the parser the
+// walk never fails on a broken size, it records it and clips the atom to its parent instead.
+type node struct {
+	atomType string
+	path     string
+	offset   int64
+	// size is the size of the atom clipped to its parent
+	size int64
+	// declared is the size stored in the header, with a size of 0 resolved to the end of the parent
+	declared   int64
+	headerSize int64
+	composite  bool
+	children   []*node
+	// trailing holds the bytes after the last child which are too few to form an atom
+	trailing []byte
+	// payload holds the payload of a leaf atom inside a composite top level atom
+	payload []byte
+	// data is the payload decoded by the atom factory, decodeErr the reason it could not be
+	data      any
+	decodeErr error
+}
+
+// child returns the first child of the given type or nil
+func (n *node) child(atomType string) *node {
+	for _, child := range n.children {
+		if child.atomType == atomType {
+			return child
+		}
+	}
+	return nil
+}
+
+// find returns the first descendant following the path of atom types or nil
+func (n *node) find(path ...string) *node {
+	current := n
+	for _, atomType := range path {
+		if current = current.child(atomType); current == nil {
+			return nil
+		}
+	}
+	return current
+}
+
+// all returns the children of the given type
+func (n *node) all(atomType string) []*node {
+	var result []*node
+	for _, child := range n.children {
+		if child.atomType == atomType {
+			result = append(result, child)
+		}
+	}
+	return result
+}
+
+// walk calls the function for the node and all its descendants in file order
+func (n *node) walk(visit func(*node)) {
+	visit(n)
+	for _, child := range n.children {
+		child.walk(visit)
+	}
+}
+
+// readTree reads the atoms of the file into a root node covering the whole file
+func readTree(r io.ReaderAt, fileSize int64) (*node, error) {
+	root := &node{size: fileSize, declared: fileSize, composite: true}
+	var err error
+	root.children, root.trailing, err = readNodes(r, 0, fileSize, "", 1)
+	if err != nil {
+		return nil, err
+	}
+	setPaths(root)
+	return root, nil
+}
+
+// readNodes reads the atoms between start and end, the payload of an atom of the parent type. The atoms
+// read are at the given nesting depth, 1 for the top level.
+func readNodes(r io.ReaderAt, start, end int64, parentType string, depth int) ([]*node, []byte, error) {
+	var nodes []*node
+	header := make([]byte, 16)
+	offset := start
+	for end-offset >= 8 {
+		if _, err := r.ReadAt(header[:8], offset); err != nil {
+			return nil, nil, fmt.Errorf("error reading atom header at offset %d: %w", offset, err)
+		}
+		n := &node{
+			atomType:   string(header[4:8]),
+			offset:     offset,
+			declared:   int64(binary.BigEndian.Uint32(header[0:4])),
+			headerSize: 8,
+		}
+		switch n.declared {
+		case 0:
+			n.declared = end - offset
+		case 1:
+			if end-offset < 16 {
+				break
+			}
+			if _, err := r.ReadAt(header[8:16], offset+8); err != nil {
+				return nil, nil, fmt.Errorf("error reading extended size at offset %d: %w", offset, err)
+			}
+			n.declared, n.headerSize = int64(binary.BigEndian.Uint64(header[8:16])), 16
+		}
+		nodes = append(nodes, n)
+		if n.declared < n.headerSize || n.declared < 0 {
+			// Nothing after an atom of invalid size can be located
+			n.size = end - offset
+			return nodes, nil, nil
+		}
+		n.size = min(n.declared, end-offset)
+		if err := readContent(r, n, parentType, depth); err != nil {
+			return nil, nil, err
+		}
+		offset += n.size
+	}
+	var trailing []byte
+	if offset < end {
+		trailing = make([]byte, end-offset)
+		if _, err := r.ReadAt(trailing, offset); err != nil {
+			return nil, nil, fmt.Errorf("error reading trailing bytes at offset %d: %w", offset, err)
+		}
+	}
+	return nodes, trailing, nil
+}
+
+// readContent reads the children of a composite atom or the payload of a leaf atom. Leaf atoms at the
+// top level, like 'mdat', are not read. Composite atoms nested deeper and payloads larger than the limits
+// in effect are not read either, the exceeded limit is recorded as the reason they are not decoded.
+func readContent(r io.ReaderAt, n *node, parentType string, depth int) error {
+	limits := atoms.CurrentLimits()
+	start, end := n.offset+n.headerSize, n.offset+n.size
+	if parser.IsCompositeAtom(n.atomType) || parentType == "ilst" {
+		n.composite = true
+		if depth >= limits.MaxDepth {
+			n.decodeErr = &atoms.LimitError{What: "atom nesting depth", Value: uint64(depth + 1), Limit: uint64(max(limits.MaxDepth, 0))}
+			return nil
+		}
+		prefix := make([]byte, min(8, end-start))
+		if _, err := r.ReadAt(prefix, start); err != nil {
+			return fmt.Errorf("error reading %s atom at offset %d: %w", n.atomType, n.offset, err)
+		}
+		var err error
+		n.children, n.trailing, err = readNodes(r, start+int64(parser.ChildrenOffset(n.atomType, prefix)), end, n.atomType, depth+1)
+		return err
+	}
+	if parentType == "" {
+		return nil
+	}
+	if n.decodeErr = atoms.CheckSize(n.atomType+" atom size", uint64(n.size), limits.MaxAtomSize); n.decodeErr != nil {
+		return nil
+	}
+	n.payload = make([]byte, end-start)
+	if _, err := r.ReadAt(n.payload, start); err != nil {
+		return fmt.Errorf("error reading %s atom at offset %d: %w", n.atomType, n.offset, err)
+	}
+	var header atoms.AtomHeader
+	copy(header.Type[:], n.atomType)
+	header.Size = uint32(min(n.size, 0xFFFFFFFF))
+	if n.data, n.decodeErr = factory.AtomFactory(header, parentType, bytes.NewReader(n.payload)); n.decodeErr != nil {
+		// The decoders return typed nil pointers together with their errors
+		n.data = nil
+	}
+	return nil
+}
+
+// setPaths gives every descendant of the node its path, numbering atoms which have siblings of the same type
+func setPaths(n *node) {
+	counts := make(map[string]int)
+	for _, child := range n.children {
+		counts[child.atomType]++
+	}
+	seen := make(map[string]int)
+	for _, child := range n.children {
+		seen[child.atomType]++
+		child.path = child.atomType
+		if counts[child.atomType] > 1 {
+			child.path = fmt.Sprintf("%s[%d]", child.atomType, seen[child.atomType])
+		}
+		if n.path != "" {
+			child.path = n.path + "/" + child.path
+		}
+		setPaths(child)
+	}
+}
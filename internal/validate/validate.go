@@ -0,0 +1,130 @@
+package validate
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"sort"
+)
+
+// Severity tells how serious a violation is
+type Severity int
+
+const (
+	// Warning marks a deviation from the specifications which players usually tolerate
+	Warning Severity = iota
+	// Error marks a violation which makes the file unplayable or its structure unreadable
+	Error
+)
+
+// String returns the name of the severity
+func (s Severity) String() string {
+	if s == Error {
+		return "error"
+	}
+	return "warning"
+}
+
+// Violation is a rule broken by an atom of the file
+type Violation struct {
+	// Rule is the name of the broken rule
+	Rule string
+	// Path is the path of the atom, e.g. 'moov/trak[2]/mdia/minf/stbl/stco'
+	Path string
+	// Offset is the byte offset of the atom in the file
+	Offset   int64
+	Severity Severity
+	Message  string
+}
+
+// String formats the violation for a report
+func (v Violation) String() string {
+	path := v.Path
+	if path == "" {
+		path = "file"
+	}
+	return fmt.Sprintf("%s: %s at offset %d: %s [%s]", v.Severity, path, v.Offset, v.Message, v.Rule)
+}
+
+// rule is a conformance check run against the atoms of a file
+type rule struct {
+	name  string
+	check func(f *file) []Violation
+}
+
+// rules lists the checks run by Validate in order
+var rules = []rule{
+	{"child-sizes", checkChildSizes},
+	{"required-atoms", checkRequiredAtoms},
+	{"payloads", checkPayloads},
+	{"entry-counts", checkEntryCounts},
+	{"chunk-offsets", checkChunkOffsets},
+	{"sample-bounds", checkSampleBounds},
+	{"track-ids", checkTrackIDs},
+	{"durations", checkDurations},
+}
+
+// RuleNames returns the names of the rules checked by Validate
+func RuleNames() []string {
+	names := make([]string, len(rules))
+	for i, r := range rules {
+		names[i] = r.name
+	}
+	return names
+}
+
+// file is the walked atom tree of a file together with the ranges of its media data
+type file struct {
+	root *node
+	size int64
+	// mediaData holds the payload ranges of the top level 'mdat' atoms
+	mediaData [][2]int64
+}
+
+// Validate checks the file against the ISO BMFF and QuickTime structure rules and returns the violations
+// found, ordered by offset. An error is only returned when the file cannot be read.
+func Validate(path string) ([]Violation, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+	return ValidateReader(f, info.Size())
+}
+
+// ValidateReader checks the data of the reader against the rules like Validate
+func ValidateReader(r io.ReaderAt, size int64) ([]Violation, error) {
+	root, err := readTree(r, size)
+	if err != nil {
+		return nil, err
+	}
+	f := &file{root: root, size: size}
+	for _, n := range root.all("mdat") {
+		f.mediaData = append(f.mediaData, [2]int64{n.offset + n.headerSize, n.offset + n.size})
+	}
+	var violations []Violation
+	for _, r := range rules {
+		violations = append(violations, r.check(f)...)
+	}
+	sort.SliceStable(violations, func(i, j int) bool { return violations[i].Offset < violations[j].Offset })
+	return violations, nil
+}
+
+// HasErrors tells whether any of the violations is an error
+func HasErrors(violations []Violation) bool {
+	for _, v := range violations {
+		if v.Severity == Error {
+			return true
+		}
+	}
+	return false
+}
+
+// violation returns a violation of the rule by the atom
+func violation(ruleName string, n *node, severity Severity, format string, args ...any) Violation {
+	return Violation{Rule: ruleName, Path: n.path, Offset: n.offset, Severity: severity, Message: fmt.Sprintf(format, args...)}
+}
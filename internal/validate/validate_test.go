@@ -0,0 +1,154 @@
+package validate
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"testing"
+
+	"github.com/KrzysztofHeinke/quicktime-movie-parser/internal/atomtest"
+	"github.com/KrzysztofHeinke/quicktime-movie-parser/pkg/models/atoms"
+	"github.com/stretchr/testify/assert"
+)
+
+// testMovie describes the fields of the test movie the tests break
+type testMovie struct {
+	movieDuration uint32
+	trackIDs      []uint32
+	stco          []byte
+	stsz          []byte
+}
+
+// defaultMovie returns a valid movie with two tracks of four one second samples of 4 bytes
+func defaultMovie() testMovie {
+	return testMovie{
+		movieDuration: 4000,
+		trackIDs:      []uint32{1, 2},
+		stsz:          atomtest.Build("stsz", atomtest.Uint32s(0, 4, 4)),
+	}
+}
+
+// build returns the file: an 'ftyp', an 'mdat' holding the samples of both tracks and a 'moov' atom
+func (m testMovie) build() []byte {
+	ftyp := atomtest.FileType("isom", "mp41")
+	var traks [][]byte
+	for i, id := range m.trackIDs {
+		stco := m.stco
+		if stco == nil || i > 0 {
+			stco = atomtest.Build("stco", atomtest.Uint32s(0, 1, atomtest.MediaOffset(ftyp)+16*uint32(i)))
+		}
+		traks = append(traks, atomtest.Trak(atomtest.Track{
+			ID: id, HandlerType: "soun", Duration: 4000, Entry: atomtest.SampleEntry("mp4a", 20),
+			Tables: [][]byte{
+				atomtest.Build("stts", atomtest.Uint32s(0, 1, 4, 1000)),
+				atomtest.Build("stsc", atomtest.Uint32s(0, 1, 1, 4, 1)),
+				m.stsz,
+				stco,
+			},
+		}))
+	}
+	return atomtest.Movie(ftyp, make([]byte, 32), atomtest.MovieHeader(m.movieDuration, 3), traks...)
+}
+
+// validate validates the data and returns the rules broken with their severity
+func validate(t *testing.T, data []byte) map[string]Severity {
+	violations, err := ValidateReader(bytes.NewReader(data), int64(len(data)))
+	assert.NoError(t, err)
+	broken := make(map[string]Severity)
+	for _, v := range violations {
+		broken[v.Rule] = max(broken[v.Rule], v.Severity)
+	}
+	return broken
+}
+
+// TestValidateValidFile tests that a well-formed file has no violations
+func TestValidateValidFile(t *testing.T) {
+	assert.Empty(t, validate(t, defaultMovie().build()))
+}
+
+// TestValidateRules tests that every rule reports the defect it checks for
+func TestValidateRules(t *testing.T) {
+	tests := []struct {
+		name     string
+		modify   func(m *testMovie)
+		rule     string
+		severity Severity
+	}{
+		{"duplicate track ID", func(m *testMovie) { m.trackIDs = []uint32{1, 1} }, "track-ids", Error},
+		{"movie shorter than track", func(m *testMovie) { m.movieDuration = 3000 }, "durations", Error},
+		{"movie longer than track", func(m *testMovie) { m.movieDuration = 5000 }, "durations", Warning},
+		{"chunk outside mdat", func(m *testMovie) { m.stco = atomtest.Build("stco", atomtest.Uint32s(0, 1, 4)) }, "chunk-offsets", Error},
+		{"samples past mdat", func(m *testMovie) { m.stsz = atomtest.Build("stsz", atomtest.Uint32s(0, 40, 4)) }, "sample-bounds", Error},
+		{"entry count past table", func(m *testMovie) { m.stsz = atomtest.Build("stsz", atomtest.Uint32s(0, 0, 5, 4, 4, 4, 4)) }, "entry-counts", Error},
+		{"sample count mismatch", func(m *testMovie) { m.stsz = atomtest.Build("stsz", atomtest.Uint32s(0, 4, 3)) }, "entry-counts", Error},
+		{"missing chunk offsets", func(m *testMovie) { m.stco = atomtest.Build("free") }, "required-atoms", Error},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := defaultMovie()
+			tt.modify(&m)
+			broken := validate(t, m.build())
+			assert.Contains(t, broken, tt.rule)
+			assert.Equal(t, tt.severity, broken[tt.rule])
+		})
+	}
+}
+
+// TestValidateChildSizes tests that atoms reaching past their parent and leftover bytes are reported
+// with their path and offset
+func TestValidateChildSizes(t *testing.T) {
+	data := defaultMovie().build()
+	trakOffset := int64(bytes.LastIndex(data, []byte("trak")) - 4)
+	// Grow the last track by 8 bytes, so that it reaches past the end of the movie
+	binary.BigEndian.PutUint32(data[trakOffset:], binary.BigEndian.Uint32(data[trakOffset:])+8)
+	data = append(data, 0, 0, 0)
+
+	violations, err := ValidateReader(bytes.NewReader(data), int64(len(data)))
+	assert.NoError(t, err)
+	assert.True(t, HasErrors(violations))
+	assert.Contains(t, violations, Violation{
+		Rule: "child-sizes", Path: "moov/trak[2]", Offset: trakOffset, Severity: Error,
+		Message: fmt.Sprintf("size %d reaches 8 bytes past the end of its parent", int64(len(data))-3-trakOffset+8),
+	})
+	assert.Contains(t, violations, Violation{
+		Rule: "child-sizes", Offset: int64(len(data) - 3), Severity: Warning,
+		Message: "3 bytes after the last child do not form an atom",
+	})
+}
+
+// TestValidateLimits tests that atoms nested deeper or larger than the limits in effect are reported
+// instead of being read
+func TestValidateLimits(t *testing.T) {
+	t.Cleanup(func() { atoms.SetLimits(atoms.DefaultLimits) })
+	data := defaultMovie().build()
+	moovOffset := int64(bytes.LastIndex(data, []byte("moov")) - 4)
+
+	limits := atoms.DefaultLimits
+	limits.MaxDepth = 3
+	atoms.SetLimits(limits)
+	violations, err := ValidateReader(bytes.NewReader(data), int64(len(data)))
+	assert.NoError(t, err)
+	assert.Contains(t, violations, Violation{
+		Rule: "payloads", Path: "moov/trak[1]/mdia", Offset: int64(bytes.Index(data, []byte("mdia")) - 4), Severity: Error,
+		Message: "payload cannot be decoded: atom nesting depth 4 exceeds the limit of 3",
+	})
+	for _, v := range violations {
+		assert.NotEqual(t, "required-atoms", v.Rule, "Expected the children of atoms nested too deep not to be required")
+	}
+
+	limits = atoms.DefaultLimits
+	limits.MaxAtomSize = 100
+	atoms.SetLimits(limits)
+	violations, err = ValidateReader(bytes.NewReader(data), int64(len(data)))
+	assert.NoError(t, err)
+	assert.Contains(t, violations, Violation{
+		Rule: "payloads", Path: "moov/mvhd", Offset: moovOffset + 8, Severity: Error,
+		Message: "payload cannot be decoded: mvhd atom size 108 exceeds the limit of 100",
+	})
+}
+
+// TestValidateWithoutMovie tests that a file without a 'moov' atom is an error
+func TestValidateWithoutMovie(t *testing.T) {
+	data := atomtest.Build("mdat", make([]byte, 8))
+	assert.Equal(t, map[string]Severity{"required-atoms": Error}, validate(t, data))
+}
@@ -0,0 +1,166 @@
+package writer
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"github.com/KrzysztofHeinke/quicktime-movie-parser/internal/track"
+	"github.com/KrzysztofHeinke/quicktime-movie-parser/pkg/models/atoms"
+)
+
+// MediaChunk is a run of bytes of the input copied to the 'mdat' atom of a rebuilt movie
+type MediaChunk struct {
+	Source uint64
+	Size   uint64
+}
+
+// WriteMovieFile writes a movie rebuilt from the samples of the input: the 'ftyp' atom followed by the
+// 'moov' atom and one 'mdat' atom holding the chunks copied from the input one after the other. With
+// fastStart unset the 'moov' atom is written behind the 'mdat' atom instead. update is called with the
+// offset of the 'mdat' payload in the output to set the chunk offsets of the 'moov' atom, again whenever
+// the serialized 'moov' atom in front of it changed its size, e.g. when 'stco' tables became 'co64'.
+func WriteMovieFile(output string, input io.ReaderAt, ftyp []byte, moov *atoms.CompositeAtom, chunks []MediaChunk, fastStart bool, update func(dataOffset uint64)) error {
+	var payloadSize uint64
+	for _, chunk := range chunks {
+		payloadSize += chunk.Size
+	}
+	mdatHeader := AppendHeader(nil, [4]byte{'m', 'd', 'a', 't'}, payloadSize, payloadSize > math.MaxUint32-8)
+
+	var moovData []byte
+	moovSize := 0
+	for pass := 0; ; pass++ {
+		if pass == maxLayoutPasses {
+			return fmt.Errorf("the size of the moov atom did not settle")
+		}
+		update(uint64(len(ftyp) + moovSize + len(mdatHeader)))
+		var err error
+		if moovData, err = Marshal(moov); err != nil {
+			return err
+		}
+		if !fastStart || len(moovData) == moovSize {
+			break
+		}
+		moovSize = len(moovData)
+	}
+
+	return ReplaceFile(output, OutputPerm, func(destination *os.File) error {
+		return writeMovie(destination, input, chunks, ftyp, moovData, mdatHeader, fastStart)
+	})
+}
+
+// WriteTracks writes a movie whose tracks hold the samples of the input grouped into the given chunks of
+// every track. The chunks are copied in the order of their offsets in the input, which keeps the
+// interleaving of the tracks, and the sample tables of the tracks are rebuilt for their new offsets.
+func WriteTracks(output string, input io.ReaderAt, ftyp []byte, moov *atoms.CompositeAtom, tracks []*track.Track, chunks [][]track.Chunk, fastStart bool) error {
+	type placedChunk struct {
+		track, index int
+		offset       uint64
+	}
+	var placed []placedChunk
+	for i := range tracks {
+		for j := range chunks[i] {
+			placed = append(placed, placedChunk{track: i, index: j})
+		}
+	}
+	sort.SliceStable(placed, func(i, j int) bool {
+		return chunks[placed[i].track][placed[i].index].Offset < chunks[placed[j].track][placed[j].index].Offset
+	})
+	mediaChunks := make([]MediaChunk, len(placed))
+	var size uint64
+	for i, chunk := range placed {
+		placed[i].offset = size
+		mediaChunks[i] = MediaChunk{Source: chunks[chunk.track][chunk.index].Offset, Size: chunks[chunk.track][chunk.index].Size}
+		size += mediaChunks[i].Size
+	}
+
+	return WriteMovieFile(output, input, ftyp, moov, mediaChunks, fastStart, func(dataOffset uint64) {
+		for _, chunk := range placed {
+			chunks[chunk.track][chunk.index].Offset = dataOffset + chunk.offset
+		}
+		for i, t := range tracks {
+			if stbl, ok := t.Atom.Find("mdia", "minf", "stbl").(*atoms.CompositeAtom); ok {
+				track.ReplaceSampleTables(stbl, track.BuildSampleTables(t.Samples, chunks[i]))
+			}
+		}
+	})
+}
+
+// writeMovie writes the atoms of a rebuilt movie with the chunks of the input copied into its 'mdat' atom
+func writeMovie(destination io.Writer, input io.ReaderAt, chunks []MediaChunk, ftyp, moovData, mdatHeader []byte, fastStart bool) error {
+	w := bufio.NewWriter(destination)
+	header := [][]byte{ftyp, moovData, mdatHeader}
+	if !fastStart {
+		header = [][]byte{ftyp, mdatHeader}
+	}
+	for _, data := range header {
+		if _, err := w.Write(data); err != nil {
+			return err
+		}
+	}
+	if err := CopyChunks(w, input, chunks); err != nil {
+		return err
+	}
+	if !fastStart {
+		if _, err := w.Write(moovData); err != nil {
+			return err
+		}
+	}
+	return w.Flush()
+}
+
+// CopyChunks copies the chunks of the input to the writer one after the other
+func CopyChunks(w io.Writer, input io.ReaderAt, chunks []MediaChunk) error {
+	for _, chunk := range chunks {
+		n, err := io.Copy(w, io.NewSectionReader(input, int64(chunk.Source), int64(chunk.Size)))
+		if err == nil && uint64(n) != chunk.Size {
+			err = io.ErrUnexpectedEOF
+		}
+		if err != nil {
+			return fmt.Errorf("failed to copy chunk at offset %d: %w", chunk.Source, err)
+		}
+	}
+	return nil
+}
+
+// OutputPerm are the permissions of new output files, those os.Create gives them under the usual umask
+const OutputPerm os.FileMode = 0o644
+
+// ReplaceFile writes the output through a temporary file in its directory, which gets the given
+// permissions and replaces the output once write succeeded. On failure the temporary file is removed,
+// so that no partial output is left behind.
+func ReplaceFile(output string, perm os.FileMode, write func(*os.File) error) error {
+	temporary, err := os.CreateTemp(filepath.Dir(output), filepath.Base(output)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(temporary.Name())
+	if err := write(temporary); err != nil {
+		temporary.Close()
+		return err
+	}
+	if err := temporary.Chmod(perm); err != nil {
+		temporary.Close()
+		return err
+	}
+	if err := temporary.Close(); err != nil {
+		return err
+	}
+	return os.Rename(temporary.Name(), output)
+}
+
+// CheckDistinctFiles returns an error if the output would overwrite the input
+func CheckDistinctFiles(input, output string) error {
+	inputInfo, err := os.Stat(input)
+	if err != nil {
+		return err
+	}
+	if outputInfo, err := os.Stat(output); err == nil && os.SameFile(inputInfo, outputInfo) {
+		return fmt.Errorf("the output %s must not be the input file", output)
+	}
+	return nil
+}
@@ -0,0 +1,130 @@
+package writer
+
+import (
+	"fmt"
+	"io"
+	"math"
+
+	"github.com/KrzysztofHeinke/quicktime-movie-parser/internal/parser"
+	"github.com/KrzysztofHeinke/quicktime-movie-parser/pkg/models/atoms"
+	"github.com/sirupsen/logrus"
+)
+
+// maxLayoutPasses bounds how often the layout is recomputed after chunk offset tables grew to 'co64'
+const maxLayoutPasses = 4
+
+// Layout returns where every top level atom of the input starts in the rewritten file, given the size
+// of the new 'moov' atom
+type Layout func(moovSize int64) []int64
+
+// chunkOffsetTable is a 'stco' or 'co64' atom together with the offsets it held in the input file
+type chunkOffsetTable struct {
+	leaf     *atoms.LeafAtom
+	data     *atoms.ChunkOffsetAtom
+	original []uint64
+}
+
+// OrderedLayout places the top level atoms one after the other in the given order of their indexes,
+// with the 'moov' atom taking its new size. Atoms missing from the order keep their offset.
+func OrderedLayout(topLevelAtoms []parser.TopLevelAtom, order []int) Layout {
+	return func(moovSize int64) []int64 {
+		offsets := make([]int64, len(topLevelAtoms))
+		for i, atom := range topLevelAtoms {
+			offsets[i] = atom.Offset
+		}
+		position := int64(0)
+		for _, i := range order {
+			offsets[i] = position
+			if topLevelAtoms[i].Type == "moov" {
+				position += moovSize
+			} else {
+				position += topLevelAtoms[i].Size
+			}
+		}
+		return offsets
+	}
+}
+
+// SequentialOrder returns the indexes of the top level atoms in their original order
+func SequentialOrder(topLevelAtoms []parser.TopLevelAtom) []int {
+	order := make([]int, len(topLevelAtoms))
+	for i := range order {
+		order[i] = i
+	}
+	return order
+}
+
+// RelocateMovie shifts the chunk offsets of the 'moov' atom along with the top level atoms holding
+// them and returns the serialized atom. Offset tables which no longer fit 32 bits are upgraded to
+// 'co64', which grows 'moov' and requires another pass over the layout. moovSize is the size of the
+// 'moov' atom the layout is first computed with.
+func RelocateMovie(moov *atoms.CompositeAtom, topLevelAtoms []parser.TopLevelAtom, layout Layout, moovSize int64) ([]byte, error) {
+	var tables []*chunkOffsetTable
+	for _, atomType := range []string{"stco", "co64"} {
+		for _, atom := range moov.FindAll(atomType) {
+			leaf, ok := atom.(*atoms.LeafAtom)
+			if !ok {
+				continue
+			}
+			data, ok := leaf.Data.(*atoms.ChunkOffsetAtom)
+			if !ok {
+				return nil, fmt.Errorf("%s atom could not be parsed", atomType)
+			}
+			tables = append(tables, &chunkOffsetTable{leaf: leaf, data: data, original: append([]uint64(nil), data.Offsets...)})
+		}
+	}
+
+	for pass := 0; pass < maxLayoutPasses; pass++ {
+		offsets := layout(moovSize)
+		for _, table := range tables {
+			for i, offset := range table.original {
+				table.data.Offsets[i] = relocateOffset(offset, topLevelAtoms, offsets)
+				if table.data.Offsets[i] > math.MaxUint32 && !table.data.Is64Bit {
+					logrus.Infof("Upgrading chunk offset table to co64")
+					table.data.Is64Bit = true
+					copy(table.leaf.Type[:], table.data.GetType())
+				}
+			}
+			table.leaf.SetData(table.data)
+		}
+
+		moovData, err := Marshal(moov)
+		if err != nil {
+			return nil, err
+		}
+		if int64(len(moovData)) == moovSize {
+			return moovData, nil
+		}
+		moovSize = int64(len(moovData))
+	}
+	return nil, fmt.Errorf("the layout of the moov atom did not settle after %d passes", maxLayoutPasses)
+}
+
+// relocateOffset moves a file offset along with the top level atom holding it
+func relocateOffset(offset uint64, topLevelAtoms []parser.TopLevelAtom, offsets []int64) uint64 {
+	for i, atom := range topLevelAtoms {
+		if int64(offset) >= atom.Offset && int64(offset) < atom.Offset+atom.Size {
+			return uint64(int64(offset) - atom.Offset + offsets[i])
+		}
+	}
+	logrus.Warnf("Chunk offset %d is outside of the atoms of the file and is kept", offset)
+	return offset
+}
+
+// WriteAtoms streams the top level atoms of the input to w in the given order, writing moovData in
+// place of the 'moov' atom
+func WriteAtoms(w io.Writer, input io.ReaderAt, topLevelAtoms []parser.TopLevelAtom, order []int, moovData []byte) error {
+	for _, i := range order {
+		atom := topLevelAtoms[i]
+		if atom.Type == "moov" {
+			if _, err := w.Write(moovData); err != nil {
+				return err
+			}
+			continue
+		}
+		if _, err := io.Copy(w, io.NewSectionReader(input, atom.Offset, atom.Size)); err != nil {
+			return fmt.Errorf("failed to copy %s atom at offset %d: %w", atom.Type, atom.Offset, err)
+		}
+	}
+	return nil
+}
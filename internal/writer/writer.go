@@ -0,0 +1,101 @@
+package writer
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+
+	"github.com/KrzysztofHeinke/quicktime-movie-parser/pkg/models/atoms"
+)
+
+// Marshal serializes the atom and its children. Sizes are recomputed, and a 64-bit header is used
+// when the atom was read with one or does not fit a 32-bit size. Composite atoms with an empty
+// header, as left by the tree builder, only write their children.
+func Marshal(atom atoms.AtomIf) ([]byte, error) {
+	switch a := atom.(type) {
+	case *atoms.CompositeAtom:
+		payload := append([]byte(nil), a.Prefix...)
+		for _, child := range a.GetChildren() {
+			data, err := Marshal(child)
+			if err != nil {
+				return nil, err
+			}
+			payload = append(payload, data...)
+		}
+		payload = append(payload, a.Trailer...)
+		if a.Type == ([4]byte{}) {
+			return payload, nil
+		}
+		return appendAtom(nil, a.AtomHeader, payload), nil
+	case *atoms.LeafAtom:
+		payload, err := EncodeLeaf(a)
+		if err != nil {
+			return nil, err
+		}
+		return appendAtom(nil, a.AtomHeader, payload), nil
+	}
+	return nil, fmt.Errorf("cannot serialize atom of type %T", atom)
+}
+
+// FileTypeAtom returns an 'ftyp' or 'styp' atom with the major brand, its minor version and the
+// compatible brands
+func FileTypeAtom(atomType, majorBrand string, minorVersion uint32, compatibleBrands ...string) []byte {
+	payload := binary.BigEndian.AppendUint32([]byte(majorBrand), minorVersion)
+	for _, brand := range compatibleBrands {
+		payload = append(payload, brand...)
+	}
+	var header [4]byte
+	copy(header[:], atomType)
+	return append(AppendHeader(nil, header, uint64(len(payload)), false), payload...)
+}
+
+// WriteAtom serializes the atom and writes it to w
+func WriteAtom(w io.Writer, atom atoms.AtomIf) error {
+	data, err := Marshal(atom)
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(data)
+	return err
+}
+
+// EncodeLeaf returns the payload of a leaf atom. The raw payload read from the file is used as long as
+// it is kept, otherwise the decoded data is encoded.
+func EncodeLeaf(leaf *atoms.LeafAtom) ([]byte, error) {
+	if leaf.Raw != nil {
+		return leaf.Raw, nil
+	}
+	switch data := leaf.Data.(type) {
+	case nil:
+		return nil, nil
+	case atoms.Encoder:
+		payload, err := data.Encode()
+		if err != nil {
+			return nil, fmt.Errorf("error encoding '%s' atom: %w", leaf.GetType(), err)
+		}
+		return payload, nil
+	}
+	if binary.Size(leaf.Data) > 0 {
+		return atoms.EncodeFixedAtom(leaf.Data)
+	}
+	return nil, fmt.Errorf("no encoder for the %T data of '%s' atom", leaf.Data, leaf.GetType())
+}
+
+// AppendHeader appends the header of an atom of the given type and payload size. A 64-bit header is
+// used when the size does not fit 32 bits or if large is set.
+func AppendHeader(data []byte, atomType [4]byte, payloadSize uint64, large bool) []byte {
+	if !large && payloadSize+8 <= math.MaxUint32 {
+		data = binary.BigEndian.AppendUint32(data, uint32(payloadSize+8))
+		return append(data, atomType[:]...)
+	}
+	data = binary.BigEndian.AppendUint32(data, 1)
+	data = append(data, atomType[:]...)
+	return binary.BigEndian.AppendUint64(data, payloadSize+16)
+}
+
+// appendAtom appends the header and the payload of an atom, keeping the 64-bit header of atoms read with one
+func appendAtom(data []byte, header atoms.AtomHeader, payload []byte) []byte {
+	data = AppendHeader(data, header.Type, uint64(len(payload)), header.Size == 1)
+	return append(data, payload...)
+}
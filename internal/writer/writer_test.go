@@ -0,0 +1,217 @@
+package writer
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/KrzysztofHeinke/quicktime-movie-parser/internal/atomtest"
+	"github.com/KrzysztofHeinke/quicktime-movie-parser/internal/parser"
+	"github.com/KrzysztofHeinke/quicktime-movie-parser/pkg/models/atoms"
+	"github.com/stretchr/testify/assert"
+)
+
+// buildLargeAtom builds an atom with a 64-bit size around the payload
+func buildLargeAtom(atomType string, payload ...[]byte) []byte {
+	data := bytes.Join(payload, nil)
+	header := make([]byte, 16)
+	binary.BigEndian.PutUint32(header, 1)
+	copy(header[4:], atomType)
+	binary.BigEndian.PutUint64(header[8:], uint64(len(data)+16))
+	return append(header, data...)
+}
+
+// testMovie builds a 'moov' atom holding one of every commonly edited atom type
+func testMovie() []byte {
+	matrix := atomtest.Uint32s(0x10000, 0, 0, 0, 0x10000, 0, 0, 0, 0x40000000)
+	mvhd := atomtest.Build("mvhd", []byte{0, 0, 0, 0}, atomtest.Uint32s(1, 2, 600, 1200, 0x10000), []byte{1, 0}, make([]byte, 10), matrix, atomtest.Uint32s(0, 0, 0, 0, 0, 0, 2))
+	tkhd := atomtest.Build("tkhd", []byte{1, 0, 0, 3}, atomtest.Uint32s(0, 1, 0, 2, 1, 0, 0, 1200), make([]byte, 8), []byte{0, 0, 0, 0, 1, 0, 0, 0}, matrix, atomtest.Uint32s(640<<16, 480<<16))
+	mdhd := atomtest.Build("mdhd", []byte{0, 0, 0, 0}, atomtest.Uint32s(1, 2, 30000, 60060), []byte{0x55, 0xC4, 0, 0})
+	hdlr := atomtest.Build("hdlr", []byte{0, 0, 0, 0}, []byte("mhlrvide"), make([]byte, 12), []byte("\x0cVideoHandler"))
+	entry := atomtest.Build("avc1", make([]byte, 6), []byte{0, 1}, make([]byte, 70), atomtest.Build("pasp", atomtest.Uint32s(1, 1)))
+	stbl := atomtest.Build("stbl",
+		atomtest.Build("stsd", atomtest.Uint32s(0, 1), entry),
+		atomtest.Build("stts", atomtest.Uint32s(0, 1, 2, 1001)),
+		atomtest.Build("ctts", atomtest.Uint32s(0, 2, 1, 2002, 1, 0xFFFFFC17)),
+		atomtest.Build("stss", atomtest.Uint32s(0, 1, 1)),
+		atomtest.Build("stsc", atomtest.Uint32s(0, 1, 1, 2, 1)),
+		atomtest.Build("stsz", atomtest.Uint32s(0, 0, 2, 100, 200)),
+		atomtest.Build("stco", atomtest.Uint32s(0, 1, 48)),
+	)
+	trak := atomtest.Build("trak", tkhd,
+		atomtest.Build("tref", atomtest.Build("chap", atomtest.Uint32s(2))),
+		atomtest.Build("mdia", mdhd, hdlr, atomtest.Build("minf", atomtest.Build("vmhd", atomtest.Uint32s(1, 0, 0)), stbl)),
+	)
+	meta := atomtest.Build("meta", []byte{0, 0, 0, 0},
+		atomtest.Build("hdlr", []byte{0, 0, 0, 0}, []byte("\x00\x00\x00\x00mdta"), make([]byte, 12), []byte("Metadata\x00")),
+		atomtest.Build("keys", atomtest.Uint32s(0, 1, 27), []byte("mdtacom.apple.quicktime")),
+		atomtest.Build("ilst", atomtest.Build("\x00\x00\x00\x01", atomtest.Build("data", atomtest.Uint32s(1, 0), []byte("Apple")))),
+	)
+	udta := atomtest.Build("udta",
+		atomtest.Build("\xa9nam", []byte{0, 5, 0x55, 0xC4}, []byte("Title")),
+		atomtest.Build("chpl", []byte{1, 0, 0, 0}, atomtest.Uint32s(0), []byte{1}, make([]byte, 8), []byte{5}, []byte("Intro")),
+		meta,
+		make([]byte, 4),
+	)
+	return atomtest.Build("moov", mvhd, trak, udta, buildLargeAtom("free", make([]byte, 8)))
+}
+
+// parseTree builds the cleaned tree of the data
+func parseTree(t *testing.T, data []byte) *atoms.CompositeAtom {
+	tree, err := parser.CreateTreeOfAtoms(bytes.NewReader(data))
+	assert.NoError(t, err)
+	root, ok := parser.CleanEmptyHeaders(tree).(*atoms.CompositeAtom)
+	assert.True(t, ok)
+	return root
+}
+
+// forEachLeaf calls fn for every leaf atom below the atom
+func forEachLeaf(atom atoms.AtomIf, fn func(*atoms.LeafAtom)) {
+	switch a := atom.(type) {
+	case *atoms.LeafAtom:
+		fn(a)
+	case *atoms.CompositeAtom:
+		for _, child := range a.GetChildren() {
+			forEachLeaf(child, fn)
+		}
+	}
+}
+
+// TestMarshalRoundTrip tests that an unchanged tree is written back byte for byte
+func TestMarshalRoundTrip(t *testing.T) {
+	data := testMovie()
+	root := parseTree(t, data)
+
+	result, err := Marshal(root)
+	assert.NoError(t, err)
+	assert.Equal(t, data, result)
+}
+
+// decodedAtoms builds one atom of every decoded type missing from testMovie, each with a payload in the
+// form its encoder writes
+func decodedAtoms() []byte {
+	kid := bytes.Repeat([]byte{0x11}, 16)
+	dsi := []byte{0x12, 0x10}
+	decoderConfig := append([]byte{0x04, 0x11, 0x40, 0x15, 0x00, 0x10, 0x00}, atomtest.Uint32s(128000, 96000)...)
+	return bytes.Join([][]byte{
+		atomtest.Build("elng", atomtest.Uint32s(0), []byte("en-US\x00")),
+		atomtest.Build("elst", atomtest.Uint32s(0, 1, 1200, 0, 0x10000)),
+		atomtest.Build("clap", atomtest.Uint32s(640, 1, 480, 1, 0, 1, 0, 1)),
+		atomtest.Build("fiel", []byte{2, 9}),
+		atomtest.Build("gama", atomtest.Uint32s(0x23333)),
+		atomtest.Build("clef", atomtest.Uint32s(0, 640<<16, 480<<16)),
+		atomtest.Build("prof", atomtest.Uint32s(0, 640<<16, 480<<16)),
+		atomtest.Build("enof", atomtest.Uint32s(0, 640<<16, 480<<16)),
+		atomtest.Build("colr", []byte("nclx"), []byte{0, 9, 0, 16, 0, 9, 0x80}),
+		atomtest.Build("colr", []byte("prof"), []byte("ICC profile")),
+		atomtest.Build("mdcv", atomtest.Uint32s(1, 2, 3, 4, 10000000, 50)),
+		atomtest.Build("clli", atomtest.Uint32s(0x03E80190)),
+		atomtest.Build("amve", atomtest.Uint32s(3140000, 0x3D133D6E)),
+		atomtest.Build("dvcC", []byte{1, 0, 0x10, 0x35, 0x10}, make([]byte, 19)),
+		atomtest.Build("dvvC", []byte{1, 0, 0x10, 0x35, 0x10}, make([]byte, 19)),
+		atomtest.Build("dvwC", []byte{1, 0, 0x14, 0x35, 0x20}, make([]byte, 19)),
+		atomtest.Build("vttC", []byte("WEBVTT")),
+		atomtest.Build("vlab", []byte("label")),
+		atomtest.Build("mehd", atomtest.Uint32s(0, 1200)),
+		atomtest.Build("trex", atomtest.Uint32s(0, 1, 1, 1001, 0, 0x10000)),
+		atomtest.Build("mfhd", atomtest.Uint32s(0, 1)),
+		atomtest.Build("tfhd", atomtest.Uint32s(0x020000, 1)),
+		atomtest.Build("tfdt", atomtest.Uint32s(0x01000000, 0, 1001)),
+		atomtest.Build("trun", atomtest.Uint32s(0x000301, 2, 40, 1001, 20, 1001, 30)),
+		atomtest.Build("sidx", atomtest.Uint32s(0, 1, 1000, 0, 0, 1, 100, 2002, 0x90000000)),
+		atomtest.Build("ssix", atomtest.Uint32s(0, 1, 2, 0x01000010, 0x02000020)),
+		atomtest.Build("tfra", atomtest.Uint32s(0x01000000, 1, 0, 1, 0, 1000, 0, 500), []byte{1, 1, 1}),
+		atomtest.Build("mfro", atomtest.Uint32s(0, 16)),
+		atomtest.Build("frma", []byte("avc1")),
+		atomtest.Build("schm", atomtest.Uint32s(0), []byte("cenc"), atomtest.Uint32s(0x10000)),
+		atomtest.Build("schm", atomtest.Uint32s(1), []byte("cbcs"), atomtest.Uint32s(0x10000), []byte("https://example.com\x00")),
+		atomtest.Build("tenc", []byte{1, 0, 0, 0, 0, 0x19, 1, 0}, kid, []byte{16}, bytes.Repeat([]byte{0x22}, 16)),
+		atomtest.Build("pssh", atomtest.Uint32s(0x01000000), kid, atomtest.Uint32s(1), kid, atomtest.Uint32s(2), []byte{0xAB, 0xCD}),
+		atomtest.Build("senc", atomtest.Uint32s(0x000002, 1), make([]byte, 8), []byte{0, 1, 0, 16, 0, 0, 0, 32}),
+		atomtest.Build("saiz", atomtest.Uint32s(0), []byte{0}, atomtest.Uint32s(2), []byte{8, 16}),
+		atomtest.Build("saiz", atomtest.Uint32s(1), []byte("cenc"), atomtest.Uint32s(0), []byte{8}, atomtest.Uint32s(3)),
+		atomtest.Build("saio", atomtest.Uint32s(0, 1, 100)),
+		atomtest.Build("saio", atomtest.Uint32s(0x01000000, 1, 1, 0)),
+		atomtest.Build("avcC", []byte{1, 0x64, 0, 0x1F, 0xFF, 0xE1, 0, 4, 0x67, 0x64, 0, 0x1F, 1, 0, 2, 0x68, 0xEB, 0xFD, 0xF8, 0xF8, 0}),
+		atomtest.Build("hvcC", []byte{1, 0x01, 0x60, 0, 0, 0, 0x90, 0, 0, 0, 0, 0, 0x5D, 0xF0, 0, 0xFC, 0xFD, 0xF8, 0xF8, 0, 0, 0x0F, 1, 0xA0, 0, 1, 0, 2, 0x40, 0x01}),
+		atomtest.Build("esds", atomtest.Uint32s(0), []byte{0x03, 0x19, 0, 1, 0}, decoderConfig, []byte{0x05, 0x02}, dsi, []byte{0x06, 0x01, 0x02}),
+		atomtest.Build("enda", []byte{0, 1}),
+		atomtest.Build("pcmC", atomtest.Uint32s(0), []byte{1, 24}),
+		atomtest.Build("co64", atomtest.Uint32s(0, 1, 1, 0)),
+	}, nil)
+}
+
+// TestMarshalEncodedRoundTrip tests that encoding the decoded data of every leaf gives back the original bytes
+func TestMarshalEncodedRoundTrip(t *testing.T) {
+	for _, data := range [][]byte{testMovie(), decodedAtoms()} {
+		root := parseTree(t, data)
+		forEachLeaf(root, func(leaf *atoms.LeafAtom) {
+			if leaf.Data != nil {
+				leaf.SetData(leaf.Data)
+			}
+		})
+
+		result, err := Marshal(root)
+		assert.NoError(t, err)
+		assert.Equal(t, data, result)
+	}
+
+	forEachLeaf(parseTree(t, decodedAtoms()), func(leaf *atoms.LeafAtom) {
+		assert.NotNil(t, leaf.Data, "Expected '%s' atom to be decoded", leaf.GetType())
+	})
+}
+
+// TestMarshalModifiedTree tests that sizes are recomputed after a table grows
+func TestMarshalModifiedTree(t *testing.T) {
+	root := parseTree(t, testMovie())
+	stco, ok := root.Find("moov", "trak", "mdia", "minf", "stbl", "stco").(*atoms.LeafAtom)
+	assert.True(t, ok)
+	chunkOffsets := stco.Data.(*atoms.ChunkOffsetAtom)
+	chunkOffsets.Offsets = append(chunkOffsets.Offsets, 0x100000000)
+	chunkOffsets.Is64Bit = true
+	stco.Type = [4]byte{'c', 'o', '6', '4'}
+	stco.SetData(chunkOffsets)
+
+	result, err := Marshal(root)
+	assert.NoError(t, err)
+
+	reparsed := parseTree(t, result)
+	offsets, ok := reparsed.LeafData("moov", "trak", "mdia", "minf", "stbl", "co64").(*atoms.ChunkOffsetAtom)
+	assert.True(t, ok)
+	assert.Equal(t, []uint64{48, 0x100000000}, offsets.Offsets)
+	assert.Equal(t, uint32(len(result)), reparsed.GetChild("moov").GetSize())
+}
+
+// TestAppendHeader tests the choice between 32-bit and 64-bit headers
+func TestAppendHeader(t *testing.T) {
+	assert.Equal(t, atomtest.Build("free", make([]byte, 8))[:8], AppendHeader(nil, [4]byte{'f', 'r', 'e', 'e'}, 8, false))
+	assert.Equal(t, buildLargeAtom("free", make([]byte, 8))[:16], AppendHeader(nil, [4]byte{'f', 'r', 'e', 'e'}, 8, true))
+
+	header := AppendHeader(nil, [4]byte{'m', 'd', 'a', 't'}, 0x100000000, false)
+	assert.Equal(t, 16, len(header))
+	assert.Equal(t, uint32(1), binary.BigEndian.Uint32(header))
+	assert.Equal(t, uint64(0x100000010), binary.BigEndian.Uint64(header[8:]))
+}
+
+// TestWriteMovieFileFailure tests that a movie whose chunks cannot be copied leaves no output behind
+func TestWriteMovieFileFailure(t *testing.T) {
+	dir := t.TempDir()
+	output := filepath.Join(dir, "output.mp4")
+	ftyp := atomtest.FileType("isom", "mp41")
+	moov := atoms.NewCompositeAtom("moov")
+	chunks := []MediaChunk{{Source: 0, Size: 4}, {Source: 4, Size: 100}}
+
+	err := WriteMovieFile(output, bytes.NewReader(make([]byte, 8)), ftyp, moov, chunks, true, func(uint64) {})
+	assert.ErrorIs(t, err, io.ErrUnexpectedEOF)
+	entries, err := os.ReadDir(dir)
+	assert.NoError(t, err)
+	assert.Empty(t, entries)
+
+	assert.NoError(t, WriteMovieFile(output, bytes.NewReader(make([]byte, 8)), ftyp, moov, chunks[:1], true, func(uint64) {}))
+	info, err := os.Stat(output)
+	assert.NoError(t, err)
+	assert.Equal(t, OutputPerm, info.Mode().Perm())
+}
@@ -9,6 +9,8 @@ type AtomIf interface {
 type AtomHeader struct {
 	Size uint32
 	Type [4]byte
+	// LargeSize is the 64-bit size of atoms whose Size is 1
+	LargeSize uint64
 }
 
 func (a *AtomHeader) SetHeader(ah *AtomHeader) {
@@ -23,9 +25,29 @@ func (a *AtomHeader) GetSize() uint32 {
 	return a.Size
 }
 
+// GetFullSize returns the size of the atom, following the 64-bit size of atoms with an extended header
+func (a *AtomHeader) GetFullSize() uint64 {
+	if a.Size == 1 {
+		return a.LargeSize
+	}
+	return uint64(a.Size)
+}
+
+// HeaderSize returns the size of the atom header, 16 bytes for atoms with a 64-bit size and 8 otherwise
+func (a *AtomHeader) HeaderSize() int {
+	if a.Size == 1 {
+		return 16
+	}
+	return 8
+}
+
 type CompositeAtom struct {
 	AtomHeader
 	Childrens []AtomIf
+	// Prefix holds the payload bytes preceding the children, like the version and flags of the ISO 'meta' atom
+	Prefix []byte
+	// Trailer holds the payload bytes following the last child which do not form an atom
+	Trailer []byte
 }
 
 func (ca *CompositeAtom) AddChild(atom AtomIf) {
@@ -43,8 +65,103 @@ func (ca *CompositeAtom) SetChildren(childrens []AtomIf) {
 type LeafAtom struct {
 	AtomHeader
 	Data any
+	// Raw holds the payload as read from the file, it is written back as long as Data is not replaced
+	Raw []byte
 }
 
+// NewLeafAtom returns a leaf atom of the given type holding the data, which is encoded when the atom is
+// written. Its size is set then too.
+func NewLeafAtom(atomType string, data any) *LeafAtom {
+	leaf := &LeafAtom{AtomHeader: AtomHeader{Size: 8}}
+	copy(leaf.Type[:], atomType)
+	leaf.SetData(data)
+	return leaf
+}
+
+// NewCompositeAtom returns a composite atom of the given type holding the children. Its size is set once
+// the tree is written, it is not zero meanwhile so that the atom is not looked through like a wrapper.
+func NewCompositeAtom(atomType string, children ...AtomIf) *CompositeAtom {
+	composite := &CompositeAtom{AtomHeader: AtomHeader{Size: 8}, Childrens: children}
+	copy(composite.Type[:], atomType)
+	return composite
+}
+
+// SetData replaces the decoded data of the atom. The raw payload is dropped, so the atom is written
+// back by encoding the new data. Call it again after modifying the data in place.
 func (la *LeafAtom) SetData(data any) {
 	la.Data = data
+	la.Raw = nil
+}
+
+// GetChild returns the first direct child of the given type or nil if there is none.
+// Composite atoms with an empty header, as left by the tree builder, are looked through.
+func (ca *CompositeAtom) GetChild(atomType string) AtomIf {
+	for _, child := range ca.Childrens {
+		if child.GetType() == atomType {
+			return child
+		}
+		if wrapper, ok := child.(*CompositeAtom); ok && wrapper.Size == 0 {
+			if found := wrapper.GetChild(atomType); found != nil {
+				return found
+			}
+		}
+	}
+	return nil
+}
+
+// Find follows the given path of atom types down the tree and returns the atom at its end.
+func (ca *CompositeAtom) Find(path ...string) AtomIf {
+	var current AtomIf = ca
+	for _, atomType := range path {
+		composite, ok := current.(*CompositeAtom)
+		if !ok {
+			return nil
+		}
+		current = composite.GetChild(atomType)
+		if current == nil {
+			return nil
+		}
+	}
+	return current
+}
+
+// FindAll returns every atom of the given type found anywhere below the composite atom.
+func (ca *CompositeAtom) FindAll(atomType string) []AtomIf {
+	var found []AtomIf
+	for _, child := range ca.Childrens {
+		if child.GetType() == atomType {
+			found = append(found, child)
+		}
+		if composite, ok := child.(*CompositeAtom); ok {
+			found = append(found, composite.FindAll(atomType)...)
+		}
+	}
+	return found
+}
+
+// RemoveChildren removes the direct children of the given type and reports whether there were any.
+// Composite atoms with an empty header are looked through, like in GetChild.
+func (ca *CompositeAtom) RemoveChildren(atomType string) bool {
+	var children []AtomIf
+	removed := false
+	for _, child := range ca.Childrens {
+		if child.GetType() == atomType {
+			removed = true
+			continue
+		}
+		if wrapper, ok := child.(*CompositeAtom); ok && wrapper.Size == 0 {
+			removed = wrapper.RemoveChildren(atomType) || removed
+		}
+		children = append(children, child)
+	}
+	ca.Childrens = children
+	return removed
+}
+
+// LeafData returns the decoded data of the leaf atom at the end of the path or nil.
+func (ca *CompositeAtom) LeafData(path ...string) any {
+	if leaf, ok := ca.Find(path...).(*LeafAtom); ok {
+		return leaf.Data
+	}
+	return nil
 }
@@ -0,0 +1,44 @@
+package atoms
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// leaf returns a leaf atom of the given type without data
+func leaf(atomType string) *LeafAtom {
+	atom := &LeafAtom{}
+	copy(atom.Type[:], atomType)
+	return atom
+}
+
+// TestRemoveChildren tests that every direct child of the type is removed, also from below composite
+// atoms with an empty header, and that the others keep their order
+func TestRemoveChildren(t *testing.T) {
+	wrapper := &CompositeAtom{Childrens: []AtomIf{leaf("edts"), leaf("mdia")}}
+	trak := &CompositeAtom{Childrens: []AtomIf{leaf("tkhd"), leaf("edts"), wrapper, leaf("edts")}}
+
+	assert.True(t, trak.RemoveChildren("edts"))
+	assert.Len(t, trak.Childrens, 2)
+	assert.Equal(t, "tkhd", trak.Childrens[0].GetType())
+	assert.Same(t, wrapper, trak.Childrens[1])
+	assert.Len(t, wrapper.Childrens, 1)
+	assert.Equal(t, "mdia", wrapper.Childrens[0].GetType())
+
+	assert.False(t, trak.RemoveChildren("edts"))
+	assert.Len(t, trak.Childrens, 2)
+}
+
+// TestNewAtoms tests that built atoms have their type and data and are not looked through as wrappers
+func TestNewAtoms(t *testing.T) {
+	elst := NewLeafAtom("elst", &ElstAtom{})
+	edts := NewCompositeAtom("edts", elst)
+	trak := NewCompositeAtom("trak", edts)
+
+	assert.Equal(t, "edts", edts.GetType())
+	assert.IsType(t, &ElstAtom{}, elst.Data)
+	assert.Same(t, edts, trak.GetChild("edts"))
+	assert.Nil(t, trak.GetChild("elst"))
+	assert.Same(t, elst, trak.Find("edts", "elst"))
+}
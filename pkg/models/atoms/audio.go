@@ -0,0 +1,326 @@
+package atoms
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+)
+
+// MPEG-4 descriptor tags of the 'esds' atom
+const (
+	esDescriptorTag            = 0x03
+	decoderConfigDescriptorTag = 0x04
+	decoderSpecificInfoTag     = 0x05
+	slConfigDescriptorTag      = 0x06
+)
+
+// maxDescriptorSize is the largest size of an MPEG-4 descriptor, written in four bytes of 7 bits
+const maxDescriptorSize = 1<<28 - 1
+
+// Sampling frequencies of the MPEG-4 audio sampling frequency index
+var samplingFrequencies = []uint32{96000, 88200, 64000, 48000, 44100, 32000, 24000, 22050, 16000, 12000, 11025, 8000, 7350}
+
+// Format flags of version 2 sound sample descriptions
+const (
+	LPCMFlagIsFloat     = 0x01
+	LPCMFlagIsBigEndian = 0x02
+	LPCMFlagIsSigned    = 0x04
+)
+
+// AudioSampleEntry holds the fields of a sound sample description in its version 0, 1 or 2 layout
+type AudioSampleEntry struct {
+	Version          uint16
+	ChannelCount     uint32
+	SampleSize       uint32
+	SampleRate       float64
+	SamplesPerPacket uint32
+	BytesPerPacket   uint32
+	BytesPerFrame    uint32
+	BytesPerSample   uint32
+	FormatFlags      uint32
+}
+
+// ParseAudioSampleEntry decodes the sound specific fields of a sample entry
+func ParseAudioSampleEntry(entry *SampleEntry) (*AudioSampleEntry, error) {
+	data := entry.Data
+	if len(data) < 20 {
+		return nil, fmt.Errorf("audio sample entry too short: %d bytes", len(data))
+	}
+	audio := AudioSampleEntry{
+		Version:      binary.BigEndian.Uint16(data[0:2]),
+		ChannelCount: uint32(binary.BigEndian.Uint16(data[8:10])),
+		SampleSize:   uint32(binary.BigEndian.Uint16(data[10:12])),
+		SampleRate:   float64(binary.BigEndian.Uint32(data[16:20])) / 65536,
+	}
+
+	switch audio.Version {
+	case 1:
+		if len(data) < 36 {
+			return nil, fmt.Errorf("version 1 audio sample entry too short: %d bytes", len(data))
+		}
+		audio.SamplesPerPacket = binary.BigEndian.Uint32(data[20:24])
+		audio.BytesPerPacket = binary.BigEndian.Uint32(data[24:28])
+		audio.BytesPerFrame = binary.BigEndian.Uint32(data[28:32])
+		audio.BytesPerSample = binary.BigEndian.Uint32(data[32:36])
+	case 2:
+		if len(data) < 56 {
+			return nil, fmt.Errorf("version 2 audio sample entry too short: %d bytes", len(data))
+		}
+		audio.SampleRate = math.Float64frombits(binary.BigEndian.Uint64(data[24:32]))
+		audio.ChannelCount = binary.BigEndian.Uint32(data[32:36])
+		audio.SampleSize = binary.BigEndian.Uint32(data[40:44])
+		audio.FormatFlags = binary.BigEndian.Uint32(data[44:48])
+		audio.BytesPerPacket = binary.BigEndian.Uint32(data[48:52])
+		audio.SamplesPerPacket = binary.BigEndian.Uint32(data[52:56])
+	}
+	return &audio, nil
+}
+
+// EndaAtom represents the QuickTime 'enda' atom telling the byte order of PCM samples
+type EndaAtom struct {
+	LittleEndian uint16
+}
+
+// PcmCAtom represents the ISO 'pcmC' PCM configuration atom of 'ipcm' and 'fpcm' sample entries
+type PcmCAtom struct {
+	Version     uint8
+	Flags       [3]byte
+	FormatFlags uint8
+	SampleSize  uint8
+}
+
+// IsLittleEndian tells whether the PCM samples are stored in little-endian byte order
+func (p *PcmCAtom) IsLittleEndian() bool {
+	return p.FormatFlags&0x01 != 0
+}
+
+// DecoderConfig holds the decoder configuration descriptor of an 'esds' atom
+type DecoderConfig struct {
+	ObjectTypeIndication uint8
+	StreamType           uint8
+	BufferSize           uint32
+	MaxBitrate           uint32
+	AvgBitrate           uint32
+	DecoderSpecificInfo  []byte
+}
+
+// EsdsAtom represents the 'esds' elementary stream descriptor atom
+type EsdsAtom struct {
+	Version       uint8
+	Flags         [3]byte
+	ESID          uint16
+	DecoderConfig DecoderConfig
+}
+
+// ParseEsdsAtom parses the 'esds' atom
+func ParseEsdsAtom(reader io.Reader) (*EsdsAtom, error) {
+	var esds EsdsAtom
+	if err := readFullAtomHeader(reader, &esds.Version, &esds.Flags); err != nil {
+		return nil, err
+	}
+	data, err := io.ReadAll(reader)
+	if err != nil {
+		return nil, fmt.Errorf("error reading descriptors: %w", err)
+	}
+
+	tag, descriptor, _, err := readDescriptor(data)
+	if err != nil {
+		return nil, err
+	}
+	if tag != esDescriptorTag || len(descriptor) < 3 {
+		return nil, fmt.Errorf("missing ES descriptor")
+	}
+	esds.ESID = binary.BigEndian.Uint16(descriptor)
+	flags := descriptor[2]
+	descriptor = descriptor[3:]
+	skip := 0
+	if flags&0x80 != 0 {
+		skip += 2
+	}
+	if flags&0x40 != 0 {
+		if len(descriptor) < 1 {
+			return nil, fmt.Errorf("missing URL length")
+		}
+		skip += 1 + int(descriptor[0])
+	}
+	if flags&0x20 != 0 {
+		skip += 2
+	}
+	if len(descriptor) < skip {
+		return nil, fmt.Errorf("ES descriptor is truncated")
+	}
+	descriptor = descriptor[skip:]
+
+	for len(descriptor) > 0 {
+		tag, payload, rest, err := readDescriptor(descriptor)
+		if err != nil {
+			return nil, err
+		}
+		descriptor = rest
+		if tag != decoderConfigDescriptorTag {
+			continue
+		}
+		if len(payload) < 13 {
+			return nil, fmt.Errorf("decoder config descriptor too short: %d bytes", len(payload))
+		}
+		esds.DecoderConfig = DecoderConfig{
+			ObjectTypeIndication: payload[0],
+			StreamType:           payload[1] >> 2,
+			BufferSize:           uint32(payload[2])<<16 | uint32(binary.BigEndian.Uint16(payload[3:5])),
+			MaxBitrate:           binary.BigEndian.Uint32(payload[5:9]),
+			AvgBitrate:           binary.BigEndian.Uint32(payload[9:13]),
+		}
+		for payload = payload[13:]; len(payload) > 0; {
+			tag, info, rest, err := readDescriptor(payload)
+			if err != nil {
+				return nil, err
+			}
+			if tag == decoderSpecificInfoTag {
+				esds.DecoderConfig.DecoderSpecificInfo = info
+				break
+			}
+			payload = rest
+		}
+		break
+	}
+	return &esds, nil
+}
+
+// Encode writes the 'esds' atom as an ES descriptor holding the decoder configuration and the SL
+// configuration predefined for MP4 files. The optional fields of the ES descriptor are not kept when
+// decoding, so none are written.
+func (e *EsdsAtom) Encode() ([]byte, error) {
+	config := e.DecoderConfig
+	if config.StreamType > 0x3F || config.BufferSize > 0xFFFFFF {
+		return nil, fmt.Errorf("stream type %d or buffer size %d exceed their fields", config.StreamType, config.BufferSize)
+	}
+	configDescriptor := []byte{config.ObjectTypeIndication, config.StreamType<<2 | 0x01, uint8(config.BufferSize >> 16)}
+	configDescriptor = binary.BigEndian.AppendUint16(configDescriptor, uint16(config.BufferSize))
+	configDescriptor = binary.BigEndian.AppendUint32(configDescriptor, config.MaxBitrate)
+	configDescriptor = binary.BigEndian.AppendUint32(configDescriptor, config.AvgBitrate)
+	var err error
+	if config.DecoderSpecificInfo != nil {
+		if configDescriptor, err = appendDescriptor(configDescriptor, decoderSpecificInfoTag, config.DecoderSpecificInfo); err != nil {
+			return nil, err
+		}
+	}
+
+	descriptor := binary.BigEndian.AppendUint16(nil, e.ESID)
+	if descriptor, err = appendDescriptor(append(descriptor, 0), decoderConfigDescriptorTag, configDescriptor); err != nil {
+		return nil, err
+	}
+	if descriptor, err = appendDescriptor(descriptor, slConfigDescriptorTag, []byte{0x02}); err != nil {
+		return nil, err
+	}
+	return appendDescriptor(appendFullAtomHeader(nil, e.Version, e.Flags), esDescriptorTag, descriptor)
+}
+
+// appendDescriptor appends an MPEG-4 descriptor with the shortest encoding of its size
+func appendDescriptor(data []byte, tag uint8, payload []byte) ([]byte, error) {
+	if len(payload) > maxDescriptorSize {
+		return nil, fmt.Errorf("descriptor 0x%02x of %d bytes is too large", tag, len(payload))
+	}
+	data = append(data, tag)
+	shift := 21
+	for shift > 0 && len(payload)>>shift == 0 {
+		shift -= 7
+	}
+	for ; shift > 0; shift -= 7 {
+		data = append(data, 0x80|uint8(len(payload)>>shift&0x7F))
+	}
+	data = append(data, uint8(len(payload)&0x7F))
+	return append(data, payload...), nil
+}
+
+// readDescriptor reads an MPEG-4 descriptor with its variable length size and returns its tag,
+// its payload and the data following it
+func readDescriptor(data []byte) (uint8, []byte, []byte, error) {
+	if len(data) < 2 {
+		return 0, nil, nil, fmt.Errorf("descriptor is truncated")
+	}
+	tag := data[0]
+	size := 0
+	position := 1
+	for i := 0; i < 4; i++ {
+		if position >= len(data) {
+			return 0, nil, nil, fmt.Errorf("descriptor size is truncated")
+		}
+		b := data[position]
+		position++
+		size = size<<7 | int(b&0x7F)
+		if b&0x80 == 0 {
+			break
+		}
+	}
+	if len(data)-position < size {
+		return 0, nil, nil, fmt.Errorf("descriptor 0x%02x of %d bytes is truncated", tag, size)
+	}
+	return tag, data[position : position+size], data[position+size:], nil
+}
+
+// AudioSpecificConfig holds the leading fields of an MPEG-4 AudioSpecificConfig
+type AudioSpecificConfig struct {
+	ObjectType             uint8
+	SamplingFrequencyIndex uint8
+	SamplingFrequency      uint32
+	ChannelConfiguration   uint8
+}
+
+// ParseAudioSpecificConfig decodes the object type, sampling frequency and channel configuration. For
+// SBR and PS streams the object type and sampling frequency of the underlying AAC core are returned.
+func ParseAudioSpecificConfig(data []byte) (*AudioSpecificConfig, error) {
+	bits := &bitReader{data: data}
+	readObjectType := func() uint8 {
+		objectType := bits.read(5)
+		if objectType == 31 {
+			objectType = 32 + bits.read(6)
+		}
+		return uint8(objectType)
+	}
+	readFrequency := func() (uint8, uint32) {
+		index := uint8(bits.read(4))
+		if index == 15 {
+			return index, bits.read(24)
+		}
+		if int(index) < len(samplingFrequencies) {
+			return index, samplingFrequencies[index]
+		}
+		return index, 0
+	}
+
+	var config AudioSpecificConfig
+	config.ObjectType = readObjectType()
+	config.SamplingFrequencyIndex, config.SamplingFrequency = readFrequency()
+	config.ChannelConfiguration = uint8(bits.read(4))
+	if config.ObjectType == 5 || config.ObjectType == 29 {
+		readFrequency()
+		config.ObjectType = readObjectType()
+	}
+	if bits.err != nil {
+		return nil, fmt.Errorf("audio specific config is truncated")
+	}
+	return &config, nil
+}
+
+// bitReader reads big-endian bit fields from a byte slice
+type bitReader struct {
+	data     []byte
+	position int
+	err      error
+}
+
+// read returns the next n bits, setting err when the data ends
+func (b *bitReader) read(n int) uint32 {
+	var value uint32
+	for i := 0; i < n; i++ {
+		if b.position/8 >= len(b.data) {
+			b.err = io.ErrUnexpectedEOF
+			return 0
+		}
+		bit := b.data[b.position/8] >> (7 - b.position%8) & 1
+		value = value<<1 | uint32(bit)
+		b.position++
+	}
+	return value
+}
@@ -0,0 +1,246 @@
+package atoms
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+)
+
+// HEVC NAL unit types of the parameter sets
+const (
+	HevcNalVPS = 32
+	HevcNalSPS = 33
+	HevcNalPPS = 34
+)
+
+// AvcCAtom represents the 'avcC' AVC decoder configuration record
+type AvcCAtom struct {
+	ConfigurationVersion uint8
+	Profile              uint8
+	ProfileCompatibility uint8
+	Level                uint8
+	LengthSize           int
+	SPS                  [][]byte
+	PPS                  [][]byte
+	// Extension holds the bytes following the PPS, e.g. the chroma format and bit depths of the high profiles
+	Extension []byte
+}
+
+// ParseAvcCAtom parses the 'avcC' atom
+func ParseAvcCAtom(reader io.Reader) (*AvcCAtom, error) {
+	data, err := io.ReadAll(reader)
+	if err != nil {
+		return nil, fmt.Errorf("error reading avcC: %w", err)
+	}
+	if len(data) < 6 {
+		return nil, fmt.Errorf("avcC too short: %d bytes", len(data))
+	}
+	avcC := AvcCAtom{
+		ConfigurationVersion: data[0],
+		Profile:              data[1],
+		ProfileCompatibility: data[2],
+		Level:                data[3],
+		LengthSize:           int(data[4]&0x03) + 1,
+	}
+	position := 5
+	if avcC.SPS, position, err = readParameterSets(data, position+1, int(data[position]&0x1F)); err != nil {
+		return nil, fmt.Errorf("error reading SPS: %w", err)
+	}
+	if position >= len(data) {
+		return nil, fmt.Errorf("missing PPS count")
+	}
+	if avcC.PPS, position, err = readParameterSets(data, position+1, int(data[position])); err != nil {
+		return nil, fmt.Errorf("error reading PPS: %w", err)
+	}
+	avcC.Extension = data[position:]
+	return &avcC, nil
+}
+
+// Encode writes the AVC decoder configuration record with its reserved bits set
+func (a *AvcCAtom) Encode() ([]byte, error) {
+	if a.LengthSize < 1 || a.LengthSize > 4 {
+		return nil, fmt.Errorf("invalid NAL unit length size %d", a.LengthSize)
+	}
+	if len(a.SPS) > 0x1F || len(a.PPS) > 0xFF {
+		return nil, fmt.Errorf("too many parameter sets: %d SPS, %d PPS", len(a.SPS), len(a.PPS))
+	}
+	data := []byte{a.ConfigurationVersion, a.Profile, a.ProfileCompatibility, a.Level, 0xFC | uint8(a.LengthSize-1)}
+	data, err := appendParameterSets(append(data, 0xE0|uint8(len(a.SPS))), a.SPS)
+	if err != nil {
+		return nil, fmt.Errorf("error writing SPS: %w", err)
+	}
+	if data, err = appendParameterSets(append(data, uint8(len(a.PPS))), a.PPS); err != nil {
+		return nil, fmt.Errorf("error writing PPS: %w", err)
+	}
+	return append(data, a.Extension...), nil
+}
+
+// GetParameterSets returns the SPS and PPS NAL units in decoding order
+func (a *AvcCAtom) GetParameterSets() [][]byte {
+	return append(append([][]byte{}, a.SPS...), a.PPS...)
+}
+
+// HvcCArray is an array of NAL units of one type in the HEVC decoder configuration record
+type HvcCArray struct {
+	Completeness bool
+	NalUnitType  uint8
+	NalUnits     [][]byte
+}
+
+// HvcCAtom represents the 'hvcC' HEVC decoder configuration record
+type HvcCAtom struct {
+	ConfigurationVersion      uint8
+	ProfileSpace              uint8
+	TierFlag                  bool
+	ProfileIdc                uint8
+	ProfileCompatibilityFlags uint32
+	ConstraintIndicatorFlags  [6]byte
+	LevelIdc                  uint8
+	MinSpatialSegmentationIdc uint16
+	ParallelismType           uint8
+	ChromaFormatIdc           uint8
+	BitDepthLuma              uint8
+	BitDepthChroma            uint8
+	AvgFrameRate              uint16
+	ConstantFrameRate         uint8
+	NumTemporalLayers         uint8
+	TemporalIDNested          bool
+	LengthSize                int
+	Arrays                    []HvcCArray
+}
+
+// ParseHvcCAtom parses the 'hvcC' atom
+func ParseHvcCAtom(reader io.Reader) (*HvcCAtom, error) {
+	data, err := io.ReadAll(reader)
+	if err != nil {
+		return nil, fmt.Errorf("error reading hvcC: %w", err)
+	}
+	if len(data) < 23 {
+		return nil, fmt.Errorf("hvcC too short: %d bytes", len(data))
+	}
+	hvcC := HvcCAtom{
+		ConfigurationVersion:      data[0],
+		ProfileSpace:              data[1] >> 6,
+		TierFlag:                  data[1]&0x20 != 0,
+		ProfileIdc:                data[1] & 0x1F,
+		ProfileCompatibilityFlags: binary.BigEndian.Uint32(data[2:6]),
+		LevelIdc:                  data[12],
+		MinSpatialSegmentationIdc: binary.BigEndian.Uint16(data[13:15]) & 0x0FFF,
+		ParallelismType:           data[15] & 0x03,
+		ChromaFormatIdc:           data[16] & 0x03,
+		BitDepthLuma:              data[17]&0x07 + 8,
+		BitDepthChroma:            data[18]&0x07 + 8,
+		AvgFrameRate:              binary.BigEndian.Uint16(data[19:21]),
+		ConstantFrameRate:         data[21] >> 6,
+		NumTemporalLayers:         data[21] >> 3 & 0x07,
+		TemporalIDNested:          data[21]&0x04 != 0,
+		LengthSize:                int(data[21]&0x03) + 1,
+	}
+	copy(hvcC.ConstraintIndicatorFlags[:], data[6:12])
+
+	position := 23
+	hvcC.Arrays = make([]HvcCArray, 0, data[22])
+	for i := 0; i < int(data[22]); i++ {
+		if len(data)-position < 3 {
+			return nil, fmt.Errorf("array %d is truncated", i+1)
+		}
+		array := HvcCArray{Completeness: data[position]&0x80 != 0, NalUnitType: data[position] & 0x3F}
+		count := int(binary.BigEndian.Uint16(data[position+1:]))
+		if array.NalUnits, position, err = readParameterSets(data, position+3, count); err != nil {
+			return nil, fmt.Errorf("array %d: %w", i+1, err)
+		}
+		hvcC.Arrays = append(hvcC.Arrays, array)
+	}
+	return &hvcC, nil
+}
+
+// Encode writes the HEVC decoder configuration record with its reserved bits set
+func (h *HvcCAtom) Encode() ([]byte, error) {
+	if h.LengthSize < 1 || h.LengthSize > 4 {
+		return nil, fmt.Errorf("invalid NAL unit length size %d", h.LengthSize)
+	}
+	if h.BitDepthLuma < 8 || h.BitDepthLuma > 15 || h.BitDepthChroma < 8 || h.BitDepthChroma > 15 {
+		return nil, fmt.Errorf("invalid bit depths %d and %d", h.BitDepthLuma, h.BitDepthChroma)
+	}
+	if len(h.Arrays) > 0xFF {
+		return nil, fmt.Errorf("too many NAL unit arrays: %d", len(h.Arrays))
+	}
+	profile := h.ProfileSpace<<6 | h.ProfileIdc&0x1F
+	if h.TierFlag {
+		profile |= 0x20
+	}
+	data := binary.BigEndian.AppendUint32([]byte{h.ConfigurationVersion, profile}, h.ProfileCompatibilityFlags)
+	data = append(append(data, h.ConstraintIndicatorFlags[:]...), h.LevelIdc)
+	data = binary.BigEndian.AppendUint16(data, 0xF000|h.MinSpatialSegmentationIdc&0x0FFF)
+	data = append(data, 0xFC|h.ParallelismType&0x03, 0xFC|h.ChromaFormatIdc&0x03, 0xF8|(h.BitDepthLuma-8), 0xF8|(h.BitDepthChroma-8))
+	data = binary.BigEndian.AppendUint16(data, h.AvgFrameRate)
+	flags := h.ConstantFrameRate<<6 | h.NumTemporalLayers&0x07<<3 | uint8(h.LengthSize-1)
+	if h.TemporalIDNested {
+		flags |= 0x04
+	}
+	data = append(data, flags, uint8(len(h.Arrays)))
+	for i, array := range h.Arrays {
+		header := array.NalUnitType & 0x3F
+		if array.Completeness {
+			header |= 0x80
+		}
+		if len(array.NalUnits) > 0xFFFF {
+			return nil, fmt.Errorf("array %d: too many NAL units: %d", i+1, len(array.NalUnits))
+		}
+		data = binary.BigEndian.AppendUint16(append(data, header), uint16(len(array.NalUnits)))
+		var err error
+		if data, err = appendParameterSets(data, array.NalUnits); err != nil {
+			return nil, fmt.Errorf("array %d: %w", i+1, err)
+		}
+	}
+	return data, nil
+}
+
+// GetParameterSets returns the VPS, SPS and PPS NAL units in decoding order, followed by any other
+// NAL units of the configuration record such as SEI messages
+func (h *HvcCAtom) GetParameterSets() [][]byte {
+	var result [][]byte
+	for _, nalType := range []uint8{HevcNalVPS, HevcNalSPS, HevcNalPPS} {
+		for _, array := range h.Arrays {
+			if array.NalUnitType == nalType {
+				result = append(result, array.NalUnits...)
+			}
+		}
+	}
+	for _, array := range h.Arrays {
+		if array.NalUnitType < HevcNalVPS || array.NalUnitType > HevcNalPPS {
+			result = append(result, array.NalUnits...)
+		}
+	}
+	return result
+}
+
+// readParameterSets reads count NAL units each prefixed with its 16-bit length
+func readParameterSets(data []byte, position, count int) ([][]byte, int, error) {
+	units := make([][]byte, 0, min(count, len(data)/2))
+	for i := 0; i < count; i++ {
+		if len(data)-position < 2 {
+			return nil, 0, fmt.Errorf("NAL unit %d length is truncated", i+1)
+		}
+		length := int(binary.BigEndian.Uint16(data[position:]))
+		position += 2
+		if len(data)-position < length {
+			return nil, 0, fmt.Errorf("NAL unit %d of %d bytes is truncated", i+1, length)
+		}
+		units = append(units, data[position:position+length])
+		position += length
+	}
+	return units, position, nil
+}
+
+// appendParameterSets appends the NAL units each prefixed with its 16-bit length
+func appendParameterSets(data []byte, units [][]byte) ([]byte, error) {
+	for i, unit := range units {
+		if len(unit) > 0xFFFF {
+			return nil, fmt.Errorf("NAL unit %d of %d bytes is too long", i+1, len(unit))
+		}
+		data = binary.BigEndian.AppendUint16(data, uint16(len(unit)))
+		data = append(data, unit...)
+	}
+	return data, nil
+}
@@ -0,0 +1,66 @@
+package atoms
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// TestParseAvcCAtom tests reading the parameter sets of an AVC decoder configuration record
+func TestParseAvcCAtom(t *testing.T) {
+	data := []byte{
+		0x01, 0x64, 0x00, 0x1F, 0xFF, // Version, profile, compatibility, level, 4-byte lengths
+		0xE1, 0x00, 0x04, 0x67, 0x64, 0x00, 0x1F, // One SPS
+		0x01, 0x00, 0x03, 0x68, 0xEE, 0x3C, // One PPS
+	}
+	avcC, err := ParseAvcCAtom(bytes.NewReader(data))
+	assert.NoError(t, err)
+	assert.Equal(t, 4, avcC.LengthSize)
+	assert.Equal(t, [][]byte{{0x67, 0x64, 0x00, 0x1F}, {0x68, 0xEE, 0x3C}}, avcC.GetParameterSets())
+
+	_, err = ParseAvcCAtom(bytes.NewReader(data[:len(data)-1]))
+	assert.Error(t, err)
+}
+
+// TestParseHvcCAtom tests that the HEVC parameter sets are returned in VPS, SPS, PPS order
+func TestParseHvcCAtom(t *testing.T) {
+	data := append(make([]byte, 21), 0x03, 3)
+	data[0] = 1
+	data = append(data,
+		0xA2, 0x00, 0x01, 0x00, 0x02, 0x44, 0x01, // PPS
+		0xA0, 0x00, 0x01, 0x00, 0x02, 0x40, 0x01, // VPS
+		0xA1, 0x00, 0x01, 0x00, 0x02, 0x42, 0x01, // SPS
+	)
+	hvcC, err := ParseHvcCAtom(bytes.NewReader(data))
+	assert.NoError(t, err)
+	assert.Equal(t, 4, hvcC.LengthSize)
+	assert.Equal(t, [][]byte{{0x40, 0x01}, {0x42, 0x01}, {0x44, 0x01}}, hvcC.GetParameterSets())
+}
+
+// TestParseEsdsAtom tests reading the AudioSpecificConfig of an AAC elementary stream descriptor
+func TestParseEsdsAtom(t *testing.T) {
+	data := []byte{
+		0x00, 0x00, 0x00, 0x00, // Version, flags
+		0x03, 0x80, 0x80, 0x80, 0x19, 0x00, 0x01, 0x00, // ES descriptor with 4-byte size
+		0x04, 0x11, 0x40, 0x15, 0x00, 0x00, 0x00, 0x00, 0x01, 0xF4, 0x00, 0x00, 0x01, 0xF4, 0x00,
+		0x05, 0x02, 0x12, 0x10, // AAC LC, 44.1 kHz, stereo
+		0x06, 0x01, 0x02,
+	}
+	esds, err := ParseEsdsAtom(bytes.NewReader(data))
+	assert.NoError(t, err)
+	assert.Equal(t, uint8(0x40), esds.DecoderConfig.ObjectTypeIndication)
+	assert.Equal(t, uint8(5), esds.DecoderConfig.StreamType)
+	assert.Equal(t, uint32(128000), esds.DecoderConfig.AvgBitrate)
+	assert.Equal(t, []byte{0x12, 0x10}, esds.DecoderConfig.DecoderSpecificInfo)
+
+	config, err := ParseAudioSpecificConfig(esds.DecoderConfig.DecoderSpecificInfo)
+	assert.NoError(t, err)
+	assert.Equal(t, AudioSpecificConfig{ObjectType: 2, SamplingFrequencyIndex: 4, SamplingFrequency: 44100, ChannelConfiguration: 2}, *config)
+
+	// HE-AAC signalled explicitly reports the AAC LC core at 24 kHz
+	config, err = ParseAudioSpecificConfig([]byte{0x2B, 0x11, 0x88, 0x00})
+	assert.NoError(t, err)
+	assert.Equal(t, uint8(2), config.ObjectType)
+	assert.Equal(t, uint32(24000), config.SamplingFrequency)
+}
@@ -0,0 +1,268 @@
+package atoms
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// ColrAtom represents the 'colr' colour information atom. Depending on the colour type it holds
+// either coded colour parameters ('nclx', 'nclc') or an embedded ICC profile ('prof', 'rICC').
+type ColrAtom struct {
+	ColourType              [4]byte
+	ColourPrimaries         uint16
+	TransferCharacteristics uint16
+	MatrixCoefficients      uint16
+	FullRange               bool
+	ICCProfile              []byte
+}
+
+// ParseColrAtom parses the 'colr' atom
+func ParseColrAtom(reader io.Reader) (*ColrAtom, error) {
+	var colr ColrAtom
+
+	if _, err := io.ReadFull(reader, colr.ColourType[:]); err != nil {
+		return nil, fmt.Errorf("error reading colour type: %w", err)
+	}
+
+	switch colr.GetColourType() {
+	case "nclx", "nclc":
+		var parameters [3]uint16
+		if err := binary.Read(reader, binary.BigEndian, &parameters); err != nil {
+			return nil, fmt.Errorf("error reading colour parameters: %w", err)
+		}
+		colr.ColourPrimaries, colr.TransferCharacteristics, colr.MatrixCoefficients = parameters[0], parameters[1], parameters[2]
+		if colr.GetColourType() == "nclx" {
+			var rangeFlag uint8
+			if err := binary.Read(reader, binary.BigEndian, &rangeFlag); err != nil {
+				return nil, fmt.Errorf("error reading full range flag: %w", err)
+			}
+			colr.FullRange = rangeFlag&0x80 != 0
+		}
+	case "prof", "rICC":
+		profile, err := io.ReadAll(reader)
+		if err != nil {
+			return nil, fmt.Errorf("error reading ICC profile: %w", err)
+		}
+		colr.ICCProfile = profile
+	}
+
+	return &colr, nil
+}
+
+// GetColourType returns the colour type as a string
+func (c *ColrAtom) GetColourType() string {
+	return string(c.ColourType[:])
+}
+
+// Encode writes the 'colr' atom. Colour types other than coded parameters and ICC profiles are written
+// without a payload, as they are decoded without one.
+func (c *ColrAtom) Encode() ([]byte, error) {
+	data := append(make([]byte, 0, 11+len(c.ICCProfile)), c.ColourType[:]...)
+	switch c.GetColourType() {
+	case "nclx", "nclc":
+		data = binary.BigEndian.AppendUint16(data, c.ColourPrimaries)
+		data = binary.BigEndian.AppendUint16(data, c.TransferCharacteristics)
+		data = binary.BigEndian.AppendUint16(data, c.MatrixCoefficients)
+		if c.GetColourType() == "nclx" {
+			rangeFlag := uint8(0)
+			if c.FullRange {
+				rangeFlag = 0x80
+			}
+			data = append(data, rangeFlag)
+		}
+	case "prof", "rICC":
+		data = append(data, c.ICCProfile...)
+	}
+	return data, nil
+}
+
+// GetICCColourSpace returns the data colour space signature of the embedded ICC profile, e.g. "RGB"
+func (c *ColrAtom) GetICCColourSpace() string {
+	if len(c.ICCProfile) < 20 {
+		return ""
+	}
+	return strings.TrimSpace(string(c.ICCProfile[16:20]))
+}
+
+// colourPrimaries names the colour primaries code points of ISO/IEC 23091-2
+var colourPrimaries = map[uint16]string{
+	1: "BT.709", 2: "Unspecified", 4: "BT.470M", 5: "BT.470BG", 6: "SMPTE 170M", 7: "SMPTE 240M",
+	8: "Film", 9: "BT.2020", 10: "SMPTE ST 428-1", 11: "DCI-P3", 12: "Display P3", 22: "EBU Tech 3213-E",
+}
+
+// transferCharacteristics names the transfer characteristics code points of ISO/IEC 23091-2
+var transferCharacteristics = map[uint16]string{
+	1: "BT.709", 2: "Unspecified", 4: "Gamma 2.2", 5: "Gamma 2.8", 6: "SMPTE 170M", 7: "SMPTE 240M",
+	8: "Linear", 9: "Log 100:1", 10: "Log 316:1", 11: "IEC 61966-2-4", 12: "BT.1361", 13: "sRGB",
+	14: "BT.2020 10-bit", 15: "BT.2020 12-bit", 16: "SMPTE ST 2084 (PQ)", 17: "SMPTE ST 428-1", 18: "ARIB STD-B67 (HLG)",
+}
+
+// matrixCoefficients names the matrix coefficients code points of ISO/IEC 23091-2
+var matrixCoefficients = map[uint16]string{
+	0: "Identity", 1: "BT.709", 2: "Unspecified", 4: "FCC", 5: "BT.470BG", 6: "SMPTE 170M", 7: "SMPTE 240M",
+	8: "YCgCo", 9: "BT.2020 non-constant", 10: "BT.2020 constant", 11: "SMPTE ST 2085",
+	12: "Chromaticity-derived non-constant", 13: "Chromaticity-derived constant", 14: "ICtCp",
+}
+
+// codePointName returns the name of a code point or its number if it is unknown
+func codePointName(names map[uint16]string, value uint16) string {
+	if name, ok := names[value]; ok {
+		return name
+	}
+	return fmt.Sprintf("Reserved (%d)", value)
+}
+
+// GetPrimariesName returns the name of the colour primaries
+func (c *ColrAtom) GetPrimariesName() string {
+	return codePointName(colourPrimaries, c.ColourPrimaries)
+}
+
+// GetTransferName returns the name of the transfer characteristics
+func (c *ColrAtom) GetTransferName() string {
+	return codePointName(transferCharacteristics, c.TransferCharacteristics)
+}
+
+// GetMatrixName returns the name of the matrix coefficients
+func (c *ColrAtom) GetMatrixName() string {
+	return codePointName(matrixCoefficients, c.MatrixCoefficients)
+}
+
+// IsPQ reports whether the transfer function is SMPTE ST 2084
+func (c *ColrAtom) IsPQ() bool {
+	return c.TransferCharacteristics == 16
+}
+
+// IsHLG reports whether the transfer function is ARIB STD-B67
+func (c *ColrAtom) IsHLG() bool {
+	return c.TransferCharacteristics == 18
+}
+
+// MdcvAtom represents the 'mdcv' mastering display colour volume atom (SMPTE ST 2086).
+// Chromaticities are in units of 0.00002, luminance in units of 0.0001 cd/m2.
+// The display primaries are stored in green, blue, red order.
+type MdcvAtom struct {
+	DisplayPrimaries [3][2]uint16
+	WhitePoint       [2]uint16
+	MaxLuminance     uint32
+	MinLuminance     uint32
+}
+
+// Chromaticity is a CIE 1931 xy chromaticity coordinate
+type Chromaticity struct {
+	X float64
+	Y float64
+}
+
+// GetPrimaries returns the red, green and blue primaries of the mastering display
+func (m *MdcvAtom) GetPrimaries() (red, green, blue Chromaticity) {
+	coordinate := func(p [2]uint16) Chromaticity {
+		return Chromaticity{X: float64(p[0]) * 0.00002, Y: float64(p[1]) * 0.00002}
+	}
+	return coordinate(m.DisplayPrimaries[2]), coordinate(m.DisplayPrimaries[0]), coordinate(m.DisplayPrimaries[1])
+}
+
+// GetWhitePoint returns the white point of the mastering display
+func (m *MdcvAtom) GetWhitePoint() Chromaticity {
+	return Chromaticity{X: float64(m.WhitePoint[0]) * 0.00002, Y: float64(m.WhitePoint[1]) * 0.00002}
+}
+
+// GetMaxLuminance returns the maximum luminance of the mastering display in cd/m2
+func (m *MdcvAtom) GetMaxLuminance() float64 {
+	return float64(m.MaxLuminance) * 0.0001
+}
+
+// GetMinLuminance returns the minimum luminance of the mastering display in cd/m2
+func (m *MdcvAtom) GetMinLuminance() float64 {
+	return float64(m.MinLuminance) * 0.0001
+}
+
+// ClliAtom represents the 'clli' content light level atom, values are in cd/m2
+type ClliAtom struct {
+	MaxContentLightLevel    uint16
+	MaxPicAverageLightLevel uint16
+}
+
+// AmveAtom represents the 'amve' ambient viewing environment atom.
+// Illuminance is in units of 0.0001 lux, the chromaticity in units of 0.00002.
+type AmveAtom struct {
+	AmbientIlluminance uint32
+	AmbientLightX      uint16
+	AmbientLightY      uint16
+}
+
+// GetIlluminance returns the ambient illuminance in lux
+func (a *AmveAtom) GetIlluminance() float64 {
+	return float64(a.AmbientIlluminance) * 0.0001
+}
+
+// GetLight returns the chromaticity of the ambient light
+func (a *AmveAtom) GetLight() Chromaticity {
+	return Chromaticity{X: float64(a.AmbientLightX) * 0.00002, Y: float64(a.AmbientLightY) * 0.00002}
+}
+
+// DoviConfigAtom represents the 'dvcC', 'dvvC' and 'dvwC' Dolby Vision configuration atoms
+type DoviConfigAtom struct {
+	VersionMajor            uint8
+	VersionMinor            uint8
+	Profile                 uint8
+	Level                   uint8
+	RPUPresent              bool
+	ELPresent               bool
+	BLPresent               bool
+	BLSignalCompatibilityID uint8
+}
+
+// ParseDoviConfigAtom parses the Dolby Vision decoder configuration record
+func ParseDoviConfigAtom(reader io.Reader) (*DoviConfigAtom, error) {
+	var record struct {
+		VersionMajor  uint8
+		VersionMinor  uint8
+		Flags         uint16
+		Compatibility uint8
+	}
+	if err := binary.Read(reader, binary.BigEndian, &record); err != nil {
+		return nil, fmt.Errorf("error reading Dolby Vision configuration: %w", err)
+	}
+
+	return &DoviConfigAtom{
+		VersionMajor:            record.VersionMajor,
+		VersionMinor:            record.VersionMinor,
+		Profile:                 uint8(record.Flags >> 9),
+		Level:                   uint8(record.Flags>>3) & 0x3F,
+		RPUPresent:              record.Flags&0x04 != 0,
+		ELPresent:               record.Flags&0x02 != 0,
+		BLPresent:               record.Flags&0x01 != 0,
+		BLSignalCompatibilityID: record.Compatibility >> 4,
+	}, nil
+}
+
+// GetProfileName returns the Dolby Vision profile in the common "profile.compatibility" notation, e.g. "8.1"
+func (d *DoviConfigAtom) GetProfileName() string {
+	if d.BLSignalCompatibilityID == 0 {
+		return fmt.Sprintf("%d", d.Profile)
+	}
+	return fmt.Sprintf("%d.%d", d.Profile, d.BLSignalCompatibilityID)
+}
+
+// doviConfigSize is the size of the Dolby Vision decoder configuration record, reserved bytes included
+const doviConfigSize = 24
+
+// Encode writes the Dolby Vision decoder configuration record with its reserved bytes set to zero
+func (d *DoviConfigAtom) Encode() ([]byte, error) {
+	if d.Profile > 0x7F || d.Level > 0x3F || d.BLSignalCompatibilityID > 0x0F {
+		return nil, fmt.Errorf("profile %d, level %d or compatibility ID %d exceed their fields", d.Profile, d.Level, d.BLSignalCompatibilityID)
+	}
+	flags := uint16(d.Profile)<<9 | uint16(d.Level)<<3
+	for bit, present := range []bool{d.BLPresent, d.ELPresent, d.RPUPresent} {
+		if present {
+			flags |= 1 << bit
+		}
+	}
+	data := make([]byte, doviConfigSize)
+	data[0], data[1] = d.VersionMajor, d.VersionMinor
+	binary.BigEndian.PutUint16(data[2:], flags)
+	data[4] = d.BLSignalCompatibilityID << 4
+	return data, nil
+}
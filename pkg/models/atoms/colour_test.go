@@ -0,0 +1,68 @@
+package atoms
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// TestParseColrAtom tests the coded and ICC profile variants of the 'colr' atom
+func TestParseColrAtom(t *testing.T) {
+	nclx := []byte{'n', 'c', 'l', 'x', 0x00, 0x09, 0x00, 0x10, 0x00, 0x09, 0x80}
+	colr, err := ParseColrAtom(bytes.NewReader(nclx))
+	assert.NoError(t, err)
+	assert.Equal(t, "BT.2020", colr.GetPrimariesName())
+	assert.Equal(t, "SMPTE ST 2084 (PQ)", colr.GetTransferName())
+	assert.Equal(t, "BT.2020 non-constant", colr.GetMatrixName())
+	assert.True(t, colr.FullRange)
+	assert.True(t, colr.IsPQ())
+
+	nclc := []byte{'n', 'c', 'l', 'c', 0x00, 0x01, 0x00, 0x01, 0x00, 0x01}
+	colr, err = ParseColrAtom(bytes.NewReader(nclc))
+	assert.NoError(t, err)
+	assert.Equal(t, "BT.709", colr.GetPrimariesName())
+	assert.False(t, colr.FullRange)
+
+	profile := make([]byte, 128)
+	copy(profile[16:], "RGB ")
+	colr, err = ParseColrAtom(bytes.NewReader(append([]byte("prof"), profile...)))
+	assert.NoError(t, err)
+	assert.Len(t, colr.ICCProfile, 128)
+	assert.Equal(t, "RGB", colr.GetICCColourSpace())
+}
+
+// TestParseMdcvAtom tests decoding of the mastering display colour volume
+func TestParseMdcvAtom(t *testing.T) {
+	data := []byte{
+		0x21, 0x34, 0x9B, 0xAA, // G (0.170, 0.797)
+		0x19, 0x96, 0x08, 0xFC, // B (0.131, 0.046)
+		0x8A, 0x48, 0x39, 0x08, // R (0.708, 0.292)
+		0x3D, 0x13, 0x40, 0x42, // WP (0.3127, 0.329)
+		0x00, 0x98, 0x96, 0x80, // Max 1000 cd/m2
+		0x00, 0x00, 0x00, 0x32, // Min 0.005 cd/m2
+	}
+	mdcv, err := ParseFixedAtom[MdcvAtom](bytes.NewReader(data))
+	assert.NoError(t, err)
+	red, green, blue := mdcv.GetPrimaries()
+	assert.InDelta(t, 0.708, red.X, 1e-4)
+	assert.InDelta(t, 0.797, green.Y, 1e-4)
+	assert.InDelta(t, 0.046, blue.Y, 1e-4)
+	assert.InDelta(t, 0.3127, mdcv.GetWhitePoint().X, 1e-4)
+	assert.InDelta(t, 1000.0, mdcv.GetMaxLuminance(), 1e-9)
+	assert.InDelta(t, 0.005, mdcv.GetMinLuminance(), 1e-9)
+}
+
+// TestParseDoviConfigAtom tests decoding of the Dolby Vision configuration
+func TestParseDoviConfigAtom(t *testing.T) {
+	// Version 1.0, profile 8, level 6, RPU and BL present, compatibility ID 1
+	data := []byte{0x01, 0x00, 0x10, 0x35, 0x10, 0x00, 0x00, 0x00}
+	dovi, err := ParseDoviConfigAtom(bytes.NewReader(data))
+	assert.NoError(t, err)
+	assert.Equal(t, uint8(8), dovi.Profile)
+	assert.Equal(t, uint8(6), dovi.Level)
+	assert.True(t, dovi.RPUPresent)
+	assert.False(t, dovi.ELPresent)
+	assert.True(t, dovi.BLPresent)
+	assert.Equal(t, "8.1", dovi.GetProfileName())
+}
@@ -0,0 +1,122 @@
+package atoms
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"unicode/utf16"
+)
+
+// Well-known data types of the 'data' atom
+const (
+	DataTypeBinary      = 0
+	DataTypeUTF8        = 1
+	DataTypeUTF16       = 2
+	DataTypeJPEG        = 13
+	DataTypePNG         = 14
+	DataTypeSignedInt   = 21
+	DataTypeUnsignedInt = 22
+	DataTypeFloat32     = 23
+	DataTypeFloat64     = 24
+	DataTypeBMP         = 27
+	DataTypeInt8        = 65
+	DataTypeInt16       = 66
+	DataTypeInt32       = 67
+	DataTypeInt64       = 74
+	DataTypeUint8       = 75
+	DataTypeUint16      = 76
+	DataTypeUint32      = 77
+	DataTypeUint64      = 78
+)
+
+// DataAtom represents the 'data' atom holding the value of a metadata item
+type DataAtom struct {
+	TypeIndicator uint32
+	Locale        uint32
+	Value         []byte
+}
+
+// ParseDataAtom parses the 'data' atom
+func ParseDataAtom(reader io.Reader) (*DataAtom, error) {
+	var data DataAtom
+
+	if err := binary.Read(reader, binary.BigEndian, &data.TypeIndicator); err != nil {
+		return nil, fmt.Errorf("error reading type indicator: %w", err)
+	}
+	if err := binary.Read(reader, binary.BigEndian, &data.Locale); err != nil {
+		return nil, fmt.Errorf("error reading locale: %w", err)
+	}
+	value, err := io.ReadAll(reader)
+	if err != nil {
+		return nil, fmt.Errorf("error reading value: %w", err)
+	}
+	data.Value = value
+
+	return &data, nil
+}
+
+// Encode writes the 'data' atom
+func (d *DataAtom) Encode() ([]byte, error) {
+	data := binary.BigEndian.AppendUint32(make([]byte, 0, 8+len(d.Value)), d.TypeIndicator)
+	data = binary.BigEndian.AppendUint32(data, d.Locale)
+	return append(data, d.Value...), nil
+}
+
+// GetDataType returns the well-known type stored in the lower 24 bits of the type indicator
+func (d *DataAtom) GetDataType() uint32 {
+	return d.TypeIndicator & 0x00FFFFFF
+}
+
+// String formats the value according to its well-known type
+func (d *DataAtom) String() string {
+	v := d.Value
+	switch d.GetDataType() {
+	case DataTypeUTF8:
+		return string(v)
+	case DataTypeUTF16:
+		units := make([]uint16, len(v)/2)
+		for i := range units {
+			units[i] = binary.BigEndian.Uint16(v[i*2:])
+		}
+		return string(utf16.Decode(units))
+	case DataTypeSignedInt, DataTypeInt8, DataTypeInt16, DataTypeInt32, DataTypeInt64:
+		switch len(v) {
+		case 1:
+			return strconv.FormatInt(int64(int8(v[0])), 10)
+		case 2:
+			return strconv.FormatInt(int64(int16(binary.BigEndian.Uint16(v))), 10)
+		case 4:
+			return strconv.FormatInt(int64(int32(binary.BigEndian.Uint32(v))), 10)
+		case 8:
+			return strconv.FormatInt(int64(binary.BigEndian.Uint64(v)), 10)
+		}
+	case DataTypeUnsignedInt, DataTypeUint8, DataTypeUint16, DataTypeUint32, DataTypeUint64:
+		switch len(v) {
+		case 1:
+			return strconv.FormatUint(uint64(v[0]), 10)
+		case 2:
+			return strconv.FormatUint(uint64(binary.BigEndian.Uint16(v)), 10)
+		case 4:
+			return strconv.FormatUint(uint64(binary.BigEndian.Uint32(v)), 10)
+		case 8:
+			return strconv.FormatUint(binary.BigEndian.Uint64(v), 10)
+		}
+	case DataTypeFloat32:
+		if len(v) == 4 {
+			return strconv.FormatFloat(float64(math.Float32frombits(binary.BigEndian.Uint32(v))), 'f', -1, 32)
+		}
+	case DataTypeFloat64:
+		if len(v) == 8 {
+			return strconv.FormatFloat(math.Float64frombits(binary.BigEndian.Uint64(v)), 'f', -1, 64)
+		}
+	case DataTypeJPEG:
+		return fmt.Sprintf("<JPEG image, %d bytes>", len(v))
+	case DataTypePNG:
+		return fmt.Sprintf("<PNG image, %d bytes>", len(v))
+	case DataTypeBMP:
+		return fmt.Sprintf("<BMP image, %d bytes>", len(v))
+	}
+	return fmt.Sprintf("<binary data, %d bytes>", len(v))
+}
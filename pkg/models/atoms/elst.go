@@ -0,0 +1,97 @@
+package atoms
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+)
+
+// EditListEntry is an edit of the 'elst' atom. A media time of -1 marks an empty edit.
+type EditListEntry struct {
+	SegmentDuration   uint64
+	MediaTime         int64
+	MediaRateInteger  int16
+	MediaRateFraction int16
+}
+
+// ElstAtom represents the 'elst' edit list atom. Version 1 atoms store durations and times as 64-bit values.
+type ElstAtom struct {
+	Version    uint8
+	Flags      [3]byte
+	EntryCount uint32
+	Entries    []EditListEntry
+}
+
+// ParseElstAtom parses the 'elst' atom
+func ParseElstAtom(reader io.Reader) (*ElstAtom, error) {
+	var elst ElstAtom
+	entrySize := 12
+	if err := readFullAtomHeader(reader, &elst.Version, &elst.Flags); err != nil {
+		return nil, err
+	}
+	if elst.Version == 1 {
+		entrySize = 20
+	}
+	if err := binary.Read(reader, binary.BigEndian, &elst.EntryCount); err != nil {
+		return nil, fmt.Errorf("error reading entry count: %w", err)
+	}
+	data, err := io.ReadAll(reader)
+	if err != nil {
+		return nil, fmt.Errorf("error reading entries: %w", err)
+	}
+	if err := checkCount("edit list entry count", elst.EntryCount, entrySize, len(data)); err != nil {
+		return nil, err
+	}
+
+	elst.Entries = make([]EditListEntry, elst.EntryCount)
+	for i := range elst.Entries {
+		entry := data[i*entrySize:]
+		if elst.Version == 1 {
+			elst.Entries[i].SegmentDuration = binary.BigEndian.Uint64(entry[0:8])
+			elst.Entries[i].MediaTime = int64(binary.BigEndian.Uint64(entry[8:16]))
+			entry = entry[16:]
+		} else {
+			elst.Entries[i].SegmentDuration = uint64(binary.BigEndian.Uint32(entry[0:4]))
+			elst.Entries[i].MediaTime = int64(int32(binary.BigEndian.Uint32(entry[4:8])))
+			entry = entry[8:]
+		}
+		elst.Entries[i].MediaRateInteger = int16(binary.BigEndian.Uint16(entry[0:2]))
+		elst.Entries[i].MediaRateFraction = int16(binary.BigEndian.Uint16(entry[2:4]))
+	}
+	return &elst, nil
+}
+
+// GetMediaStart returns the media time of the first edit which is not empty, or 0 without such an edit
+func (e *ElstAtom) GetMediaStart() int64 {
+	for _, entry := range e.Entries {
+		if entry.MediaTime >= 0 {
+			return entry.MediaTime
+		}
+	}
+	return 0
+}
+
+// Encode writes the 'elst' atom. Version 0 is upgraded to version 1 when a value does not fit 32 bits.
+func (e *ElstAtom) Encode() ([]byte, error) {
+	version := e.Version
+	for _, entry := range e.Entries {
+		if entry.SegmentDuration > math.MaxUint32 || entry.MediaTime > math.MaxInt32 || entry.MediaTime < math.MinInt32 {
+			version = 1
+		}
+	}
+	data := appendFullAtomHeader(nil, version, e.Flags)
+	data = binary.BigEndian.AppendUint32(data, uint32(len(e.Entries)))
+	for _, entry := range e.Entries {
+		if version == 1 {
+			data = binary.BigEndian.AppendUint64(data, entry.SegmentDuration)
+			data = binary.BigEndian.AppendUint64(data, uint64(entry.MediaTime))
+		} else {
+			data = binary.BigEndian.AppendUint32(data, uint32(entry.SegmentDuration))
+			data = binary.BigEndian.AppendUint32(data, uint32(entry.MediaTime))
+		}
+		data = binary.BigEndian.AppendUint16(data, uint16(entry.MediaRateInteger))
+		data = binary.BigEndian.AppendUint16(data, uint16(entry.MediaRateFraction))
+	}
+	return data, nil
+}
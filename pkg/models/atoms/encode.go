@@ -0,0 +1,47 @@
+package atoms
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+)
+
+// Encoder is implemented by the decoded data of leaf atoms which can be written back to a file
+type Encoder interface {
+	// Encode returns the payload of the atom, without the atom header
+	Encode() ([]byte, error)
+}
+
+// EncodeFixedAtom writes an atom whose payload maps directly onto the fields of its data, the counterpart of ParseFixedAtom
+func EncodeFixedAtom(data any) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := binary.Write(&buf, binary.BigEndian, data); err != nil {
+		return nil, fmt.Errorf("error writing %T: %w", data, err)
+	}
+	return buf.Bytes(), nil
+}
+
+// appendFullAtomHeader appends the version and flags of a full atom
+func appendFullAtomHeader(data []byte, version uint8, flags [3]byte) []byte {
+	return append(append(data, version), flags[:]...)
+}
+
+// appendVersionedTime appends a value stored on 64 bits in version 1 atoms and on 32 bits otherwise
+func appendVersionedTime(data []byte, version uint8, value uint64) []byte {
+	if version == 1 {
+		return binary.BigEndian.AppendUint64(data, value)
+	}
+	return binary.BigEndian.AppendUint32(data, uint32(value))
+}
+
+// checkHeaderTimes returns an error if the times or the duration of a header atom do not fit its
+// 32-bit fields of version 0
+func checkHeaderTimes(version uint8, creationTime, modificationTime, duration uint64) error {
+	if version == 1 {
+		return nil
+	}
+	if creationTime > 0xFFFFFFFF || modificationTime > 0xFFFFFFFF || duration > 0xFFFFFFFF {
+		return fmt.Errorf("times or duration exceed the 32-bit fields of a version 0 header")
+	}
+	return nil
+}
@@ -0,0 +1,495 @@
+package atoms
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"math"
+	"unsafe"
+)
+
+// Well-known DRM system IDs of 'pssh' atoms
+var drmSystems = map[string]string{
+	"edef8ba9-79d6-4ace-a3c8-27dcd51d21ed": "Widevine",
+	"9a04f079-9840-4286-ab92-e65be0885f95": "PlayReady",
+	"94ce86fb-07ff-4f43-adb8-93d2fa968ca2": "FairPlay",
+	"1077efec-c0b2-4d02-ace3-3c1e52e2fb4b": "W3C Common",
+	"e2719d58-a985-b3c9-781a-b030af78d30e": "ClearKey",
+	"5e629af5-38da-4063-8977-97ffbd9902d4": "Marlin",
+	"f239e769-efa3-4850-9c16-a903c6932efb": "Adobe Primetime",
+}
+
+// Senc flags
+const SencUseSubsampleEncryption = 0x000002
+
+// FormatUUID formats a 16-byte identifier such as a key ID or a system ID in the canonical UUID form
+func FormatUUID(id [16]byte) string {
+	text := hex.EncodeToString(id[:])
+	return text[0:8] + "-" + text[8:12] + "-" + text[12:16] + "-" + text[16:20] + "-" + text[20:32]
+}
+
+// GetDRMSystemName returns the name of a DRM system ID or "Unknown"
+func GetDRMSystemName(systemID [16]byte) string {
+	if name, ok := drmSystems[FormatUUID(systemID)]; ok {
+		return name
+	}
+	return "Unknown"
+}
+
+// FrmaAtom represents the 'frma' original format atom of a protected sample entry
+type FrmaAtom struct {
+	DataFormat [4]byte
+}
+
+// GetDataFormat returns the original format of the protected sample entry
+func (f *FrmaAtom) GetDataFormat() string {
+	return string(f.DataFormat[:])
+}
+
+// SchmAtom represents the 'schm' scheme type atom
+type SchmAtom struct {
+	Version       uint8
+	Flags         [3]byte
+	SchemeType    [4]byte
+	SchemeVersion uint32
+	SchemeURI     string
+}
+
+// ParseSchmAtom parses the 'schm' atom
+func ParseSchmAtom(reader io.Reader) (*SchmAtom, error) {
+	var schm SchmAtom
+	if err := readFullAtomHeader(reader, &schm.Version, &schm.Flags); err != nil {
+		return nil, err
+	}
+	if _, err := io.ReadFull(reader, schm.SchemeType[:]); err != nil {
+		return nil, fmt.Errorf("error reading scheme type: %w", err)
+	}
+	if err := binary.Read(reader, binary.BigEndian, &schm.SchemeVersion); err != nil {
+		return nil, fmt.Errorf("error reading scheme version: %w", err)
+	}
+	if flagsValue(schm.Flags)&0x000001 != 0 {
+		uri, err := io.ReadAll(reader)
+		if err != nil {
+			return nil, fmt.Errorf("error reading scheme URI: %w", err)
+		}
+		schm.SchemeURI = string(bytes.TrimRight(uri, "\x00"))
+	}
+	return &schm, nil
+}
+
+// GetSchemeType returns the protection scheme, e.g. "cenc" or "cbcs"
+func (s *SchmAtom) GetSchemeType() string {
+	return string(s.SchemeType[:])
+}
+
+// Encode writes the 'schm' atom. The null terminated scheme URI is written when flag 0x000001 is set.
+func (s *SchmAtom) Encode() ([]byte, error) {
+	data := appendFullAtomHeader(make([]byte, 0, 13+len(s.SchemeURI)), s.Version, s.Flags)
+	data = append(data, s.SchemeType[:]...)
+	data = binary.BigEndian.AppendUint32(data, s.SchemeVersion)
+	if flagsValue(s.Flags)&0x000001 != 0 {
+		data = append(append(data, s.SchemeURI...), 0)
+	}
+	return data, nil
+}
+
+// TencAtom represents the 'tenc' track encryption atom holding the default encryption parameters
+type TencAtom struct {
+	Version                uint8
+	Flags                  [3]byte
+	DefaultCryptByteBlock  uint8
+	DefaultSkipByteBlock   uint8
+	DefaultIsProtected     uint8
+	DefaultPerSampleIVSize uint8
+	DefaultKID             [16]byte
+	DefaultConstantIV      []byte
+}
+
+// ParseTencAtom parses the 'tenc' atom
+func ParseTencAtom(reader io.Reader) (*TencAtom, error) {
+	var tenc TencAtom
+	if err := readFullAtomHeader(reader, &tenc.Version, &tenc.Flags); err != nil {
+		return nil, err
+	}
+	fields := make([]byte, 4)
+	if _, err := io.ReadFull(reader, fields); err != nil {
+		return nil, fmt.Errorf("error reading encryption defaults: %w", err)
+	}
+	if tenc.Version > 0 {
+		tenc.DefaultCryptByteBlock = fields[1] >> 4
+		tenc.DefaultSkipByteBlock = fields[1] & 0x0F
+	}
+	tenc.DefaultIsProtected = fields[2]
+	tenc.DefaultPerSampleIVSize = fields[3]
+	if _, err := io.ReadFull(reader, tenc.DefaultKID[:]); err != nil {
+		return nil, fmt.Errorf("error reading default KID: %w", err)
+	}
+
+	if tenc.DefaultIsProtected == 1 && tenc.DefaultPerSampleIVSize == 0 {
+		var size uint8
+		if err := binary.Read(reader, binary.BigEndian, &size); err != nil {
+			return nil, fmt.Errorf("error reading constant IV size: %w", err)
+		}
+		tenc.DefaultConstantIV = make([]byte, size)
+		if _, err := io.ReadFull(reader, tenc.DefaultConstantIV); err != nil {
+			return nil, fmt.Errorf("error reading constant IV: %w", err)
+		}
+	}
+	return &tenc, nil
+}
+
+// GetIVSize returns the size of the initialization vectors, either per sample or the constant one
+func (t *TencAtom) GetIVSize() int {
+	if t.DefaultPerSampleIVSize != 0 {
+		return int(t.DefaultPerSampleIVSize)
+	}
+	return len(t.DefaultConstantIV)
+}
+
+// HasPattern tells whether the track uses pattern encryption as in the 'cens' and 'cbcs' schemes
+func (t *TencAtom) HasPattern() bool {
+	return t.DefaultCryptByteBlock != 0 || t.DefaultSkipByteBlock != 0
+}
+
+// Encode writes the 'tenc' atom. The pattern is only written by version 1 atoms and the constant IV only
+// when the samples are protected without a per-sample IV, the same way they are read.
+func (t *TencAtom) Encode() ([]byte, error) {
+	data := appendFullAtomHeader(make([]byte, 0, 25+len(t.DefaultConstantIV)), t.Version, t.Flags)
+	pattern := uint8(0)
+	if t.Version > 0 {
+		if t.DefaultCryptByteBlock > 0x0F || t.DefaultSkipByteBlock > 0x0F {
+			return nil, fmt.Errorf("pattern %d:%d exceeds 4 bits", t.DefaultCryptByteBlock, t.DefaultSkipByteBlock)
+		}
+		pattern = t.DefaultCryptByteBlock<<4 | t.DefaultSkipByteBlock
+	}
+	data = append(data, 0, pattern, t.DefaultIsProtected, t.DefaultPerSampleIVSize)
+	data = append(data, t.DefaultKID[:]...)
+	if t.DefaultIsProtected == 1 && t.DefaultPerSampleIVSize == 0 {
+		if len(t.DefaultConstantIV) > 0xFF {
+			return nil, fmt.Errorf("constant IV of %d bytes is too long", len(t.DefaultConstantIV))
+		}
+		data = append(data, uint8(len(t.DefaultConstantIV)))
+		data = append(data, t.DefaultConstantIV...)
+	}
+	return data, nil
+}
+
+// PsshAtom represents the 'pssh' protection system specific header atom
+type PsshAtom struct {
+	Version  uint8
+	Flags    [3]byte
+	SystemID [16]byte
+	KIDs     [][16]byte
+	Data     []byte
+}
+
+// ParsePsshAtom parses the 'pssh' atom
+func ParsePsshAtom(reader io.Reader) (*PsshAtom, error) {
+	var pssh PsshAtom
+	if err := readFullAtomHeader(reader, &pssh.Version, &pssh.Flags); err != nil {
+		return nil, err
+	}
+	if _, err := io.ReadFull(reader, pssh.SystemID[:]); err != nil {
+		return nil, fmt.Errorf("error reading system ID: %w", err)
+	}
+	data, err := io.ReadAll(reader)
+	if err != nil {
+		return nil, fmt.Errorf("error reading protection system data: %w", err)
+	}
+
+	if pssh.Version > 0 {
+		if len(data) < 4 {
+			return nil, fmt.Errorf("missing KID count")
+		}
+		count := binary.BigEndian.Uint32(data)
+		data = data[4:]
+		if err := checkCount("KID count", count, 16, len(data)); err != nil {
+			return nil, err
+		}
+		pssh.KIDs = make([][16]byte, count)
+		for i := range pssh.KIDs {
+			copy(pssh.KIDs[i][:], data[i*16:])
+		}
+		data = data[count*16:]
+	}
+
+	if len(data) < 4 {
+		return nil, fmt.Errorf("missing data size")
+	}
+	size := binary.BigEndian.Uint32(data)
+	if uint64(len(data)-4) < uint64(size) {
+		return nil, &LimitError{What: "data size", Value: uint64(size), Limit: uint64(len(data) - 4), Remaining: true}
+	}
+	pssh.Data = data[4 : 4+size]
+	return &pssh, nil
+}
+
+// GetSystemName returns the name of the DRM system of the header
+func (p *PsshAtom) GetSystemName() string {
+	return GetDRMSystemName(p.SystemID)
+}
+
+// Encode writes the 'pssh' atom. Only version 1 atoms list KIDs.
+func (p *PsshAtom) Encode() ([]byte, error) {
+	if p.Version == 0 && len(p.KIDs) > 0 {
+		return nil, fmt.Errorf("a version 0 pssh atom cannot list %d KIDs", len(p.KIDs))
+	}
+	data := appendFullAtomHeader(make([]byte, 0, 28+len(p.KIDs)*16+len(p.Data)), p.Version, p.Flags)
+	data = append(data, p.SystemID[:]...)
+	if p.Version > 0 {
+		data = binary.BigEndian.AppendUint32(data, uint32(len(p.KIDs)))
+		for _, kid := range p.KIDs {
+			data = append(data, kid[:]...)
+		}
+	}
+	data = binary.BigEndian.AppendUint32(data, uint32(len(p.Data)))
+	return append(data, p.Data...), nil
+}
+
+// SubsampleEntry is the clear and protected byte count of a subsample
+type SubsampleEntry struct {
+	BytesOfClearData     uint16
+	BytesOfProtectedData uint32
+}
+
+// SampleEncryption holds the initialization vector and subsample map of a protected sample
+type SampleEncryption struct {
+	IV         []byte
+	Subsamples []SubsampleEntry
+}
+
+// SencAtom represents the 'senc' sample encryption atom. Its entries can only be decoded
+// once the IV size from the 'tenc' atom is known, see GetSamples.
+type SencAtom struct {
+	Version     uint8
+	Flags       [3]byte
+	SampleCount uint32
+	Data        []byte
+}
+
+// ParseSencAtom parses the 'senc' atom
+func ParseSencAtom(reader io.Reader) (*SencAtom, error) {
+	var senc SencAtom
+	if err := readFullAtomHeader(reader, &senc.Version, &senc.Flags); err != nil {
+		return nil, err
+	}
+	if err := binary.Read(reader, binary.BigEndian, &senc.SampleCount); err != nil {
+		return nil, fmt.Errorf("error reading sample count: %w", err)
+	}
+	data, err := io.ReadAll(reader)
+	if err != nil {
+		return nil, fmt.Errorf("error reading samples: %w", err)
+	}
+	senc.Data = data
+	return &senc, nil
+}
+
+// UsesSubsamples tells whether the samples carry subsample maps
+func (s *SencAtom) UsesSubsamples() bool {
+	return flagsValue(s.Flags)&SencUseSubsampleEncryption != 0
+}
+
+// Encode writes the 'senc' atom with its entries as they were read
+func (s *SencAtom) Encode() ([]byte, error) {
+	data := appendFullAtomHeader(make([]byte, 0, 8+len(s.Data)), s.Version, s.Flags)
+	data = binary.BigEndian.AppendUint32(data, s.SampleCount)
+	return append(data, s.Data...), nil
+}
+
+// GetSamples decodes the per-sample encryption entries using the IV size of the track, charging them to
+// the budget. Entries without an IV or subsamples take no bytes, so only the budget bounds their number.
+func (s *SencAtom) GetSamples(ivSize int, budget *Budget) ([]SampleEncryption, error) {
+	entrySize := ivSize
+	if s.UsesSubsamples() {
+		entrySize += 2
+	}
+	if err := checkCount("sample count", s.SampleCount, entrySize, len(s.Data)); err != nil {
+		return nil, err
+	}
+	if err := budget.Charge("sample encryption entries", uint64(s.SampleCount), unsafe.Sizeof(SampleEncryption{})); err != nil {
+		return nil, err
+	}
+	samples := make([]SampleEncryption, s.SampleCount)
+	data := s.Data
+	for i := range samples {
+		if len(data) < ivSize {
+			return nil, fmt.Errorf("sample %d: truncated IV", i+1)
+		}
+		samples[i].IV = data[:ivSize]
+		data = data[ivSize:]
+		if !s.UsesSubsamples() {
+			continue
+		}
+
+		if len(data) < 2 {
+			return nil, fmt.Errorf("sample %d: missing subsample count", i+1)
+		}
+		count := int(binary.BigEndian.Uint16(data))
+		data = data[2:]
+		if err := checkCount(fmt.Sprintf("subsample count of sample %d", i+1), uint32(count), 6, len(data)); err != nil {
+			return nil, err
+		}
+		samples[i].Subsamples = make([]SubsampleEntry, count)
+		for j := range samples[i].Subsamples {
+			samples[i].Subsamples[j] = SubsampleEntry{
+				BytesOfClearData:     binary.BigEndian.Uint16(data[j*6:]),
+				BytesOfProtectedData: binary.BigEndian.Uint32(data[j*6+2:]),
+			}
+		}
+		data = data[count*6:]
+	}
+	return samples, nil
+}
+
+// SaizAtom represents the 'saiz' sample auxiliary information sizes atom
+type SaizAtom struct {
+	Version               uint8
+	Flags                 [3]byte
+	AuxInfoType           [4]byte
+	AuxInfoTypeParameter  uint32
+	DefaultSampleInfoSize uint8
+	SampleCount           uint32
+	SampleInfoSizes       []uint8
+}
+
+// ParseSaizAtom parses the 'saiz' atom
+func ParseSaizAtom(reader io.Reader) (*SaizAtom, error) {
+	var saiz SaizAtom
+	if err := readFullAtomHeader(reader, &saiz.Version, &saiz.Flags); err != nil {
+		return nil, err
+	}
+	if flagsValue(saiz.Flags)&0x000001 != 0 {
+		if err := readAuxInfoType(reader, &saiz.AuxInfoType, &saiz.AuxInfoTypeParameter); err != nil {
+			return nil, err
+		}
+	}
+	if err := binary.Read(reader, binary.BigEndian, &saiz.DefaultSampleInfoSize); err != nil {
+		return nil, fmt.Errorf("error reading default sample info size: %w", err)
+	}
+	if err := binary.Read(reader, binary.BigEndian, &saiz.SampleCount); err != nil {
+		return nil, fmt.Errorf("error reading sample count: %w", err)
+	}
+	if saiz.DefaultSampleInfoSize != 0 {
+		return &saiz, nil
+	}
+
+	data, err := io.ReadAll(reader)
+	if err != nil {
+		return nil, fmt.Errorf("error reading sample info sizes: %w", err)
+	}
+	if err := checkCount("sample count", saiz.SampleCount, 1, len(data)); err != nil {
+		return nil, err
+	}
+	saiz.SampleInfoSizes = data[:saiz.SampleCount]
+	return &saiz, nil
+}
+
+// GetSampleInfoSize returns the size of the auxiliary information of the sample with the 0-based index
+func (s *SaizAtom) GetSampleInfoSize(index int) int {
+	if s.DefaultSampleInfoSize != 0 {
+		return int(s.DefaultSampleInfoSize)
+	}
+	if index < 0 || index >= len(s.SampleInfoSizes) {
+		return 0
+	}
+	return int(s.SampleInfoSizes[index])
+}
+
+// Encode writes the 'saiz' atom. Without a default size the sample count is taken from SampleInfoSizes.
+func (s *SaizAtom) Encode() ([]byte, error) {
+	data := appendFullAtomHeader(make([]byte, 0, 21+len(s.SampleInfoSizes)), s.Version, s.Flags)
+	if flagsValue(s.Flags)&0x000001 != 0 {
+		data = appendAuxInfoType(data, s.AuxInfoType, s.AuxInfoTypeParameter)
+	}
+	data = append(data, s.DefaultSampleInfoSize)
+	if s.DefaultSampleInfoSize != 0 {
+		return binary.BigEndian.AppendUint32(data, s.SampleCount), nil
+	}
+	data = binary.BigEndian.AppendUint32(data, uint32(len(s.SampleInfoSizes)))
+	return append(data, s.SampleInfoSizes...), nil
+}
+
+// SaioAtom represents the 'saio' sample auxiliary information offsets atom
+type SaioAtom struct {
+	Version              uint8
+	Flags                [3]byte
+	AuxInfoType          [4]byte
+	AuxInfoTypeParameter uint32
+	EntryCount           uint32
+	Offsets              []uint64
+}
+
+// ParseSaioAtom parses the 'saio' atom
+func ParseSaioAtom(reader io.Reader) (*SaioAtom, error) {
+	var saio SaioAtom
+	if err := readFullAtomHeader(reader, &saio.Version, &saio.Flags); err != nil {
+		return nil, err
+	}
+	if flagsValue(saio.Flags)&0x000001 != 0 {
+		if err := readAuxInfoType(reader, &saio.AuxInfoType, &saio.AuxInfoTypeParameter); err != nil {
+			return nil, err
+		}
+	}
+	if err := binary.Read(reader, binary.BigEndian, &saio.EntryCount); err != nil {
+		return nil, fmt.Errorf("error reading entry count: %w", err)
+	}
+
+	offsetSize := 4
+	if saio.Version == 1 {
+		offsetSize = 8
+	}
+	data, err := io.ReadAll(reader)
+	if err != nil {
+		return nil, fmt.Errorf("error reading offsets: %w", err)
+	}
+	if err := checkCount("entry count", saio.EntryCount, offsetSize, len(data)); err != nil {
+		return nil, err
+	}
+	saio.Offsets = make([]uint64, saio.EntryCount)
+	for i := range saio.Offsets {
+		if offsetSize == 8 {
+			saio.Offsets[i] = binary.BigEndian.Uint64(data[i*8:])
+		} else {
+			saio.Offsets[i] = uint64(binary.BigEndian.Uint32(data[i*4:]))
+		}
+	}
+	return &saio, nil
+}
+
+// Encode writes the 'saio' atom. The entry count is taken from Offsets.
+func (s *SaioAtom) Encode() ([]byte, error) {
+	data := appendFullAtomHeader(make([]byte, 0, 20+len(s.Offsets)*8), s.Version, s.Flags)
+	if flagsValue(s.Flags)&0x000001 != 0 {
+		data = appendAuxInfoType(data, s.AuxInfoType, s.AuxInfoTypeParameter)
+	}
+	data = binary.BigEndian.AppendUint32(data, uint32(len(s.Offsets)))
+	for _, offset := range s.Offsets {
+		if s.Version == 1 {
+			data = binary.BigEndian.AppendUint64(data, offset)
+			continue
+		}
+		if offset > math.MaxUint32 {
+			return nil, fmt.Errorf("offset %d exceeds the 32-bit offsets of a version 0 saio atom", offset)
+		}
+		data = binary.BigEndian.AppendUint32(data, uint32(offset))
+	}
+	return data, nil
+}
+
+// readAuxInfoType reads the optional auxiliary information type fields of 'saiz' and 'saio'
+func readAuxInfoType(reader io.Reader, auxInfoType *[4]byte, parameter *uint32) error {
+	if _, err := io.ReadFull(reader, auxInfoType[:]); err != nil {
+		return fmt.Errorf("error reading aux info type: %w", err)
+	}
+	if err := binary.Read(reader, binary.BigEndian, parameter); err != nil {
+		return fmt.Errorf("error reading aux info type parameter: %w", err)
+	}
+	return nil
+}
+
+// appendAuxInfoType appends the optional auxiliary information type fields of 'saiz' and 'saio'
+func appendAuxInfoType(data []byte, auxInfoType [4]byte, parameter uint32) []byte {
+	return binary.BigEndian.AppendUint32(append(data, auxInfoType[:]...), parameter)
+}
@@ -0,0 +1,60 @@
+package atoms
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// TestSencGetSamples tests decoding sample encryption entries with subsample maps
+func TestSencGetSamples(t *testing.T) {
+	data := []byte{
+		0x00, 0x00, 0x00, 0x02, // Version, flags with subsample encryption
+		0x00, 0x00, 0x00, 0x02, // Sample count
+		1, 2, 3, 4, 5, 6, 7, 8, // IV
+		0x00, 0x02, 0x00, 0x05, 0x00, 0x00, 0x00, 0x10, 0x00, 0x03, 0x00, 0x00, 0x00, 0x20,
+		8, 7, 6, 5, 4, 3, 2, 1, // IV
+		0x00, 0x00,
+	}
+	senc, err := ParseSencAtom(bytes.NewReader(data))
+	assert.NoError(t, err)
+	assert.True(t, senc.UsesSubsamples())
+
+	samples, err := senc.GetSamples(8, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, []SampleEncryption{
+		{IV: []byte{1, 2, 3, 4, 5, 6, 7, 8}, Subsamples: []SubsampleEntry{{5, 16}, {3, 32}}},
+		{IV: []byte{8, 7, 6, 5, 4, 3, 2, 1}, Subsamples: []SubsampleEntry{}},
+	}, samples)
+
+	_, err = senc.GetSamples(16, nil)
+	assert.Error(t, err)
+}
+
+// TestSencGetSamplesBudget tests that entries taking no bytes are charged to the allocation budget
+func TestSencGetSamplesBudget(t *testing.T) {
+	senc := &SencAtom{SampleCount: 1 << 16}
+	_, err := senc.GetSamples(0, NewBudget(1<<20))
+	assert.ErrorIs(t, err, ErrLimitExceeded)
+	samples, err := senc.GetSamples(0, NewBudget(1<<23))
+	assert.NoError(t, err)
+	assert.Len(t, samples, 1<<16)
+}
+
+// TestParseSaizSaioAtoms tests decoding the sample auxiliary information tables
+func TestParseSaizSaioAtoms(t *testing.T) {
+	saiz, err := ParseSaizAtom(bytes.NewReader([]byte{
+		0x00, 0x00, 0x00, 0x01, 'c', 'e', 'n', 'c', 0x00, 0x00, 0x00, 0x00,
+		0x00, 0x00, 0x00, 0x00, 0x03, 16, 22, 28,
+	}))
+	assert.NoError(t, err)
+	assert.Equal(t, "cenc", string(saiz.AuxInfoType[:]))
+	assert.Equal(t, 22, saiz.GetSampleInfoSize(1))
+
+	saio, err := ParseSaioAtom(bytes.NewReader([]byte{
+		0x01, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x01, 0x00, 0x00, 0x00, 0x01, 0x00, 0x00, 0x10, 0x00,
+	}))
+	assert.NoError(t, err)
+	assert.Equal(t, []uint64{1<<32 | 0x1000}, saio.Offsets)
+}
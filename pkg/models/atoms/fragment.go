@@ -0,0 +1,350 @@
+package atoms
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+)
+
+// Track fragment header flags
+const (
+	TfhdBaseDataOffsetPresent         = 0x000001
+	TfhdSampleDescriptionIndexPresent = 0x000002
+	TfhdDefaultSampleDurationPresent  = 0x000008
+	TfhdDefaultSampleSizePresent      = 0x000010
+	TfhdDefaultSampleFlagsPresent     = 0x000020
+	TfhdDurationIsEmpty               = 0x010000
+	TfhdDefaultBaseIsMoof             = 0x020000
+)
+
+// Track run flags
+const (
+	TrunDataOffsetPresent                   = 0x000001
+	TrunFirstSampleFlagsPresent             = 0x000004
+	TrunSampleDurationPresent               = 0x000100
+	TrunSampleSizePresent                   = 0x000200
+	TrunSampleFlagsPresent                  = 0x000400
+	TrunSampleCompositionTimeOffsetsPresent = 0x000800
+)
+
+// SampleIsNonSyncSample is the sample flag marking samples which are not sync samples
+const SampleIsNonSyncSample = 0x00010000
+
+// flagsValue returns the 24-bit flags of a full atom as an integer
+func flagsValue(flags [3]byte) uint32 {
+	return uint32(flags[0])<<16 | uint32(flags[1])<<8 | uint32(flags[2])
+}
+
+// flagsBytes returns the 24-bit flags of a full atom from an integer
+func flagsBytes(flags uint32) [3]byte {
+	return [3]byte{byte(flags >> 16), byte(flags >> 8), byte(flags)}
+}
+
+// readFullAtomHeader reads the version and flags of a full atom
+func readFullAtomHeader(reader io.Reader, version *uint8, flags *[3]byte) error {
+	if err := binary.Read(reader, binary.BigEndian, version); err != nil {
+		return fmt.Errorf("error reading version: %w", err)
+	}
+	if _, err := io.ReadFull(reader, flags[:]); err != nil {
+		return fmt.Errorf("error reading flags: %w", err)
+	}
+	return nil
+}
+
+// readVersionedTime reads a value stored on 64 bits in version 1 atoms and on 32 bits otherwise
+func readVersionedTime(reader io.Reader, version uint8) (uint64, error) {
+	if version == 1 {
+		var value uint64
+		err := binary.Read(reader, binary.BigEndian, &value)
+		return value, err
+	}
+	var value uint32
+	err := binary.Read(reader, binary.BigEndian, &value)
+	return uint64(value), err
+}
+
+// MehdAtom represents the 'mehd' movie extends header atom holding the duration of the fragmented movie
+type MehdAtom struct {
+	Version          uint8
+	Flags            [3]byte
+	FragmentDuration uint64
+}
+
+// ParseMehdAtom parses the 'mehd' atom
+func ParseMehdAtom(reader io.Reader) (*MehdAtom, error) {
+	var mehd MehdAtom
+	if err := readFullAtomHeader(reader, &mehd.Version, &mehd.Flags); err != nil {
+		return nil, err
+	}
+	duration, err := readVersionedTime(reader, mehd.Version)
+	if err != nil {
+		return nil, fmt.Errorf("error reading fragment duration: %w", err)
+	}
+	mehd.FragmentDuration = duration
+	return &mehd, nil
+}
+
+// TrexAtom represents the 'trex' track extends atom holding the sample defaults of a track's fragments
+type TrexAtom struct {
+	Version                       uint8
+	Flags                         [3]byte
+	TrackID                       uint32
+	DefaultSampleDescriptionIndex uint32
+	DefaultSampleDuration         uint32
+	DefaultSampleSize             uint32
+	DefaultSampleFlags            uint32
+}
+
+// MfhdAtom represents the 'mfhd' movie fragment header atom
+type MfhdAtom struct {
+	Version        uint8
+	Flags          [3]byte
+	SequenceNumber uint32
+}
+
+// TfhdAtom represents the 'tfhd' track fragment header atom. Only the fields flagged as present are set.
+type TfhdAtom struct {
+	Version                uint8
+	Flags                  [3]byte
+	TrackID                uint32
+	BaseDataOffset         uint64
+	SampleDescriptionIndex uint32
+	DefaultSampleDuration  uint32
+	DefaultSampleSize      uint32
+	DefaultSampleFlags     uint32
+}
+
+// ParseTfhdAtom parses the 'tfhd' atom
+func ParseTfhdAtom(reader io.Reader) (*TfhdAtom, error) {
+	var tfhd TfhdAtom
+	if err := readFullAtomHeader(reader, &tfhd.Version, &tfhd.Flags); err != nil {
+		return nil, err
+	}
+	if err := binary.Read(reader, binary.BigEndian, &tfhd.TrackID); err != nil {
+		return nil, fmt.Errorf("error reading track ID: %w", err)
+	}
+
+	flags := tfhd.GetFlags()
+	fields := []struct {
+		flag  uint32
+		value any
+	}{
+		{TfhdBaseDataOffsetPresent, &tfhd.BaseDataOffset},
+		{TfhdSampleDescriptionIndexPresent, &tfhd.SampleDescriptionIndex},
+		{TfhdDefaultSampleDurationPresent, &tfhd.DefaultSampleDuration},
+		{TfhdDefaultSampleSizePresent, &tfhd.DefaultSampleSize},
+		{TfhdDefaultSampleFlagsPresent, &tfhd.DefaultSampleFlags},
+	}
+	for _, field := range fields {
+		if flags&field.flag == 0 {
+			continue
+		}
+		if err := binary.Read(reader, binary.BigEndian, field.value); err != nil {
+			return nil, fmt.Errorf("error reading track fragment defaults: %w", err)
+		}
+	}
+	return &tfhd, nil
+}
+
+// GetFlags returns the flags of the track fragment header
+func (t *TfhdAtom) GetFlags() uint32 {
+	return flagsValue(t.Flags)
+}
+
+// SetFlags replaces the flags of the atom, which select the fields present
+func (t *TfhdAtom) SetFlags(flags uint32) {
+	t.Flags = flagsBytes(flags)
+}
+
+// TfdtAtom represents the 'tfdt' track fragment decode time atom
+type TfdtAtom struct {
+	Version             uint8
+	Flags               [3]byte
+	BaseMediaDecodeTime uint64
+}
+
+// ParseTfdtAtom parses the 'tfdt' atom
+func ParseTfdtAtom(reader io.Reader) (*TfdtAtom, error) {
+	var tfdt TfdtAtom
+	if err := readFullAtomHeader(reader, &tfdt.Version, &tfdt.Flags); err != nil {
+		return nil, err
+	}
+	decodeTime, err := readVersionedTime(reader, tfdt.Version)
+	if err != nil {
+		return nil, fmt.Errorf("error reading base media decode time: %w", err)
+	}
+	tfdt.BaseMediaDecodeTime = decodeTime
+	return &tfdt, nil
+}
+
+// TrunSample holds the per-sample fields of a track run. Only the fields flagged as present are set.
+type TrunSample struct {
+	Duration              uint32
+	Size                  uint32
+	Flags                 uint32
+	CompositionTimeOffset int32
+}
+
+// TrunAtom represents the 'trun' track run atom
+type TrunAtom struct {
+	Version          uint8
+	Flags            [3]byte
+	SampleCount      uint32
+	DataOffset       int32
+	FirstSampleFlags uint32
+	Samples          []TrunSample
+}
+
+// ParseTrunAtom parses the 'trun' atom
+func ParseTrunAtom(reader io.Reader) (*TrunAtom, error) {
+	var trun TrunAtom
+	if err := readFullAtomHeader(reader, &trun.Version, &trun.Flags); err != nil {
+		return nil, err
+	}
+	if err := binary.Read(reader, binary.BigEndian, &trun.SampleCount); err != nil {
+		return nil, fmt.Errorf("error reading sample count: %w", err)
+	}
+	flags := trun.GetFlags()
+	if flags&TrunDataOffsetPresent != 0 {
+		if err := binary.Read(reader, binary.BigEndian, &trun.DataOffset); err != nil {
+			return nil, fmt.Errorf("error reading data offset: %w", err)
+		}
+	}
+	if flags&TrunFirstSampleFlagsPresent != 0 {
+		if err := binary.Read(reader, binary.BigEndian, &trun.FirstSampleFlags); err != nil {
+			return nil, fmt.Errorf("error reading first sample flags: %w", err)
+		}
+	}
+
+	sampleSize := trun.sampleFieldsSize()
+	data, err := io.ReadAll(reader)
+	if err != nil {
+		return nil, fmt.Errorf("error reading samples: %w", err)
+	}
+	if err := checkCount("track run sample count", trun.SampleCount, sampleSize, len(data)); err != nil {
+		return nil, err
+	}
+	if sampleSize == 0 {
+		// The samples have nothing to hold, only the limits on the samples of a track bound their count
+		return &trun, nil
+	}
+
+	trun.Samples = make([]TrunSample, trun.SampleCount)
+	position := 0
+	next := func() uint32 {
+		value := binary.BigEndian.Uint32(data[position:])
+		position += 4
+		return value
+	}
+	for i := range trun.Samples {
+		sample := &trun.Samples[i]
+		if flags&TrunSampleDurationPresent != 0 {
+			sample.Duration = next()
+		}
+		if flags&TrunSampleSizePresent != 0 {
+			sample.Size = next()
+		}
+		if flags&TrunSampleFlagsPresent != 0 {
+			sample.Flags = next()
+		}
+		if flags&TrunSampleCompositionTimeOffsetsPresent != 0 {
+			sample.CompositionTimeOffset = int32(next())
+		}
+	}
+	return &trun, nil
+}
+
+// GetFlags returns the flags of the track run
+func (t *TrunAtom) GetFlags() uint32 {
+	return flagsValue(t.Flags)
+}
+
+// SetFlags replaces the flags of the atom, which select the fields present
+func (t *TrunAtom) SetFlags(flags uint32) {
+	t.Flags = flagsBytes(flags)
+}
+
+// sampleFieldsSize returns the bytes every sample takes for the fields flagged as present
+func (t *TrunAtom) sampleFieldsSize() int {
+	size := 0
+	for _, flag := range []uint32{TrunSampleDurationPresent, TrunSampleSizePresent, TrunSampleFlagsPresent, TrunSampleCompositionTimeOffsetsPresent} {
+		if t.GetFlags()&flag != 0 {
+			size += 4
+		}
+	}
+	return size
+}
+
+// Encode writes the 'mehd' atom
+func (m *MehdAtom) Encode() ([]byte, error) {
+	if err := checkHeaderTimes(m.Version, 0, 0, m.FragmentDuration); err != nil {
+		return nil, err
+	}
+	return appendVersionedTime(appendFullAtomHeader(nil, m.Version, m.Flags), m.Version, m.FragmentDuration), nil
+}
+
+// Encode writes the 'tfhd' atom with the fields flagged as present
+func (t *TfhdAtom) Encode() ([]byte, error) {
+	data := appendFullAtomHeader(make([]byte, 0, 36), t.Version, t.Flags)
+	data = binary.BigEndian.AppendUint32(data, t.TrackID)
+	flags := t.GetFlags()
+	if flags&TfhdBaseDataOffsetPresent != 0 {
+		data = binary.BigEndian.AppendUint64(data, t.BaseDataOffset)
+	}
+	fields := []struct {
+		flag  uint32
+		value uint32
+	}{
+		{TfhdSampleDescriptionIndexPresent, t.SampleDescriptionIndex},
+		{TfhdDefaultSampleDurationPresent, t.DefaultSampleDuration},
+		{TfhdDefaultSampleSizePresent, t.DefaultSampleSize},
+		{TfhdDefaultSampleFlagsPresent, t.DefaultSampleFlags},
+	}
+	for _, field := range fields {
+		if flags&field.flag != 0 {
+			data = binary.BigEndian.AppendUint32(data, field.value)
+		}
+	}
+	return data, nil
+}
+
+// Encode writes the 'tfdt' atom
+func (t *TfdtAtom) Encode() ([]byte, error) {
+	if err := checkHeaderTimes(t.Version, 0, 0, t.BaseMediaDecodeTime); err != nil {
+		return nil, err
+	}
+	return appendVersionedTime(appendFullAtomHeader(nil, t.Version, t.Flags), t.Version, t.BaseMediaDecodeTime), nil
+}
+
+// Encode writes the 'trun' atom with the fields flagged as present. The sample count is taken from Samples,
+// or from SampleCount for a run without sample fields, whose samples are not held.
+func (t *TrunAtom) Encode() ([]byte, error) {
+	flags := t.GetFlags()
+	count := uint32(len(t.Samples))
+	if t.sampleFieldsSize() == 0 && len(t.Samples) == 0 {
+		count = t.SampleCount
+	}
+	data := appendFullAtomHeader(make([]byte, 0, 16+len(t.Samples)*16), t.Version, t.Flags)
+	data = binary.BigEndian.AppendUint32(data, count)
+	if flags&TrunDataOffsetPresent != 0 {
+		data = binary.BigEndian.AppendUint32(data, uint32(t.DataOffset))
+	}
+	if flags&TrunFirstSampleFlagsPresent != 0 {
+		data = binary.BigEndian.AppendUint32(data, t.FirstSampleFlags)
+	}
+	for _, sample := range t.Samples {
+		if flags&TrunSampleDurationPresent != 0 {
+			data = binary.BigEndian.AppendUint32(data, sample.Duration)
+		}
+		if flags&TrunSampleSizePresent != 0 {
+			data = binary.BigEndian.AppendUint32(data, sample.Size)
+		}
+		if flags&TrunSampleFlagsPresent != 0 {
+			data = binary.BigEndian.AppendUint32(data, sample.Flags)
+		}
+		if flags&TrunSampleCompositionTimeOffsetsPresent != 0 {
+			data = binary.BigEndian.AppendUint32(data, uint32(sample.CompositionTimeOffset))
+		}
+	}
+	return data, nil
+}
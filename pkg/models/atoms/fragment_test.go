@@ -0,0 +1,28 @@
+package atoms
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// TestTrunWithoutSampleFields tests that a track run without sample fields keeps its sample count
+// without holding entries, whatever the count, and encodes it back
+func TestTrunWithoutSampleFields(t *testing.T) {
+	data := binary.BigEndian.AppendUint32([]byte{0, 0, 0, 1}, 1<<20)
+	data = binary.BigEndian.AppendUint32(data, 100)
+
+	trun, err := ParseTrunAtom(bytes.NewReader(data))
+	assert.NoError(t, err)
+	assert.Equal(t, uint32(1<<20), trun.SampleCount)
+	assert.Nil(t, trun.Samples)
+	encoded, err := trun.Encode()
+	assert.NoError(t, err)
+	assert.Equal(t, data, encoded)
+
+	data = binary.BigEndian.AppendUint32([]byte{0, 0, 0, 0}, DefaultLimits.MaxEntryCount+1)
+	_, err = ParseTrunAtom(bytes.NewReader(data))
+	assert.ErrorIs(t, err, ErrLimitExceeded)
+}
@@ -0,0 +1,81 @@
+package atoms_test
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+
+	"github.com/KrzysztofHeinke/quicktime-movie-parser/internal/atomtest"
+	"github.com/KrzysztofHeinke/quicktime-movie-parser/pkg/models/atoms"
+	"github.com/stretchr/testify/assert"
+)
+
+// sampleDescription builds the payload of an 'stsd' atom holding the sample entries
+func sampleDescription(entries ...[]byte) []byte {
+	data := binary.BigEndian.AppendUint32(make([]byte, 4), uint32(len(entries)))
+	for _, entry := range entries {
+		data = append(data, entry...)
+	}
+	return data
+}
+
+// sampleEntry builds a sample entry of the given type around its media specific fields
+func sampleEntry(entryType string, fields []byte) []byte {
+	data := binary.BigEndian.AppendUint32(nil, uint32(16+len(fields)))
+	data = append(data, entryType...)
+	data = append(data, 0, 0, 0, 0, 0, 0, 0, 1)
+	return append(data, fields...)
+}
+
+// FuzzParseStsdAtom tests that sample descriptions and the sample entry decoders never panic, and that
+// decoded descriptions survive encoding
+func FuzzParseStsdAtom(f *testing.F) {
+	atomtest.SetFuzzLimits(f)
+	audio := append(make([]byte, 16), 0xBB, 0x80, 0x00, 0x00)
+	visual := make([]byte, 70) // The fields of a visual sample entry
+	binary.BigEndian.PutUint16(visual[24:], 1920)
+	binary.BigEndian.PutUint16(visual[26:], 1080)
+	timecode := []byte{0, 0, 0, 0, 0, 0, 0, 3, 0, 0, 0x75, 0x30, 0, 0, 0x03, 0xE9, 0x1E, 0}
+	f.Add(sampleDescription(sampleEntry("mp4a", audio)))
+	f.Add(sampleDescription(sampleEntry("avc1", visual), sampleEntry("encv", visual)))
+	f.Add(sampleDescription(sampleEntry("tmcd", timecode)))
+	f.Add(sampleDescription(sampleEntry("tx3g", make([]byte, 30)), sampleEntry("stpp", []byte("ns\x00\x00\x00"))))
+	f.Add(sampleDescription(sampleEntry("mp4a", audio))[:20])
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		atomtest.CheckAllocation(t, func() {
+			stsd, err := atoms.ParseStsdAtom(bytes.NewReader(data))
+			if err != nil {
+				return
+			}
+			_, _ = atoms.GetSampleRates(stsd)
+			for i := range stsd.SampleEntries {
+				entry := &stsd.SampleEntries[i]
+				entry.GetOriginalFormat()
+				for _, handlerType := range []string{"vide", "soun", "text", "subt"} {
+					entry.ExtensionsOffset(handlerType)
+				}
+				_, _ = atoms.ParseAudioSampleEntry(entry)
+				if visual, err := atoms.ParseVisualSampleEntry(entry); err == nil {
+					visual.GetCompressorName()
+				}
+				_, _ = atoms.ParseTx3gSampleEntry(entry)
+				_, _ = atoms.ParseXMLSubtitleSampleEntry(entry)
+				if tmcd, err := atoms.ParseTimecodeSampleEntry(entry); err == nil {
+					tmcd.GetFrameRate()
+					tmcd.FormatTimecode(int64(len(data)) * 1000)
+				}
+			}
+
+			encoded, err := stsd.Encode()
+			assert.NoError(t, err)
+			decoded, err := atoms.ParseStsdAtom(bytes.NewReader(encoded))
+			assert.NoError(t, err)
+			assert.Equal(t, len(stsd.SampleEntries), len(decoded.SampleEntries))
+			for i := range decoded.SampleEntries {
+				assert.Equal(t, stsd.SampleEntries[i].Type, decoded.SampleEntries[i].Type)
+				assert.Equal(t, stsd.SampleEntries[i].Data, decoded.SampleEntries[i].Data)
+			}
+		})
+	})
+}
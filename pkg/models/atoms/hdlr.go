@@ -0,0 +1,80 @@
+package atoms
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+)
+
+// HdlrAtom represents the 'hdlr' atom which declares the media handler of a track or meta atom
+type HdlrAtom struct {
+	Version       uint8
+	Flags         [3]byte
+	ComponentType [4]byte
+	HandlerType   [4]byte
+	Reserved      [12]byte
+	Name          string
+	// PascalName is set when the name is stored as a QuickTime Pascal string instead of a C string
+	PascalName bool
+}
+
+// ParseHdlrAtom parses the 'hdlr' atom. The name is either a Pascal string (QuickTime) or a C string (MP4),
+// a single null byte is read as an empty C string.
+func ParseHdlrAtom(reader io.Reader) (*HdlrAtom, error) {
+	var hdlr HdlrAtom
+
+	if err := binary.Read(reader, binary.BigEndian, &hdlr.Version); err != nil {
+		return nil, fmt.Errorf("error reading version: %w", err)
+	}
+	if _, err := io.ReadFull(reader, hdlr.Flags[:]); err != nil {
+		return nil, fmt.Errorf("error reading flags: %w", err)
+	}
+	if _, err := io.ReadFull(reader, hdlr.ComponentType[:]); err != nil {
+		return nil, fmt.Errorf("error reading component type: %w", err)
+	}
+	if _, err := io.ReadFull(reader, hdlr.HandlerType[:]); err != nil {
+		return nil, fmt.Errorf("error reading handler type: %w", err)
+	}
+	if _, err := io.ReadFull(reader, hdlr.Reserved[:]); err != nil {
+		return nil, fmt.Errorf("error reading reserved bytes: %w", err)
+	}
+
+	name, err := io.ReadAll(reader)
+	if err != nil {
+		return nil, fmt.Errorf("error reading handler name: %w", err)
+	}
+	if len(name) > 1 && int(name[0]) == len(name)-1 {
+		hdlr.Name = string(name[1:])
+		hdlr.PascalName = true
+		return &hdlr, nil
+	}
+	hdlr.Name = string(bytes.TrimRight(name, "\x00"))
+
+	return &hdlr, nil
+}
+
+// GetHandlerType returns the handler type as a string, e.g. 'vide', 'soun' or 'mdta'
+func (h *HdlrAtom) GetHandlerType() string {
+	return string(h.HandlerType[:])
+}
+
+// Encode writes the 'hdlr' atom, storing the name the way it was read
+func (h *HdlrAtom) Encode() ([]byte, error) {
+	data := appendFullAtomHeader(make([]byte, 0, 25+len(h.Name)), h.Version, h.Flags)
+	data = append(data, h.ComponentType[:]...)
+	data = append(data, h.HandlerType[:]...)
+	data = append(data, h.Reserved[:]...)
+	if h.PascalName {
+		if len(h.Name) > 255 {
+			return nil, fmt.Errorf("handler name of %d bytes does not fit a Pascal string", len(h.Name))
+		}
+		return append(append(data, byte(len(h.Name))), h.Name...), nil
+	}
+	data = append(append(data, h.Name...), 0)
+	if len(h.Name) > 0 && int(h.Name[0]) == len(h.Name) {
+		// A second null byte keeps the name from reading as a Pascal string
+		data = append(data, 0)
+	}
+	return data, nil
+}
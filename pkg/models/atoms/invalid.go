@@ -0,0 +1,9 @@
+package atoms
+
+// InvalidAtom is an atom which the lenient parser could not decode. It keeps the bytes of the atom,
+// header included and clipped to its parent, together with the reason it was rejected.
+type InvalidAtom struct {
+	AtomHeader
+	Raw []byte
+	Err error
+}
@@ -0,0 +1,82 @@
+package atoms
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+)
+
+// KeyEntry is a single key of the 'keys' atom, e.g. 'mdta' / 'com.apple.quicktime.make'
+type KeyEntry struct {
+	Namespace [4]byte
+	Value     string
+}
+
+// KeysAtom represents the 'keys' atom of a QuickTime 'mdta' metadata atom
+type KeysAtom struct {
+	Version    uint8
+	Flags      [3]byte
+	EntryCount uint32
+	Entries    []KeyEntry
+}
+
+// ParseKeysAtom parses the 'keys' atom
+func ParseKeysAtom(reader io.Reader) (*KeysAtom, error) {
+	var keys KeysAtom
+
+	if err := binary.Read(reader, binary.BigEndian, &keys.Version); err != nil {
+		return nil, fmt.Errorf("error reading version: %w", err)
+	}
+	if _, err := io.ReadFull(reader, keys.Flags[:]); err != nil {
+		return nil, fmt.Errorf("error reading flags: %w", err)
+	}
+	if err := binary.Read(reader, binary.BigEndian, &keys.EntryCount); err != nil {
+		return nil, fmt.Errorf("error reading entry count: %w", err)
+	}
+
+	for i := uint32(0); i < keys.EntryCount; i++ {
+		var size uint32
+		var entry KeyEntry
+		if err := binary.Read(reader, binary.BigEndian, &size); err != nil {
+			return nil, fmt.Errorf("error reading key size: %w", err)
+		}
+		if size < 8 {
+			return nil, fmt.Errorf("invalid key size: %d", size)
+		}
+		if _, err := io.ReadFull(reader, entry.Namespace[:]); err != nil {
+			return nil, fmt.Errorf("error reading key namespace: %w", err)
+		}
+		// The value is read as it comes, so that a corrupt size cannot allocate more than the atom holds
+		value, err := io.ReadAll(io.LimitReader(reader, int64(size-8)))
+		if err != nil {
+			return nil, fmt.Errorf("error reading key value: %w", err)
+		}
+		if len(value) < int(size-8) {
+			return nil, &LimitError{What: "key size", Value: uint64(size), Limit: uint64(len(value) + 8), Remaining: true}
+		}
+		entry.Value = string(value)
+		keys.Entries = append(keys.Entries, entry)
+	}
+
+	return &keys, nil
+}
+
+// GetKey returns the key for the 1-based index used by the 'ilst' items
+func (k *KeysAtom) GetKey(index uint32) (string, bool) {
+	if index == 0 || index > uint32(len(k.Entries)) {
+		return "", false
+	}
+	return k.Entries[index-1].Value, true
+}
+
+// Encode writes the 'keys' atom. The entry count is taken from Entries.
+func (k *KeysAtom) Encode() ([]byte, error) {
+	data := appendFullAtomHeader(nil, k.Version, k.Flags)
+	data = binary.BigEndian.AppendUint32(data, uint32(len(k.Entries)))
+	for _, entry := range k.Entries {
+		data = binary.BigEndian.AppendUint32(data, uint32(8+len(entry.Value)))
+		data = append(data, entry.Namespace[:]...)
+		data = append(data, entry.Value...)
+	}
+	return data, nil
+}
@@ -0,0 +1,107 @@
+package atoms
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+)
+
+// UndeterminedLanguage is the ISO-639-2 code used when no language is specified
+const UndeterminedLanguage = "und"
+
+// macintoshLanguages maps the legacy Macintosh language codes to ISO-639-2/T codes
+var macintoshLanguages = map[uint16]string{
+	0: "eng", 1: "fra", 2: "deu", 3: "ita", 4: "nld", 5: "swe", 6: "spa", 7: "dan", 8: "por", 9: "nor",
+	10: "heb", 11: "jpn", 12: "ara", 13: "fin", 14: "ell", 15: "isl", 16: "mlt", 17: "tur", 18: "hrv", 19: "zho",
+	20: "urd", 21: "hin", 22: "tha", 23: "kor", 24: "lit", 25: "pol", 26: "hun", 27: "est", 28: "lav", 29: "sme",
+	30: "fao", 31: "fas", 32: "rus", 33: "zho", 34: "nld", 35: "gle", 36: "sqi", 37: "ron", 38: "ces", 39: "slk",
+	40: "slv", 41: "yid", 42: "srp", 43: "mkd", 44: "bul", 45: "ukr", 46: "bel", 47: "uzb", 48: "kaz", 49: "aze",
+	50: "aze", 51: "hye", 52: "kat", 53: "ron", 54: "kir", 55: "tgk", 56: "tuk", 57: "mon", 58: "mon", 59: "pus",
+	60: "kur", 61: "kas", 62: "snd", 63: "bod", 64: "nep", 65: "san", 66: "mar", 67: "ben", 68: "asm", 69: "guj",
+	70: "pan", 71: "ori", 72: "mal", 73: "kan", 74: "tam", 75: "tel", 76: "sin", 77: "mya", 78: "khm", 79: "lao",
+	80: "vie", 81: "ind", 82: "tgl", 83: "msa", 84: "msa", 85: "amh", 86: "tir", 87: "orm", 88: "som", 89: "swa",
+	90: "kin", 91: "run", 92: "nya", 93: "mlg", 94: "epo",
+	128: "cym", 129: "eus", 130: "cat", 131: "lat", 132: "que", 133: "grn", 134: "aym", 135: "tat", 136: "uig", 137: "dzo",
+	138: "jav", 139: "sun", 140: "glg", 141: "afr", 142: "bre", 143: "iku", 144: "gla", 145: "glv", 146: "gle", 147: "ton",
+	148: "ell", 149: "kal", 150: "aze", 151: "nno",
+}
+
+// DecodeLanguage decodes a 16-bit language code. Values below 0x400 are legacy Macintosh language
+// codes, other values hold a packed ISO-639-2/T code of three 5-bit characters offset by 0x60.
+func DecodeLanguage(code uint16) string {
+	if code < 0x400 {
+		if language, ok := macintoshLanguages[code]; ok {
+			return language
+		}
+		return UndeterminedLanguage
+	}
+	if code == 0x7FFF {
+		return UndeterminedLanguage
+	}
+
+	var language [3]byte
+	for i := 0; i < 3; i++ {
+		c := (code >> (10 - 5*uint(i))) & 0x1F
+		if c < 1 || c > 26 {
+			return UndeterminedLanguage
+		}
+		language[i] = byte(c) + 0x60
+	}
+	return string(language[:])
+}
+
+// EncodeLanguage packs a three letter ISO-639-2/T code into its 16-bit representation
+func EncodeLanguage(language string) (uint16, error) {
+	if len(language) != 3 {
+		return 0, fmt.Errorf("invalid ISO-639-2 language code: %q", language)
+	}
+	var code uint16
+	for i := 0; i < 3; i++ {
+		c := language[i]
+		if c < 'a' || c > 'z' {
+			return 0, fmt.Errorf("invalid ISO-639-2 language code: %q", language)
+		}
+		code = code<<5 | uint16(c-0x60)
+	}
+	return code, nil
+}
+
+// ElngAtom represents the 'elng' extended language atom holding a BCP-47 language tag
+type ElngAtom struct {
+	Version  uint8
+	Flags    [3]byte
+	Language string
+}
+
+// ParseElngAtom parses the 'elng' atom
+func ParseElngAtom(reader io.Reader) (*ElngAtom, error) {
+	var elng ElngAtom
+
+	if err := binary.Read(reader, binary.BigEndian, &elng.Version); err != nil {
+		return nil, fmt.Errorf("error reading version: %w", err)
+	}
+	if _, err := io.ReadFull(reader, elng.Flags[:]); err != nil {
+		return nil, fmt.Errorf("error reading flags: %w", err)
+	}
+	tag, err := io.ReadAll(reader)
+	if err != nil {
+		return nil, fmt.Errorf("error reading language tag: %w", err)
+	}
+	if end := bytes.IndexByte(tag, 0); end >= 0 {
+		tag = tag[:end]
+	}
+	elng.Language = string(tag)
+
+	return &elng, nil
+}
+
+// Encode writes the 'elng' atom with its null terminated language tag
+func (e *ElngAtom) Encode() ([]byte, error) {
+	if bytes.IndexByte([]byte(e.Language), 0) >= 0 {
+		return nil, fmt.Errorf("language tag %q holds a null character", e.Language)
+	}
+	data := appendFullAtomHeader(make([]byte, 0, 5+len(e.Language)), e.Version, e.Flags)
+	data = append(data, e.Language...)
+	return append(data, 0), nil
+}
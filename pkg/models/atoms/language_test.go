@@ -0,0 +1,71 @@
+package atoms
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// TestDecodeLanguage tests decoding of packed ISO-639-2/T and Macintosh language codes
+func TestDecodeLanguage(t *testing.T) {
+	assert.Equal(t, "eng", DecodeLanguage(0x15C7), "Expected packed 'eng'")
+	assert.Equal(t, "und", DecodeLanguage(0x55C4), "Expected packed 'und'")
+	assert.Equal(t, "pol", DecodeLanguage(0x41EC), "Expected packed 'pol'")
+	assert.Equal(t, "eng", DecodeLanguage(0), "Expected Macintosh English")
+	assert.Equal(t, "deu", DecodeLanguage(2), "Expected Macintosh German")
+	assert.Equal(t, "jpn", DecodeLanguage(11), "Expected Macintosh Japanese")
+	assert.Equal(t, "und", DecodeLanguage(0x3FF), "Expected unknown Macintosh code to be undetermined")
+	assert.Equal(t, "und", DecodeLanguage(0x7FFF), "Expected unspecified language to be undetermined")
+}
+
+// TestEncodeLanguage tests that encoding is the inverse of decoding
+func TestEncodeLanguage(t *testing.T) {
+	code, err := EncodeLanguage("eng")
+	assert.NoError(t, err)
+	assert.Equal(t, uint16(0x15C7), code)
+
+	_, err = EncodeLanguage("EN")
+	assert.Error(t, err)
+}
+
+// TestParseElngAtom tests the ParseElngAtom function
+func TestParseElngAtom(t *testing.T) {
+	data := append([]byte{0, 0, 0, 0}, []byte("pt-BR\x00")...)
+	elng, err := ParseElngAtom(bytes.NewReader(data))
+	assert.NoError(t, err)
+	assert.Equal(t, "pt-BR", elng.Language)
+}
+
+// TestParseMdhdAtom tests both versions of the 'mdhd' atom
+func TestParseMdhdAtom(t *testing.T) {
+	v0 := []byte{
+		0x00, 0x00, 0x00, 0x00,
+		0x00, 0x00, 0x00, 0x01,
+		0x00, 0x00, 0x00, 0x02,
+		0x00, 0x00, 0x02, 0x58, // TimeScale 600
+		0x00, 0x00, 0x17, 0x70, // Duration 6000
+		0x41, 0xEC, // Language 'pol'
+		0x00, 0x00,
+	}
+	mdhd, err := ParseMdhdAtom(bytes.NewReader(v0))
+	assert.NoError(t, err)
+	assert.Equal(t, uint32(600), mdhd.TimeScale)
+	assert.Equal(t, uint64(6000), mdhd.Duration)
+	assert.Equal(t, "pol", mdhd.GetLanguage())
+
+	v1 := []byte{
+		0x01, 0x00, 0x00, 0x00,
+		0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x01,
+		0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x02,
+		0x00, 0x00, 0xBB, 0x80, // TimeScale 48000
+		0x00, 0x00, 0x00, 0x01, 0x00, 0x00, 0x00, 0x00, // Duration 2^32
+		0x15, 0xC7, // Language 'eng'
+		0x00, 0x00,
+	}
+	mdhd, err = ParseMdhdAtom(bytes.NewReader(v1))
+	assert.NoError(t, err)
+	assert.Equal(t, uint32(48000), mdhd.TimeScale)
+	assert.Equal(t, uint64(1)<<32, mdhd.Duration)
+	assert.Equal(t, "eng", mdhd.GetLanguage())
+}
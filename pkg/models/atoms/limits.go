@@ -0,0 +1,135 @@
+package atoms
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"sync/atomic"
+)
+
+// Limits bound the resources spent on the sizes and counts read from a file, so that a crafted or
+// corrupt file cannot make the parser allocate gigabytes or recurse without end
+type Limits struct {
+	// MaxAtomSize is the largest atom read into memory, in bytes
+	MaxAtomSize int64
+	// MaxEntryCount is the largest entry count of a table, e.g. the sample count of a 'stsz' atom
+	MaxEntryCount uint32
+	// MaxDepth is the deepest nesting of composite atoms
+	MaxDepth int
+	// MaxTotalAllocation is the largest number of bytes held in memory for the atoms of one tree, and
+	// separately for the sample index built from them
+	MaxTotalAllocation int64
+}
+
+// DefaultLimits are the limits in effect until SetLimits is called. They leave room for the
+// metadata of feature length movies.
+var DefaultLimits = Limits{
+	MaxAtomSize:        256 << 20,
+	MaxEntryCount:      1 << 24,
+	MaxDepth:           64,
+	MaxTotalAllocation: 1 << 30,
+}
+
+// limits holds the limits in effect
+var limits atomic.Pointer[Limits]
+
+// SetLimits replaces the limits in effect. Limits which are zero or negative keep their default.
+func SetLimits(l Limits) {
+	if l.MaxAtomSize <= 0 {
+		l.MaxAtomSize = DefaultLimits.MaxAtomSize
+	}
+	if l.MaxEntryCount == 0 {
+		l.MaxEntryCount = DefaultLimits.MaxEntryCount
+	}
+	if l.MaxDepth <= 0 {
+		l.MaxDepth = DefaultLimits.MaxDepth
+	}
+	if l.MaxTotalAllocation <= 0 {
+		l.MaxTotalAllocation = DefaultLimits.MaxTotalAllocation
+	}
+	limits.Store(&l)
+}
+
+// CurrentLimits returns the limits in effect
+func CurrentLimits() Limits {
+	if l := limits.Load(); l != nil {
+		return *l
+	}
+	return DefaultLimits
+}
+
+// ErrLimitExceeded matches every LimitError with errors.Is
+var ErrLimitExceeded = errors.New("limit exceeded")
+
+// LimitError reports a size or count read from a file which exceeds a limit, either one of the
+// configured Limits or what the remaining data can hold
+type LimitError struct {
+	// What names the value, e.g. 'stsz sample count'
+	What  string
+	Value uint64
+	Limit uint64
+	// Remaining is set when the limit is what the remaining data can hold rather than a configured limit
+	Remaining bool
+}
+
+// Error describes the exceeded limit
+func (e *LimitError) Error() string {
+	if e.Remaining {
+		return fmt.Sprintf("%s %d exceeds the %d the remaining data can hold", e.What, e.Value, e.Limit)
+	}
+	return fmt.Sprintf("%s %d exceeds the limit of %d", e.What, e.Value, e.Limit)
+}
+
+// Is makes errors.Is match the error with ErrLimitExceeded
+func (e *LimitError) Is(target error) bool {
+	return target == ErrLimitExceeded
+}
+
+// CheckSize checks a size read from a file against the given limit
+func CheckSize(what string, size uint64, limit int64) error {
+	if size > uint64(max(limit, 0)) {
+		return &LimitError{What: what, Value: size, Limit: uint64(max(limit, 0))}
+	}
+	return nil
+}
+
+// Budget accounts for the memory held for the data of one file, like the atoms of its tree or the
+// sample index built from them, against a total allocation limit
+type Budget struct {
+	limit     int64
+	allocated uint64
+}
+
+// NewBudget returns an empty budget of the given limit, usually the MaxTotalAllocation in effect
+func NewBudget(limit int64) *Budget {
+	return &Budget{limit: limit}
+}
+
+// Charge accounts for count items of the given size held for the named data. It fails without charging
+// anything once the total would exceed the limit. A nil budget charges nothing.
+func (b *Budget) Charge(what string, count uint64, size uintptr) error {
+	if b == nil {
+		return nil
+	}
+	total := b.allocated + count*uint64(size)
+	if count != 0 && (total-b.allocated)/count != uint64(size) || total < b.allocated {
+		total = math.MaxUint64
+	}
+	if err := CheckSize("total allocation", total, b.limit); err != nil {
+		return fmt.Errorf("%s: %w", what, err)
+	}
+	b.allocated = total
+	return nil
+}
+
+// checkCount checks an entry count read from an atom against the entry count limit and against the
+// remaining bytes, of which every entry takes at least entrySize
+func checkCount(what string, count uint32, entrySize int, remaining int) error {
+	if limit := CurrentLimits().MaxEntryCount; count > limit {
+		return &LimitError{What: what, Value: uint64(count), Limit: uint64(limit)}
+	}
+	if entrySize > 0 && uint64(count)*uint64(entrySize) > uint64(max(remaining, 0)) {
+		return &LimitError{What: what, Value: uint64(count), Limit: uint64(max(remaining, 0) / entrySize), Remaining: true}
+	}
+	return nil
+}
@@ -0,0 +1,48 @@
+package atoms
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// TestParseStsdAtomLimits tests that the entry count of an 'stsd' atom is checked against its bytes and
+// that a huge entry size only keeps the bytes there are
+func TestParseStsdAtomLimits(t *testing.T) {
+	_, err := ParseStsdAtom(bytes.NewReader([]byte{0, 0, 0, 0, 0, 0, 0, 2, 0, 0, 0, 16}))
+	var limitErr *LimitError
+	assert.True(t, errors.As(err, &limitErr), "Expected a limit error, got %v", err)
+	assert.Equal(t, &LimitError{What: "sample entry count", Value: 2, Limit: 0, Remaining: true}, limitErr)
+
+	data := []byte{
+		0x00, 0x00, 0x00, 0x00, // Version, flags
+		0x00, 0x00, 0x00, 0x01, // Entry count
+		0xFF, 0xFF, 0xFF, 0xF0, // Entry size of almost 4GB
+		'm', 'p', '4', 'a',
+		0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x01,
+		0x01, 0x02, 0x03, 0x04,
+	}
+	stsd, err := ParseStsdAtom(bytes.NewReader(data))
+	assert.NoError(t, err)
+	assert.Equal(t, []byte{1, 2, 3, 4}, stsd.SampleEntries[0].Data)
+}
+
+// TestSetLimits tests that the configured entry count limit applies and that unset limits keep their default
+func TestSetLimits(t *testing.T) {
+	t.Cleanup(func() { SetLimits(DefaultLimits) })
+	SetLimits(Limits{MaxEntryCount: 2})
+	assert.Equal(t, DefaultLimits.MaxAtomSize, CurrentLimits().MaxAtomSize)
+	assert.Equal(t, uint32(2), CurrentLimits().MaxEntryCount)
+
+	// A time-to-sample table of three entries
+	stts := []byte{0, 0, 0, 0, 0, 0, 0, 3, 0, 0, 0, 1, 0, 0, 0, 1, 0, 0, 0, 1, 0, 0, 0, 1, 0, 0, 0, 1, 0, 0, 0, 1}
+	_, err := ParseSttsAtom(bytes.NewReader(stts))
+	assert.True(t, errors.Is(err, ErrLimitExceeded))
+	assert.EqualError(t, err, "entry count 3 exceeds the limit of 2")
+
+	SetLimits(DefaultLimits)
+	_, err = ParseSttsAtom(bytes.NewReader(stts))
+	assert.NoError(t, err)
+}
@@ -0,0 +1,93 @@
+package atoms
+
+import (
+	"encoding/binary"
+	"math"
+)
+
+// Matrix is the 3x3 transformation matrix stored in the 'tkhd' and 'mvhd' atoms.
+// The a, b, c, d, x and y components are 16.16 fixed-point values, u, v and w are 2.30 fixed-point values.
+// A point (x, y) is displayed at (a*x + c*y + tx, b*x + d*y + ty).
+type Matrix struct {
+	A, B, U float64
+	C, D, V float64
+	X, Y, W float64
+}
+
+// Transform describes the orientation change applied by a matrix
+type Transform struct {
+	Rotation       int
+	HorizontalFlip bool
+	VerticalFlip   bool
+}
+
+// IdentityMatrix is the matrix applying no transformation
+var IdentityMatrix = Matrix{A: 1, D: 1, W: 1}
+
+// DecodeMatrix decodes the raw 36 bytes of a matrix
+func DecodeMatrix(raw [36]byte) Matrix {
+	value := func(index int, fractionBits uint) float64 {
+		return float64(int32(binary.BigEndian.Uint32(raw[index*4:]))) / float64(uint32(1)<<fractionBits)
+	}
+	return Matrix{
+		A: value(0, 16), B: value(1, 16), U: value(2, 30),
+		C: value(3, 16), D: value(4, 16), V: value(5, 30),
+		X: value(6, 16), Y: value(7, 16), W: value(8, 30),
+	}
+}
+
+// Encode encodes the matrix back into its raw 36 bytes
+func (m Matrix) Encode() [36]byte {
+	var raw [36]byte
+	values := []struct {
+		value        float64
+		fractionBits uint
+	}{
+		{m.A, 16}, {m.B, 16}, {m.U, 30},
+		{m.C, 16}, {m.D, 16}, {m.V, 30},
+		{m.X, 16}, {m.Y, 16}, {m.W, 30},
+	}
+	for i, v := range values {
+		binary.BigEndian.PutUint32(raw[i*4:], uint32(int32(math.Round(v.value*float64(uint32(1)<<v.fractionBits)))))
+	}
+	return raw
+}
+
+// IsFlipped reports whether the matrix mirrors the image
+func (m Matrix) IsFlipped() bool {
+	return m.A*m.D-m.B*m.C < 0
+}
+
+// Rotation returns the clockwise rotation in degrees in the range [0, 360), ignoring any flip
+func (m Matrix) Rotation() float64 {
+	a, b := m.A, m.B
+	if m.IsFlipped() {
+		a, b = -a, -b
+	}
+	degrees := math.Atan2(b, a) * 180 / math.Pi
+	if degrees < 0 {
+		degrees += 360
+	}
+	return degrees
+}
+
+// GetTransform returns the rotation rounded to a multiple of 90 degrees and the flips applied by the matrix.
+// A horizontal flip combined with a rotation of 180 degrees is reported as a vertical flip.
+func (m Matrix) GetTransform() Transform {
+	rotation := int(math.Round(m.Rotation()/90)) * 90 % 360
+	transform := Transform{Rotation: rotation}
+	if m.IsFlipped() {
+		if rotation == 180 {
+			transform.Rotation = 0
+			transform.VerticalFlip = true
+		} else {
+			transform.HorizontalFlip = true
+		}
+	}
+	return transform
+}
+
+// DisplaySize returns the size of the bounding box of a width x height rectangle after the transformation
+func (m Matrix) DisplaySize(width, height float64) (float64, float64) {
+	return math.Abs(m.A*width) + math.Abs(m.C*height), math.Abs(m.B*width) + math.Abs(m.D*height)
+}
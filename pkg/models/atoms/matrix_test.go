@@ -0,0 +1,45 @@
+package atoms
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// TestDecodeMatrix tests decoding and orientation detection of display matrices
+func TestDecodeMatrix(t *testing.T) {
+	tests := []struct {
+		name          string
+		matrix        Matrix
+		transform     Transform
+		displayWidth  float64
+		displayHeight float64
+	}{
+		{"identity", IdentityMatrix, Transform{}, 1920, 1080},
+		{"rotate 90", Matrix{B: 1, C: -1, X: 1080, W: 1}, Transform{Rotation: 90}, 1080, 1920},
+		{"rotate 180", Matrix{A: -1, D: -1, X: 1920, Y: 1080, W: 1}, Transform{Rotation: 180}, 1920, 1080},
+		{"rotate 270", Matrix{B: -1, C: 1, Y: 1920, W: 1}, Transform{Rotation: 270}, 1080, 1920},
+		{"horizontal flip", Matrix{A: -1, D: 1, X: 1920, W: 1}, Transform{HorizontalFlip: true}, 1920, 1080},
+		{"vertical flip", Matrix{A: 1, D: -1, Y: 1080, W: 1}, Transform{VerticalFlip: true}, 1920, 1080},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			decoded := DecodeMatrix(tt.matrix.Encode())
+			assert.Equal(t, tt.matrix, decoded, "Expected matrix to survive encoding")
+			assert.Equal(t, tt.transform, decoded.GetTransform())
+			width, height := decoded.DisplaySize(1920, 1080)
+			assert.InDelta(t, tt.displayWidth, width, 1e-9)
+			assert.InDelta(t, tt.displayHeight, height, 1e-9)
+		})
+	}
+}
+
+// TestTkhdGetMatrix tests that a zeroed matrix is treated as identity
+func TestTkhdGetMatrix(t *testing.T) {
+	tkhd := &TkhdAtom{}
+	assert.Equal(t, IdentityMatrix, tkhd.GetMatrix())
+
+	tkhd.Matrix = Matrix{B: 1, C: -1, X: 1080, W: 1}.Encode()
+	assert.Equal(t, 90, tkhd.GetMatrix().GetTransform().Rotation)
+}
@@ -1,12 +1,85 @@
 package atoms
 
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+)
+
+// MdhdAtom represents the 'mdhd' media header atom. Version 1 atoms store times and duration as 64-bit values.
 type MdhdAtom struct {
 	Version          uint8
 	Flags            [3]byte
-	CreationTime     uint32
-	ModificationTime uint32
+	CreationTime     uint64
+	ModificationTime uint64
 	TimeScale        uint32
-	Duration         uint32
+	Duration         uint64
 	Language         uint16
 	Quality          uint16
 }
+
+// ParseMdhdAtom parses the 'mdhd' atom in both its 32-bit and 64-bit versions
+func ParseMdhdAtom(reader io.Reader) (*MdhdAtom, error) {
+	var mdhd MdhdAtom
+
+	if err := binary.Read(reader, binary.BigEndian, &mdhd.Version); err != nil {
+		return nil, fmt.Errorf("error reading version: %w", err)
+	}
+	if _, err := io.ReadFull(reader, mdhd.Flags[:]); err != nil {
+		return nil, fmt.Errorf("error reading flags: %w", err)
+	}
+
+	if mdhd.Version == 1 {
+		var times struct {
+			CreationTime     uint64
+			ModificationTime uint64
+			TimeScale        uint32
+			Duration         uint64
+		}
+		if err := binary.Read(reader, binary.BigEndian, &times); err != nil {
+			return nil, fmt.Errorf("error reading times: %w", err)
+		}
+		mdhd.CreationTime, mdhd.ModificationTime = times.CreationTime, times.ModificationTime
+		mdhd.TimeScale, mdhd.Duration = times.TimeScale, times.Duration
+	} else {
+		var times struct {
+			CreationTime     uint32
+			ModificationTime uint32
+			TimeScale        uint32
+			Duration         uint32
+		}
+		if err := binary.Read(reader, binary.BigEndian, &times); err != nil {
+			return nil, fmt.Errorf("error reading times: %w", err)
+		}
+		mdhd.CreationTime, mdhd.ModificationTime = uint64(times.CreationTime), uint64(times.ModificationTime)
+		mdhd.TimeScale, mdhd.Duration = times.TimeScale, uint64(times.Duration)
+	}
+
+	if err := binary.Read(reader, binary.BigEndian, &mdhd.Language); err != nil {
+		return nil, fmt.Errorf("error reading language: %w", err)
+	}
+	if err := binary.Read(reader, binary.BigEndian, &mdhd.Quality); err != nil {
+		return nil, fmt.Errorf("error reading quality: %w", err)
+	}
+
+	return &mdhd, nil
+}
+
+// GetLanguage returns the decoded ISO-639-2/T language of the media
+func (m *MdhdAtom) GetLanguage() string {
+	return DecodeLanguage(m.Language)
+}
+
+// Encode writes the 'mdhd' atom in the version it was read with
+func (m *MdhdAtom) Encode() ([]byte, error) {
+	if err := checkHeaderTimes(m.Version, m.CreationTime, m.ModificationTime, m.Duration); err != nil {
+		return nil, err
+	}
+	data := appendFullAtomHeader(make([]byte, 0, 36), m.Version, m.Flags)
+	data = appendVersionedTime(data, m.Version, m.CreationTime)
+	data = appendVersionedTime(data, m.Version, m.ModificationTime)
+	data = binary.BigEndian.AppendUint32(data, m.TimeScale)
+	data = appendVersionedTime(data, m.Version, m.Duration)
+	data = binary.BigEndian.AppendUint16(data, m.Language)
+	return binary.BigEndian.AppendUint16(data, m.Quality), nil
+}
@@ -0,0 +1,109 @@
+package atoms
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+)
+
+// MvhdAtom represents the 'mvhd' movie header atom. Version 1 atoms store times and duration as 64-bit values.
+type MvhdAtom struct {
+	Version           uint8
+	Flags             [3]byte
+	CreationTime      uint64
+	ModificationTime  uint64
+	TimeScale         uint32
+	Duration          uint64
+	PreferredRate     uint32
+	PreferredVolume   uint16
+	Reserved          [10]byte
+	Matrix            [36]byte
+	PreviewTime       uint32
+	PreviewDuration   uint32
+	PosterTime        uint32
+	SelectionTime     uint32
+	SelectionDuration uint32
+	CurrentTime       uint32
+	NextTrackID       uint32
+}
+
+// ParseMvhdAtom parses the 'mvhd' atom in both its 32-bit and 64-bit versions
+func ParseMvhdAtom(reader io.Reader) (*MvhdAtom, error) {
+	var mvhd MvhdAtom
+
+	if err := binary.Read(reader, binary.BigEndian, &mvhd.Version); err != nil {
+		return nil, fmt.Errorf("error reading version: %w", err)
+	}
+	if _, err := io.ReadFull(reader, mvhd.Flags[:]); err != nil {
+		return nil, fmt.Errorf("error reading flags: %w", err)
+	}
+
+	if mvhd.Version == 1 {
+		var times struct {
+			CreationTime     uint64
+			ModificationTime uint64
+			TimeScale        uint32
+			Duration         uint64
+		}
+		if err := binary.Read(reader, binary.BigEndian, &times); err != nil {
+			return nil, fmt.Errorf("error reading times: %w", err)
+		}
+		mvhd.CreationTime, mvhd.ModificationTime = times.CreationTime, times.ModificationTime
+		mvhd.TimeScale, mvhd.Duration = times.TimeScale, times.Duration
+	} else {
+		var times struct {
+			CreationTime     uint32
+			ModificationTime uint32
+			TimeScale        uint32
+			Duration         uint32
+		}
+		if err := binary.Read(reader, binary.BigEndian, &times); err != nil {
+			return nil, fmt.Errorf("error reading times: %w", err)
+		}
+		mvhd.CreationTime, mvhd.ModificationTime = uint64(times.CreationTime), uint64(times.ModificationTime)
+		mvhd.TimeScale, mvhd.Duration = times.TimeScale, uint64(times.Duration)
+	}
+
+	var rest struct {
+		PreferredRate     uint32
+		PreferredVolume   uint16
+		Reserved          [10]byte
+		Matrix            [36]byte
+		PreviewTime       uint32
+		PreviewDuration   uint32
+		PosterTime        uint32
+		SelectionTime     uint32
+		SelectionDuration uint32
+		CurrentTime       uint32
+		NextTrackID       uint32
+	}
+	if err := binary.Read(reader, binary.BigEndian, &rest); err != nil {
+		return nil, fmt.Errorf("error reading movie properties: %w", err)
+	}
+	mvhd.PreferredRate, mvhd.PreferredVolume, mvhd.Reserved = rest.PreferredRate, rest.PreferredVolume, rest.Reserved
+	mvhd.Matrix, mvhd.PreviewTime, mvhd.PreviewDuration = rest.Matrix, rest.PreviewTime, rest.PreviewDuration
+	mvhd.PosterTime, mvhd.SelectionTime, mvhd.SelectionDuration = rest.PosterTime, rest.SelectionTime, rest.SelectionDuration
+	mvhd.CurrentTime, mvhd.NextTrackID = rest.CurrentTime, rest.NextTrackID
+
+	return &mvhd, nil
+}
+
+// Encode writes the 'mvhd' atom in the version it was read with
+func (m *MvhdAtom) Encode() ([]byte, error) {
+	if err := checkHeaderTimes(m.Version, m.CreationTime, m.ModificationTime, m.Duration); err != nil {
+		return nil, err
+	}
+	data := appendFullAtomHeader(make([]byte, 0, 112), m.Version, m.Flags)
+	data = appendVersionedTime(data, m.Version, m.CreationTime)
+	data = appendVersionedTime(data, m.Version, m.ModificationTime)
+	data = binary.BigEndian.AppendUint32(data, m.TimeScale)
+	data = appendVersionedTime(data, m.Version, m.Duration)
+	data = binary.BigEndian.AppendUint32(data, m.PreferredRate)
+	data = binary.BigEndian.AppendUint16(data, m.PreferredVolume)
+	data = append(data, m.Reserved[:]...)
+	data = append(data, m.Matrix[:]...)
+	for _, value := range []uint32{m.PreviewTime, m.PreviewDuration, m.PosterTime, m.SelectionTime, m.SelectionDuration, m.CurrentTime, m.NextTrackID} {
+		data = binary.BigEndian.AppendUint32(data, value)
+	}
+	return data, nil
+}
@@ -0,0 +1,311 @@
+package atoms
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+)
+
+// TimeToSampleEntry is an entry of the 'stts' atom
+type TimeToSampleEntry struct {
+	SampleCount    uint32
+	SampleDuration uint32
+}
+
+// SttsAtom represents the 'stts' decoding time-to-sample atom
+type SttsAtom struct {
+	Version    uint8
+	Flags      [3]byte
+	EntryCount uint32
+	Entries    []TimeToSampleEntry
+}
+
+// CompositionOffsetEntry is an entry of the 'ctts' atom. Version 1 atoms store signed offsets.
+type CompositionOffsetEntry struct {
+	SampleCount  uint32
+	SampleOffset int32
+}
+
+// CttsAtom represents the 'ctts' composition time-to-sample atom
+type CttsAtom struct {
+	Version    uint8
+	Flags      [3]byte
+	EntryCount uint32
+	Entries    []CompositionOffsetEntry
+}
+
+// SampleToChunkEntry is an entry of the 'stsc' atom
+type SampleToChunkEntry struct {
+	FirstChunk             uint32
+	SamplesPerChunk        uint32
+	SampleDescriptionIndex uint32
+}
+
+// StscAtom represents the 'stsc' sample-to-chunk atom
+type StscAtom struct {
+	Version    uint8
+	Flags      [3]byte
+	EntryCount uint32
+	Entries    []SampleToChunkEntry
+}
+
+// StszAtom represents the 'stsz' sample size atom. When SampleSize is not zero all samples have that size
+// and EntrySizes is empty.
+type StszAtom struct {
+	Version     uint8
+	Flags       [3]byte
+	SampleSize  uint32
+	SampleCount uint32
+	EntrySizes  []uint32
+}
+
+// ChunkOffsetAtom represents both the 'stco' and the 'co64' chunk offset atoms
+type ChunkOffsetAtom struct {
+	Version    uint8
+	Flags      [3]byte
+	EntryCount uint32
+	Offsets    []uint64
+	Is64Bit    bool
+}
+
+// StssAtom represents the 'stss' sync sample atom
+type StssAtom struct {
+	Version       uint8
+	Flags         [3]byte
+	EntryCount    uint32
+	SampleNumbers []uint32
+}
+
+// readTable reads the version, flags and entry count of a table atom and returns the bytes of its
+// entries, checking that they hold entryCount entries of entrySize bytes.
+func readTable(reader io.Reader, version *uint8, flags *[3]byte, entryCount *uint32, entrySize int) ([]byte, error) {
+	if err := binary.Read(reader, binary.BigEndian, version); err != nil {
+		return nil, fmt.Errorf("error reading version: %w", err)
+	}
+	if _, err := io.ReadFull(reader, flags[:]); err != nil {
+		return nil, fmt.Errorf("error reading flags: %w", err)
+	}
+	if err := binary.Read(reader, binary.BigEndian, entryCount); err != nil {
+		return nil, fmt.Errorf("error reading entry count: %w", err)
+	}
+	data, err := io.ReadAll(reader)
+	if err != nil {
+		return nil, fmt.Errorf("error reading entries: %w", err)
+	}
+	if err := checkCount("entry count", *entryCount, entrySize, len(data)); err != nil {
+		return nil, err
+	}
+	return data, nil
+}
+
+// ParseSttsAtom parses the 'stts' atom
+func ParseSttsAtom(reader io.Reader) (*SttsAtom, error) {
+	var stts SttsAtom
+	data, err := readTable(reader, &stts.Version, &stts.Flags, &stts.EntryCount, 8)
+	if err != nil {
+		return nil, err
+	}
+	stts.Entries = make([]TimeToSampleEntry, stts.EntryCount)
+	for i := range stts.Entries {
+		stts.Entries[i] = TimeToSampleEntry{
+			SampleCount:    binary.BigEndian.Uint32(data[i*8:]),
+			SampleDuration: binary.BigEndian.Uint32(data[i*8+4:]),
+		}
+	}
+	return &stts, nil
+}
+
+// ParseCttsAtom parses the 'ctts' atom
+func ParseCttsAtom(reader io.Reader) (*CttsAtom, error) {
+	var ctts CttsAtom
+	data, err := readTable(reader, &ctts.Version, &ctts.Flags, &ctts.EntryCount, 8)
+	if err != nil {
+		return nil, err
+	}
+	ctts.Entries = make([]CompositionOffsetEntry, ctts.EntryCount)
+	for i := range ctts.Entries {
+		ctts.Entries[i] = CompositionOffsetEntry{
+			SampleCount:  binary.BigEndian.Uint32(data[i*8:]),
+			SampleOffset: int32(binary.BigEndian.Uint32(data[i*8+4:])),
+		}
+	}
+	return &ctts, nil
+}
+
+// ParseStscAtom parses the 'stsc' atom
+func ParseStscAtom(reader io.Reader) (*StscAtom, error) {
+	var stsc StscAtom
+	data, err := readTable(reader, &stsc.Version, &stsc.Flags, &stsc.EntryCount, 12)
+	if err != nil {
+		return nil, err
+	}
+	stsc.Entries = make([]SampleToChunkEntry, stsc.EntryCount)
+	for i := range stsc.Entries {
+		stsc.Entries[i] = SampleToChunkEntry{
+			FirstChunk:             binary.BigEndian.Uint32(data[i*12:]),
+			SamplesPerChunk:        binary.BigEndian.Uint32(data[i*12+4:]),
+			SampleDescriptionIndex: binary.BigEndian.Uint32(data[i*12+8:]),
+		}
+	}
+	return &stsc, nil
+}
+
+// ParseStszAtom parses the 'stsz' atom
+func ParseStszAtom(reader io.Reader) (*StszAtom, error) {
+	var stsz StszAtom
+	if err := binary.Read(reader, binary.BigEndian, &stsz.Version); err != nil {
+		return nil, fmt.Errorf("error reading version: %w", err)
+	}
+	if _, err := io.ReadFull(reader, stsz.Flags[:]); err != nil {
+		return nil, fmt.Errorf("error reading flags: %w", err)
+	}
+	if err := binary.Read(reader, binary.BigEndian, &stsz.SampleSize); err != nil {
+		return nil, fmt.Errorf("error reading sample size: %w", err)
+	}
+	if err := binary.Read(reader, binary.BigEndian, &stsz.SampleCount); err != nil {
+		return nil, fmt.Errorf("error reading sample count: %w", err)
+	}
+	if stsz.SampleSize != 0 {
+		return &stsz, nil
+	}
+
+	data, err := io.ReadAll(reader)
+	if err != nil {
+		return nil, fmt.Errorf("error reading sample sizes: %w", err)
+	}
+	if err := checkCount("sample count", stsz.SampleCount, 4, len(data)); err != nil {
+		return nil, err
+	}
+	stsz.EntrySizes = make([]uint32, stsz.SampleCount)
+	for i := range stsz.EntrySizes {
+		stsz.EntrySizes[i] = binary.BigEndian.Uint32(data[i*4:])
+	}
+	return &stsz, nil
+}
+
+// GetSampleSize returns the size of the sample with the 0-based index
+func (s *StszAtom) GetSampleSize(index int) uint32 {
+	if s.SampleSize != 0 {
+		return s.SampleSize
+	}
+	return s.EntrySizes[index]
+}
+
+// ParseChunkOffsetAtom parses the 'stco' atom or, if is64Bit is set, the 'co64' atom
+func ParseChunkOffsetAtom(reader io.Reader, is64Bit bool) (*ChunkOffsetAtom, error) {
+	chunkOffset := ChunkOffsetAtom{Is64Bit: is64Bit}
+	entrySize := 4
+	if is64Bit {
+		entrySize = 8
+	}
+	data, err := readTable(reader, &chunkOffset.Version, &chunkOffset.Flags, &chunkOffset.EntryCount, entrySize)
+	if err != nil {
+		return nil, err
+	}
+	chunkOffset.Offsets = make([]uint64, chunkOffset.EntryCount)
+	for i := range chunkOffset.Offsets {
+		if is64Bit {
+			chunkOffset.Offsets[i] = binary.BigEndian.Uint64(data[i*8:])
+		} else {
+			chunkOffset.Offsets[i] = uint64(binary.BigEndian.Uint32(data[i*4:]))
+		}
+	}
+	return &chunkOffset, nil
+}
+
+// ParseStssAtom parses the 'stss' atom
+func ParseStssAtom(reader io.Reader) (*StssAtom, error) {
+	var stss StssAtom
+	data, err := readTable(reader, &stss.Version, &stss.Flags, &stss.EntryCount, 4)
+	if err != nil {
+		return nil, err
+	}
+	stss.SampleNumbers = make([]uint32, stss.EntryCount)
+	for i := range stss.SampleNumbers {
+		stss.SampleNumbers[i] = binary.BigEndian.Uint32(data[i*4:])
+	}
+	return &stss, nil
+}
+
+// Encode writes the 'stts' atom
+func (s *SttsAtom) Encode() ([]byte, error) {
+	data := appendFullAtomHeader(make([]byte, 0, 8+len(s.Entries)*8), s.Version, s.Flags)
+	data = binary.BigEndian.AppendUint32(data, uint32(len(s.Entries)))
+	for _, entry := range s.Entries {
+		data = binary.BigEndian.AppendUint32(data, entry.SampleCount)
+		data = binary.BigEndian.AppendUint32(data, entry.SampleDuration)
+	}
+	return data, nil
+}
+
+// Encode writes the 'ctts' atom
+func (c *CttsAtom) Encode() ([]byte, error) {
+	data := appendFullAtomHeader(make([]byte, 0, 8+len(c.Entries)*8), c.Version, c.Flags)
+	data = binary.BigEndian.AppendUint32(data, uint32(len(c.Entries)))
+	for _, entry := range c.Entries {
+		data = binary.BigEndian.AppendUint32(data, entry.SampleCount)
+		data = binary.BigEndian.AppendUint32(data, uint32(entry.SampleOffset))
+	}
+	return data, nil
+}
+
+// Encode writes the 'stsc' atom
+func (s *StscAtom) Encode() ([]byte, error) {
+	data := appendFullAtomHeader(make([]byte, 0, 8+len(s.Entries)*12), s.Version, s.Flags)
+	data = binary.BigEndian.AppendUint32(data, uint32(len(s.Entries)))
+	for _, entry := range s.Entries {
+		data = binary.BigEndian.AppendUint32(data, entry.FirstChunk)
+		data = binary.BigEndian.AppendUint32(data, entry.SamplesPerChunk)
+		data = binary.BigEndian.AppendUint32(data, entry.SampleDescriptionIndex)
+	}
+	return data, nil
+}
+
+// Encode writes the 'stsz' atom. The sample count is taken from EntrySizes unless all samples have the same size.
+func (s *StszAtom) Encode() ([]byte, error) {
+	data := appendFullAtomHeader(make([]byte, 0, 12+len(s.EntrySizes)*4), s.Version, s.Flags)
+	data = binary.BigEndian.AppendUint32(data, s.SampleSize)
+	if s.SampleSize != 0 {
+		return binary.BigEndian.AppendUint32(data, s.SampleCount), nil
+	}
+	data = binary.BigEndian.AppendUint32(data, uint32(len(s.EntrySizes)))
+	for _, size := range s.EntrySizes {
+		data = binary.BigEndian.AppendUint32(data, size)
+	}
+	return data, nil
+}
+
+// Encode writes the 'stco' atom or, if Is64Bit is set, the 'co64' atom
+func (c *ChunkOffsetAtom) Encode() ([]byte, error) {
+	data := appendFullAtomHeader(make([]byte, 0, 8+len(c.Offsets)*8), c.Version, c.Flags)
+	data = binary.BigEndian.AppendUint32(data, uint32(len(c.Offsets)))
+	for _, offset := range c.Offsets {
+		if c.Is64Bit {
+			data = binary.BigEndian.AppendUint64(data, offset)
+			continue
+		}
+		if offset > 0xFFFFFFFF {
+			return nil, fmt.Errorf("chunk offset %d does not fit a 'stco' atom", offset)
+		}
+		data = binary.BigEndian.AppendUint32(data, uint32(offset))
+	}
+	return data, nil
+}
+
+// GetType returns the type of the atom holding the offsets, 'co64' or 'stco'
+func (c *ChunkOffsetAtom) GetType() string {
+	if c.Is64Bit {
+		return "co64"
+	}
+	return "stco"
+}
+
+// Encode writes the 'stss' atom
+func (s *StssAtom) Encode() ([]byte, error) {
+	data := appendFullAtomHeader(make([]byte, 0, 8+len(s.SampleNumbers)*4), s.Version, s.Flags)
+	data = binary.BigEndian.AppendUint32(data, uint32(len(s.SampleNumbers)))
+	for _, number := range s.SampleNumbers {
+		data = binary.BigEndian.AppendUint32(data, number)
+	}
+	return data, nil
+}
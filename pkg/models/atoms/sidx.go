@@ -0,0 +1,296 @@
+package atoms
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+)
+
+// SegmentReference is a reference of a segment index to either media or another 'sidx' atom
+type SegmentReference struct {
+	ReferenceType      uint8
+	ReferencedSize     uint32
+	SubsegmentDuration uint32
+	StartsWithSAP      bool
+	SAPType            uint8
+	SAPDeltaTime       uint32
+}
+
+// IsIndexReference tells whether the reference points to another 'sidx' atom instead of media
+func (s SegmentReference) IsIndexReference() bool {
+	return s.ReferenceType == 1
+}
+
+// SidxAtom represents the 'sidx' segment index atom
+type SidxAtom struct {
+	Version                  uint8
+	Flags                    [3]byte
+	ReferenceID              uint32
+	TimeScale                uint32
+	EarliestPresentationTime uint64
+	FirstOffset              uint64
+	Reserved                 uint16
+	ReferenceCount           uint16
+	References               []SegmentReference
+}
+
+// ParseSidxAtom parses the 'sidx' atom
+func ParseSidxAtom(reader io.Reader) (*SidxAtom, error) {
+	var sidx SidxAtom
+	if err := readFullAtomHeader(reader, &sidx.Version, &sidx.Flags); err != nil {
+		return nil, err
+	}
+	if err := binary.Read(reader, binary.BigEndian, &sidx.ReferenceID); err != nil {
+		return nil, fmt.Errorf("error reading reference ID: %w", err)
+	}
+	if err := binary.Read(reader, binary.BigEndian, &sidx.TimeScale); err != nil {
+		return nil, fmt.Errorf("error reading time scale: %w", err)
+	}
+	var err error
+	if sidx.EarliestPresentationTime, err = readVersionedTime(reader, sidx.Version); err != nil {
+		return nil, fmt.Errorf("error reading earliest presentation time: %w", err)
+	}
+	if sidx.FirstOffset, err = readVersionedTime(reader, sidx.Version); err != nil {
+		return nil, fmt.Errorf("error reading first offset: %w", err)
+	}
+	if err := binary.Read(reader, binary.BigEndian, &sidx.Reserved); err != nil {
+		return nil, fmt.Errorf("error reading reserved: %w", err)
+	}
+	if err := binary.Read(reader, binary.BigEndian, &sidx.ReferenceCount); err != nil {
+		return nil, fmt.Errorf("error reading reference count: %w", err)
+	}
+
+	data, err := io.ReadAll(reader)
+	if err != nil {
+		return nil, fmt.Errorf("error reading references: %w", err)
+	}
+	if err := checkCount("reference count", uint32(sidx.ReferenceCount), 12, len(data)); err != nil {
+		return nil, err
+	}
+	sidx.References = make([]SegmentReference, sidx.ReferenceCount)
+	for i := range sidx.References {
+		entry := data[i*12:]
+		size := binary.BigEndian.Uint32(entry[0:4])
+		sap := binary.BigEndian.Uint32(entry[8:12])
+		sidx.References[i] = SegmentReference{
+			ReferenceType:      uint8(size >> 31),
+			ReferencedSize:     size & 0x7FFFFFFF,
+			SubsegmentDuration: binary.BigEndian.Uint32(entry[4:8]),
+			StartsWithSAP:      sap>>31 == 1,
+			SAPType:            uint8(sap>>28) & 0x07,
+			SAPDeltaTime:       sap & 0x0FFFFFFF,
+		}
+	}
+	return &sidx, nil
+}
+
+// GetDuration returns the sum of the subsegment durations in the time scale of the index
+func (s *SidxAtom) GetDuration() uint64 {
+	var duration uint64
+	for _, reference := range s.References {
+		duration += uint64(reference.SubsegmentDuration)
+	}
+	return duration
+}
+
+// Encode writes the 'sidx' atom. The reference count is taken from References.
+func (s *SidxAtom) Encode() ([]byte, error) {
+	if err := checkHeaderTimes(s.Version, s.EarliestPresentationTime, s.FirstOffset, 0); err != nil {
+		return nil, err
+	}
+	data := appendFullAtomHeader(make([]byte, 0, 32+len(s.References)*12), s.Version, s.Flags)
+	data = binary.BigEndian.AppendUint32(data, s.ReferenceID)
+	data = binary.BigEndian.AppendUint32(data, s.TimeScale)
+	data = appendVersionedTime(data, s.Version, s.EarliestPresentationTime)
+	data = appendVersionedTime(data, s.Version, s.FirstOffset)
+	data = binary.BigEndian.AppendUint16(data, s.Reserved)
+	data = binary.BigEndian.AppendUint16(data, uint16(len(s.References)))
+	for _, reference := range s.References {
+		data = binary.BigEndian.AppendUint32(data, uint32(reference.ReferenceType)<<31|reference.ReferencedSize&0x7FFFFFFF)
+		data = binary.BigEndian.AppendUint32(data, reference.SubsegmentDuration)
+		sap := uint32(reference.SAPType&0x07)<<28 | reference.SAPDeltaTime&0x0FFFFFFF
+		if reference.StartsWithSAP {
+			sap |= 1 << 31
+		}
+		data = binary.BigEndian.AppendUint32(data, sap)
+	}
+	return data, nil
+}
+
+// TrackFragmentRandomAccessEntry is a random access point of a track listed in a 'tfra' atom
+type TrackFragmentRandomAccessEntry struct {
+	Time         uint64
+	MoofOffset   uint64
+	TrafNumber   uint32
+	TrunNumber   uint32
+	SampleNumber uint32
+}
+
+// TfraAtom represents the 'tfra' track fragment random access atom
+type TfraAtom struct {
+	Version     uint8
+	Flags       [3]byte
+	TrackID     uint32
+	LengthSizes uint32
+	EntryCount  uint32
+	Entries     []TrackFragmentRandomAccessEntry
+}
+
+// ParseTfraAtom parses the 'tfra' atom
+func ParseTfraAtom(reader io.Reader) (*TfraAtom, error) {
+	var tfra TfraAtom
+	if err := readFullAtomHeader(reader, &tfra.Version, &tfra.Flags); err != nil {
+		return nil, err
+	}
+	if err := binary.Read(reader, binary.BigEndian, &tfra.TrackID); err != nil {
+		return nil, fmt.Errorf("error reading track ID: %w", err)
+	}
+	if err := binary.Read(reader, binary.BigEndian, &tfra.LengthSizes); err != nil {
+		return nil, fmt.Errorf("error reading length sizes: %w", err)
+	}
+	if err := binary.Read(reader, binary.BigEndian, &tfra.EntryCount); err != nil {
+		return nil, fmt.Errorf("error reading entry count: %w", err)
+	}
+
+	timeSize := 4
+	if tfra.Version == 1 {
+		timeSize = 8
+	}
+	trafSize := int(tfra.LengthSizes>>4&0x03) + 1
+	trunSize := int(tfra.LengthSizes>>2&0x03) + 1
+	sampleSize := int(tfra.LengthSizes&0x03) + 1
+	entrySize := 2*timeSize + trafSize + trunSize + sampleSize
+
+	data, err := io.ReadAll(reader)
+	if err != nil {
+		return nil, fmt.Errorf("error reading entries: %w", err)
+	}
+	if err := checkCount("entry count", tfra.EntryCount, entrySize, len(data)); err != nil {
+		return nil, err
+	}
+
+	tfra.Entries = make([]TrackFragmentRandomAccessEntry, tfra.EntryCount)
+	position := 0
+	next := func(size int) uint64 {
+		var value uint64
+		for _, b := range data[position : position+size] {
+			value = value<<8 | uint64(b)
+		}
+		position += size
+		return value
+	}
+	for i := range tfra.Entries {
+		tfra.Entries[i] = TrackFragmentRandomAccessEntry{
+			Time:         next(timeSize),
+			MoofOffset:   next(timeSize),
+			TrafNumber:   uint32(next(trafSize)),
+			TrunNumber:   uint32(next(trunSize)),
+			SampleNumber: uint32(next(sampleSize)),
+		}
+	}
+	return &tfra, nil
+}
+
+// Encode writes the 'tfra' atom with the field sizes of LengthSizes. The entry count is taken from Entries.
+func (t *TfraAtom) Encode() ([]byte, error) {
+	timeSize := 4
+	if t.Version == 1 {
+		timeSize = 8
+	}
+	sizes := []int{timeSize, timeSize, int(t.LengthSizes>>4&0x03) + 1, int(t.LengthSizes>>2&0x03) + 1, int(t.LengthSizes&0x03) + 1}
+	entrySize := 0
+	for _, size := range sizes {
+		entrySize += size
+	}
+	data := appendFullAtomHeader(make([]byte, 0, 16+len(t.Entries)*entrySize), t.Version, t.Flags)
+	data = binary.BigEndian.AppendUint32(data, t.TrackID)
+	data = binary.BigEndian.AppendUint32(data, t.LengthSizes)
+	data = binary.BigEndian.AppendUint32(data, uint32(len(t.Entries)))
+	for i, entry := range t.Entries {
+		for j, value := range []uint64{entry.Time, entry.MoofOffset, uint64(entry.TrafNumber), uint64(entry.TrunNumber), uint64(entry.SampleNumber)} {
+			if sizes[j] < 8 && value>>(8*sizes[j]) != 0 {
+				return nil, fmt.Errorf("entry %d: value %d does not fit %d bytes", i+1, value, sizes[j])
+			}
+			for shift := 8 * (sizes[j] - 1); shift >= 0; shift -= 8 {
+				data = append(data, byte(value>>shift))
+			}
+		}
+	}
+	return data, nil
+}
+
+// MfroAtom represents the 'mfro' movie fragment random access offset atom holding the size of 'mfra'
+type MfroAtom struct {
+	Version uint8
+	Flags   [3]byte
+	Size    uint32
+}
+
+// SubsegmentRange is a byte range of a subsegment assigned to a level
+type SubsegmentRange struct {
+	Level     uint8
+	RangeSize uint32
+}
+
+// SsixAtom represents the 'ssix' subsegment index atom with the ranges of every subsegment
+type SsixAtom struct {
+	Version         uint8
+	Flags           [3]byte
+	SubsegmentCount uint32
+	Subsegments     [][]SubsegmentRange
+}
+
+// ParseSsixAtom parses the 'ssix' atom
+func ParseSsixAtom(reader io.Reader) (*SsixAtom, error) {
+	var ssix SsixAtom
+	if err := readFullAtomHeader(reader, &ssix.Version, &ssix.Flags); err != nil {
+		return nil, err
+	}
+	if err := binary.Read(reader, binary.BigEndian, &ssix.SubsegmentCount); err != nil {
+		return nil, fmt.Errorf("error reading subsegment count: %w", err)
+	}
+	data, err := io.ReadAll(reader)
+	if err != nil {
+		return nil, fmt.Errorf("error reading subsegments: %w", err)
+	}
+	if err := checkCount("subsegment count", ssix.SubsegmentCount, 4, len(data)); err != nil {
+		return nil, err
+	}
+
+	ssix.Subsegments = make([][]SubsegmentRange, ssix.SubsegmentCount)
+	position := 0
+	for i := range ssix.Subsegments {
+		if len(data)-position < 4 {
+			return nil, fmt.Errorf("subsegment %d is truncated", i+1)
+		}
+		rangeCount := binary.BigEndian.Uint32(data[position:])
+		position += 4
+		if err := checkCount(fmt.Sprintf("range count of subsegment %d", i+1), rangeCount, 4, len(data)-position); err != nil {
+			return nil, err
+		}
+		ranges := make([]SubsegmentRange, rangeCount)
+		for j := range ranges {
+			value := binary.BigEndian.Uint32(data[position:])
+			ranges[j] = SubsegmentRange{Level: uint8(value >> 24), RangeSize: value & 0xFFFFFF}
+			position += 4
+		}
+		ssix.Subsegments[i] = ranges
+	}
+	return &ssix, nil
+}
+
+// Encode writes the 'ssix' atom. The subsegment and range counts are taken from Subsegments.
+func (s *SsixAtom) Encode() ([]byte, error) {
+	data := appendFullAtomHeader(nil, s.Version, s.Flags)
+	data = binary.BigEndian.AppendUint32(data, uint32(len(s.Subsegments)))
+	for i, ranges := range s.Subsegments {
+		data = binary.BigEndian.AppendUint32(data, uint32(len(ranges)))
+		for _, r := range ranges {
+			if r.RangeSize > 0xFFFFFF {
+				return nil, fmt.Errorf("subsegment %d: range size %d exceeds 24 bits", i+1, r.RangeSize)
+			}
+			data = binary.BigEndian.AppendUint32(data, uint32(r.Level)<<24|r.RangeSize)
+		}
+	}
+	return data, nil
+}
@@ -0,0 +1,53 @@
+package atoms
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// TestParseSidxAtom tests decoding a version 1 segment index with a media and an index reference
+func TestParseSidxAtom(t *testing.T) {
+	data := []byte{
+		0x01, 0x00, 0x00, 0x00, // Version 1, flags
+		0x00, 0x00, 0x00, 0x02, // Reference ID
+		0x00, 0x00, 0xAC, 0x44, // Time scale 44100
+		0x00, 0x00, 0x00, 0x01, 0x00, 0x00, 0x00, 0x00, // Earliest presentation time
+		0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x10, // First offset
+		0x00, 0x00, 0x00, 0x02, // Reserved, reference count
+		0x00, 0x00, 0x10, 0x00, 0x00, 0x00, 0xAC, 0x44, 0x90, 0x00, 0x00, 0x00,
+		0x80, 0x00, 0x20, 0x00, 0x00, 0x01, 0x58, 0x88, 0x00, 0x00, 0x00, 0x05,
+	}
+	sidx, err := ParseSidxAtom(bytes.NewReader(data))
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(1)<<32, sidx.EarliestPresentationTime)
+	assert.Equal(t, uint64(16), sidx.FirstOffset)
+	assert.Equal(t, []SegmentReference{
+		{ReferencedSize: 0x1000, SubsegmentDuration: 44100, StartsWithSAP: true, SAPType: 1},
+		{ReferenceType: 1, ReferencedSize: 0x2000, SubsegmentDuration: 88200, SAPDeltaTime: 5},
+	}, sidx.References)
+	assert.True(t, sidx.References[1].IsIndexReference())
+	assert.Equal(t, uint64(132300), sidx.GetDuration())
+
+	_, err = ParseSidxAtom(bytes.NewReader(data[:len(data)-1]))
+	assert.Error(t, err)
+}
+
+// TestParseTfraAtom tests decoding random access entries with mixed field lengths
+func TestParseTfraAtom(t *testing.T) {
+	data := []byte{
+		0x01, 0x00, 0x00, 0x00, // Version 1, flags
+		0x00, 0x00, 0x00, 0x01, // Track ID
+		0x00, 0x00, 0x00, 0x12, // traf number on 2 bytes, trun number on 1 byte, sample number on 3 bytes
+		0x00, 0x00, 0x00, 0x01, // Entry count
+		0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x03, 0xE8,
+		0x00, 0x00, 0x00, 0x01, 0x00, 0x00, 0x00, 0x00,
+		0x00, 0x01, 0x02, 0x00, 0x00, 0x03,
+	}
+	tfra, err := ParseTfraAtom(bytes.NewReader(data))
+	assert.NoError(t, err)
+	assert.Equal(t, []TrackFragmentRandomAccessEntry{
+		{Time: 1000, MoofOffset: 1 << 32, TrafNumber: 1, TrunNumber: 2, SampleNumber: 3},
+	}, tfra.Entries)
+}
@@ -1,6 +1,7 @@
 package atoms
 
 import (
+	"bytes"
 	"encoding/binary"
 	"fmt"
 	"io"
@@ -23,6 +24,8 @@ type SampleEntry struct {
 	Reserved [6]byte
 	RefIndex uint16
 	Data     []byte
+	// Extensions holds the child atoms following the media specific fields, e.g. 'pasp' or 'esds'
+	Extensions AtomIf
 }
 
 // ParseStsdAtom parses the 'stsd' atom and extracts details for audio streams
@@ -39,6 +42,17 @@ func ParseStsdAtom(reader io.Reader) (*AtomStsd, error) {
 		return nil, fmt.Errorf("error reading entry count: %w", err)
 	}
 
+	data, err := io.ReadAll(reader)
+	if err != nil {
+		return nil, fmt.Errorf("error reading sample entries: %w", err)
+	}
+	// Every entry starts with a header of 16 bytes, even a truncated one
+	if err := checkCount("sample entry count", stsd.EntryCount, 16, len(data)); err != nil {
+		return nil, err
+	}
+	entries := bytes.NewReader(data)
+	reader = entries
+
 	stsd.SampleEntries = make([]SampleEntry, stsd.EntryCount)
 	for i := uint32(0); i < stsd.EntryCount; i++ {
 		var entry SampleEntry
@@ -55,12 +69,21 @@ func ParseStsdAtom(reader io.Reader) (*AtomStsd, error) {
 			return nil, fmt.Errorf("error reading data reference index: %w", err)
 		}
 
-		entryHeaderSize := binary.Size(entry.Type) + binary.Size(entry.Reserved) + binary.Size(entry.RefIndex)
-		entrySize := 78 // Default size for simplicity; adjust based on actual data structure
-		entry.Data = make([]byte, entrySize-entryHeaderSize)
-		if _, err := reader.Read(entry.Data); err != nil {
+		entryHeaderSize := binary.Size(entry.Size) + binary.Size(entry.Type) + binary.Size(entry.Reserved) + binary.Size(entry.RefIndex)
+		entrySize := int(binary.BigEndian.Uint32(entry.Size[:]))
+		if entrySize < entryHeaderSize {
+			return nil, fmt.Errorf("invalid sample entry size: %d", entrySize)
+		}
+		// A truncated entry keeps the bytes there are, so it cannot allocate more than the atom holds
+		entry.Data = make([]byte, min(entrySize-entryHeaderSize, entries.Len()))
+		if _, err := io.ReadFull(reader, entry.Data); err != nil {
 			return nil, fmt.Errorf("error reading sample entry data: %w", err)
 		}
+		if len(entry.Data) < entrySize-entryHeaderSize {
+			logrus.Debugf("Sample entry %s truncated: %d of %d bytes", string(entry.Type[:]), len(entry.Data), entrySize-entryHeaderSize)
+			// The size is that of the bytes kept, the one the entry is written back with
+			binary.BigEndian.PutUint32(entry.Size[:], uint32(entryHeaderSize+len(entry.Data)))
+		}
 
 		stsd.SampleEntries[i] = entry
 	}
@@ -68,21 +91,102 @@ func ParseStsdAtom(reader io.Reader) (*AtomStsd, error) {
 	return &stsd, nil
 }
 
+// Encode writes the 'stsd' atom. The entries are written from their Data, so changes to their
+// decoded extensions are not carried over. Sizes and the entry count are recomputed.
+func (s *AtomStsd) Encode() ([]byte, error) {
+	data := appendFullAtomHeader(nil, s.Version, s.Flags)
+	data = binary.BigEndian.AppendUint32(data, uint32(len(s.SampleEntries)))
+	for _, entry := range s.SampleEntries {
+		data = binary.BigEndian.AppendUint32(data, uint32(16+len(entry.Data)))
+		data = append(data, entry.Type[:]...)
+		data = append(data, entry.Reserved[:]...)
+		data = binary.BigEndian.AppendUint16(data, entry.RefIndex)
+		data = append(data, entry.Data...)
+	}
+	return data, nil
+}
+
+// GetType returns the sample entry type, i.e. the codec four character code
+func (e *SampleEntry) GetType() string {
+	return string(e.Type[:])
+}
+
+// IsProtected tells whether the sample entry is a protected 'encv', 'enca', 'enct' or 'encs' entry
+func (e *SampleEntry) IsProtected() bool {
+	switch e.GetType() {
+	case "encv", "enca", "enct", "encs":
+		return true
+	}
+	return false
+}
+
+// GetOriginalFormat returns the codec of the entry, resolving protected entries through their 'frma' atom
+func (e *SampleEntry) GetOriginalFormat() string {
+	if e.IsProtected() {
+		if frma, ok := e.GetExtension("frma").(*FrmaAtom); ok {
+			return frma.GetDataFormat()
+		}
+	}
+	return e.GetType()
+}
+
+// ExtensionsOffset returns where in Data the child atoms of the entry start for the given
+// media handler type, or -1 if the layout of the entry is unknown.
+func (e *SampleEntry) ExtensionsOffset(handlerType string) int {
+	switch e.GetType() {
+	case "wvtt":
+		return 0
+	case "tx3g":
+		return tx3gSampleEntrySize
+	}
+	switch handlerType {
+	case "vide":
+		return visualSampleEntrySize
+	case "soun":
+		if len(e.Data) < 2 {
+			return -1
+		}
+		switch binary.BigEndian.Uint16(e.Data[0:2]) {
+		case 0:
+			return 20
+		case 1:
+			return 36
+		case 2:
+			return 56
+		}
+	}
+	return -1
+}
+
+// GetExtension returns the decoded data of the first extension atom of the given type or nil
+func (e *SampleEntry) GetExtension(atomType string) any {
+	root, ok := e.Extensions.(*CompositeAtom)
+	if !ok {
+		return nil
+	}
+	for _, child := range root.FindAll(atomType) {
+		if leaf, ok := child.(*LeafAtom); ok {
+			return leaf.Data
+		}
+	}
+	return nil
+}
+
 // GetSampleRates extracts the sample rates for all audio sample entries
 func GetSampleRates(stsd *AtomStsd) (map[string][]float64, error) {
 	sampleRates := make(map[string][]float64)
 
 	for _, entry := range stsd.SampleEntries {
-		switch string(entry.Type[:]) {
+		switch entry.GetOriginalFormat() {
 		case "mp4a":
-			if len(entry.Data) >= 16 {
+			if len(entry.Data) >= 20 {
 				rate := binary.BigEndian.Uint32(entry.Data[16:20])
 				sampleRates["mp4a"] = append(sampleRates["mp4a"], float64(rate))
 			}
 		case "ac-3", "ec-3", "alac":
-			if len(entry.Data) >= 16 {
+			if len(entry.Data) >= 20 {
 				rate := binary.BigEndian.Uint32(entry.Data[16:20])
-				sampleRates[string(entry.Type[:])] = append(sampleRates[string(entry.Type[:])], float64(rate))
+				sampleRates[entry.GetOriginalFormat()] = append(sampleRates[entry.GetOriginalFormat()], float64(rate))
 			}
 		default:
 			logrus.Debugf("Unsupported audio type: %s\n", string(entry.Type[:]))
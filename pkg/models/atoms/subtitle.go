@@ -0,0 +1,157 @@
+package atoms
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+)
+
+// tx3gSampleEntrySize is the size of the 3GPP timed text sample entry fields preceding its child atoms
+const tx3gSampleEntrySize = 30
+
+// subtitleFormats names the sample entry types of text, subtitle and closed caption tracks
+var subtitleFormats = map[string]string{
+	"text": "QuickTime Text",
+	"tx3g": "3GPP Timed Text",
+	"wvtt": "WebVTT",
+	"stpp": "TTML",
+	"c608": "CEA-608",
+	"c708": "CEA-708",
+}
+
+// GetSubtitleFormat returns the name of the subtitle or caption format of a sample entry type
+func GetSubtitleFormat(sampleEntryType string) (string, bool) {
+	name, ok := subtitleFormats[sampleEntryType]
+	return name, ok
+}
+
+// IsClosedCaptionFormat reports whether the sample entry type holds CEA-608 or CEA-708 captions
+func IsClosedCaptionFormat(sampleEntryType string) bool {
+	return sampleEntryType == "c608" || sampleEntryType == "c708"
+}
+
+// StyleRecord is the default text style of a 3GPP timed text sample entry
+type StyleRecord struct {
+	StartChar uint16
+	EndChar   uint16
+	FontID    uint16
+	FaceFlags uint8
+	FontSize  uint8
+	TextColor [4]byte
+}
+
+// Tx3gSampleEntry holds the fields of a 3GPP timed text sample description
+type Tx3gSampleEntry struct {
+	DisplayFlags            uint32
+	HorizontalJustification int8
+	VerticalJustification   int8
+	BackgroundColor         [4]byte
+	DefaultTextBox          [4]int16
+	DefaultStyle            StyleRecord
+}
+
+// ParseTx3gSampleEntry decodes the timed text specific fields of a sample entry
+func ParseTx3gSampleEntry(entry *SampleEntry) (*Tx3gSampleEntry, error) {
+	if len(entry.Data) < tx3gSampleEntrySize {
+		return nil, fmt.Errorf("tx3g sample entry too short: %d bytes", len(entry.Data))
+	}
+	var tx3g Tx3gSampleEntry
+	if err := binary.Read(bytes.NewReader(entry.Data), binary.BigEndian, &tx3g); err != nil {
+		return nil, fmt.Errorf("error reading tx3g sample entry: %w", err)
+	}
+	return &tx3g, nil
+}
+
+// XMLSubtitleSampleEntry holds the fields of an 'stpp' sample description
+type XMLSubtitleSampleEntry struct {
+	Namespace          string
+	SchemaLocation     string
+	AuxiliaryMimeTypes string
+}
+
+// ParseXMLSubtitleSampleEntry decodes the three null-terminated strings of an 'stpp' sample entry
+func ParseXMLSubtitleSampleEntry(entry *SampleEntry) (*XMLSubtitleSampleEntry, error) {
+	fields := bytes.SplitN(entry.Data, []byte{0}, 4)
+	if len(fields) < 2 {
+		return nil, fmt.Errorf("stpp sample entry without namespace")
+	}
+	stpp := &XMLSubtitleSampleEntry{Namespace: string(fields[0])}
+	if len(fields) > 2 {
+		stpp.SchemaLocation = string(fields[1])
+	}
+	if len(fields) > 3 {
+		stpp.AuxiliaryMimeTypes = string(fields[2])
+	}
+	return stpp, nil
+}
+
+// StringAtom represents atoms holding only a string, like the WebVTT 'vttC' configuration and 'vlab' label
+type StringAtom struct {
+	Value string
+}
+
+// ParseStringAtom parses an atom whose payload is a string
+func ParseStringAtom(reader io.Reader) (*StringAtom, error) {
+	data, err := io.ReadAll(reader)
+	if err != nil {
+		return nil, fmt.Errorf("error reading string: %w", err)
+	}
+	return &StringAtom{Value: string(bytes.TrimRight(data, "\x00"))}, nil
+}
+
+// Encode writes the string as the whole payload, without a null terminator
+func (s *StringAtom) Encode() ([]byte, error) {
+	return []byte(s.Value), nil
+}
+
+// WebVTTCue is a cue of a WebVTT sample, built from the 'iden', 'sttg' and 'payl' atoms of a 'vttc' atom
+type WebVTTCue struct {
+	ID       string
+	Settings string
+	Payload  string
+}
+
+// DecodeWebVTTSample decodes the cues of a WebVTT sample. An empty cue atom ('vtte') yields no cues.
+func DecodeWebVTTSample(sample []byte) ([]WebVTTCue, error) {
+	var cues []WebVTTCue
+	for len(sample) > 0 {
+		atomType, payload, rest, err := splitAtom(sample)
+		if err != nil {
+			return nil, err
+		}
+		if atomType == "vttc" {
+			var cue WebVTTCue
+			for len(payload) > 0 {
+				childType, childPayload, childRest, err := splitAtom(payload)
+				if err != nil {
+					return nil, err
+				}
+				switch childType {
+				case "iden":
+					cue.ID = string(childPayload)
+				case "sttg":
+					cue.Settings = string(childPayload)
+				case "payl":
+					cue.Payload = string(childPayload)
+				}
+				payload = childRest
+			}
+			cues = append(cues, cue)
+		}
+		sample = rest
+	}
+	return cues, nil
+}
+
+// splitAtom splits the first atom of the data into its type and payload and returns the remaining data
+func splitAtom(data []byte) (atomType string, payload []byte, rest []byte, err error) {
+	if len(data) < 8 {
+		return "", nil, nil, fmt.Errorf("atom header too short: %d bytes", len(data))
+	}
+	size := binary.BigEndian.Uint32(data)
+	if size < 8 || uint64(size) > uint64(len(data)) {
+		return "", nil, nil, fmt.Errorf("invalid atom size: %d", size)
+	}
+	return string(data[4:8]), data[8:size], data[size:], nil
+}
@@ -0,0 +1,34 @@
+package atoms
+
+import (
+	"encoding/binary"
+	"fmt"
+	"unicode/utf16"
+)
+
+// DecodeTextSample decodes a QuickTime text or 3GPP timed text ('tx3g') sample. The sample starts with
+// a 16-bit text length followed by the text, which is UTF-8 unless it starts with a UTF-16 byte order mark.
+// Any style or modifier atoms after the text are ignored.
+func DecodeTextSample(sample []byte) (string, error) {
+	if len(sample) < 2 {
+		return "", fmt.Errorf("text sample too short: %d bytes", len(sample))
+	}
+	length := int(binary.BigEndian.Uint16(sample))
+	if length > len(sample)-2 {
+		return "", fmt.Errorf("text length %d exceeds the %d bytes of the sample", length, len(sample)-2)
+	}
+	text := sample[2 : 2+length]
+
+	if len(text) >= 2 && (text[0] == 0xFE && text[1] == 0xFF || text[0] == 0xFF && text[1] == 0xFE) {
+		order := binary.ByteOrder(binary.BigEndian)
+		if text[0] == 0xFF {
+			order = binary.LittleEndian
+		}
+		units := make([]uint16, (len(text)-2)/2)
+		for i := range units {
+			units[i] = order.Uint16(text[2+i*2:])
+		}
+		return string(utf16.Decode(units)), nil
+	}
+	return string(text), nil
+}
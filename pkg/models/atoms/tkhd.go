@@ -1,13 +1,20 @@
 package atoms
 
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+)
+
+// TkhdAtom represents the 'tkhd' track header atom. Version 1 atoms store times and duration as 64-bit values.
 type TkhdAtom struct {
 	Version          uint8
 	Flags            [3]byte
-	CreationTime     uint32
-	ModificationTime uint32
+	CreationTime     uint64
+	ModificationTime uint64
 	TrackID          uint32
 	Reserved         uint32
-	Duration         uint32
+	Duration         uint64
 	Reserved2        [8]byte
 	Layer            uint16
 	AlternateGroup   uint16
@@ -17,3 +24,91 @@ type TkhdAtom struct {
 	Width            uint32
 	Height           uint32
 }
+
+// ParseTkhdAtom parses the 'tkhd' atom in both its 32-bit and 64-bit versions
+func ParseTkhdAtom(reader io.Reader) (*TkhdAtom, error) {
+	var tkhd TkhdAtom
+
+	if err := binary.Read(reader, binary.BigEndian, &tkhd.Version); err != nil {
+		return nil, fmt.Errorf("error reading version: %w", err)
+	}
+	if _, err := io.ReadFull(reader, tkhd.Flags[:]); err != nil {
+		return nil, fmt.Errorf("error reading flags: %w", err)
+	}
+
+	if tkhd.Version == 1 {
+		var times struct {
+			CreationTime     uint64
+			ModificationTime uint64
+			TrackID          uint32
+			Reserved         uint32
+			Duration         uint64
+		}
+		if err := binary.Read(reader, binary.BigEndian, &times); err != nil {
+			return nil, fmt.Errorf("error reading times: %w", err)
+		}
+		tkhd.CreationTime, tkhd.ModificationTime = times.CreationTime, times.ModificationTime
+		tkhd.TrackID, tkhd.Reserved, tkhd.Duration = times.TrackID, times.Reserved, times.Duration
+	} else {
+		var times struct {
+			CreationTime     uint32
+			ModificationTime uint32
+			TrackID          uint32
+			Reserved         uint32
+			Duration         uint32
+		}
+		if err := binary.Read(reader, binary.BigEndian, &times); err != nil {
+			return nil, fmt.Errorf("error reading times: %w", err)
+		}
+		tkhd.CreationTime, tkhd.ModificationTime = uint64(times.CreationTime), uint64(times.ModificationTime)
+		tkhd.TrackID, tkhd.Reserved, tkhd.Duration = times.TrackID, times.Reserved, uint64(times.Duration)
+	}
+
+	var rest struct {
+		Reserved2      [8]byte
+		Layer          uint16
+		AlternateGroup uint16
+		Volume         uint16
+		Reserved3      uint16
+		Matrix         [36]byte
+		Width          uint32
+		Height         uint32
+	}
+	if err := binary.Read(reader, binary.BigEndian, &rest); err != nil {
+		return nil, fmt.Errorf("error reading track properties: %w", err)
+	}
+	tkhd.Reserved2, tkhd.Layer, tkhd.AlternateGroup = rest.Reserved2, rest.Layer, rest.AlternateGroup
+	tkhd.Volume, tkhd.Reserved3, tkhd.Matrix = rest.Volume, rest.Reserved3, rest.Matrix
+	tkhd.Width, tkhd.Height = rest.Width, rest.Height
+
+	return &tkhd, nil
+}
+
+// GetMatrix returns the decoded display matrix of the track. A zeroed matrix is treated as the identity.
+func (t *TkhdAtom) GetMatrix() Matrix {
+	if t.Matrix == ([36]byte{}) {
+		return IdentityMatrix
+	}
+	return DecodeMatrix(t.Matrix)
+}
+
+// Encode writes the 'tkhd' atom in the version it was read with
+func (t *TkhdAtom) Encode() ([]byte, error) {
+	if err := checkHeaderTimes(t.Version, t.CreationTime, t.ModificationTime, t.Duration); err != nil {
+		return nil, err
+	}
+	data := appendFullAtomHeader(make([]byte, 0, 96), t.Version, t.Flags)
+	data = appendVersionedTime(data, t.Version, t.CreationTime)
+	data = appendVersionedTime(data, t.Version, t.ModificationTime)
+	data = binary.BigEndian.AppendUint32(data, t.TrackID)
+	data = binary.BigEndian.AppendUint32(data, t.Reserved)
+	data = appendVersionedTime(data, t.Version, t.Duration)
+	data = append(data, t.Reserved2[:]...)
+	data = binary.BigEndian.AppendUint16(data, t.Layer)
+	data = binary.BigEndian.AppendUint16(data, t.AlternateGroup)
+	data = binary.BigEndian.AppendUint16(data, t.Volume)
+	data = binary.BigEndian.AppendUint16(data, t.Reserved3)
+	data = append(data, t.Matrix[:]...)
+	data = binary.BigEndian.AppendUint32(data, t.Width)
+	return binary.BigEndian.AppendUint32(data, t.Height), nil
+}
@@ -0,0 +1,114 @@
+package atoms
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+)
+
+// Timecode flags of the 'tmcd' sample description
+const (
+	TimecodeDropFrame     = 0x0001
+	Timecode24HourMax     = 0x0002
+	TimecodeNegativeTimes = 0x0004
+	TimecodeCounter       = 0x0008
+)
+
+// timecodeSampleEntrySize is the size of the timecode sample entry fields preceding its child atoms
+const timecodeSampleEntrySize = 18
+
+// TimecodeSampleEntry holds the fields of a 'tmcd' sample description
+type TimecodeSampleEntry struct {
+	Reserved       uint32
+	Flags          uint32
+	TimeScale      uint32
+	FrameDuration  uint32
+	NumberOfFrames uint8
+	Reserved2      uint8
+	ReelName       string
+}
+
+// ParseTimecodeSampleEntry decodes the timecode specific fields of a sample entry and the
+// source reel name stored in its 'name' atom.
+func ParseTimecodeSampleEntry(entry *SampleEntry) (*TimecodeSampleEntry, error) {
+	if len(entry.Data) < timecodeSampleEntrySize {
+		return nil, fmt.Errorf("timecode sample entry too short: %d bytes", len(entry.Data))
+	}
+	var tmcd TimecodeSampleEntry
+	data := entry.Data
+	tmcd.Reserved = binary.BigEndian.Uint32(data[0:4])
+	tmcd.Flags = binary.BigEndian.Uint32(data[4:8])
+	tmcd.TimeScale = binary.BigEndian.Uint32(data[8:12])
+	tmcd.FrameDuration = binary.BigEndian.Uint32(data[12:16])
+	tmcd.NumberOfFrames = data[16]
+	tmcd.Reserved2 = data[17]
+
+	children := data[timecodeSampleEntrySize:]
+	for len(children) >= 8 {
+		size := binary.BigEndian.Uint32(children[0:4])
+		if size < 8 || uint64(size) > uint64(len(children)) {
+			break
+		}
+		if string(children[4:8]) == "name" {
+			text, err := ParseUserDataTextAtom(bytes.NewReader(children[8:size]))
+			if err != nil {
+				return nil, fmt.Errorf("error reading reel name: %w", err)
+			}
+			tmcd.ReelName = text.GetText()
+		}
+		children = children[size:]
+	}
+
+	return &tmcd, nil
+}
+
+// IsDropFrame reports whether the timecode uses drop-frame counting
+func (t *TimecodeSampleEntry) IsDropFrame() bool {
+	return t.Flags&TimecodeDropFrame != 0
+}
+
+// GetFrameRate returns the exact frame rate of the timecode
+func (t *TimecodeSampleEntry) GetFrameRate() float64 {
+	if t.FrameDuration == 0 {
+		return 0
+	}
+	return float64(t.TimeScale) / float64(t.FrameDuration)
+}
+
+// FormatTimecode formats a frame number as SMPTE HH:MM:SS:FF, or HH:MM:SS;FF for drop-frame timecode.
+// Drop-frame timecode skips frame numbers 0 and 1 (0 to 3 at 60 fps) at the start of every minute
+// except every tenth minute.
+func (t *TimecodeSampleEntry) FormatTimecode(frame int64) string {
+	fps := int64(t.NumberOfFrames)
+	if fps == 0 {
+		return ""
+	}
+	sign := ""
+	if frame < 0 {
+		sign = "-"
+		frame = -frame
+	}
+
+	separator := ":"
+	if t.IsDropFrame() {
+		separator = ";"
+		dropFrames := fps / 15
+		framesPerMinute := fps*60 - dropFrames
+		framesPer10Minutes := fps*600 - dropFrames*9
+		tens := frame / framesPer10Minutes
+		remainder := frame % framesPer10Minutes
+		frame += dropFrames * 9 * tens
+		if remainder > dropFrames {
+			frame += dropFrames * ((remainder - dropFrames) / framesPerMinute)
+		}
+	}
+
+	frames := frame % fps
+	seconds := frame / fps % 60
+	minutes := frame / (fps * 60) % 60
+	hours := frame / (fps * 3600)
+	if t.Flags&Timecode24HourMax != 0 {
+		hours %= 24
+	}
+	return fmt.Sprintf("%s%02d:%02d:%02d%s%02d", sign, hours, minutes, seconds, separator, frames)
+}
@@ -0,0 +1,43 @@
+package atoms
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// TestParseTimecodeSampleEntry tests decoding of the 'tmcd' sample description and its reel name
+func TestParseTimecodeSampleEntry(t *testing.T) {
+	entry := &SampleEntry{
+		Type: [4]byte{'t', 'm', 'c', 'd'},
+		Data: []byte{
+			0x00, 0x00, 0x00, 0x00, // Reserved
+			0x00, 0x00, 0x00, 0x03, // Flags: drop frame, 24 hour max
+			0x00, 0x00, 0x75, 0x30, // Time scale 30000
+			0x00, 0x00, 0x03, 0xE9, // Frame duration 1001
+			0x1E, 0x00, // Number of frames 30
+			0x00, 0x00, 0x00, 0x12, 'n', 'a', 'm', 'e',
+			0x00, 0x06, 0x15, 0xC7, 'A', '0', '0', '1', 'C', '1',
+		},
+	}
+
+	tmcd, err := ParseTimecodeSampleEntry(entry)
+	assert.NoError(t, err)
+	assert.True(t, tmcd.IsDropFrame())
+	assert.InDelta(t, 29.97, tmcd.GetFrameRate(), 1e-3)
+	assert.Equal(t, "A001C1", tmcd.ReelName)
+}
+
+// TestFormatTimecode tests non drop-frame and drop-frame timecode formatting
+func TestFormatTimecode(t *testing.T) {
+	ndf := &TimecodeSampleEntry{NumberOfFrames: 25}
+	assert.Equal(t, "00:00:00:00", ndf.FormatTimecode(0))
+	assert.Equal(t, "01:00:00:00", ndf.FormatTimecode(25*3600))
+	assert.Equal(t, "10:11:12:13", ndf.FormatTimecode(((10*60+11)*60+12)*25+13))
+
+	df := &TimecodeSampleEntry{NumberOfFrames: 30, Flags: TimecodeDropFrame}
+	assert.Equal(t, "00:00:59;29", df.FormatTimecode(1799))
+	assert.Equal(t, "00:01:00;02", df.FormatTimecode(1800))
+	assert.Equal(t, "00:10:00;00", df.FormatTimecode(17982))
+	assert.Equal(t, "01:00:00;00", df.FormatTimecode(107892))
+}
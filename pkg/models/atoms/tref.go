@@ -0,0 +1,111 @@
+package atoms
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+)
+
+// TrackReferenceAtom represents a child of the 'tref' atom, e.g. 'chap' or 'tmcd', listing the referenced track IDs
+type TrackReferenceAtom struct {
+	TrackIDs []uint32
+}
+
+// ParseTrackReferenceAtom parses a track reference type atom
+func ParseTrackReferenceAtom(reader io.Reader) (*TrackReferenceAtom, error) {
+	data, err := io.ReadAll(reader)
+	if err != nil {
+		return nil, fmt.Errorf("error reading track IDs: %w", err)
+	}
+	if len(data)%4 != 0 {
+		return nil, fmt.Errorf("invalid track reference size: %d", len(data))
+	}
+	tref := &TrackReferenceAtom{TrackIDs: make([]uint32, len(data)/4)}
+	for i := range tref.TrackIDs {
+		tref.TrackIDs[i] = binary.BigEndian.Uint32(data[i*4:])
+	}
+	return tref, nil
+}
+
+// Encode writes the track IDs of the track reference type atom
+func (t *TrackReferenceAtom) Encode() ([]byte, error) {
+	data := make([]byte, 0, len(t.TrackIDs)*4)
+	for _, trackID := range t.TrackIDs {
+		data = binary.BigEndian.AppendUint32(data, trackID)
+	}
+	return data, nil
+}
+
+// ChapterEntry is a single chapter of the Nero 'chpl' atom. The start time is in units of 100 nanoseconds.
+type ChapterEntry struct {
+	StartTime uint64
+	Title     string
+}
+
+// ChplAtom represents the Nero chapter list atom stored in 'udta'
+type ChplAtom struct {
+	Version  uint8
+	Flags    [3]byte
+	Chapters []ChapterEntry
+}
+
+// ParseChplAtom parses the 'chpl' atom
+func ParseChplAtom(reader io.Reader) (*ChplAtom, error) {
+	var chpl ChplAtom
+
+	if err := binary.Read(reader, binary.BigEndian, &chpl.Version); err != nil {
+		return nil, fmt.Errorf("error reading version: %w", err)
+	}
+	if _, err := io.ReadFull(reader, chpl.Flags[:]); err != nil {
+		return nil, fmt.Errorf("error reading flags: %w", err)
+	}
+	if chpl.Version == 1 {
+		var reserved uint32
+		if err := binary.Read(reader, binary.BigEndian, &reserved); err != nil {
+			return nil, fmt.Errorf("error reading reserved bytes: %w", err)
+		}
+	}
+	var count uint8
+	if err := binary.Read(reader, binary.BigEndian, &count); err != nil {
+		return nil, fmt.Errorf("error reading chapter count: %w", err)
+	}
+
+	for i := uint8(0); i < count; i++ {
+		var entry ChapterEntry
+		var length uint8
+		if err := binary.Read(reader, binary.BigEndian, &entry.StartTime); err != nil {
+			return nil, fmt.Errorf("error reading chapter start: %w", err)
+		}
+		if err := binary.Read(reader, binary.BigEndian, &length); err != nil {
+			return nil, fmt.Errorf("error reading chapter title length: %w", err)
+		}
+		title := make([]byte, length)
+		if _, err := io.ReadFull(reader, title); err != nil {
+			return nil, fmt.Errorf("error reading chapter title: %w", err)
+		}
+		entry.Title = string(title)
+		chpl.Chapters = append(chpl.Chapters, entry)
+	}
+
+	return &chpl, nil
+}
+
+// Encode writes the 'chpl' atom
+func (c *ChplAtom) Encode() ([]byte, error) {
+	if len(c.Chapters) > 255 {
+		return nil, fmt.Errorf("%d chapters do not fit a 'chpl' atom", len(c.Chapters))
+	}
+	data := appendFullAtomHeader(nil, c.Version, c.Flags)
+	if c.Version == 1 {
+		data = binary.BigEndian.AppendUint32(data, 0)
+	}
+	data = append(data, byte(len(c.Chapters)))
+	for _, chapter := range c.Chapters {
+		if len(chapter.Title) > 255 {
+			return nil, fmt.Errorf("chapter title of %d bytes is too long", len(chapter.Title))
+		}
+		data = binary.BigEndian.AppendUint64(data, chapter.StartTime)
+		data = append(append(data, byte(len(chapter.Title))), chapter.Title...)
+	}
+	return data, nil
+}
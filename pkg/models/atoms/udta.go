@@ -0,0 +1,70 @@
+package atoms
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+)
+
+// UserDataText is a single localized string of a classic QuickTime '©xxx' user data atom
+type UserDataText struct {
+	Language uint16
+	Text     string
+}
+
+// UserDataTextAtom represents a classic QuickTime user data text atom such as '©nam' or '©day'
+type UserDataTextAtom struct {
+	Entries []UserDataText
+}
+
+// ParseUserDataTextAtom parses the list of (size, language, text) entries of a '©xxx' user data atom
+func ParseUserDataTextAtom(reader io.Reader) (*UserDataTextAtom, error) {
+	var atom UserDataTextAtom
+
+	for {
+		var size, language uint16
+		if err := binary.Read(reader, binary.BigEndian, &size); err != nil {
+			if err == io.EOF {
+				break
+			}
+			return nil, fmt.Errorf("error reading text size: %w", err)
+		}
+		if err := binary.Read(reader, binary.BigEndian, &language); err != nil {
+			return nil, fmt.Errorf("error reading text language: %w", err)
+		}
+		text := make([]byte, size)
+		if _, err := io.ReadFull(reader, text); err != nil {
+			return nil, fmt.Errorf("error reading text: %w", err)
+		}
+		atom.Entries = append(atom.Entries, UserDataText{Language: language, Text: string(text)})
+	}
+
+	return &atom, nil
+}
+
+// GetText returns the text of the first entry or an empty string
+func (u *UserDataTextAtom) GetText() string {
+	if len(u.Entries) == 0 {
+		return ""
+	}
+	return u.Entries[0].Text
+}
+
+// IsUserDataTextType reports whether the atom type is a classic '©xxx' user data text atom
+func IsUserDataTextType(atomType [4]byte) bool {
+	return atomType[0] == 0xA9
+}
+
+// Encode writes the (size, language, text) entries of the user data text atom
+func (u *UserDataTextAtom) Encode() ([]byte, error) {
+	var data []byte
+	for _, entry := range u.Entries {
+		if len(entry.Text) > 0xFFFF {
+			return nil, fmt.Errorf("user data text of %d bytes is too long", len(entry.Text))
+		}
+		data = binary.BigEndian.AppendUint16(data, uint16(len(entry.Text)))
+		data = binary.BigEndian.AppendUint16(data, entry.Language)
+		data = append(data, entry.Text...)
+	}
+	return data, nil
+}
@@ -0,0 +1,169 @@
+package atoms
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+)
+
+// visualSampleEntrySize is the size of the visual sample entry fields preceding its child atoms
+const visualSampleEntrySize = 70
+
+// VisualSampleEntry holds the fields of a video sample description
+type VisualSampleEntry struct {
+	Version         uint16
+	RevisionLevel   uint16
+	Vendor          [4]byte
+	TemporalQuality uint32
+	SpatialQuality  uint32
+	Width           uint16
+	Height          uint16
+	HorizontalRes   uint32
+	VerticalRes     uint32
+	DataSize        uint32
+	FrameCount      uint16
+	CompressorName  [32]byte
+	Depth           uint16
+	ColorTableID    int16
+}
+
+// ParseVisualSampleEntry decodes the video specific fields of a sample entry
+func ParseVisualSampleEntry(entry *SampleEntry) (*VisualSampleEntry, error) {
+	if len(entry.Data) < visualSampleEntrySize {
+		return nil, fmt.Errorf("visual sample entry too short: %d bytes", len(entry.Data))
+	}
+	var visual VisualSampleEntry
+	if err := binary.Read(bytes.NewReader(entry.Data), binary.BigEndian, &visual); err != nil {
+		return nil, fmt.Errorf("error reading visual sample entry: %w", err)
+	}
+	return &visual, nil
+}
+
+// GetCompressorName returns the Pascal string compressor name
+func (v *VisualSampleEntry) GetCompressorName() string {
+	length := int(v.CompressorName[0])
+	if length > len(v.CompressorName)-1 {
+		length = len(v.CompressorName) - 1
+	}
+	return string(v.CompressorName[1 : 1+length])
+}
+
+// PaspAtom represents the 'pasp' pixel aspect ratio atom
+type PaspAtom struct {
+	HorizontalSpacing uint32
+	VerticalSpacing   uint32
+}
+
+// ClapAtom represents the 'clap' clean aperture atom. Each value is a fraction of numerator and denominator.
+type ClapAtom struct {
+	WidthN            uint32
+	WidthD            uint32
+	HeightN           uint32
+	HeightD           uint32
+	HorizontalOffsetN int32
+	HorizontalOffsetD uint32
+	VerticalOffsetN   int32
+	VerticalOffsetD   uint32
+}
+
+// FielAtom represents the 'fiel' field handling atom
+type FielAtom struct {
+	FieldCount    uint8
+	FieldOrdering uint8
+}
+
+// GamaAtom represents the 'gama' atom holding the 16.16 fixed-point gamma level
+type GamaAtom struct {
+	Gamma uint32
+}
+
+// TrackApertureDimensionsAtom represents the 'clef', 'prof' and 'enof' atoms of the 'tapt' track aperture mode dimensions atom
+type TrackApertureDimensionsAtom struct {
+	Version uint8
+	Flags   [3]byte
+	Width   uint32
+	Height  uint32
+}
+
+// ParseFixedAtom reads an atom whose payload maps directly onto the fields of T
+func ParseFixedAtom[T any](reader io.Reader) (*T, error) {
+	result := new(T)
+	if err := binary.Read(reader, binary.BigEndian, result); err != nil {
+		return nil, fmt.Errorf("error reading %T: %w", *result, err)
+	}
+	return result, nil
+}
+
+// GetRatio returns the pixel aspect ratio as a floating-point number
+func (p *PaspAtom) GetRatio() float64 {
+	if p.VerticalSpacing == 0 {
+		return 1
+	}
+	return float64(p.HorizontalSpacing) / float64(p.VerticalSpacing)
+}
+
+// fraction returns n/d or 0 for a zero denominator
+func fraction(n float64, d uint32) float64 {
+	if d == 0 {
+		return 0
+	}
+	return n / float64(d)
+}
+
+// GetWidth returns the width of the clean aperture in pixels
+func (c *ClapAtom) GetWidth() float64 {
+	return fraction(float64(c.WidthN), c.WidthD)
+}
+
+// GetHeight returns the height of the clean aperture in pixels
+func (c *ClapAtom) GetHeight() float64 {
+	return fraction(float64(c.HeightN), c.HeightD)
+}
+
+// GetRectangle returns the origin and size of the clean aperture within a width x height picture.
+// The offsets in the atom are relative to the center of the picture.
+func (c *ClapAtom) GetRectangle(width, height float64) (x, y, w, h float64) {
+	w, h = c.GetWidth(), c.GetHeight()
+	x = (width-w)/2 + fraction(float64(c.HorizontalOffsetN), c.HorizontalOffsetD)
+	y = (height-h)/2 + fraction(float64(c.VerticalOffsetN), c.VerticalOffsetD)
+	return x, y, w, h
+}
+
+// IsInterlaced reports whether the video consists of two fields per frame
+func (f *FielAtom) IsInterlaced() bool {
+	return f.FieldCount == 2
+}
+
+// GetFieldOrder describes the field ordering of the video
+func (f *FielAtom) GetFieldOrder() string {
+	if !f.IsInterlaced() {
+		return "progressive"
+	}
+	switch f.FieldOrdering {
+	case 1:
+		return "separated, top field first"
+	case 6:
+		return "separated, bottom field first"
+	case 9:
+		return "interleaved, top field first"
+	case 14:
+		return "interleaved, bottom field first"
+	}
+	return "interlaced, unknown order"
+}
+
+// GetGamma returns the gamma level as a floating-point number
+func (g *GamaAtom) GetGamma() float64 {
+	return float64(g.Gamma) / (1 << 16)
+}
+
+// GetWidth returns the 16.16 fixed-point width as a floating-point number
+func (t *TrackApertureDimensionsAtom) GetWidth() float64 {
+	return float64(t.Width) / (1 << 16)
+}
+
+// GetHeight returns the 16.16 fixed-point height as a floating-point number
+func (t *TrackApertureDimensionsAtom) GetHeight() float64 {
+	return float64(t.Height) / (1 << 16)
+}
@@ -0,0 +1,178 @@
+package metadata
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Item is a single metadata entry as found in the file
+type Item struct {
+	Key      string
+	Value    string
+	Language string
+}
+
+// Location is a geographic position decoded from an ISO 6709 string
+type Location struct {
+	Latitude    float64
+	Longitude   float64
+	Altitude    float64
+	HasAltitude bool
+}
+
+// Metadata is the descriptive metadata of a movie. Classic QuickTime user data atoms
+// and 'mdta' keyed metadata are both merged into this model.
+type Metadata struct {
+	Title        string
+	Make         string
+	Model        string
+	Software     string
+	CreationDate string
+	Location     *Location
+	Items        []Item
+}
+
+// wellKnownKeys maps the user data atom types and the 'mdta' reverse-DNS keys to the model fields
+var wellKnownKeys = map[string]string{
+	"©nam":                                 "title",
+	"©day":                                 "creationdate",
+	"©mak":                                 "make",
+	"©mod":                                 "model",
+	"©swr":                                 "software",
+	"©too":                                 "software",
+	"©xyz":                                 "location",
+	"com.apple.quicktime.title":            "title",
+	"com.apple.quicktime.creationdate":     "creationdate",
+	"com.apple.quicktime.make":             "make",
+	"com.apple.quicktime.model":            "model",
+	"com.apple.quicktime.software":         "software",
+	"com.apple.quicktime.location.ISO6709": "location",
+}
+
+// Add records the item and fills in the matching model field if it is still empty.
+func (m *Metadata) Add(item Item) {
+	m.Items = append(m.Items, item)
+
+	switch wellKnownKeys[item.Key] {
+	case "title":
+		setIfEmpty(&m.Title, item.Value)
+	case "creationdate":
+		setIfEmpty(&m.CreationDate, item.Value)
+	case "make":
+		setIfEmpty(&m.Make, item.Value)
+	case "model":
+		setIfEmpty(&m.Model, item.Value)
+	case "software":
+		setIfEmpty(&m.Software, item.Value)
+	case "location":
+		if m.Location == nil {
+			if location, err := ParseISO6709(item.Value); err == nil {
+				m.Location = location
+			}
+		}
+	}
+}
+
+// Get returns the value of the first item with the given key
+func (m *Metadata) Get(key string) (string, bool) {
+	for _, item := range m.Items {
+		if item.Key == key {
+			return item.Value, true
+		}
+	}
+	return "", false
+}
+
+func setIfEmpty(field *string, value string) {
+	if *field == "" {
+		*field = value
+	}
+}
+
+// ParseISO6709 decodes an ISO 6709 location string such as "+37.3318-122.0312+045.000/".
+// Degrees, degrees-minutes and degrees-minutes-seconds notations are supported.
+func ParseISO6709(value string) (*Location, error) {
+	value = strings.TrimSuffix(strings.TrimSpace(value), "/")
+
+	var parts []string
+	start := -1
+	for i, r := range value {
+		if r == '+' || r == '-' {
+			if start >= 0 {
+				parts = append(parts, value[start:i])
+			}
+			start = i
+		}
+	}
+	if start < 0 {
+		return nil, fmt.Errorf("invalid ISO 6709 location: %q", value)
+	}
+	parts = append(parts, value[start:])
+	if len(parts) < 2 || len(parts) > 3 {
+		return nil, fmt.Errorf("invalid ISO 6709 location: %q", value)
+	}
+
+	latitude, err := parseISO6709Coordinate(parts[0], 2)
+	if err != nil {
+		return nil, err
+	}
+	longitude, err := parseISO6709Coordinate(parts[1], 3)
+	if err != nil {
+		return nil, err
+	}
+	location := &Location{Latitude: latitude, Longitude: longitude}
+
+	if len(parts) == 3 {
+		altitude, err := strconv.ParseFloat(strings.TrimSuffix(parts[2], "CRS"), 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid ISO 6709 altitude %q: %w", parts[2], err)
+		}
+		location.Altitude = altitude
+		location.HasAltitude = true
+	}
+
+	return location, nil
+}
+
+// parseISO6709Coordinate decodes a signed coordinate whose integer part has degreeDigits
+// digits for degrees, optionally followed by two digits of minutes and two of seconds.
+func parseISO6709Coordinate(value string, degreeDigits int) (float64, error) {
+	sign := 1.0
+	if value[0] == '-' {
+		sign = -1.0
+	}
+	digits := value[1:]
+	integerPart := digits
+	fraction := ""
+	if dot := strings.IndexByte(digits, '.'); dot >= 0 {
+		integerPart, fraction = digits[:dot], digits[dot:]
+	}
+
+	var degrees, minutes, seconds float64
+	var err error
+	switch len(integerPart) {
+	case degreeDigits:
+		degrees, err = strconv.ParseFloat(integerPart+fraction, 64)
+	case degreeDigits + 2:
+		degrees, err = strconv.ParseFloat(integerPart[:degreeDigits], 64)
+		if err == nil {
+			minutes, err = strconv.ParseFloat(integerPart[degreeDigits:]+fraction, 64)
+		}
+	case degreeDigits + 4:
+		degrees, err = strconv.ParseFloat(integerPart[:degreeDigits], 64)
+		if err == nil {
+			minutes, err = strconv.ParseFloat(integerPart[degreeDigits:degreeDigits+2], 64)
+		}
+		if err == nil {
+			seconds, err = strconv.ParseFloat(integerPart[degreeDigits+2:]+fraction, 64)
+		}
+	default:
+		return 0, fmt.Errorf("invalid ISO 6709 coordinate: %q", value)
+	}
+	if err != nil {
+		return 0, fmt.Errorf("invalid ISO 6709 coordinate %q: %w", value, err)
+	}
+
+	return sign * (degrees + minutes/60 + seconds/3600), nil
+}
@@ -0,0 +1,38 @@
+package metadata
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// TestParseISO6709 tests decoding of ISO 6709 location strings
+func TestParseISO6709(t *testing.T) {
+	location, err := ParseISO6709("+37.3318-122.0312+045.000/")
+	assert.NoError(t, err)
+	assert.InDelta(t, 37.3318, location.Latitude, 1e-9)
+	assert.InDelta(t, -122.0312, location.Longitude, 1e-9)
+	assert.True(t, location.HasAltitude)
+	assert.InDelta(t, 45.0, location.Altitude, 1e-9)
+
+	location, err = ParseISO6709("+5213.782+02100.732/")
+	assert.NoError(t, err)
+	assert.InDelta(t, 52.2297, location.Latitude, 1e-4)
+	assert.InDelta(t, 21.0122, location.Longitude, 1e-4)
+	assert.False(t, location.HasAltitude)
+
+	_, err = ParseISO6709("not a location")
+	assert.Error(t, err)
+}
+
+// TestMetadataAdd tests that classic and keyed items fill the same model fields
+func TestMetadataAdd(t *testing.T) {
+	md := &Metadata{}
+	md.Add(Item{Key: "com.apple.quicktime.model", Value: "iPhone 15 Pro"})
+	md.Add(Item{Key: "©mak", Value: "Apple"})
+	md.Add(Item{Key: "©mod", Value: "ignored"})
+
+	assert.Equal(t, "Apple", md.Make)
+	assert.Equal(t, "iPhone 15 Pro", md.Model)
+	assert.Len(t, md.Items, 3)
+}